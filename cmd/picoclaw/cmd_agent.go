@@ -22,6 +22,7 @@ import (
 func agentCmd() {
 	message := ""
 	sessionKey := "cli:default"
+	branch := ""
 	modelOverride := ""
 
 	args := os.Args[2:]
@@ -40,6 +41,11 @@ func agentCmd() {
 				sessionKey = args[i+1]
 				i++
 			}
+		case "-b", "--branch":
+			if i+1 < len(args) {
+				branch = args[i+1]
+				i++
+			}
 		case "--model", "-model":
 			if i+1 < len(args) {
 				modelOverride = args[i+1]
@@ -70,6 +76,7 @@ func agentCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	defer agentLoop.Close()
 
 	// Print agent startup info (only for interactive mode)
 	startupInfo := agentLoop.GetStartupInfo()
@@ -81,8 +88,14 @@ func agentCmd() {
 		})
 
 	if message != "" {
+		reader := bufio.NewReader(os.Stdin)
+		agentLoop.SetApprovalPrompter(approvalPrompter(func(prompt string) (string, error) {
+			fmt.Print(prompt)
+			return reader.ReadString('\n')
+		}))
+
 		ctx := context.Background()
-		response, err := agentLoop.ProcessDirect(ctx, message, sessionKey)
+		response, err := agentLoop.ProcessDirect(ctx, message, sessionKey, branch)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			os.Exit(1)
@@ -90,11 +103,36 @@ func agentCmd() {
 		fmt.Printf("\n%s %s\n", logo, response)
 	} else {
 		fmt.Printf("%s Interactive mode (Ctrl+C to exit)\n\n", logo)
-		interactiveMode(agentLoop, sessionKey)
+		interactiveMode(agentLoop, sessionKey, branch)
+	}
+}
+
+// processInteractive sends one line of input to the agent. Once /branch
+// switches the active branch, later input follows it instead of the branch
+// given on the command line.
+func processInteractive(agentLoop *agent.AgentLoop, input, sessionKey string, branch *string) (string, error) {
+	response, err := agentLoop.ProcessDirect(context.Background(), input, sessionKey, *branch)
+	if err == nil && strings.HasPrefix(input, "/branch ") {
+		*branch = ""
+	}
+	return response, err
+}
+
+// approvalPrompter asks at the terminal whether a tool call may run, reading
+// the answer with readLine.
+func approvalPrompter(readLine func(prompt string) (string, error)) agent.ApprovalPrompter {
+	return func(ctx context.Context, req agent.ApprovalRequest) bool {
+		fmt.Printf("\n⚠️  Approval needed: %s %s\nReason: %s\n", req.Tool, req.Args, req.Reason)
+		answer, err := readLine("Allow it? [y/N] ")
+		if err != nil {
+			return false
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
 	}
 }
 
-func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
+func interactiveMode(agentLoop *agent.AgentLoop, sessionKey, branch string) {
 	prompt := fmt.Sprintf("%s You: ", logo)
 
 	rl, err := readline.NewEx(&readline.Config{
@@ -108,11 +146,17 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	if err != nil {
 		fmt.Printf("Error initializing readline: %v\n", err)
 		fmt.Println("Falling back to simple input mode...")
-		simpleInteractiveMode(agentLoop, sessionKey)
+		simpleInteractiveMode(agentLoop, sessionKey, branch)
 		return
 	}
 	defer rl.Close()
 
+	agentLoop.SetApprovalPrompter(approvalPrompter(func(p string) (string, error) {
+		rl.SetPrompt(p)
+		defer rl.SetPrompt(prompt)
+		return rl.Readline()
+	}))
+
 	for {
 		line, err := rl.Readline()
 		if err != nil {
@@ -134,8 +178,7 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 			return
 		}
 
-		ctx := context.Background()
-		response, err := agentLoop.ProcessDirect(ctx, input, sessionKey)
+		response, err := processInteractive(agentLoop, input, sessionKey, &branch)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
@@ -145,8 +188,13 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	}
 }
 
-func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
+func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey, branch string) {
 	reader := bufio.NewReader(os.Stdin)
+	agentLoop.SetApprovalPrompter(approvalPrompter(func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		return reader.ReadString('\n')
+	}))
+
 	for {
 		fmt.Print(fmt.Sprintf("%s You: ", logo))
 		line, err := reader.ReadString('\n')
@@ -169,8 +217,7 @@ func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 			return
 		}
 
-		ctx := context.Background()
-		response, err := agentLoop.ProcessDirect(ctx, input, sessionKey)
+		response, err := processInteractive(agentLoop, input, sessionKey, &branch)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
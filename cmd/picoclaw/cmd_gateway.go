@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/api"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -56,6 +57,7 @@ func gatewayCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	agentLoop.PersistSubagentTasks()
 
 	// Print agent startup info
 	fmt.Println("\n📦 Agent Status:")
@@ -179,6 +181,14 @@ func gatewayCmd() {
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	if cfg.Gateway.API.Enabled {
+		if cfg.Gateway.API.Token == "" {
+			fmt.Println("⚠ gateway.api.enabled is set but gateway.api.token is empty; OpenAI-compatible API not started")
+		} else {
+			healthServer.Handle("/v1/", api.NewHandler(agentLoop, cfg.Gateway.API.Token))
+			fmt.Printf("✓ OpenAI-compatible API available at http://%s:%d/v1\n", cfg.Gateway.Host, cfg.Gateway.Port)
+		}
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
@@ -186,23 +196,45 @@ func gatewayCmd() {
 	}()
 	fmt.Printf("✓ Health endpoints available at http://%s:%d/health and /ready\n", cfg.Gateway.Host, cfg.Gateway.Port)
 
-	go agentLoop.Run(ctx)
+	agentDone := make(chan struct{})
+	go func() {
+		agentLoop.Run(ctx)
+		close(agentDone)
+	}()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 	<-sigChan
 
 	fmt.Println("\nShutting down...")
-	cancel()
+	// Stop taking new work, then let the sessions already queued or running
+	// finish so their replies still go out. They are canceled only if that
+	// takes longer than shutdownDrainTimeout.
 	healthServer.Stop(context.Background())
 	deviceService.Stop()
 	heartbeatService.Stop()
 	cronService.Stop()
 	agentLoop.Stop()
-	channelManager.StopAll(ctx)
+	select {
+	case <-agentDone:
+	case <-time.After(shutdownDrainTimeout):
+		fmt.Printf("⚠ Sessions still running after %s, canceling them\n", shutdownDrainTimeout)
+		cancel()
+		<-agentDone
+	}
+	cancel()
+	agentLoop.Close()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer stopCancel()
+	channelManager.StopAll(stopCtx)
 	fmt.Println("✓ Gateway stopped")
 }
 
+// shutdownDrainTimeout bounds how long the gateway waits on shutdown for
+// queued and in-flight sessions to finish.
+const shutdownDrainTimeout = 30 * time.Second
+
 func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace string, restrict bool, execTimeout time.Duration, cfg *config.Config) *cron.CronService {
 	cronStorePath := filepath.Join(workspace, "cron", "jobs.json")
 
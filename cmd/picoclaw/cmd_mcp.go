@@ -0,0 +1,187 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mcp"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func mcpCmd() {
+	if len(os.Args) < 3 {
+		mcpHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "serve":
+		mcpServeCmd()
+	default:
+		fmt.Printf("Unknown mcp command: %s\n", os.Args[2])
+		mcpHelp()
+	}
+}
+
+func mcpHelp() {
+	fmt.Println("\nMCP commands:")
+	fmt.Println("  serve             Serve picoclaw's tools and a chat tool over MCP")
+	fmt.Println()
+	fmt.Println("Serve options:")
+	fmt.Println("  --http <addr>     Listen for streamable HTTP at <addr>/mcp instead of using stdio")
+	fmt.Println("  --token <token>   Bearer token HTTP clients must send (or PICOCLAW_MCP_TOKEN); required with --http")
+	fmt.Println("  --insecure        Allow --http without a token on a loopback address")
+	fmt.Println("  -d, --debug       Enable debug logging")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  picoclaw mcp serve")
+	fmt.Println("  picoclaw mcp serve --http 0.0.0.0:18791 --token secret")
+}
+
+func mcpServeCmd() {
+	httpAddr := ""
+	token := os.Getenv("PICOCLAW_MCP_TOKEN")
+	insecure := false
+
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--http":
+			if i+1 < len(args) {
+				httpAddr = args[i+1]
+				i++
+			}
+		case "--token":
+			if i+1 < len(args) {
+				token = args[i+1]
+				i++
+			}
+		case "--insecure":
+			insecure = true
+		case "--debug", "-d":
+			logger.SetLevel(logger.DEBUG)
+		case "-h", "--help", "help":
+			mcpHelp()
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown option: %s\n", args[i])
+			mcpHelp()
+			return
+		}
+	}
+
+	// Over HTTP the tools, exec included, are open to anyone who can reach
+	// the address, so a token is required unless only this machine can.
+	if httpAddr != "" && token == "" {
+		if !insecure {
+			fmt.Fprintln(os.Stderr, "Error: --http needs --token (or PICOCLAW_MCP_TOKEN); use --insecure to serve without one on a loopback address")
+			os.Exit(1)
+		}
+		if !isLoopbackAddr(httpAddr) {
+			fmt.Fprintf(os.Stderr, "Error: --insecure only serves loopback addresses such as 127.0.0.1:18791, not %s\n", httpAddr)
+			os.Exit(1)
+		}
+	}
+
+	// In stdio mode stdout belongs to the protocol; anything else that
+	// prints is sent to stderr instead.
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	provider, modelID, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	if modelID != "" {
+		cfg.Agents.Defaults.Model = modelID
+	}
+
+	msgBus := bus.NewMessageBus()
+	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	defer agentLoop.Close()
+
+	execTimeout := time.Duration(cfg.Tools.Cron.ExecTimeoutMinutes) * time.Minute
+	cronService := setupCronTool(agentLoop, msgBus, cfg.WorkspacePath(), cfg.Agents.Defaults.RestrictToWorkspace, execTimeout, cfg)
+	if err := cronService.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting cron service: %v\n", err)
+	}
+	defer cronService.Stop()
+
+	server := mcp.NewServer(
+		mcp.Implementation{Name: "picoclaw", Version: version},
+		"Tools of a picoclaw agent. Use chat to talk to the agent itself; the other tools act on its workspace directly.",
+		agentLoop.MCPHandler(),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		<-sigChan
+		cancel()
+		if httpAddr == "" {
+			os.Stdin.Close() // unblock ServeStdio
+		}
+	}()
+
+	if httpAddr == "" {
+		if err := server.ServeStdio(ctx, os.Stdin, protocolOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return
+	}
+
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "⚠ No --token set: any local process can run tools")
+	}
+	server.Token = token
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", server)
+	httpServer := &http.Server{Addr: httpAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "%s MCP server listening on http://%s/mcp\n", logo, httpAddr)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// isLoopbackAddr reports whether a listen address only accepts connections
+// from this machine. An empty host listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,235 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func sessionsCmd() {
+	if len(os.Args) < 3 {
+		sessionsHelp()
+		return
+	}
+
+	subcommand := os.Args[2]
+	if subcommand == "-h" || subcommand == "--help" || subcommand == "help" {
+		sessionsHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	// Options shared by the subcommands; positional args are collected apart.
+	var positional []string
+	agentID := ""
+	format := "md"
+	output := ""
+	maxAgeDays, maxMessages := cfg.Session.MaxAgeDays, cfg.Session.MaxMessages
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-a", "--agent":
+			if i+1 < len(args) {
+				agentID = routing.NormalizeAgentID(args[i+1])
+				i++
+			}
+		case "-f", "--format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case "-o", "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "--max-age-days":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &maxAgeDays)
+				i++
+			}
+		case "--max-messages":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &maxMessages)
+				i++
+			}
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	managers := agent.OpenSessionManagers(cfg)
+	defer func() {
+		for _, sm := range managers {
+			sm.Close()
+		}
+	}()
+	if agentID != "" {
+		sm, ok := managers[agentID]
+		if !ok {
+			fmt.Printf("Unknown agent: %s\n", agentID)
+			return
+		}
+		managers = map[string]*session.SessionManager{agentID: sm}
+	}
+
+	switch subcommand {
+	case "list":
+		sessionsListCmd(managers)
+	case "show", "export", "delete":
+		if len(positional) < 1 {
+			fmt.Printf("Usage: picoclaw sessions %s <session-key>\n", subcommand)
+			return
+		}
+		id, sm, s := findSession(managers, positional[0])
+		if s == nil {
+			fmt.Printf("Session not found: %s\n", positional[0])
+			return
+		}
+		switch subcommand {
+		case "show":
+			fmt.Print(session.ExportMarkdown(s))
+		case "export":
+			sessionsExportCmd(s, format, output)
+		case "delete":
+			if err := sm.Delete(s.Key); err != nil {
+				fmt.Printf("Error deleting session: %v\n", err)
+				return
+			}
+			fmt.Printf("✓ Deleted session %s (agent %s)\n", s.Key, id)
+		}
+	case "prune":
+		sessionsPruneCmd(managers, maxAgeDays, maxMessages)
+	default:
+		fmt.Printf("Unknown sessions command: %s\n", subcommand)
+		sessionsHelp()
+	}
+}
+
+func sessionsHelp() {
+	fmt.Println("\nSessions commands:")
+	fmt.Println("  list                List stored conversations")
+	fmt.Println("  show <key>          Print a conversation as markdown")
+	fmt.Println("  export <key>        Export a conversation")
+	fmt.Println("  delete <key>        Delete a conversation")
+	fmt.Println("  prune               Apply the retention policy now")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -a, --agent <id>        Only this agent's sessions (default: all agents)")
+	fmt.Println("  -f, --format <md|json>  Export format (default: md)")
+	fmt.Println("  -o, --output <file>     Export to a file instead of stdout")
+	fmt.Println("  --max-age-days <n>      Prune: delete sessions idle this long (default: session.max_age_days)")
+	fmt.Println("  --max-messages <n>      Prune: trim sessions to this size (default: session.max_messages)")
+}
+
+// sortedAgentIDs returns the keys of managers in order, for stable output.
+func sortedAgentIDs(managers map[string]*session.SessionManager) []string {
+	ids := make([]string, 0, len(managers))
+	for id := range managers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// findSession looks key up in each agent's store.
+func findSession(managers map[string]*session.SessionManager, key string) (string, *session.SessionManager, *session.Session) {
+	for _, id := range sortedAgentIDs(managers) {
+		if s := managers[id].Get(key); s != nil {
+			return id, managers[id], s
+		}
+	}
+	return "", nil, nil
+}
+
+func sessionsListCmd(managers map[string]*session.SessionManager) {
+	total := 0
+	for _, id := range sortedAgentIDs(managers) {
+		infos, err := managers[id].List()
+		if err != nil {
+			fmt.Printf("Error listing sessions of agent %s: %v\n", id, err)
+			continue
+		}
+		if len(infos) == 0 {
+			continue
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Updated.After(infos[j].Updated) })
+
+		fmt.Printf("\nAgent %s:\n", id)
+		for _, info := range infos {
+			summary := ""
+			if info.Summary {
+				summary = ", summarized"
+			}
+			fmt.Printf("  %s\n    %d messages%s, updated %s\n",
+				info.Key, info.Messages, summary, info.Updated.Format("2006-01-02 15:04"))
+		}
+		total += len(infos)
+	}
+	if total == 0 {
+		fmt.Println("No sessions.")
+	}
+}
+
+func sessionsExportCmd(s *session.Session, format, output string) {
+	var data []byte
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		data = []byte(session.ExportMarkdown(s))
+	case "json":
+		var err error
+		if data, err = session.ExportJSON(s); err != nil {
+			fmt.Printf("Error exporting session: %v\n", err)
+			return
+		}
+	default:
+		fmt.Printf("Unknown format: %s (use md or json)\n", format)
+		return
+	}
+
+	if output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fmt.Printf("Error writing %s: %v\n", output, err)
+		return
+	}
+	fmt.Printf("✓ Exported %d messages to %s\n", len(s.Messages), output)
+}
+
+func sessionsPruneCmd(managers map[string]*session.SessionManager, maxAgeDays, maxMessages int) {
+	if maxAgeDays <= 0 && maxMessages <= 0 {
+		fmt.Println("No retention policy: set session.max_age_days or session.max_messages, or pass --max-age-days/--max-messages.")
+		return
+	}
+
+	total := 0
+	for _, id := range sortedAgentIDs(managers) {
+		sm := managers[id]
+		sm.SetRetention(session.RetentionPolicy{
+			MaxAge:      time.Duration(maxAgeDays) * 24 * time.Hour,
+			MaxMessages: maxMessages,
+		})
+		n, err := sm.Prune()
+		if err != nil {
+			fmt.Printf("Error pruning sessions of agent %s: %v\n", id, err)
+		}
+		total += n
+	}
+	fmt.Printf("✓ Pruned %d sessions\n", total)
+}
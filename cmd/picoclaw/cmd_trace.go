@@ -0,0 +1,183 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/trace"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+func traceCmd() {
+	if len(os.Args) < 3 {
+		traceHelp()
+		return
+	}
+
+	subcommand := os.Args[2]
+	if subcommand == "-h" || subcommand == "--help" || subcommand == "help" {
+		traceHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	var positional []string
+	agentID := ""
+	limit := 20
+	verbose := false
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-a", "--agent":
+			if i+1 < len(args) {
+				agentID = routing.NormalizeAgentID(args[i+1])
+				i++
+			}
+		case "-n", "--limit":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &limit)
+				i++
+			}
+		case "-v", "--verbose":
+			verbose = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	stores := agent.TraceStores(cfg)
+	if agentID != "" {
+		store, ok := stores[agentID]
+		if !ok {
+			fmt.Printf("Unknown agent: %s\n", agentID)
+			return
+		}
+		stores = map[string]*trace.Store{agentID: store}
+	}
+
+	switch subcommand {
+	case "list":
+		traceListCmd(stores, limit)
+	case "show", "replay":
+		if len(positional) < 1 {
+			fmt.Printf("Usage: picoclaw trace %s <id>\n", subcommand)
+			return
+		}
+		t, err := findTrace(stores, positional[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if subcommand == "show" {
+			trace.Render(os.Stdout, t, verbose)
+			return
+		}
+
+		replayed, err := agent.ReplayTrace(context.Background(), cfg, t)
+		if err != nil {
+			fmt.Printf("Error replaying trace: %v\n", err)
+			return
+		}
+		if verbose {
+			trace.Render(os.Stdout, replayed, true)
+			fmt.Println()
+		}
+		diffs := trace.Diff(t, replayed)
+		if len(diffs) == 0 {
+			fmt.Printf("✓ Replay of %s matches the recording (%d steps)\n", t.ID, len(t.Steps))
+			return
+		}
+		fmt.Printf("Replay of %s differs from the recording:\n", t.ID)
+		for _, d := range diffs {
+			fmt.Printf("  • %s\n", d)
+		}
+	default:
+		fmt.Printf("Unknown trace command: %s\n", subcommand)
+		traceHelp()
+	}
+}
+
+func traceHelp() {
+	fmt.Println("\nTrace commands:")
+	fmt.Println("  list                List recorded turns, newest first")
+	fmt.Println("  show <id>           Print a recorded turn")
+	fmt.Println("  replay <id>         Run a turn again against its recorded responses and report what changed")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -a, --agent <id>    Only this agent's traces (default: all agents)")
+	fmt.Println("  -n, --limit <n>     List: number of traces (default: 20)")
+	fmt.Println("  -v, --verbose       Show: print every message sent to the LLM; replay: print the new run")
+	fmt.Println()
+	fmt.Println("Turns are recorded when agents.defaults.trace is true.")
+}
+
+func traceListCmd(stores map[string]*trace.Store, limit int) {
+	type entry struct {
+		agentID string
+		t       *trace.Trace
+	}
+	var entries []entry
+	for agentID, store := range stores {
+		ids, err := store.List()
+		if err != nil {
+			fmt.Printf("Error listing traces of agent %s: %v\n", agentID, err)
+			continue
+		}
+		if limit > 0 && len(ids) > limit {
+			ids = ids[len(ids)-limit:]
+		}
+		for _, id := range ids {
+			if t, err := store.Load(id); err == nil {
+				entries = append(entries, entry{agentID, t})
+			}
+		}
+	}
+	if len(entries) == 0 {
+		fmt.Println("No traces recorded. Set agents.defaults.trace to true to record turns.")
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].t.ID > entries[j].t.ID })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for _, e := range entries {
+		status := "ok"
+		if e.t.Error != "" {
+			status = "error"
+		}
+		fmt.Printf("%s  %-8s %-5s %2d steps %7s  %s\n", e.t.ID, e.agentID, status, len(e.t.Steps),
+			(time.Duration(e.t.DurationMS) * time.Millisecond).Round(100*time.Millisecond),
+			utils.Truncate(strings.ReplaceAll(e.t.UserMessage, "\n", " "), 60))
+	}
+}
+
+// findTrace looks id up in each agent's store.
+func findTrace(stores map[string]*trace.Store, id string) (*trace.Trace, error) {
+	var lastErr error
+	for _, store := range stores {
+		t, err := store.Load(id)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("trace %s not found", id)
+	}
+	return nil, lastErr
+}
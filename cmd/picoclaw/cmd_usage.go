@@ -0,0 +1,91 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+func usageCmd() {
+	days := 7
+	by := "day"
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-d", "--days":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &days)
+				i++
+			}
+		case "-b", "--by":
+			if i+1 < len(args) {
+				by = args[i+1]
+				i++
+			}
+		case "-h", "--help", "help":
+			usageHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			usageHelp()
+			return
+		}
+	}
+
+	key, ok := usage.KeyFunc(by)
+	if !ok {
+		fmt.Printf("Unknown breakdown: %s\n", by)
+		usageHelp()
+		return
+	}
+	if days <= 0 {
+		days = 1
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -(days - 1))
+
+	ledger := usage.NewLedger(cfg.WorkspacePath())
+	records, err := ledger.Records(since)
+	if err != nil {
+		fmt.Printf("Error reading usage: %v\n", err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Printf("No usage recorded in the last %d days.\n", days)
+		return
+	}
+
+	fmt.Printf("\nUsage for the last %d days, by %s:\n", days, by)
+	fmt.Println("-----------------------------------")
+	for _, g := range usage.GroupBy(records, key) {
+		name := g.Key
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Printf("  %s\n    %s\n", name, g.Totals)
+	}
+	fmt.Println("-----------------------------------")
+	fmt.Printf("  Total: %s\n", usage.Sum(records))
+}
+
+func usageHelp() {
+	fmt.Println("\nUsage command:")
+	fmt.Println("  picoclaw usage [options]   Show token usage and cost")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -d, --days <n>     Number of days to include (default: 7)")
+	fmt.Println("  -b, --by <dim>     Breakdown: day, week, agent, session, channel, model (default: day)")
+}
@@ -115,6 +115,14 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "usage":
+		usageCmd()
+	case "sessions":
+		sessionsCmd()
+	case "trace":
+		traceCmd()
+	case "mcp":
+		mcpCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -184,6 +192,10 @@ func printHelp() {
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  usage       Show token usage and cost")
+	fmt.Println("  sessions    Manage conversation history (list, show, export, delete, prune)")
+	fmt.Println("  trace       Inspect and replay recorded turns (list, show, replay)")
+	fmt.Println("  mcp         Serve picoclaw over the Model Context Protocol")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  version     Show version information")
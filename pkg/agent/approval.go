@@ -0,0 +1,448 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Replies that answer an approval request, optionally followed by its ID.
+const (
+	approveCommand = "/approve"
+	denyCommand    = "/deny"
+)
+
+// defaultApprovalTimeout is used when tools.approval.timeout_seconds is unset.
+const defaultApprovalTimeout = 5 * time.Minute
+
+// ApprovalRequest describes a tool call waiting for approval.
+type ApprovalRequest struct {
+	ID      string
+	AgentID string
+	Tool    string
+	Args    string // Arguments as JSON, truncated
+	Reason  string // Why the call needs approval
+}
+
+// ApprovalPrompter asks whoever is at the terminal to approve a tool call
+// made on the cli channel, where there is no chat to send the request to.
+type ApprovalPrompter func(ctx context.Context, req ApprovalRequest) bool
+
+// approvalPolicy decides which tool calls need approval.
+type approvalPolicy struct {
+	tools          map[string]bool
+	execPatterns   []*regexp.Regexp
+	writeAllowDirs []string
+	hardwareWrites bool
+}
+
+func newApprovalPolicy(cfg config.ApprovalConfig) *approvalPolicy {
+	p := &approvalPolicy{
+		tools:          make(map[string]bool),
+		writeAllowDirs: cfg.WriteAllowDirs,
+		hardwareWrites: cfg.HardwareWrites,
+	}
+	for _, name := range cfg.Tools {
+		p.tools[name] = true
+	}
+	for _, pattern := range cfg.ExecPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.WarnCF("approval", "Invalid exec approval pattern", map[string]interface{}{
+				"pattern": pattern,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		p.execPatterns = append(p.execPatterns, re)
+	}
+	return p
+}
+
+// check returns why a call needs approval, or "" if it may run as is.
+func (p *approvalPolicy) check(workspace string, tc providers.ToolCall) string {
+	if p.tools[tc.Name] {
+		return fmt.Sprintf("every %s call needs approval", tc.Name)
+	}
+
+	switch tc.Name {
+	case "exec":
+		command, _ := tc.Arguments["command"].(string)
+		for _, re := range p.execPatterns {
+			if re.MatchString(command) {
+				return fmt.Sprintf("command matches %s", re.String())
+			}
+		}
+	case "write_file", "edit_file", "append_file":
+		path, _ := tc.Arguments["path"].(string)
+		if len(p.writeAllowDirs) > 0 && path != "" && !p.writeAllowed(workspace, path) {
+			return fmt.Sprintf("%s is outside %s", path, strings.Join(p.writeAllowDirs, ", "))
+		}
+	case "i2c":
+		if action, _ := tc.Arguments["action"].(string); p.hardwareWrites && action == "write" {
+			return "i2c write"
+		}
+	case "spi":
+		if action, _ := tc.Arguments["action"].(string); p.hardwareWrites && action == "transfer" {
+			return "spi transfer"
+		}
+	}
+	return ""
+}
+
+// writeAllowed reports whether path lies in one of the allowed directories.
+// Relative paths, in both, are taken from the workspace.
+func (p *approvalPolicy) writeAllowed(workspace, path string) bool {
+	abs := func(path string) string {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workspace, path)
+		}
+		return filepath.Clean(path)
+	}
+	target := abs(path)
+	for _, dir := range p.writeAllowDirs {
+		rel, err := filepath.Rel(abs(dir), target)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// approvals holds tool calls that wait for someone in the originating chat to
+// approve them, and records every decision. A request is answered by the
+// user whose message led to the call, or by one of the approvers.
+type approvals struct {
+	policy    *approvalPolicy // nil when approval is disabled
+	timeout   time.Duration
+	bus       *bus.MessageBus
+	prompter  ApprovalPrompter
+	approvers []string
+
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+	auditMu sync.Mutex
+}
+
+type pendingApproval struct {
+	tool      string
+	channel   string
+	chatID    string
+	requester string // Sender of the message that led to the call
+	decided   chan approvalDecision
+}
+
+type approvalDecision struct {
+	approved bool
+	by       string
+}
+
+// approvalRecord is one line of <workspace>/audit/approvals.jsonl.
+type approvalRecord struct {
+	Time      time.Time              `json:"time"`
+	ID        string                 `json:"id"`
+	Agent     string                 `json:"agent"`
+	Session   string                 `json:"session,omitempty"`
+	Channel   string                 `json:"channel"`
+	ChatID    string                 `json:"chat_id,omitempty"`
+	Tool      string                 `json:"tool"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+	Reason    string                 `json:"reason"`
+	Decision  string                 `json:"decision"` // approved, denied, timeout, canceled or unavailable
+	DecidedBy string                 `json:"decided_by,omitempty"`
+	WaitedMS  int64                  `json:"waited_ms"`
+}
+
+func newApprovals(cfg config.ApprovalConfig, msgBus *bus.MessageBus) *approvals {
+	a := &approvals{
+		timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+		bus:       msgBus,
+		approvers: cfg.Approvers,
+		pending:   make(map[string]*pendingApproval),
+	}
+	if a.timeout <= 0 {
+		a.timeout = defaultApprovalTimeout
+	}
+	if cfg.Enabled {
+		a.policy = newApprovalPolicy(cfg)
+	}
+	return a
+}
+
+// review asks for approval of the calls that need it, one at a time, and
+// returns for each call the refusal to report instead of running it, or nil
+// if it may run.
+func (a *approvals) review(ctx context.Context, agent *AgentInstance, opts processOptions, calls []providers.ToolCall) []*tools.ToolResult {
+	refusals := make([]*tools.ToolResult, len(calls))
+	if a.policy == nil {
+		return refusals
+	}
+
+	for i, tc := range calls {
+		reason := a.policy.check(agent.Workspace, tc)
+		if reason == "" {
+			continue
+		}
+		req := ApprovalRequest{
+			ID:      uuid.NewString()[:8],
+			AgentID: agent.ID,
+			Tool:    tc.Name,
+			Args:    argsPreview(tc.Arguments),
+			Reason:  reason,
+		}
+
+		start := time.Now()
+		outcome, by := a.decide(ctx, req, opts.Channel, opts.ChatID, opts.SenderID)
+		a.audit(agent.Workspace, approvalRecord{
+			Time:      start,
+			ID:        req.ID,
+			Agent:     agent.ID,
+			Session:   opts.SessionKey,
+			Channel:   opts.Channel,
+			ChatID:    opts.ChatID,
+			Tool:      tc.Name,
+			Args:      tc.Arguments,
+			Reason:    reason,
+			Decision:  outcome,
+			DecidedBy: by,
+			WaitedMS:  time.Since(start).Milliseconds(),
+		})
+
+		switch outcome {
+		case "approved":
+		case "denied":
+			refusals[i] = tools.ErrorResult(fmt.Sprintf("The call to %s was denied by %s and did not run. Do not retry it; ask the user how they want to proceed.", tc.Name, by))
+		case "timeout":
+			refusals[i] = tools.ErrorResult(fmt.Sprintf("The call to %s needs approval (%s), which was not given within %s, so it did not run. Do not retry it unless the user asks.", tc.Name, reason, a.timeout))
+		case "canceled":
+			refusals[i] = tools.ErrorResult(fmt.Sprintf("The call to %s was canceled while waiting for approval.", tc.Name))
+		default:
+			refusals[i] = tools.ErrorResult(fmt.Sprintf("The call to %s needs approval (%s), but there is no one to ask on the %s channel, so it did not run.", tc.Name, reason, opts.Channel))
+		}
+	}
+	return refusals
+}
+
+// decide gets a decision on req from requester or an approver in the chat it
+// came from, or from the terminal for cli calls, and returns the outcome and
+// who decided.
+func (a *approvals) decide(ctx context.Context, req ApprovalRequest, channel, chatID, requester string) (string, string) {
+	if channel == "cli" && a.prompter != nil {
+		if a.prompter(ctx, req) {
+			return "approved", "cli"
+		}
+		return "denied", "cli"
+	}
+	if constants.IsInternalChannel(channel) || channel == "" || chatID == "" {
+		return "unavailable", ""
+	}
+
+	p := &pendingApproval{tool: req.Tool, channel: channel, chatID: chatID, requester: requester, decided: make(chan approvalDecision, 1)}
+	a.mu.Lock()
+	a.pending[req.ID] = p
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, req.ID)
+		a.mu.Unlock()
+	}()
+
+	a.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: fmt.Sprintf("Approval needed [%s]: %s %s\nReason: %s\n\nReply %s %s or %s %s. Unanswered requests are denied after %s.",
+			req.ID, req.Tool, req.Args, req.Reason, approveCommand, req.ID, denyCommand, req.ID, a.timeout),
+		Buttons: []bus.Button{
+			{Text: "Approve", Data: approveCommand + " " + req.ID},
+			{Text: "Deny", Data: denyCommand + " " + req.ID},
+		},
+	})
+
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+	select {
+	case d := <-p.decided:
+		if d.approved {
+			return "approved", d.by
+		}
+		return "denied", d.by
+	case <-timer.C:
+		a.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: fmt.Sprintf("Approval request [%s] for %s timed out and was denied.", req.ID, req.Tool),
+		})
+		return "timeout", ""
+	case <-ctx.Done():
+		return "canceled", ""
+	}
+}
+
+// Resolve answers a pending approval request if msg is an /approve or /deny
+// reply, and reports whether it was one. Replies are taken only from the chat
+// the request was sent to, and only from its requester or an approver;
+// without an ID they answer the only request waiting there that the sender
+// may answer.
+func (a *approvals) Resolve(msg bus.InboundMessage) bool {
+	fields := strings.Fields(msg.Content)
+	if a.policy == nil || len(fields) == 0 || len(fields) > 2 || (fields[0] != approveCommand && fields[0] != denyCommand) {
+		return false
+	}
+
+	reply := func(content string) {
+		a.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: content})
+	}
+
+	a.mu.Lock()
+	var id string
+	var p *pendingApproval
+	refused := false
+	if len(fields) == 2 {
+		id = fields[1]
+		if candidate := a.pending[id]; candidate != nil && candidate.channel == msg.Channel && candidate.chatID == msg.ChatID {
+			if a.mayDecide(candidate, msg.SenderID) {
+				p = candidate
+			} else {
+				refused = true
+			}
+		}
+	} else {
+		var ids []string
+		for candidateID, candidate := range a.pending {
+			if candidate.channel == msg.Channel && candidate.chatID == msg.ChatID {
+				if a.mayDecide(candidate, msg.SenderID) {
+					ids = append(ids, candidateID)
+				} else {
+					refused = true
+				}
+			}
+		}
+		if len(ids) > 1 {
+			a.mu.Unlock()
+			reply(fmt.Sprintf("Several requests are waiting; reply with %s <id> or %s <id>.", approveCommand, denyCommand))
+			return true
+		}
+		if len(ids) == 1 {
+			id, p = ids[0], a.pending[ids[0]]
+		}
+	}
+	if p != nil {
+		delete(a.pending, id)
+	}
+	a.mu.Unlock()
+
+	if p == nil {
+		if refused {
+			reply("Only the user who made the request or an approver can answer it.")
+		} else if id != "" {
+			reply(fmt.Sprintf("No approval request %s is waiting in this chat.", id))
+		} else {
+			reply("No approval request is waiting in this chat.")
+		}
+		return true
+	}
+
+	approved := fields[0] == approveCommand
+	p.decided <- approvalDecision{approved: approved, by: msg.SenderID}
+	if approved {
+		reply(fmt.Sprintf("Approved %s [%s].", p.tool, id))
+	} else {
+		reply(fmt.Sprintf("Denied %s [%s].", p.tool, id))
+	}
+	return true
+}
+
+// mayDecide reports whether sender may answer p: its requester and the
+// configured approvers may. Callers hold mu.
+func (a *approvals) mayDecide(p *pendingApproval, sender string) bool {
+	if sender == "" {
+		return false
+	}
+	if sender == p.requester {
+		return true
+	}
+	// Telegram senders are "id|username"; approvers may list either part.
+	id, user, _ := strings.Cut(sender, "|")
+	for _, approver := range a.approvers {
+		approver = strings.TrimPrefix(approver, "@")
+		if approver == sender || approver == id || (user != "" && approver == user) {
+			return true
+		}
+	}
+	return false
+}
+
+// audit appends rec to the agent's approval log.
+func (a *approvals) audit(workspace string, rec approvalRecord) {
+	logger.InfoCF("approval", "Tool call "+rec.Decision, map[string]interface{}{
+		"id":         rec.ID,
+		"agent_id":   rec.Agent,
+		"tool":       rec.Tool,
+		"reason":     rec.Reason,
+		"decided_by": rec.DecidedBy,
+	})
+
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+
+	dir := filepath.Join(workspace, "audit")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "approvals.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.WarnCF("approval", "Failed to write approval audit", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	json.NewEncoder(f).Encode(rec)
+}
+
+// argsPreview renders tool arguments for an approval request.
+func argsPreview(args map[string]interface{}) string {
+	data, _ := json.Marshal(args)
+	return utils.Truncate(string(data), 300)
+}
+
+// SetApprovalPrompter sets how tool calls made on the cli channel are
+// approved. Without one they are refused.
+func (al *AgentLoop) SetApprovalPrompter(p ApprovalPrompter) {
+	al.approvals.prompter = p
+}
+
+// executeToolCalls runs the calls that need no approval or were approved,
+// and returns the results of all calls in order, with refusals in place of
+// the calls that were not approved.
+func (al *AgentLoop) executeToolCalls(ctx context.Context, agent *AgentInstance, opts processOptions, calls []providers.ToolCall, callback func(tc providers.ToolCall) tools.AsyncCallback) []*tools.ToolResult {
+	results := al.approvals.review(ctx, agent, opts, calls)
+
+	approved := make([]providers.ToolCall, 0, len(calls))
+	for i, tc := range calls {
+		if results[i] == nil {
+			approved = append(approved, tc)
+		}
+	}
+	executed := agent.Tools.ExecuteCalls(ctx, approved, opts.Channel, opts.ChatID, agent.MaxParallel, callback)
+	for i := range results {
+		if results[i] == nil {
+			results[i], executed = executed[0], executed[1:]
+		}
+	}
+	return results
+}
@@ -0,0 +1,277 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// execOnce asks for one exec call of command, then replies with its result.
+func execOnce(command string) func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+	return func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		if last := messages[len(messages)-1]; last.Role == "tool" {
+			return &providers.LLMResponse{Content: last.Content}, nil
+		}
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID: "call-1", Name: "exec", Arguments: map[string]interface{}{"command": command},
+		}}}, nil
+	}
+}
+
+// fakeExecTool stands in for exec and records the commands it ran.
+type fakeExecTool struct {
+	ran []string
+}
+
+func (t *fakeExecTool) Name() string        { return "exec" }
+func (t *fakeExecTool) Description() string { return "fake exec" }
+func (t *fakeExecTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (t *fakeExecTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	command, _ := args["command"].(string)
+	t.ran = append(t.ran, command)
+	return tools.NewToolResult("ran " + command)
+}
+
+// newApprovalTestLoop returns a loop whose LLM runs command once with a
+// fake exec, and where rm needs approval.
+func newApprovalTestLoop(t *testing.T, command string) (*AgentLoop, *bus.MessageBus, *fakeExecTool, string) {
+	al, msgBus := newTestLoop(t, &scriptedProvider{reply: execOnce(command)}, func(cfg *config.Config) {
+		cfg.Tools.Approval = config.ApprovalConfig{Enabled: true, ExecPatterns: []string{`\brm\b`}}
+	})
+	agent := al.registry.GetDefaultAgent()
+	exec := &fakeExecTool{}
+	agent.Tools.Register(exec)
+	return al, msgBus, exec, agent.Workspace
+}
+
+// runInChat processes content as a message from sender in telegram chat 42
+// and returns the prompt sent there for approval along with a channel that
+// receives the reply.
+func runInChat(t *testing.T, al *AgentLoop, msgBus *bus.MessageBus, sender, content string) (bus.OutboundMessage, <-chan string) {
+	t.Helper()
+	reply := make(chan string, 1)
+	go func() {
+		response, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel: "telegram", ChatID: "42", SenderID: sender, Content: content, SessionKey: "agent:main:approval",
+		})
+		if err != nil {
+			response = "error: " + err.Error()
+		}
+		reply <- response
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for {
+		msg, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok {
+			t.Fatal("no approval prompt was sent")
+		}
+		if len(msg.Buttons) > 0 {
+			return msg, reply
+		}
+	}
+}
+
+func TestApprovalPolicy_Check(t *testing.T) {
+	workspace := t.TempDir()
+	policy := newApprovalPolicy(config.ApprovalConfig{
+		Tools:          []string{"cron"},
+		ExecPatterns:   []string{`\bsudo\b`, `(invalid`},
+		WriteAllowDirs: []string{"notes", "/tmp/scratch"},
+		HardwareWrites: true,
+	})
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want bool
+	}{
+		{"cron", map[string]interface{}{"action": "list"}, true},
+		{"exec", map[string]interface{}{"command": "sudo reboot"}, true},
+		{"exec", map[string]interface{}{"command": "ls -la"}, false},
+		{"write_file", map[string]interface{}{"path": "notes/todo.md"}, false},
+		{"write_file", map[string]interface{}{"path": filepath.Join(workspace, "notes", "a.md")}, false},
+		{"edit_file", map[string]interface{}{"path": "/tmp/scratch/x"}, false},
+		{"write_file", map[string]interface{}{"path": "notes/../secrets.txt"}, true},
+		{"append_file", map[string]interface{}{"path": "notes-old/a.md"}, true},
+		{"read_file", map[string]interface{}{"path": "/etc/passwd"}, false},
+		{"i2c", map[string]interface{}{"action": "write"}, true},
+		{"i2c", map[string]interface{}{"action": "read"}, false},
+		{"spi", map[string]interface{}{"action": "transfer"}, true},
+		{"spi", map[string]interface{}{"action": "read"}, false},
+	}
+	for _, tt := range tests {
+		reason := policy.check(workspace, providers.ToolCall{Name: tt.name, Arguments: tt.args})
+		if (reason != "") != tt.want {
+			t.Errorf("check(%s %v) = %q, want approval needed: %v", tt.name, tt.args, reason, tt.want)
+		}
+	}
+}
+
+func TestApproval_ApprovedInChat(t *testing.T) {
+	al, msgBus, exec, workspace := newApprovalTestLoop(t, "rm -rf build")
+
+	prompt, reply := runInChat(t, al, msgBus, "alice", "clean up")
+	if prompt.Channel != "telegram" || prompt.ChatID != "42" || !strings.Contains(prompt.Content, "rm -rf build") {
+		t.Fatalf("prompt = %+v", prompt)
+	}
+	approve := prompt.Buttons[0].Data
+	if !strings.HasPrefix(approve, approveCommand+" ") {
+		t.Fatalf("first button = %+v, want approve", prompt.Buttons[0])
+	}
+
+	// Replies from another chat are not taken.
+	if !al.approvals.Resolve(bus.InboundMessage{Channel: "telegram", ChatID: "99", SenderID: "mallory", Content: approve}) {
+		t.Error("approval reply from another chat was not handled")
+	}
+	if !al.approvals.Resolve(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "alice", Content: approve}) {
+		t.Fatal("approval reply was not handled")
+	}
+
+	if got := <-reply; got != "ran rm -rf build" {
+		t.Errorf("reply = %q, want the exec result", got)
+	}
+	if len(exec.ran) != 1 {
+		t.Errorf("exec ran %v", exec.ran)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workspace, "audit", "approvals.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec approvalRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("audit record %q: %v", data, err)
+	}
+	if rec.Decision != "approved" || rec.DecidedBy != "alice" || rec.Tool != "exec" || rec.ChatID != "42" {
+		t.Errorf("audit record = %+v", rec)
+	}
+}
+
+func TestApproval_DeniedOrTimedOut(t *testing.T) {
+	al, msgBus, exec, _ := newApprovalTestLoop(t, "rm notes.txt")
+
+	prompt, reply := runInChat(t, al, msgBus, "bob", "delete notes")
+	// A bare /deny answers the only request waiting in the chat.
+	if !al.approvals.Resolve(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "bob", Content: denyCommand}) {
+		t.Fatal("deny reply was not handled")
+	}
+	if got := <-reply; !strings.Contains(got, "denied by bob") {
+		t.Errorf("reply after deny = %q", got)
+	}
+
+	al.approvals.timeout = 50 * time.Millisecond
+	_, reply = runInChat(t, al, msgBus, "bob", "delete notes again")
+	if got := <-reply; !strings.Contains(got, "not given within") {
+		t.Errorf("reply after timeout = %q", got)
+	}
+
+	// A late answer finds nothing waiting.
+	if !al.approvals.Resolve(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: prompt.Buttons[0].Data}) {
+		t.Error("late approval reply was not handled")
+	}
+	if len(exec.ran) != 0 {
+		t.Errorf("exec ran %v without approval", exec.ran)
+	}
+}
+
+func TestApproval_OnlyRequesterOrApprover(t *testing.T) {
+	al, msgBus, exec, workspace := newApprovalTestLoop(t, "rm -rf build")
+	al.approvals.approvers = []string{"@carol"}
+
+	prompt, reply := runInChat(t, al, msgBus, "alice", "clean up")
+	approve := prompt.Buttons[0].Data
+
+	// Someone else in the chat cannot answer alice's request.
+	for _, content := range []string{approve, approveCommand} {
+		if !al.approvals.Resolve(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "bob", Content: content}) {
+			t.Fatalf("%q from bob was not handled", content)
+		}
+	}
+	select {
+	case got := <-reply:
+		t.Fatalf("bob's approval was taken: %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(exec.ran) != 0 {
+		t.Fatalf("exec ran %v on bob's approval", exec.ran)
+	}
+
+	// A configured approver can, here a Telegram "id|username" sender.
+	if !al.approvals.Resolve(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "7|carol", Content: approveCommand}) {
+		t.Fatal("approver's reply was not handled")
+	}
+	if got := <-reply; got != "ran rm -rf build" {
+		t.Errorf("reply = %q, want the exec result", got)
+	}
+	data, _ := os.ReadFile(filepath.Join(workspace, "audit", "approvals.jsonl"))
+	if !strings.Contains(string(data), `"decided_by":"7|carol"`) {
+		t.Errorf("audit = %s", data)
+	}
+}
+
+func TestApproval_CLI(t *testing.T) {
+	al, _, exec, _ := newApprovalTestLoop(t, "rm -r tmp")
+
+	// Without a prompter there is no one to ask.
+	got, err := al.ProcessDirect(context.Background(), "clean", "agent:main:cli", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "no one to ask") || len(exec.ran) != 0 {
+		t.Errorf("reply = %q, exec ran %v", got, exec.ran)
+	}
+
+	var asked ApprovalRequest
+	al.SetApprovalPrompter(func(ctx context.Context, req ApprovalRequest) bool {
+		asked = req
+		return true
+	})
+	got, err = al.ProcessDirect(context.Background(), "clean", "agent:main:cli", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "ran rm -r tmp" || asked.Tool != "exec" || !strings.Contains(asked.Args, "rm -r tmp") {
+		t.Errorf("reply = %q, request = %+v", got, asked)
+	}
+}
+
+func TestApproval_DisabledIgnoresReplies(t *testing.T) {
+	al := NewAgentLoop(&config.Config{}, bus.NewMessageBus(), &mockProvider{})
+	if al.approvals.Resolve(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "/approve abc"}) {
+		t.Error("approval reply handled with approval disabled")
+	}
+}
+
+func TestApproval_MCPCallsAreRefused(t *testing.T) {
+	al, _, exec, _ := newApprovalTestLoop(t, "")
+	handler := al.MCPHandler()
+
+	result, err := handler.CallTool(context.Background(), "exec", map[string]interface{}{"command": "rm -rf build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || !strings.Contains(result.Content[0].Text, "no one to ask") {
+		t.Errorf("result = %+v, want a refusal", result)
+	}
+	if len(exec.ran) != 0 {
+		t.Errorf("exec ran %v without approval", exec.ran)
+	}
+
+	if result, _ := handler.CallTool(context.Background(), "exec", map[string]interface{}{"command": "ls"}); result.IsError || len(exec.ran) != 1 {
+		t.Errorf("a call needing no approval = %+v, ran %v", result, exec.ran)
+	}
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// branchKey returns the key of the branch of session root a message goes to.
+// An explicit branch is forked from the active branch the first time it is
+// used, without switching to it; otherwise the active branch is used.
+func (al *AgentLoop) branchKey(agent *AgentInstance, root, branch string) (string, error) {
+	if branch == "" {
+		return agent.Sessions.ActiveKey(root), nil
+	}
+	key := session.BranchKey(root, branch)
+	if branch == session.MainBranch || agent.Sessions.Get(key) != nil {
+		return key, nil
+	}
+	if _, err := agent.Sessions.Fork(root, branch, 0); err != nil {
+		return "", err
+	}
+	logger.InfoCF("agent", "Forked session branch", map[string]interface{}{
+		"session_key": root,
+		"branch":      branch,
+	})
+	return key, nil
+}
+
+// branchCommand answers /retry, /undo and /branch for the conversation msg
+// belongs to. /retry and /undo act on the branch msg was sent to.
+func (al *AgentLoop) branchCommand(ctx context.Context, msg bus.InboundMessage, cmd string, args []string) string {
+	agent, root, _ := al.resolveSession(msg)
+	sessions := agent.Sessions
+	key, err := al.branchKey(agent, root, msg.Metadata["branch"])
+	if err != nil {
+		return err.Error()
+	}
+
+	switch cmd {
+	case "/undo":
+		n := 1
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v <= 0 {
+				return "Usage: /undo [turns]"
+			}
+			n = v
+		}
+		dropped := sessions.DropTurns(key, n)
+		if len(dropped) == 0 {
+			return "Nothing to undo."
+		}
+		if err := sessions.Save(key); err != nil {
+			return fmt.Sprintf("Failed to save conversation: %v", err)
+		}
+		return fmt.Sprintf("Undid the last %s (%d messages).", plural(countTurns(dropped), "turn"), len(dropped))
+
+	case "/retry":
+		if len(args) > 1 {
+			return "Usage: /retry [model]"
+		}
+		dropped := sessions.DropTurns(key, 1)
+		if len(dropped) == 0 || dropped[0].Role != "user" {
+			return "Nothing to retry."
+		}
+		if err := sessions.Save(key); err != nil {
+			return fmt.Sprintf("Failed to save conversation: %v", err)
+		}
+		opts := processOptions{
+			SessionKey:      key,
+			SenderID:        msg.SenderID,
+			Channel:         msg.Channel,
+			ChatID:          msg.ChatID,
+			UserMessage:     dropped[0].Content,
+			DefaultResponse: "I've completed processing but have no response to give.",
+			EnableSummary:   true,
+			Stream:          true,
+			ModelOverride:   al.switchedModel(root),
+		}
+		if len(args) == 1 {
+			opts.ModelOverride = args[0]
+		}
+		response, err := al.runAgentLoop(ctx, agent, opts)
+		if err != nil {
+			return fmt.Sprintf("Retry failed: %v", err)
+		}
+		return response
+
+	case "/branch":
+		if len(args) == 0 {
+			return formatBranches(sessions, root)
+		}
+		if len(args) > 1 {
+			return "Usage: /branch [name]"
+		}
+		name := args[0]
+		if name == session.MainBranch || sessions.Get(session.BranchKey(root, name)) != nil {
+			if err := sessions.SwitchBranch(root, name); err != nil {
+				return fmt.Sprintf("Failed to switch branch: %v", err)
+			}
+			return fmt.Sprintf("Switched to branch %s.", name)
+		}
+		if _, err := sessions.Fork(root, name, 0); err != nil {
+			return fmt.Sprintf("Failed to create branch: %v", err)
+		}
+		if err := sessions.SwitchBranch(root, name); err != nil {
+			return fmt.Sprintf("Failed to switch branch: %v", err)
+		}
+		_, from := session.SplitBranchKey(key)
+		return fmt.Sprintf("Created branch %s from %s and switched to it.", name, from)
+	}
+
+	return ""
+}
+
+// formatBranches lists the branches of root, marking the active one.
+func formatBranches(sessions *session.SessionManager, root string) string {
+	branches, err := sessions.Branches(root)
+	if err != nil {
+		return fmt.Sprintf("Failed to list branches: %v", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Branches:")
+	for _, b := range branches {
+		mark := " "
+		if b.Active {
+			mark = "*"
+		}
+		fmt.Fprintf(&sb, "\n%s %s: %s", mark, b.Name, plural(b.Messages, "message"))
+		if b.Parent != "" {
+			fmt.Fprintf(&sb, ", forked from %s at turn %d", b.Parent, b.ForkTurn)
+		}
+	}
+	return sb.String()
+}
+
+// countTurns returns how many distinct turns messages span.
+func countTurns(messages []session.Message) int {
+	n, last := 0, -1
+	for _, m := range messages {
+		if m.Turn != last {
+			n, last = n+1, m.Turn
+		}
+	}
+	return n
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
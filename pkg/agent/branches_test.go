@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// echoReply answers with the last message and the model asked.
+func echoReply(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{Content: fmt.Sprintf("%s (%s)", messages[len(messages)-1].Content, model)}, nil
+}
+
+func TestBranchCommands_UndoAndRetry(t *testing.T) {
+	provider := &scriptedProvider{reply: echoReply}
+	al, _ := newTestLoop(t, provider, nil)
+	agent := al.registry.GetDefaultAgent()
+	key := "agent:main:test-branch"
+	send := func(content string) string {
+		t.Helper()
+		response, err := al.ProcessDirect(context.Background(), content, key, "")
+		if err != nil {
+			t.Fatalf("ProcessDirect(%q) error: %v", content, err)
+		}
+		return response
+	}
+
+	send("one")
+	send("two")
+	if got := send("/undo"); !strings.Contains(got, "1 turn") {
+		t.Errorf("/undo = %q", got)
+	}
+	if history := agent.Sessions.GetHistory(key); len(history) != 2 || history[0].Content != "one" {
+		t.Fatalf("history after /undo = %+v", history)
+	}
+
+	got := send("/retry other-model")
+	if got != "one (other-model)" {
+		t.Errorf("/retry = %q, want the first message answered by other-model", got)
+	}
+	if last := provider.models[len(provider.models)-1]; last != "other-model" {
+		t.Errorf("retry used model %q", last)
+	}
+	// The retried turn replaces the old one under a new turn ID.
+	messages := agent.Sessions.Get(key).Messages
+	if len(messages) != 2 || messages[1].Content != "one (other-model)" || messages[0].Turn != 3 {
+		t.Errorf("history after /retry = %+v", messages)
+	}
+
+	send("/undo 5")
+	if got := send("/undo"); got != "Nothing to undo." {
+		t.Errorf("/undo on empty history = %q", got)
+	}
+	if got := send("/retry"); got != "Nothing to retry." {
+		t.Errorf("/retry on empty history = %q", got)
+	}
+}
+
+func TestBranchCommands_CreateAndSwitch(t *testing.T) {
+	al, _ := newTestLoop(t, &scriptedProvider{reply: echoReply}, nil)
+	agent := al.registry.GetDefaultAgent()
+	key := "agent:main:test-branch"
+	send := func(content string) string {
+		t.Helper()
+		response, err := al.ProcessDirect(context.Background(), content, key, "")
+		if err != nil {
+			t.Fatalf("ProcessDirect(%q) error: %v", content, err)
+		}
+		return response
+	}
+
+	send("shared")
+	if got := send("/branch idea"); !strings.Contains(got, "Created branch idea") {
+		t.Errorf("/branch idea = %q", got)
+	}
+	send("only on idea")
+
+	if history := agent.Sessions.GetHistory(key + "#idea"); len(history) != 4 {
+		t.Errorf("idea history has %d messages, want 4", len(history))
+	}
+	if history := agent.Sessions.GetHistory(key); len(history) != 2 {
+		t.Errorf("main history has %d messages, want 2", len(history))
+	}
+
+	list := send("/branch")
+	if !strings.Contains(list, "  main: 2 messages") || !strings.Contains(list, "* idea: 4 messages, forked from main at turn 1") {
+		t.Errorf("/branch = %q", list)
+	}
+	if got := send("/branch main"); got != "Switched to branch main." {
+		t.Errorf("/branch main = %q", got)
+	}
+	if got := send("/history"); strings.Contains(got, "only on idea") {
+		t.Errorf("/history on main shows the other branch: %q", got)
+	}
+	if got := send("/branch bad#name"); !strings.Contains(got, "Failed to create branch") {
+		t.Errorf("/branch bad#name = %q", got)
+	}
+}
+
+func TestProcessDirect_ForksBranch(t *testing.T) {
+	al, _ := newTestLoop(t, &scriptedProvider{reply: echoReply}, nil)
+	agent := al.registry.GetDefaultAgent()
+	key := "agent:main:test-branch"
+
+	if _, err := al.ProcessDirect(context.Background(), "shared", key, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := al.ProcessDirect(context.Background(), "api only", key, "api"); err != nil {
+		t.Fatal(err)
+	}
+
+	if history := agent.Sessions.GetHistory(key + "#api"); len(history) != 4 || history[0].Content != "shared" {
+		t.Errorf("forked history = %+v", history)
+	}
+	// An explicit branch does not change the active one.
+	if got := agent.Sessions.ActiveBranch(key); got != "main" {
+		t.Errorf("active branch = %q, want main", got)
+	}
+	if history := agent.Sessions.GetHistory(key); len(history) != 2 {
+		t.Errorf("main history has %d messages, want 2", len(history))
+	}
+}
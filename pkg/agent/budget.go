@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+const (
+	// defaultContextWindow is assumed for models without context_window in
+	// model_list and not in knownContextWindows.
+	defaultContextWindow = 32768
+	// messageOverheadTokens covers the role and framing of each message.
+	messageOverheadTokens = 4
+	// imageTokens is a rough cost of one image input.
+	imageTokens = 1000
+)
+
+// knownContextWindows maps model ID prefixes to context windows, checked in
+// order so longer prefixes come first.
+var knownContextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4.1", 1047576},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"gpt-5", 400000},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+	{"gemini", 1048576},
+	{"deepseek", 128000},
+	{"glm-4", 128000},
+	{"qwen", 131072},
+	{"moonshot", 128000},
+	{"kimi", 131072},
+	{"llama-3", 131072},
+	{"llama3", 131072},
+	{"mistral", 32768},
+}
+
+// resolveContextBudget returns the context window and tokenizer of model,
+// from its model_list entry when it has one.
+func resolveContextBudget(cfg *config.Config, model string) (int, tokenizer.Tokenizer) {
+	modelID := model
+	window, encoding := 0, ""
+	if cfg != nil {
+		if mc, err := cfg.GetModelConfig(model); err == nil {
+			_, modelID = providers.ExtractProtocol(mc.Model)
+			window, encoding = mc.ContextWindow, mc.Tokenizer
+		}
+	}
+	if i := strings.LastIndex(modelID, "/"); i >= 0 {
+		modelID = modelID[i+1:]
+	}
+
+	if window <= 0 {
+		window = defaultContextWindow
+		lower := strings.ToLower(modelID)
+		for _, known := range knownContextWindows {
+			if strings.HasPrefix(lower, known.prefix) {
+				window = known.tokens
+				break
+			}
+		}
+	}
+	return window, tokenizer.ForName(encoding)
+}
+
+// SetContextBudget enables context budgeting: BuildMessages drops the oldest
+// turns of history once the request would leave fewer than maxOutput tokens
+// of the window for the reply.
+func (cb *ContextBuilder) SetContextBudget(window, maxOutput int, tk tokenizer.Tokenizer) {
+	cb.contextWindow = window
+	cb.maxOutput = maxOutput
+	cb.tokenizer = tk
+}
+
+// CountTokens returns the tokens messages take up in a request.
+func (cb *ContextBuilder) CountTokens(messages []providers.Message) int {
+	total := 0
+	for _, m := range messages {
+		total += cb.messageTokens(m)
+	}
+	return total
+}
+
+func (cb *ContextBuilder) messageTokens(m providers.Message) int {
+	tk := cb.tokenizer
+	if tk == nil {
+		tk = tokenizer.ForName(tokenizer.Heuristic)
+	}
+
+	n := messageOverheadTokens + tk.Count(m.Content)
+	for _, p := range m.Parts {
+		if p.Type == providers.PartImage {
+			n += imageTokens
+		}
+	}
+	for _, tc := range m.ToolCalls {
+		if tc.Function != nil {
+			n += tk.Count(tc.Function.Name) + tk.Count(tc.Function.Arguments)
+		} else {
+			args, _ := json.Marshal(tc.Arguments)
+			n += tk.Count(tc.Name) + tk.Count(string(args))
+		}
+	}
+	return n
+}
+
+// toolTokens returns the tokens taken by the tool schemas sent with each
+// request.
+func (cb *ContextBuilder) toolTokens() int {
+	if cb.tools == nil || cb.tokenizer == nil {
+		return 0
+	}
+	defs := cb.tools.ToProviderDefs()
+	if len(defs) == 0 {
+		return 0
+	}
+	data, _ := json.Marshal(defs)
+	return cb.tokenizer.Count(string(data))
+}
+
+// FitBudget drops whole turns from the start of the history until messages,
+// the tool schemas and the reply fit the context window. The system prompt
+// and the current turn, from the last user message on, are always kept.
+func (cb *ContextBuilder) FitBudget(messages []providers.Message) []providers.Message {
+	if cb.contextWindow <= 0 || len(messages) < 2 || messages[0].Role != "system" {
+		return messages
+	}
+
+	budget := cb.contextWindow - cb.maxOutput - cb.toolTokens()
+	total := cb.CountTokens(messages)
+	if total <= budget {
+		return messages
+	}
+
+	current := len(messages)
+	for i := len(messages) - 1; i > 0; i-- {
+		if messages[i].Role == "user" {
+			current = i
+			break
+		}
+	}
+
+	keep := 1
+	for total > budget && keep < current {
+		end := keep + 1
+		for end < current && messages[end].Role != "user" {
+			end++
+		}
+		total -= cb.CountTokens(messages[keep:end])
+		keep = end
+	}
+
+	dropped := keep - 1
+	if dropped == 0 {
+		logger.WarnCF("agent", "Current turn alone exceeds the context budget",
+			map[string]interface{}{
+				"tokens": total,
+				"budget": budget,
+			})
+		return messages
+	}
+
+	system := messages[0]
+	system.Content += fmt.Sprintf("\n\n[%d earlier messages were left out to fit the context window]", dropped)
+	fitted := append([]providers.Message{system}, messages[keep:]...)
+
+	logger.InfoCF("agent", "Trimmed history to fit the context window",
+		map[string]interface{}{
+			"dropped_msgs": dropped,
+			"tokens":       total,
+			"budget":       budget,
+		})
+	return fitted
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+func TestResolveContextBudget(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "small", Model: "openai/my-model", ContextWindow: 1000, Tokenizer: "heuristic"},
+			{ModelName: "sonnet", Model: "anthropic/claude-sonnet-4.6"},
+		},
+	}
+
+	tests := []struct {
+		model  string
+		window int
+	}{
+		{"small", 1000},
+		{"sonnet", 200000},
+		{"gpt-4o-mini", 128000},
+		{"openrouter/google/gemini-2.5-pro", 1048576},
+		{"some-local-model", defaultContextWindow},
+	}
+	for _, tt := range tests {
+		window, _ := resolveContextBudget(cfg, tt.model)
+		if window != tt.window {
+			t.Errorf("resolveContextBudget(%q) window = %d, want %d", tt.model, window, tt.window)
+		}
+	}
+
+	if _, tk := resolveContextBudget(cfg, "small"); tk.Name() != tokenizer.Heuristic {
+		t.Errorf("tokenizer = %s, want heuristic", tk.Name())
+	}
+}
+
+func TestBuildMessages_FitsContextBudget(t *testing.T) {
+	cb := NewContextBuilder(t.TempDir())
+	tk := tokenizer.ForName(tokenizer.Heuristic)
+
+	filler := strings.Repeat("word ", 400) // ~500 tokens
+	history := []providers.Message{
+		{Role: "user", Content: "first " + filler},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{
+			ID: "1", Type: "function",
+			Function: &providers.FunctionCall{Name: "read_file", Arguments: `{"path":"a.txt"}`},
+		}}},
+		{Role: "tool", Content: filler, ToolCallID: "1"},
+		{Role: "assistant", Content: "done"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", Content: "ok"},
+	}
+
+	// Without a budget everything is sent.
+	unbounded := cb.BuildMessages(history, "", "third", nil, "", "")
+	if len(unbounded) != len(history)+2 {
+		t.Fatalf("len(messages) = %d without budget", len(unbounded))
+	}
+
+	system := cb.CountTokens(unbounded[:1])
+	cb.SetContextBudget(system+400, 200, tk)
+	messages := cb.BuildMessages(history, "", "third", nil, "", "")
+
+	// The whole first turn, tool call and result included, is dropped.
+	if len(messages) != 4 {
+		t.Fatalf("roles = %v, want system + second turn + current", roles(messages))
+	}
+	if messages[1].Content != "second" || messages[3].Content != "third" {
+		t.Errorf("kept = %v", roles(messages))
+	}
+	if !strings.Contains(messages[0].Content, "4 earlier messages were left out") {
+		t.Error("system prompt does not mention the dropped messages")
+	}
+	if n := cb.CountTokens(messages); n > system+400-200+20 {
+		t.Errorf("fitted request is %d tokens, over budget", n)
+	}
+}
+
+func TestFitBudget_KeepsCurrentTurn(t *testing.T) {
+	cb := NewContextBuilder(t.TempDir())
+	cb.SetContextBudget(100, 50, tokenizer.ForName(tokenizer.Heuristic))
+
+	messages := []providers.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: strings.Repeat("long ", 200)},
+	}
+	if got := cb.FitBudget(messages); len(got) != 2 {
+		t.Errorf("FitBudget dropped the current turn: %v", roles(got))
+	}
+}
+
+func roles(messages []providers.Message) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		out[i] = m.Role
+	}
+	return out
+}
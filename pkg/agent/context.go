@@ -11,14 +11,26 @@ import (
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
+// defaultMemoryTopK is how many memory snippets the prompt carries when
+// agents.defaults.memory_top_k is unset.
+const defaultMemoryTopK = 5
+
 type ContextBuilder struct {
 	workspace    string
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
+	memoryTopK   int
 	tools        *tools.ToolRegistry // Direct reference to tool registry
+	now          func() time.Time    // Clock for the prompt's current time; replays pin it to the recording
+
+	// Context budgeting, see SetContextBudget
+	contextWindow int
+	maxOutput     int
+	tokenizer     tokenizer.Tokenizer
 }
 
 func getGlobalConfigDir() string {
@@ -40,21 +52,37 @@ func NewContextBuilder(workspace string) *ContextBuilder {
 		workspace:    workspace,
 		skillsLoader: skills.NewSkillsLoader(workspace, globalSkillsDir, builtinSkillsDir),
 		memory:       NewMemoryStore(workspace),
+		memoryTopK:   defaultMemoryTopK,
+		now:          time.Now,
+	}
+}
+
+// SetMemoryTopK sets how many memory snippets are retrieved into the
+// system prompt. Values below 1 keep the default.
+func (cb *ContextBuilder) SetMemoryTopK(k int) {
+	if k > 0 {
+		cb.memoryTopK = k
 	}
 }
 
+// SetSkillsFilter limits the skills offered in the system prompt to those
+// matching patterns; nil offers all.
+func (cb *ContextBuilder) SetSkillsFilter(patterns []string) {
+	cb.skillsLoader.SetFilter(patterns)
+}
+
 // SetToolsRegistry sets the tools registry for dynamic tool summary generation.
 func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 	cb.tools = registry
 }
 
-func (cb *ContextBuilder) getIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
+func (cb *ContextBuilder) getIdentity(registry *tools.ToolRegistry) string {
+	now := cb.now().Format("2006-01-02 15:04 (Monday)")
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
 	runtime := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
 
 	// Build tools section dynamically
-	toolsSection := cb.buildToolsSection()
+	toolsSection := buildToolsSection(registry)
 
 	return fmt.Sprintf(`# picoclaw 🦞
 
@@ -78,18 +106,28 @@ Your workspace is at: %s
 
 1. **ALWAYS use tools** - When you need to perform an action (schedule reminders, send messages, execute commands, etc.), you MUST call the appropriate tool. Do NOT just say you'll do it or pretend to do it.
 
-2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
+2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.%s`,
+		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, memoryRule(registry))
+}
 
-3. **Memory** - When remembering something, write to %s/memory/MEMORY.md`,
-		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
+// memoryRule returns the rule on using the memory tools, for agents that
+// have them.
+func memoryRule(registry *tools.ToolRegistry) string {
+	if registry == nil {
+		return ""
+	}
+	if _, ok := registry.Get("memory_write"); !ok {
+		return ""
+	}
+	return "\n\n3. **Memory** - When remembering something, use the memory_write tool. Memories relevant to the current message are included below; use memory_search to find others."
 }
 
-func (cb *ContextBuilder) buildToolsSection() string {
-	if cb.tools == nil {
+func buildToolsSection(registry *tools.ToolRegistry) string {
+	if registry == nil {
 		return ""
 	}
 
-	summaries := cb.tools.GetSummaries()
+	summaries := registry.GetSummaries()
 	if len(summaries) == 0 {
 		return ""
 	}
@@ -106,11 +144,29 @@ func (cb *ContextBuilder) buildToolsSection() string {
 	return sb.String()
 }
 
-func (cb *ContextBuilder) BuildSystemPrompt() string {
+// BuildSystemPrompt assembles the system prompt. query is the message being
+// answered; it selects which memory snippets are included.
+func (cb *ContextBuilder) BuildSystemPrompt(query string) string {
+	return cb.buildSystemPrompt(query, cb.tools)
+}
+
+// BuildSubagentPrompt assembles the system prompt of a subagent working on
+// task with the tools in registry.
+func (cb *ContextBuilder) BuildSubagentPrompt(task string, registry *tools.ToolRegistry) string {
+	return cb.buildSystemPrompt(task, registry) + `
+
+---
+
+# Subagent
+
+You are running as a subagent: another agent gave you the task in the next message. Nobody will answer questions, so complete the task independently with your tools, then reply with a clear, self-contained summary of the result for that agent.`
+}
+
+func (cb *ContextBuilder) buildSystemPrompt(query string, registry *tools.ToolRegistry) string {
 	parts := []string{}
 
 	// Core identity section
-	parts = append(parts, cb.getIdentity())
+	parts = append(parts, cb.getIdentity(registry))
 
 	// Bootstrap files
 	bootstrapContent := cb.LoadBootstrapFiles()
@@ -129,7 +185,7 @@ The following skills extend your capabilities. To use a skill, read its SKILL.md
 	}
 
 	// Memory context
-	memoryContext := cb.memory.GetMemoryContext()
+	memoryContext := cb.memory.GetMemoryContext(query, cb.memoryTopK)
 	if memoryContext != "" {
 		parts = append(parts, "# Memory\n\n"+memoryContext)
 	}
@@ -160,7 +216,7 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string) []providers.Message {
 	messages := []providers.Message{}
 
-	systemPrompt := cb.BuildSystemPrompt()
+	systemPrompt := cb.BuildSystemPrompt(memoryQuery(history, currentMessage))
 
 	// Add Current Session info if provided
 	if channel != "" && chatID != "" {
@@ -199,13 +255,31 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	messages = append(messages, history...)
 
 	if strings.TrimSpace(currentMessage) != "" {
-		messages = append(messages, providers.Message{
+		userMsg := providers.Message{
 			Role:    "user",
 			Content: currentMessage,
-		})
+		}
+		if images := loadImageParts(media); len(images) > 0 {
+			userMsg.Parts = append([]providers.ContentPart{{Type: providers.PartText, Text: currentMessage}}, images...)
+		}
+		messages = append(messages, userMsg)
 	}
 
-	return messages
+	return cb.FitBudget(messages)
+}
+
+// memoryQuery is the text memory retrieval runs against: the current
+// message, or the last user message when retrying without one.
+func memoryQuery(history []providers.Message, currentMessage string) string {
+	if strings.TrimSpace(currentMessage) != "" {
+		return currentMessage
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			return history[i].Content
+		}
+	}
+	return ""
 }
 
 func sanitizeHistoryForProvider(history []providers.Message) []providers.Message {
@@ -270,7 +344,7 @@ func (cb *ContextBuilder) AddAssistantMessage(messages []providers.Message, cont
 }
 
 func (cb *ContextBuilder) loadSkills() string {
-	allSkills := cb.skillsLoader.ListSkills()
+	allSkills := cb.skillsLoader.AvailableSkills()
 	if len(allSkills) == 0 {
 		return ""
 	}
@@ -288,16 +362,17 @@ func (cb *ContextBuilder) loadSkills() string {
 	return "# Skill Definitions\n\n" + content
 }
 
-// GetSkillsInfo returns information about loaded skills.
+// GetSkillsInfo returns information about loaded skills: how many are
+// installed, and how many and which of them the agent is offered.
 func (cb *ContextBuilder) GetSkillsInfo() map[string]interface{} {
-	allSkills := cb.skillsLoader.ListSkills()
-	skillNames := make([]string, 0, len(allSkills))
-	for _, s := range allSkills {
+	available := cb.skillsLoader.AvailableSkills()
+	skillNames := make([]string, 0, len(available))
+	for _, s := range available {
 		skillNames = append(skillNames, s.Name)
 	}
 	return map[string]interface{}{
-		"total":     len(allSkills),
-		"available": len(allSkills),
+		"total":     len(cb.skillsLoader.ListSkills()),
+		"available": len(available),
 		"names":     skillNames,
 	}
 }
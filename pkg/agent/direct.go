@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// DirectRequest is a message submitted to a specific agent from outside the
+// chat channels, such as through the OpenAI-compatible API.
+type DirectRequest struct {
+	AgentID    string // Empty means the default agent
+	SessionKey string // Conversation to continue, scoped to the agent
+	Branch     string // Branch of the conversation; a new name forks the active branch. Empty means the active branch
+	Content    string
+	Channel    string // Reported to tools and usage accounting
+	ChatID     string
+
+	// OnDelta, when set, receives the reply text as the LLM streams it.
+	OnDelta func(delta string)
+}
+
+// AgentIDs returns the IDs of all configured agents, sorted.
+func (al *AgentLoop) AgentIDs() []string {
+	ids := al.registry.ListAgentIDs()
+	sort.Strings(ids)
+	return ids
+}
+
+// DefaultAgentID returns the ID of the agent that handles unrouted messages.
+func (al *AgentLoop) DefaultAgentID() string {
+	return al.registry.GetDefaultAgent().ID
+}
+
+// ProcessRequest runs a full agent turn, with tools and session history,
+// for req and returns the final reply. It waits for any turn already
+// running on the same session, from a channel or another request.
+func (al *AgentLoop) ProcessRequest(ctx context.Context, req DirectRequest) (string, error) {
+	agent := al.registry.GetDefaultAgent()
+	if req.AgentID != "" {
+		var ok bool
+		if agent, ok = al.registry.GetAgent(req.AgentID); !ok {
+			return "", fmt.Errorf("unknown agent: %s", req.AgentID)
+		}
+	}
+
+	root := fmt.Sprintf("agent:%s:%s", agent.ID, req.SessionKey)
+	unlock, err := al.sessionLocks.lock(ctx, root)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	sessionKey, err := al.branchKey(agent, root, req.Branch)
+	if err != nil {
+		return "", err
+	}
+
+	return al.runAgentLoop(ctx, agent, processOptions{
+		SessionKey:      sessionKey,
+		Channel:         req.Channel,
+		ChatID:          req.ChatID,
+		UserMessage:     req.Content,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		EnableSummary:   true,
+		OnDelta:         req.OnDelta,
+	})
+}
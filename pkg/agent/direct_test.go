@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func TestProcessRequest_StreamsDeltasAndKeepsHistory(t *testing.T) {
+	provider := &scriptedProvider{reply: func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		return &providers.LLMResponse{Content: "Hello, world"}, nil
+	}}
+	// Channel streaming is off; OnDelta streams regardless.
+	al, _ := newTestLoop(t, provider, withStreaming(false))
+
+	var deltas []string
+	reply, err := al.ProcessRequest(context.Background(), DirectRequest{
+		SessionKey: "api:alice",
+		Content:    "hi",
+		Channel:    "api",
+		ChatID:     "alice",
+		OnDelta:    func(d string) { deltas = append(deltas, d) },
+	})
+	if err != nil {
+		t.Fatalf("ProcessRequest() error: %v", err)
+	}
+	if reply != "Hello, world" || len(deltas) != 2 || strings.Join(deltas, "") != "Hello, world" {
+		t.Errorf("reply = %q, deltas = %q", reply, deltas)
+	}
+
+	history := al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:api:alice")
+	if len(history) != 2 || history[0].Content != "hi" {
+		t.Errorf("history = %+v, want the user message and the reply", history)
+	}
+}
+
+func TestProcessRequest_UnknownAgent(t *testing.T) {
+	al, _ := newTestLoop(t, &scriptedProvider{}, nil)
+	if _, err := al.ProcessRequest(context.Background(), DirectRequest{AgentID: "ghost", Content: "hi"}); err == nil {
+		t.Error("ProcessRequest() should fail for an unknown agent")
+	}
+}
+
+func TestProcessRequest_SerializesSession(t *testing.T) {
+	var active, peak atomic.Int32
+	al, _ := newTestLoop(t, &scriptedProvider{reply: func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		if n > peak.Load() {
+			peak.Store(n)
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &providers.LLMResponse{Content: "ok"}, nil
+	}}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A new branch forks on first use, which must not race either.
+			if _, err := al.ProcessRequest(context.Background(), DirectRequest{SessionKey: "api:alice", Branch: "b", Content: "hi"}); err != nil {
+				t.Errorf("ProcessRequest() error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := peak.Load(); peak != 1 {
+		t.Errorf("%d turns ran on the session at once, want 1", peak)
+	}
+	history := al.registry.GetDefaultAgent().Sessions.GetHistory(session.BranchKey("agent:main:api:alice", "b"))
+	if len(history) != 8 {
+		t.Errorf("history has %d messages, want 8", len(history))
+	}
+}
+
+func TestDeltaStream_SeparatesCalls(t *testing.T) {
+	var out strings.Builder
+	d := &deltaStream{onDelta: func(s string) { out.WriteString(s) }}
+
+	d.Reset()
+	d.OnChunk(providers.StreamChunk{ContentDelta: "Checking"})
+	d.Reset() // tool call, next LLM call
+	d.Reset() // fallback attempt resets again
+	d.OnChunk(providers.StreamChunk{ContentDelta: ""})
+	d.OnChunk(providers.StreamChunk{ContentDelta: "Done"})
+
+	if out.String() != "Checking\n\nDone" {
+		t.Errorf("streamed = %q", out.String())
+	}
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// defaultMaxConcurrentSessions is used when agents.defaults.max_concurrent_sessions is unset.
+const defaultMaxConcurrentSessions = 4
+
+// sessionLocks serializes turns on a session across everything that runs
+// them: the dispatcher for channel messages and ProcessRequest for the API.
+// Keys are root session keys, so a fork to a new branch is covered too.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	ch   chan struct{} // Holds a token while the session is busy
+	refs int           // Holders and waiters; the lock is dropped at zero
+}
+
+func newSessionLocks() *sessionLocks {
+	return &sessionLocks{locks: make(map[string]*sessionLock)}
+}
+
+// lock waits until no other turn runs on key, or ctx is done. On success
+// the caller must call the returned unlock.
+func (l *sessionLocks) lock(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	lk, ok := l.locks[key]
+	if !ok {
+		lk = &sessionLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lk
+	}
+	lk.refs++
+	l.mu.Unlock()
+
+	release := func() {
+		l.mu.Lock()
+		if lk.refs--; lk.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+
+	select {
+	case lk.ch <- struct{}{}:
+		return func() {
+			<-lk.ch
+			release()
+		}, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// sessionDispatcher runs inbound messages on per-session workers. Messages
+// sharing a key are handled one at a time in arrival order; messages for
+// different keys run in parallel, bounded by the size of sem. The worker
+// for a key also holds its session lock, so turns started elsewhere wait.
+type sessionDispatcher struct {
+	handle func(ctx context.Context, msg bus.InboundMessage)
+	sem    chan struct{}
+	locks  *sessionLocks
+
+	mu     sync.Mutex
+	queues map[string][]bus.InboundMessage // key -> messages waiting behind the active one
+	wg     sync.WaitGroup
+}
+
+func newSessionDispatcher(limit int, locks *sessionLocks, handle func(ctx context.Context, msg bus.InboundMessage)) *sessionDispatcher {
+	if limit <= 0 {
+		limit = defaultMaxConcurrentSessions
+	}
+	return &sessionDispatcher{
+		handle: handle,
+		sem:    make(chan struct{}, limit),
+		locks:  locks,
+		queues: make(map[string][]bus.InboundMessage),
+	}
+}
+
+// Dispatch queues msg behind any in-flight message for key, or starts a
+// worker for key if none is running.
+func (d *sessionDispatcher) Dispatch(ctx context.Context, key string, msg bus.InboundMessage) {
+	d.mu.Lock()
+	if queue, active := d.queues[key]; active {
+		d.queues[key] = append(queue, msg)
+		d.mu.Unlock()
+		return
+	}
+	d.queues[key] = nil
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go d.work(ctx, key, msg)
+}
+
+func (d *sessionDispatcher) work(ctx context.Context, key string, msg bus.InboundMessage) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case d.sem <- struct{}{}:
+			if unlock, err := d.locks.lock(ctx, key); err == nil {
+				d.handle(ctx, msg)
+				unlock()
+			} else {
+				d.dropped(key, msg)
+			}
+			<-d.sem
+		case <-ctx.Done():
+			d.dropped(key, msg)
+		}
+
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		msg = queue[0]
+		d.queues[key] = queue[1:]
+		d.mu.Unlock()
+	}
+}
+
+func (d *sessionDispatcher) dropped(key string, msg bus.InboundMessage) {
+	logger.WarnCF("agent", "Dropping queued message on shutdown",
+		map[string]interface{}{
+			"session_key": key,
+			"channel":     msg.Channel,
+			"chat_id":     msg.ChatID,
+		})
+	// The message never reaches processMessage, which would clean these up
+	removeDownloadedImages(msg.Media)
+}
+
+// Wait blocks until every worker has finished, including queued messages.
+func (d *sessionDispatcher) Wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+func TestSessionDispatcher_PreservesOrderPerSession(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+
+	d := newSessionDispatcher(4, newSessionLocks(), func(ctx context.Context, msg bus.InboundMessage) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		got = append(got, msg.Content)
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	for _, c := range []string{"1", "2", "3", "4", "5"} {
+		d.Dispatch(ctx, "session-a", bus.InboundMessage{Content: c})
+	}
+	d.Wait()
+
+	want := []string{"1", "2", "3", "4", "5"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSessionDispatcher_RunsSessionsInParallel(t *testing.T) {
+	release := make(chan struct{})
+	var running atomic.Int32
+	started := make(chan struct{}, 2)
+
+	d := newSessionDispatcher(2, newSessionLocks(), func(ctx context.Context, msg bus.InboundMessage) {
+		running.Add(1)
+		started <- struct{}{}
+		<-release
+	})
+
+	ctx := context.Background()
+	d.Dispatch(ctx, "session-a", bus.InboundMessage{Content: "a"})
+	d.Dispatch(ctx, "session-b", bus.InboundMessage{Content: "b"})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("expected both sessions to start concurrently")
+		}
+	}
+	close(release)
+	d.Wait()
+
+	if running.Load() != 2 {
+		t.Fatalf("running = %d, want 2", running.Load())
+	}
+}
+
+func TestSessionDispatcher_RespectsLimit(t *testing.T) {
+	var active, peak atomic.Int32
+
+	d := newSessionDispatcher(2, newSessionLocks(), func(ctx context.Context, msg bus.InboundMessage) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		active.Add(-1)
+	})
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		d.Dispatch(ctx, key, bus.InboundMessage{Content: key})
+	}
+	d.Wait()
+
+	if peak.Load() > 2 {
+		t.Fatalf("peak concurrency = %d, want <= 2", peak.Load())
+	}
+}
+
+func TestSessionDispatcher_DropsQueuedOnShutdown(t *testing.T) {
+	release := make(chan struct{})
+	var handled atomic.Int32
+
+	d := newSessionDispatcher(1, newSessionLocks(), func(ctx context.Context, msg bus.InboundMessage) {
+		handled.Add(1)
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Dispatch(ctx, "a", bus.InboundMessage{Content: "first"})
+	d.Dispatch(ctx, "b", bus.InboundMessage{Content: "blocked"})
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	close(release)
+	d.Wait()
+
+	if handled.Load() != 1 {
+		t.Fatalf("handled = %d, want 1", handled.Load())
+	}
+}
+
+func TestAgentLoop_StopDrainsSessions(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	provider := &scriptedProvider{reply: func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &providers.LLMResponse{Content: "reply to " + messages[len(messages)-1].Content}, nil
+	}}
+	al, msgBus := newTestLoop(t, provider, nil)
+
+	done := make(chan struct{})
+	go func() {
+		al.Run(context.Background())
+		close(done)
+	}()
+	for _, content := range []string{"one", "two", "three"} {
+		msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "u", Content: content})
+	}
+	<-started
+	time.Sleep(20 * time.Millisecond) // let Run queue the other two
+
+	al.Stop()
+	select {
+	case <-done:
+		t.Fatal("Run returned before its sessions finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, content := range []string{"one", "two", "three"} {
+		out, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok || !strings.Contains(out.Content, "reply to ") || !strings.Contains(out.Content, content) {
+			t.Fatalf("outbound = %+v, %v; want the reply to %q", out, ok, content)
+		}
+	}
+}
+
+func TestSessionDispatcher_DropRemovesDownloadedImages(t *testing.T) {
+	if err := os.MkdirAll(utils.MediaDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	img := writeTestImage(t, utils.MediaDir(), "picoclaw-test-dropped.png")
+	defer os.Remove(img)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d := newSessionDispatcher(1, newSessionLocks(), func(ctx context.Context, msg bus.InboundMessage) {
+		t.Error("handled a message after shutdown")
+	})
+	// Hold the only slot so the message can only be dropped
+	d.sem <- struct{}{}
+	d.Dispatch(ctx, "a", bus.InboundMessage{Content: "look", Media: []string{img}})
+	d.Wait()
+
+	if _, err := os.Stat(img); !os.IsNotExist(err) {
+		t.Error("expected the dropped message's image to be removed")
+	}
+}
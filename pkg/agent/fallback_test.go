@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestAgentLoop_FallbackDispatchesToCandidateProvider(t *testing.T) {
+	var primaryCalls atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		http.Error(w, `{"error":{"message":"rate limit exceeded"}}`, http.StatusTooManyRequests)
+	}))
+	defer primary.Close()
+
+	var backupModel string
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		backupModel, _ = body["model"].(string)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]interface{}{"content": "from backup"}, "finish_reason": "stop"},
+			},
+		})
+	}))
+	defer backup.Close()
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "primary",
+				ModelFallbacks:    []string{"backup"},
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "primary", Model: "openai/gpt-4o", APIKey: "k1", APIBase: primary.URL},
+			{ModelName: "backup", Model: "openai/backup-model", APIKey: "k2", APIBase: backup.URL},
+		},
+	}
+
+	// The default provider must never be used when candidates resolve to model_list entries.
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "from default"})
+
+	response, err := al.ProcessDirectWithChannel(context.Background(), "hello", "agent:main:test", "test", "chat")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+	}
+	if response != "from backup" {
+		t.Fatalf("response = %q, want %q", response, "from backup")
+	}
+	if primaryCalls.Load() != 1 {
+		t.Errorf("primary calls = %d, want 1", primaryCalls.Load())
+	}
+	if backupModel != "backup-model" {
+		t.Errorf("backup received model %q, want backup-model", backupModel)
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/trace"
 )
 
 // AgentInstance represents a fully configured agent with its own workspace,
@@ -21,16 +25,25 @@ type AgentInstance struct {
 	Fallbacks      []string
 	Workspace      string
 	MaxIterations  int
+	MaxParallel    int // Read-only tool calls of one response run at once
 	MaxTokens      int
 	Temperature    float64
-	ContextWindow  int
+	ContextWindow  int    // Model's total token window, from model_list or known defaults
+	SummaryModel   string // Model for history summaries; empty uses the agent's model
+	Tokenizer      tokenizer.Tokenizer
 	Provider       providers.LLMProvider
 	Sessions       *session.SessionManager
 	ContextBuilder *ContextBuilder
 	Tools          *tools.ToolRegistry
 	Subagents      *config.SubagentsConfig
-	SkillsFilter   []string
+	SubagentTasks  *tools.SubagentManager // Subagents this agent has started; set with the spawn tool
+	SkillsFilter   []string               // Skills this agent is offered, by name or glob pattern; nil means all
+	MCPServers     []string               // MCP servers whose tools this agent gets; nil means all
 	Candidates     []providers.FallbackCandidate
+	Traces         *trace.Store // Where turns are recorded; nil unless agents.defaults.trace is set
+
+	// ImageCandidates handle turns that carry images (agents.defaults.image_model).
+	ImageCandidates []providers.FallbackCandidate
 }
 
 // NewAgentInstance creates an agent instance from config.
@@ -48,36 +61,56 @@ func NewAgentInstance(
 
 	restrict := defaults.RestrictToWorkspace
 	toolsRegistry := tools.NewToolRegistry()
+	if agentCfg != nil && agentCfg.Tools != nil {
+		toolsRegistry.SetPolicy(&tools.ToolPolicy{Allow: agentCfg.Tools.Allow, Deny: agentCfg.Tools.Deny})
+	}
 	toolsRegistry.Register(tools.NewReadFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewWriteFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewListDirTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewExecToolWithConfig(workspace, restrict, cfg))
 	toolsRegistry.Register(tools.NewEditFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewAppendFileTool(workspace, restrict))
+	if cfg != nil && cfg.Tools.AuditLog {
+		toolsRegistry.SetAuditLog(tools.NewAuditLog(workspace))
+	}
 
-	sessionsDir := filepath.Join(workspace, "sessions")
-	sessionsManager := session.NewSessionManager(sessionsDir)
+	sessionsManager := newSessionManager(filepath.Join(workspace, "sessions"), cfg)
 
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
+	contextBuilder.SetMemoryTopK(defaults.MemoryTopK)
+	memoryFiles := contextBuilder.memory.files
+	if embedder := newMemoryEmbedder(defaults.EmbeddingModel, cfg); embedder != nil {
+		memoryFiles.Index().SetEmbedder(embedder)
+	}
+	toolsRegistry.Register(tools.NewMemorySearchTool(memoryFiles.Index()))
+	toolsRegistry.Register(tools.NewMemoryWriteTool(memoryFiles))
 
 	agentID := routing.DefaultAgentID
 	agentName := ""
 	var subagents *config.SubagentsConfig
 	var skillsFilter []string
+	var mcpServers []string
 
 	if agentCfg != nil {
 		agentID = routing.NormalizeAgentID(agentCfg.ID)
 		agentName = agentCfg.Name
 		subagents = agentCfg.Subagents
 		skillsFilter = agentCfg.Skills
+		mcpServers = agentCfg.MCP
 	}
+	contextBuilder.SetSkillsFilter(skillsFilter)
 
 	maxIter := defaults.MaxToolIterations
 	if maxIter == 0 {
 		maxIter = 20
 	}
 
+	maxParallel := defaults.MaxParallelTools
+	if maxParallel == 0 {
+		maxParallel = 4
+	}
+
 	maxTokens := defaults.MaxTokens
 	if maxTokens == 0 {
 		maxTokens = 8192
@@ -94,6 +127,21 @@ func NewAgentInstance(
 		Fallbacks: fallbacks,
 	}
 	candidates := providers.ResolveCandidates(modelCfg, defaults.Provider)
+	var imageCandidates []providers.FallbackCandidate
+	if imageModel := strings.TrimSpace(defaults.ImageModel); imageModel != "" {
+		imageCandidates = providers.ResolveCandidates(providers.ModelConfig{
+			Primary:   imageModel,
+			Fallbacks: defaults.ImageModelFallbacks,
+		}, defaults.Provider)
+	}
+
+	var traces *trace.Store
+	if defaults.Trace {
+		traces = trace.NewStore(workspace, defaults.MaxTraces)
+	}
+
+	contextWindow, tk := resolveContextBudget(cfg, model)
+	contextBuilder.SetContextBudget(contextWindow, maxTokens, tk)
 
 	return &AgentInstance{
 		ID:             agentID,
@@ -102,16 +150,23 @@ func NewAgentInstance(
 		Fallbacks:      fallbacks,
 		Workspace:      workspace,
 		MaxIterations:  maxIter,
+		MaxParallel:    maxParallel,
 		MaxTokens:      maxTokens,
 		Temperature:    temperature,
-		ContextWindow:  maxTokens,
+		ContextWindow:  contextWindow,
+		SummaryModel:   strings.TrimSpace(defaults.SummaryModel),
+		Tokenizer:      tk,
 		Provider:       provider,
 		Sessions:       sessionsManager,
 		ContextBuilder: contextBuilder,
 		Tools:          toolsRegistry,
 		Subagents:      subagents,
 		SkillsFilter:   skillsFilter,
+		MCPServers:     mcpServers,
 		Candidates:     candidates,
+		Traces:         traces,
+
+		ImageCandidates: imageCandidates,
 	}
 }
 
@@ -157,3 +212,68 @@ func expandHome(path string) string {
 	}
 	return path
 }
+
+// OpenSessionManagers opens the session store of every configured agent,
+// keyed by agent ID, without building the agents themselves.
+func OpenSessionManagers(cfg *config.Config) map[string]*session.SessionManager {
+	agentConfigs := cfg.Agents.List
+	if len(agentConfigs) == 0 {
+		agentConfigs = []config.AgentConfig{{ID: "main", Default: true}}
+	}
+
+	managers := make(map[string]*session.SessionManager, len(agentConfigs))
+	for i := range agentConfigs {
+		ac := &agentConfigs[i]
+		workspace := resolveAgentWorkspace(ac, &cfg.Agents.Defaults)
+		managers[routing.NormalizeAgentID(ac.ID)] = newSessionManager(filepath.Join(workspace, "sessions"), cfg)
+	}
+	return managers
+}
+
+// newSessionManager opens the session store configured under "session",
+// falling back to JSON files if it can't be opened.
+func newSessionManager(dir string, cfg *config.Config) *session.SessionManager {
+	var sessionCfg config.SessionConfig
+	if cfg != nil {
+		sessionCfg = cfg.Session
+	}
+
+	store, err := session.OpenStore(sessionCfg.Store, dir)
+	if err != nil {
+		logger.WarnCF("agent", "Failed to open session store, using JSON files",
+			map[string]interface{}{
+				"store": sessionCfg.Store,
+				"error": err.Error(),
+			})
+		store = session.NewJSONStore(dir)
+	}
+
+	sm := session.NewSessionManagerWithStore(store)
+	sm.SetRetention(session.RetentionPolicy{
+		MaxAge:      time.Duration(sessionCfg.MaxAgeDays) * 24 * time.Hour,
+		MaxMessages: sessionCfg.MaxMessages,
+	})
+	return sm
+}
+
+// newMemoryEmbedder returns the embedding client for the model_list entry
+// named by agents.defaults.embedding_model, or nil to search memory by
+// keywords only.
+func newMemoryEmbedder(modelName string, cfg *config.Config) *providers.EmbeddingClient {
+	if modelName == "" || cfg == nil {
+		return nil
+	}
+	modelCfg, err := cfg.GetModelConfig(modelName)
+	if err == nil {
+		var client *providers.EmbeddingClient
+		if client, err = providers.NewEmbeddingClient(modelCfg); err == nil {
+			return client
+		}
+	}
+	logger.WarnCF("agent", "Memory embeddings disabled",
+		map[string]interface{}{
+			"embedding_model": modelName,
+			"error":           err.Error(),
+		})
+	return nil
+}
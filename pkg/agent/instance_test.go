@@ -2,9 +2,12 @@ package agent
 
 import (
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
 func TestNewAgentInstance_UsesDefaultsTemperatureAndMaxTokens(t *testing.T) {
@@ -93,3 +96,37 @@ func TestNewAgentInstance_DefaultsTemperatureWhenUnset(t *testing.T) {
 		t.Fatalf("Temperature = %f, want %f", agent.Temperature, 0.7)
 	}
 }
+
+func TestNewAgentInstance_ToolPolicy(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: t.TempDir(), Model: "test-model"},
+			List: []config.AgentConfig{
+				{ID: "private", Default: true, Tools: &config.AgentToolsConfig{Deny: []string{"i2c", "spi"}}},
+				{ID: "public", Tools: &config.AgentToolsConfig{Allow: []string{"web_*", "read_file"}}},
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	al.RegisterTool(tools.NewCronTool(nil, nil, nil, "", false, 0, cfg))
+
+	private, _ := al.registry.GetAgent("private")
+	if _, ok := private.Tools.Get("exec"); !ok {
+		t.Error("private agent lost exec")
+	}
+	if _, ok := private.Tools.Get("cron"); !ok {
+		t.Error("private agent did not get cron")
+	}
+	if _, ok := private.Tools.Get("i2c"); ok {
+		t.Error("private agent got i2c")
+	}
+
+	public, _ := al.registry.GetAgent("public")
+	if got := strings.Join(public.Tools.List(), ","); got != "read_file,web_fetch" {
+		t.Errorf("public agent tools = %s", got)
+	}
+	prompt := public.ContextBuilder.BuildSystemPrompt("")
+	if !strings.Contains(prompt, "`read_file`") || strings.Contains(prompt, "`exec`") || strings.Contains(prompt, "memory_write") {
+		t.Errorf("public agent prompt advertises the wrong tools:\n%s", prompt)
+	}
+}
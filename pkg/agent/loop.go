@@ -10,21 +10,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mcp"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/trace"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -34,21 +37,36 @@ type AgentLoop struct {
 	registry       *AgentRegistry
 	state          *state.Manager
 	running        atomic.Bool
+	stop           chan struct{} // Closed by Stop
+	stopOnce       sync.Once
 	summarizing    sync.Map
 	fallback       *providers.FallbackChain
+	providers      *providers.ProviderPool
+	ledger         *usage.Ledger
+	prices         usage.PriceTable
+	mcp            *mcp.Manager
 	channelManager *channels.Manager
+	approvals      *approvals
+	sessionLocks   *sessionLocks
+	models         sync.Map // Conversation (root session key) -> model chosen with /switch model
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string // Session identifier for history/context
-	Channel         string // Target channel for tool execution
-	ChatID          string // Target chat ID for tool execution
-	UserMessage     string // User message content (may include prefix)
-	DefaultResponse string // Response when LLM returns empty
-	EnableSummary   bool   // Whether to trigger summarization
-	SendResponse    bool   // Whether to send response via bus
-	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SessionKey      string       // Session identifier for history/context
+	SenderID        string       // User the message came from, for the tool audit log
+	Channel         string       // Target channel for tool execution
+	ChatID          string       // Target chat ID for tool execution
+	UserMessage     string       // User message content (may include prefix)
+	DefaultResponse string       // Response when LLM returns empty
+	EnableSummary   bool         // Whether to trigger summarization
+	SendResponse    bool         // Whether to send response via bus
+	NoHistory       bool         // If true, don't load session history (for heartbeat)
+	Stream          bool         // Whether to stream partial replies to the channel
+	ModelOverride   string       // Model to use instead of the candidates: a /retry choice, or the budget downgrade
+	Media           []string     // Local paths or URLs of media attached to the user message
+	OnDelta         func(string) // Receives reply text as it streams, instead of the channel
+	Trace           *trace.Trace // Records the turn; set by a replay, otherwise by runAgentLoop when tracing is on
 }
 
 func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
@@ -64,18 +82,44 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	// Create state manager using default agent's workspace for channel recording
 	defaultAgent := registry.GetDefaultAgent()
 	var stateManager *state.Manager
+	var ledger *usage.Ledger
 	if defaultAgent != nil {
 		stateManager = state.NewManager(defaultAgent.Workspace)
+		ledger = usage.NewLedger(defaultAgent.Workspace)
 	}
 
-	return &AgentLoop{
-		bus:         msgBus,
-		cfg:         cfg,
-		registry:    registry,
-		state:       stateManager,
-		summarizing: sync.Map{},
-		fallback:    fallbackChain,
+	al := &AgentLoop{
+		bus:          msgBus,
+		cfg:          cfg,
+		registry:     registry,
+		state:        stateManager,
+		summarizing:  sync.Map{},
+		fallback:     fallbackChain,
+		providers:    providers.NewProviderPool(cfg),
+		ledger:       ledger,
+		prices:       usage.NewPriceTable(cfg.ModelList),
+		approvals:    newApprovals(cfg.Tools.Approval, msgBus),
+		stop:         make(chan struct{}),
+		sessionLocks: newSessionLocks(),
 	}
+
+	// Subagents run as the agent they are started for, with its model and
+	// tools, so they need the loop's providers and approvals.
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok && agent.SubagentTasks != nil {
+			agent.SubagentTasks.SetResolver(al.subagentResolver(agent))
+		}
+	}
+
+	// Connect to MCP servers and register their tools
+	if len(cfg.Tools.MCP.Servers) > 0 {
+		al.mcp = mcp.NewManager(cfg.Tools.MCP)
+		startCtx, cancel := context.WithTimeout(context.Background(), mcpStartTimeout)
+		al.mcp.Start(startCtx, al.registerMCPTools)
+		cancel()
+	}
+
+	return al
 }
 
 // registerSharedTools registers tools that are shared across all agents (web, message, spawn).
@@ -120,66 +164,130 @@ func registerSharedTools(cfg *config.Config, msgBus *bus.MessageBus, registry *A
 		// Spawn tool with allowlist checker
 		subagentManager := tools.NewSubagentManager(provider, agent.Model, agent.Workspace, msgBus)
 		subagentManager.SetLLMOptions(agent.MaxTokens, agent.Temperature)
+		subagentManager.SetLimits(subagentLimits(&cfg.Agents.Defaults))
+		subagentManager.SetTimeout(subagentTimeout(&cfg.Agents.Defaults))
+		agent.SubagentTasks = subagentManager
 		spawnTool := tools.NewSpawnTool(subagentManager)
 		currentAgentID := agentID
 		spawnTool.SetAllowlistChecker(func(targetAgentID string) bool {
 			return registry.CanSpawnSubagent(currentAgentID, targetAgentID)
 		})
 		agent.Tools.Register(spawnTool)
+		agent.Tools.Register(tools.NewSubagentStatusTool(subagentManager))
+		agent.Tools.Register(tools.NewSubagentCancelTool(subagentManager))
+		agent.Tools.Register(tools.NewSubagentWaitTool(subagentManager))
+
+		// Delegate tool, offering the agents this one may start
+		var delegates []string
+		for _, id := range registry.ListAgentIDs() {
+			if id != currentAgentID && registry.CanSpawnSubagent(currentAgentID, id) {
+				delegates = append(delegates, id)
+			}
+		}
+		sort.Strings(delegates)
+		delegateTool := tools.NewDelegateTool(subagentManager, delegates)
+		delegateTool.SetAllowlistChecker(func(targetAgentID string) bool {
+			return registry.CanSpawnSubagent(currentAgentID, targetAgentID)
+		})
+		agent.Tools.Register(delegateTool)
 
 		// Update context builder with the complete tools registry
 		agent.ContextBuilder.SetToolsRegistry(agent.Tools)
 	}
 }
 
+// Run consumes inbound messages until ctx is canceled or Stop is called.
+// Messages for the same session are processed in order; different sessions
+// run concurrently up to agents.defaults.max_concurrent_sessions. Run returns
+// only after all queued and in-flight sessions have finished. They run with
+// ctx, so after Stop they are drained, while canceling ctx aborts them and
+// drops the queued ones.
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
 
+	consumeCtx, stopConsuming := context.WithCancel(ctx)
+	defer stopConsuming()
+	go func() {
+		select {
+		case <-al.stop:
+			stopConsuming()
+		case <-consumeCtx.Done():
+		}
+	}()
+
+	dispatcher := newSessionDispatcher(al.cfg.Agents.Defaults.MaxConcurrentSessions, al.sessionLocks, al.handleInbound)
+	defer dispatcher.Wait()
+
 	for al.running.Load() {
 		select {
-		case <-ctx.Done():
+		case <-consumeCtx.Done():
 			return nil
 		default:
-			msg, ok := al.bus.ConsumeInbound(ctx)
+			msg, ok := al.bus.ConsumeInbound(consumeCtx)
 			if !ok {
 				continue
 			}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
+			// Approval replies are handled here, since the session they
+			// answer is busy waiting for them.
+			if al.approvals.Resolve(msg) {
+				removeDownloadedImages(msg.Media)
+				continue
 			}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				// Use default agent's tools to check (message tool is shared).
-				alreadySent := false
-				defaultAgent := al.registry.GetDefaultAgent()
-				if defaultAgent != nil {
-					if tool, ok := defaultAgent.Tools.Get("message"); ok {
-						if mt, ok := tool.(*tools.MessageTool); ok {
-							alreadySent = mt.HasSentInRound()
-						}
-					}
-				}
-
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
-				}
-			}
+			dispatcher.Dispatch(ctx, al.dispatchKey(msg), msg)
 		}
 	}
 
 	return nil
 }
 
+// handleInbound processes one inbound message and publishes the reply.
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	round := tools.NewRound()
+	ctx = tools.WithRound(ctx, round)
+	ctx, streamID := withStream(ctx)
+	defer al.endStream(msg.Channel, msg.ChatID, streamID)
+
+	response, err := al.processMessage(ctx, msg)
+	if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+	}
+
+	// Skip publishing if the message tool already replied during this round,
+	// to avoid duplicate messages to the user.
+	if response != "" && !round.MessageSent() {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  response,
+			StreamID: streamID,
+		})
+	}
+}
+
+// dispatchKey returns the session a message will be processed in, so that
+// messages sharing conversation history are never handled concurrently.
+func (al *AgentLoop) dispatchKey(msg bus.InboundMessage) string {
+	if msg.Channel == "system" {
+		return routing.BuildAgentMainSessionKey(al.registry.GetDefaultAgent().ID)
+	}
+	_, sessionKey, _ := al.resolveSession(msg)
+	return sessionKey
+}
+
+// Stop makes Run stop taking inbound messages. Run returns once the
+// sessions it has started have finished.
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	al.stopOnce.Do(func() { close(al.stop) })
+}
+
+// Close disconnects from MCP servers. Call it once no more turns run.
+func (al *AgentLoop) Close() {
+	if al.mcp != nil {
+		al.mcp.Close()
+	}
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
@@ -212,11 +320,18 @@ func (al *AgentLoop) RecordLastChatID(chatID string) error {
 	return al.state.SetLastChatID(chatID)
 }
 
-func (al *AgentLoop) ProcessDirect(ctx context.Context, content, sessionKey string) (string, error) {
-	return al.ProcessDirectWithChannel(ctx, content, sessionKey, "cli", "direct")
+// ProcessDirect processes content in sessionKey as if sent from the CLI. A
+// non-empty branch sends it to that branch of the session, forking the
+// branch from the active one on first use; "" uses the active branch.
+func (al *AgentLoop) ProcessDirect(ctx context.Context, content, sessionKey, branch string) (string, error) {
+	return al.processDirect(ctx, content, sessionKey, branch, "cli", "direct")
 }
 
 func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error) {
+	return al.processDirect(ctx, content, sessionKey, "", channel, chatID)
+}
+
+func (al *AgentLoop) processDirect(ctx context.Context, content, sessionKey, branch, channel, chatID string) (string, error) {
 	msg := bus.InboundMessage{
 		Channel:    channel,
 		SenderID:   "cron",
@@ -224,6 +339,15 @@ func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sess
 		Content:    content,
 		SessionKey: sessionKey,
 	}
+	if branch != "" {
+		msg.Metadata = map[string]string{"branch": branch}
+	}
+
+	unlock, err := al.sessionLocks.lock(ctx, al.dispatchKey(msg))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
 
 	return al.processMessage(ctx, msg)
 }
@@ -260,6 +384,9 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 			"session_key": msg.SessionKey,
 		})
 
+	// Images handed over by channels are ours to clean up once the turn is built
+	defer removeDownloadedImages(msg.Media)
+
 	// Route system messages to processSystemMessage
 	if msg.Channel == "system" {
 		return al.processSystemMessage(ctx, msg)
@@ -271,6 +398,45 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	}
 
 	// Route to determine agent and session key
+	agent, root, matchedBy := al.resolveSession(msg)
+	sessionKey, err := al.branchKey(agent, root, msg.Metadata["branch"])
+	if err != nil {
+		return "", err
+	}
+
+	logger.InfoCF("agent", "Routed message",
+		map[string]interface{}{
+			"agent_id":    agent.ID,
+			"session_key": sessionKey,
+			"matched_by":  matchedBy,
+		})
+
+	return al.runAgentLoop(ctx, agent, processOptions{
+		SessionKey:      sessionKey,
+		SenderID:        msg.SenderID,
+		Channel:         msg.Channel,
+		ChatID:          msg.ChatID,
+		UserMessage:     msg.Content,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		EnableSummary:   true,
+		SendResponse:    false,
+		Stream:          true,
+		ModelOverride:   al.switchedModel(root),
+		Media:           msg.Media,
+	})
+}
+
+// switchedModel returns the model chosen with /switch model for the
+// conversation rooted at root, or "" if none was.
+func (al *AgentLoop) switchedModel(root string) string {
+	if model, ok := al.models.Load(root); ok {
+		return model.(string)
+	}
+	return ""
+}
+
+// resolveSession picks the agent and session key for a non-system message.
+func (al *AgentLoop) resolveSession(msg bus.InboundMessage) (*AgentInstance, string, string) {
 	route := al.registry.ResolveRoute(routing.RouteInput{
 		Channel:    msg.Channel,
 		AccountID:  msg.Metadata["account_id"],
@@ -291,22 +457,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		sessionKey = msg.SessionKey
 	}
 
-	logger.InfoCF("agent", "Routed message",
-		map[string]interface{}{
-			"agent_id":    agent.ID,
-			"session_key": sessionKey,
-			"matched_by":  route.MatchedBy,
-		})
-
-	return al.runAgentLoop(ctx, agent, processOptions{
-		SessionKey:      sessionKey,
-		Channel:         msg.Channel,
-		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
-		DefaultResponse: "I've completed processing but have no response to give.",
-		EnableSummary:   true,
-		SendResponse:    false,
-	})
+	return agent, sessionKey, route.MatchedBy
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -356,6 +507,7 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 
 	return al.runAgentLoop(ctx, agent, processOptions{
 		SessionKey:      sessionKey,
+		SenderID:        msg.SenderID,
 		Channel:         originChannel,
 		ChatID:          originChatID,
 		UserMessage:     fmt.Sprintf("[System: %s] %s", msg.SenderID, msg.Content),
@@ -378,8 +530,18 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		}
 	}
 
-	// 1. Update tool contexts
-	al.updateToolContexts(agent, opts.Channel, opts.ChatID)
+	// 1. Scope tool calls to this conversation (per call, tools are shared across sessions)
+	ctx = tools.WithToolContext(ctx, opts.Channel, opts.ChatID)
+	ctx = tools.WithCaller(ctx, tools.Caller{AgentID: agent.ID, SessionKey: opts.SessionKey, SenderID: opts.SenderID})
+
+	// Enforce the session's daily token budget before spending more
+	downgrade, refusal := al.checkBudget(opts.SessionKey)
+	if refusal != "" {
+		return refusal, nil
+	}
+	if downgrade != "" {
+		opts.ModelOverride = downgrade
+	}
 
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
@@ -388,11 +550,22 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		history = agent.Sessions.GetHistory(opts.SessionKey)
 		summary = agent.Sessions.GetSummary(opts.SessionKey)
 	}
+
+	// Record the turn when tracing is on, unless the caller records it
+	var recorded *trace.Trace
+	if opts.Trace == nil && agent.Traces != nil {
+		recorded = trace.New(agent.ID, opts.SessionKey, opts.Channel, opts.ChatID, opts.UserMessage)
+		opts.Trace = recorded
+	}
+	if opts.Trace != nil {
+		opts.Trace.Media, opts.Trace.History, opts.Trace.Summary = opts.Media, history, summary
+	}
+
 	messages := agent.ContextBuilder.BuildMessages(
 		history,
 		summary,
 		opts.UserMessage,
-		nil,
+		opts.Media,
 		opts.Channel,
 		opts.ChatID,
 	)
@@ -403,6 +576,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	// 4. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, agent, messages, opts)
 	if err != nil {
+		al.saveTrace(agent, recorded, "", err)
 		return "", err
 	}
 
@@ -417,6 +591,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	// 6. Save final assistant message to session
 	agent.Sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
 	agent.Sessions.Save(opts.SessionKey)
+	al.saveTrace(agent, recorded, finalContent, nil)
 
 	// 7. Optional: summarization
 	if opts.EnableSummary {
@@ -449,6 +624,10 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance, messages []providers.Message, opts processOptions) (string, int, error) {
 	iteration := 0
 	var finalContent string
+	stream := al.streamPublisherFor(ctx, opts)
+
+	// Turns carrying images go to the image model when one is configured
+	imageTurn := len(agent.ImageCandidates) > 0 && hasImages(messages)
 
 	for iteration < agent.MaxIterations {
 		iteration++
@@ -460,6 +639,11 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 				"max":       agent.MaxIterations,
 			})
 
+		// Tool results of earlier iterations may have outgrown the window
+		if iteration > 1 {
+			messages = agent.ContextBuilder.FitBudget(messages)
+		}
+
 		// Build tool definitions
 		providerToolDefs := agent.Tools.ToProviderDefs()
 
@@ -487,15 +671,63 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 		// Call LLM with fallback chain if candidates are configured.
 		var response *providers.LLMResponse
 		var err error
+		var usedModel, usedModelID string // for usage accounting
+		var usedProvider string           // for error classification
 
 		callLLM := func() (*providers.LLMResponse, error) {
+			var onChunk providers.StreamCallback
+			if stream != nil {
+				stream.Reset()
+				onChunk = stream.OnChunk
+			}
+
+			if imageTurn && al.fallback != nil {
+				fbResult, fbErr := al.fallback.ExecuteImage(ctx, agent.ImageCandidates,
+					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
+						if stream != nil {
+							stream.Reset()
+						}
+						llm, modelID, err := al.resolveCandidate(agent, agent.ImageCandidates, provider, model, model)
+						if err != nil {
+							return nil, err
+						}
+						usedProvider, usedModel, usedModelID = provider, candidateModel(agent, provider, model), modelID
+						return chatWithProvider(ctx, llm, messages, providerToolDefs, modelID, map[string]interface{}{
+							"max_tokens":  agent.MaxTokens,
+							"temperature": agent.Temperature,
+						}, onChunk)
+					},
+				)
+				if fbErr != nil {
+					return nil, fbErr
+				}
+				return fbResult.Response, nil
+			}
+
+			if opts.ModelOverride != "" {
+				llm, modelID := al.namedModelProvider(agent, opts.ModelOverride)
+				usedModel, usedModelID = opts.ModelOverride, modelID
+				return chatWithProvider(ctx, llm, messages, providerToolDefs, modelID, map[string]interface{}{
+					"max_tokens":  agent.MaxTokens,
+					"temperature": agent.Temperature,
+				}, onChunk)
+			}
+
 			if len(agent.Candidates) > 1 && al.fallback != nil {
 				fbResult, fbErr := al.fallback.Execute(ctx, agent.Candidates,
 					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
-						return agent.Provider.Chat(ctx, messages, providerToolDefs, model, map[string]interface{}{
+						if stream != nil {
+							stream.Reset()
+						}
+						llm, modelID, err := al.resolveCandidate(agent, agent.Candidates, provider, model, model)
+						if err != nil {
+							return nil, err
+						}
+						usedProvider, usedModel, usedModelID = provider, candidateModel(agent, provider, model), modelID
+						return chatWithProvider(ctx, llm, messages, providerToolDefs, modelID, map[string]interface{}{
 							"max_tokens":  agent.MaxTokens,
 							"temperature": agent.Temperature,
-						})
+						}, onChunk)
 					},
 				)
 				if fbErr != nil {
@@ -508,13 +740,24 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 				}
 				return fbResult.Response, nil
 			}
-			return agent.Provider.Chat(ctx, messages, providerToolDefs, agent.Model, map[string]interface{}{
+			llm, modelID := agent.Provider, agent.Model
+			usedModel = agent.Model
+			if len(agent.Candidates) == 1 {
+				primary := agent.Candidates[0]
+				if llm, modelID, err = al.resolveCandidate(agent, agent.Candidates, primary.Provider, primary.Model, agent.Model); err != nil {
+					return nil, err
+				}
+				usedProvider, usedModel = primary.Provider, candidateModel(agent, primary.Provider, primary.Model)
+			}
+			usedModelID = modelID
+			return chatWithProvider(ctx, llm, messages, providerToolDefs, modelID, map[string]interface{}{
 				"max_tokens":  agent.MaxTokens,
 				"temperature": agent.Temperature,
-			})
+			}, onChunk)
 		}
 
-		// Retry loop for context/token errors
+		// Retry loop for context window overflows
+		callStart := time.Now()
 		maxRetries := 2
 		for retry := 0; retry <= maxRetries; retry++ {
 			response, err = callLLM()
@@ -522,16 +765,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 				break
 			}
 
-			errMsg := strings.ToLower(err.Error())
-			isContextError := strings.Contains(errMsg, "token") ||
-				strings.Contains(errMsg, "context") ||
-				strings.Contains(errMsg, "invalidparameter") ||
-				strings.Contains(errMsg, "length")
-
-			if isContextError && retry < maxRetries {
-				logger.WarnCF("agent", "Context window error detected, attempting compression", map[string]interface{}{
-					"error": err.Error(),
-					"retry": retry,
+			failErr := providers.ClassifyError(err, usedProvider, usedModelID)
+			if failErr != nil && failErr.Reason == providers.FailoverContextOverflow && retry < maxRetries {
+				logger.WarnCF("agent", "Context window exceeded, attempting compression", map[string]interface{}{
+					"error":    err.Error(),
+					"provider": failErr.Provider,
+					"retry":    retry,
 				})
 
 				if retry == 0 && !constants.IsInternalChannel(opts.Channel) {
@@ -545,10 +784,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 				al.forceCompression(agent, opts.SessionKey)
 				newHistory := agent.Sessions.GetHistory(opts.SessionKey)
 				newSummary := agent.Sessions.GetSummary(opts.SessionKey)
-				messages = agent.ContextBuilder.BuildMessages(
+				rebuilt := agent.ContextBuilder.BuildMessages(
 					newHistory, newSummary, "",
 					nil, opts.Channel, opts.ChatID,
 				)
+				carryImages(messages, rebuilt)
+				messages = rebuilt
 				continue
 			}
 			break
@@ -564,6 +805,9 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 			return "", iteration, fmt.Errorf("LLM call failed after retries: %w", err)
 		}
 
+		al.recordUsage(agent, opts.SessionKey, opts.Channel, usedModel, usedModelID, response.Usage)
+		step := opts.Trace.AddStep(usedModel, messages, providerToolDefs, response, time.Since(callStart))
+
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
@@ -626,7 +870,6 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 		// Save assistant message with tool calls to session
 		agent.Sessions.AddFullMessage(opts.SessionKey, assistantMsg)
 
-		// Execute tool calls
 		for _, tc := range normalizedToolCalls {
 			argsJSON, _ := json.Marshal(tc.Arguments)
 			argsPreview := utils.Truncate(string(argsJSON), 200)
@@ -636,12 +879,14 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 					"tool":      tc.Name,
 					"iteration": iteration,
 				})
+		}
 
-			// Create async callback for tools that implement AsyncTool
-			// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
-			// Instead, they notify the agent via PublishInbound, and the agent decides
-			// whether to forward the result to the user (in processSystemMessage).
-			asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
+		// Create async callback for tools that implement AsyncTool
+		// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
+		// Instead, they notify the agent via PublishInbound, and the agent decides
+		// whether to forward the result to the user (in processSystemMessage).
+		asyncCallback := func(tc providers.ToolCall) tools.AsyncCallback {
+			return func(callbackCtx context.Context, result *tools.ToolResult) {
 				// Log the async completion but don't send directly to user
 				// The agent will handle user notification via processSystemMessage
 				if !result.Silent && result.ForUser != "" {
@@ -652,8 +897,13 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 						})
 				}
 			}
+		}
 
-			toolResult := agent.Tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+		// Execute tool calls, once any that need approval are approved.
+		// Read-only ones run concurrently; results are handled in call order.
+		toolResults := al.executeToolCalls(ctx, agent, opts, normalizedToolCalls, asyncCallback)
+		for i, tc := range normalizedToolCalls {
+			toolResult := toolResults[i]
 
 			// Send ForUser content to user immediately if not Silent
 			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
@@ -681,6 +931,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 				ToolCallID: tc.ID,
 			}
 			messages = append(messages, toolResultMsg)
+			step.AddToolResult(tc, contentForLLM, toolResult.IsError)
 
 			// Save tool result message to session
 			agent.Sessions.AddFullMessage(opts.SessionKey, toolResultMsg)
@@ -690,30 +941,64 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 	return finalContent, iteration, nil
 }
 
-// updateToolContexts updates the context for tools that need channel/chatID info.
-func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID string) {
-	// Use ContextualTool interface instead of type assertions
-	if tool, ok := agent.Tools.Get("message"); ok {
-		if mt, ok := tool.(tools.ContextualTool); ok {
-			mt.SetContext(channel, chatID)
+// resolveCandidate returns the provider and model ID a fallback candidate is
+// dispatched to. Candidates with a model_list entry get their own provider
+// from the pool; anything else goes to the agent's default provider with
+// defaultModel.
+func (al *AgentLoop) resolveCandidate(agent *AgentInstance, candidates []providers.FallbackCandidate, provider, model, defaultModel string) (providers.LLMProvider, string, error) {
+	for _, candidate := range candidates {
+		if candidate.Provider != provider || candidate.Model != model {
+			continue
 		}
-	}
-	if tool, ok := agent.Tools.Get("spawn"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
+		mc, ok := al.providers.Lookup(candidate)
+		if !ok {
+			break
+		}
+		llm, modelID, err := al.providers.Get(mc)
+		if err != nil {
+			// Misconfigured entries should not stop the chain from trying the next candidate.
+			return nil, "", &providers.FailoverError{
+				Reason:   providers.FailoverAuth,
+				Provider: provider,
+				Model:    model,
+				Wrapped:  err,
+			}
 		}
+		return llm, modelID, nil
 	}
-	if tool, ok := agent.Tools.Get("subagent"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
+	return agent.Provider, defaultModel, nil
+}
+
+// primaryProvider returns the provider and model ID for background calls such
+// as summarization, so they share the primary model's pool entry and RPM budget.
+func (al *AgentLoop) primaryProvider(agent *AgentInstance) (providers.LLMProvider, string) {
+	if len(agent.Candidates) == 0 {
+		return agent.Provider, agent.Model
+	}
+	primary := agent.Candidates[0]
+	llm, modelID, err := al.resolveCandidate(agent, agent.Candidates, primary.Provider, primary.Model, agent.Model)
+	if err != nil {
+		return agent.Provider, agent.Model
+	}
+	return llm, modelID
+}
+
+// namedModelProvider returns the provider and model ID for a model named in
+// config, such as the budget or summary model, preferring its model_list
+// entry and falling back to the agent's provider.
+func (al *AgentLoop) namedModelProvider(agent *AgentInstance, model string) (providers.LLMProvider, string) {
+	if mc, ok := al.providers.Lookup(providers.FallbackCandidate{Model: model, Ref: model}); ok {
+		if llm, modelID, err := al.providers.Get(mc); err == nil {
+			return llm, modelID
 		}
 	}
+	return agent.Provider, model
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
 func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, chatID string) {
 	newHistory := agent.Sessions.GetHistory(sessionKey)
-	tokenEstimate := al.estimateTokens(newHistory)
+	tokenEstimate := agent.ContextBuilder.CountTokens(newHistory)
 	threshold := agent.ContextWindow * 75 / 100
 
 	if len(newHistory) > 20 || tokenEstimate > threshold {
@@ -734,56 +1019,6 @@ func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, c
 	}
 }
 
-// forceCompression aggressively reduces context when the limit is hit.
-// It drops the oldest 50% of messages (keeping system prompt and last user message).
-func (al *AgentLoop) forceCompression(agent *AgentInstance, sessionKey string) {
-	history := agent.Sessions.GetHistory(sessionKey)
-	if len(history) <= 4 {
-		return
-	}
-
-	// Keep system prompt (usually [0]) and the very last message (user's trigger)
-	// We want to drop the oldest half of the *conversation*
-	// Assuming [0] is system, [1:] is conversation
-	conversation := history[1 : len(history)-1]
-	if len(conversation) == 0 {
-		return
-	}
-
-	// Helper to find the mid-point of the conversation
-	mid := len(conversation) / 2
-
-	// New history structure:
-	// 1. System Prompt (with compression note appended)
-	// 2. Second half of conversation
-	// 3. Last message
-
-	droppedCount := mid
-	keptConversation := conversation[mid:]
-
-	newHistory := make([]providers.Message, 0)
-
-	// Append compression note to the original system prompt instead of adding a new system message
-	// This avoids having two consecutive system messages which some APIs (like Zhipu) reject
-	compressionNote := fmt.Sprintf("\n\n[System Note: Emergency compression dropped %d oldest messages due to context limit]", droppedCount)
-	enhancedSystemPrompt := history[0]
-	enhancedSystemPrompt.Content = enhancedSystemPrompt.Content + compressionNote
-	newHistory = append(newHistory, enhancedSystemPrompt)
-
-	newHistory = append(newHistory, keptConversation...)
-	newHistory = append(newHistory, history[len(history)-1]) // Last message
-
-	// Update session
-	agent.Sessions.SetHistory(sessionKey, newHistory)
-	agent.Sessions.Save(sessionKey)
-
-	logger.WarnCF("agent", "Forced compression executed", map[string]interface{}{
-		"session_key":  sessionKey,
-		"dropped_msgs": droppedCount,
-		"new_count":    len(newHistory),
-	})
-}
-
 // GetStartupInfo returns information about loaded tools and skills for logging.
 func (al *AgentLoop) GetStartupInfo() map[string]interface{} {
 	info := make(map[string]interface{})
@@ -863,110 +1098,6 @@ func formatToolsForLog(tools []providers.ToolDefinition) string {
 	return result
 }
 
-// summarizeSession summarizes the conversation history for a session.
-func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
-
-	history := agent.Sessions.GetHistory(sessionKey)
-	summary := agent.Sessions.GetSummary(sessionKey)
-
-	// Keep last 4 messages for continuity
-	if len(history) <= 4 {
-		return
-	}
-
-	toSummarize := history[:len(history)-4]
-
-	// Oversized Message Guard
-	maxMessageTokens := agent.ContextWindow / 2
-	validMessages := make([]providers.Message, 0)
-	omitted := false
-
-	for _, m := range toSummarize {
-		if m.Role != "user" && m.Role != "assistant" {
-			continue
-		}
-		msgTokens := len(m.Content) / 2
-		if msgTokens > maxMessageTokens {
-			omitted = true
-			continue
-		}
-		validMessages = append(validMessages, m)
-	}
-
-	if len(validMessages) == 0 {
-		return
-	}
-
-	// Multi-Part Summarization
-	var finalSummary string
-	if len(validMessages) > 10 {
-		mid := len(validMessages) / 2
-		part1 := validMessages[:mid]
-		part2 := validMessages[mid:]
-
-		s1, _ := al.summarizeBatch(ctx, agent, part1, "")
-		s2, _ := al.summarizeBatch(ctx, agent, part2, "")
-
-		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
-		resp, err := agent.Provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, agent.Model, map[string]interface{}{
-			"max_tokens":  1024,
-			"temperature": 0.3,
-		})
-		if err == nil {
-			finalSummary = resp.Content
-		} else {
-			finalSummary = s1 + " " + s2
-		}
-	} else {
-		finalSummary, _ = al.summarizeBatch(ctx, agent, validMessages, summary)
-	}
-
-	if omitted && finalSummary != "" {
-		finalSummary += "\n[Note: Some oversized messages were omitted from this summary for efficiency.]"
-	}
-
-	if finalSummary != "" {
-		agent.Sessions.SetSummary(sessionKey, finalSummary)
-		agent.Sessions.TruncateHistory(sessionKey, 4)
-		agent.Sessions.Save(sessionKey)
-	}
-}
-
-// summarizeBatch summarizes a batch of messages.
-func (al *AgentLoop) summarizeBatch(ctx context.Context, agent *AgentInstance, batch []providers.Message, existingSummary string) (string, error) {
-	prompt := "Provide a concise summary of this conversation segment, preserving core context and key points.\n"
-	if existingSummary != "" {
-		prompt += "Existing context: " + existingSummary + "\n"
-	}
-	prompt += "\nCONVERSATION:\n"
-	for _, m := range batch {
-		prompt += fmt.Sprintf("%s: %s\n", m.Role, m.Content)
-	}
-
-	response, err := agent.Provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, agent.Model, map[string]interface{}{
-		"max_tokens":  1024,
-		"temperature": 0.3,
-	})
-	if err != nil {
-		return "", err
-	}
-	return response.Content, nil
-}
-
-// estimateTokens estimates the number of tokens in a message list.
-// Uses a safe heuristic of 2.5 characters per token to account for CJK and other
-// overheads better than the previous 3 chars/token.
-func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
-	totalChars := 0
-	for _, m := range messages {
-		totalChars += utf8.RuneCountInString(m.Content)
-	}
-	// 2.5 chars per token = totalChars * 2 / 5
-	return totalChars * 2 / 5
-}
-
 func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
 	content := strings.TrimSpace(msg.Content)
 	if !strings.HasPrefix(content, "/") {
@@ -982,17 +1113,35 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 	args := parts[1:]
 
 	switch cmd {
+	case "/usage":
+		return al.usageCommand(msg, args), true
+
+	case "/tasks":
+		return al.tasksCommand(msg, args), true
+
+	case "/skills":
+		return al.skillsCommand(msg), true
+
+	case "/retry", "/undo", "/branch":
+		return al.branchCommand(ctx, msg, cmd, args), true
+
+	case "/new", "/history", "/summary", "/export", "/forget":
+		return al.sessionCommand(msg, cmd, args), true
+
 	case "/show":
 		if len(args) < 1 {
 			return "Usage: /show [model|channel|agents]", true
 		}
 		switch args[0] {
 		case "model":
-			defaultAgent := al.registry.GetDefaultAgent()
-			if defaultAgent == nil {
+			agent, root, _ := al.resolveSession(msg)
+			if agent == nil {
 				return "No default agent configured", true
 			}
-			return fmt.Sprintf("Current model: %s", defaultAgent.Model), true
+			if model := al.switchedModel(root); model != "" {
+				return fmt.Sprintf("Current model: %s", model), true
+			}
+			return fmt.Sprintf("Current model: %s", agent.Model), true
 		case "channel":
 			return fmt.Sprintf("Current channel: %s", msg.Channel), true
 		case "agents":
@@ -1034,12 +1183,16 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 
 		switch target {
 		case "model":
-			defaultAgent := al.registry.GetDefaultAgent()
-			if defaultAgent == nil {
+			// The choice is per conversation; the agent's model is shared by all chats
+			agent, root, _ := al.resolveSession(msg)
+			if agent == nil {
 				return "No default agent configured", true
 			}
-			oldModel := defaultAgent.Model
-			defaultAgent.Model = value
+			oldModel := al.switchedModel(root)
+			if oldModel == "" {
+				oldModel = agent.Model
+			}
+			al.models.Store(root, value)
 			return fmt.Sprintf("Switched model from %s to %s", oldModel, value), true
 		case "channel":
 			if al.channelManager == nil {
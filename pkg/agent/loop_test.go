@@ -570,7 +570,7 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 	al := NewAgentLoop(cfg, msgBus, provider)
 
 	// Inject some history to simulate a full context
-	sessionKey := "test-session-context"
+	sessionKey := "agent:main:test-session-context"
 	// Create dummy history
 	history := []providers.Message{
 		{Role: "system", Content: "System prompt"},
@@ -584,6 +584,7 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 	if defaultAgent == nil {
 		t.Fatal("No default agent found")
 	}
+	defaultAgent.Sessions.GetOrCreate(sessionKey)
 	defaultAgent.Sessions.SetHistory(sessionKey, history)
 
 	// Call ProcessDirectWithChannel
@@ -613,3 +614,87 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+// TestAgentLoop_NoCompressionOnOtherErrors verifies that errors which merely
+// mention tokens or lengths are not mistaken for context overflow.
+func TestAgentLoop_NoCompressionOnOtherErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+
+	provider := &failFirstMockProvider{
+		failures:    1,
+		failError:   fmt.Errorf(`401 Unauthorized {"error":{"message":"invalid token length","type":"authentication_error"}}`),
+		successResp: "unexpected",
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	sessionKey := "agent:main:test-auth"
+	history := []providers.Message{
+		{Role: "user", Content: "Old message 1"},
+		{Role: "assistant", Content: "Old response 1"},
+		{Role: "user", Content: "Old message 2"},
+		{Role: "assistant", Content: "Old response 2"},
+	}
+	defaultAgent := al.registry.GetDefaultAgent()
+	defaultAgent.Sessions.GetOrCreate(sessionKey)
+	defaultAgent.Sessions.SetHistory(sessionKey, history)
+
+	if _, err := al.ProcessDirectWithChannel(context.Background(), "Trigger message", sessionKey, "test", "test-chat"); err == nil {
+		t.Fatal("expected the auth error to be returned")
+	}
+	if provider.currentCall != 1 {
+		t.Errorf("Expected 1 call, got %d", provider.currentCall)
+	}
+	// History keeps the old turns plus the new user message: nothing was compressed.
+	if got := len(defaultAgent.Sessions.GetHistory(sessionKey)); got != len(history)+1 {
+		t.Errorf("history len = %d, want %d (uncompressed)", got, len(history)+1)
+	}
+}
+
+func TestSwitchModel_PerConversation(t *testing.T) {
+	provider := &scriptedProvider{reply: echoReply}
+	al, _ := newTestLoop(t, provider, nil)
+	send := func(content, key string) string {
+		t.Helper()
+		response, err := al.ProcessDirect(context.Background(), content, key, "")
+		if err != nil {
+			t.Fatalf("ProcessDirect(%q) error: %v", content, err)
+		}
+		return response
+	}
+
+	// Another chat keeps talking while the switch happens
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			al.ProcessDirect(context.Background(), "busy", "agent:main:chat-b", "")
+		}
+	}()
+	if got := send("/switch model to other-model", "agent:main:chat-a"); got != "Switched model from test-model to other-model" {
+		t.Errorf("/switch = %q", got)
+	}
+	<-done
+
+	if got := send("hi", "agent:main:chat-a"); got != "hi (other-model)" {
+		t.Errorf("switched chat reply = %q, want other-model", got)
+	}
+	if got := send("hi", "agent:main:chat-b"); got != "hi (test-model)" {
+		t.Errorf("other chat reply = %q, want the agent's model", got)
+	}
+	if got := send("/show model", "agent:main:chat-a"); got != "Current model: other-model" {
+		t.Errorf("/show model = %q", got)
+	}
+	if model := al.registry.GetDefaultAgent().Model; model != "test-model" {
+		t.Errorf("agent model = %q, want it unchanged", model)
+	}
+}
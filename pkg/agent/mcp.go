@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mcp"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// allowsMCPServer reports whether the agent gets the tools of an MCP server.
+func (a *AgentInstance) allowsMCPServer(server string) bool {
+	return a.MCPServers == nil || slices.Contains(a.MCPServers, server)
+}
+
+// mcpStartTimeout bounds how long NewAgentLoop waits for MCP servers to
+// connect. Servers that take longer register their tools when they do.
+const mcpStartTimeout = 10 * time.Second
+
+// registerMCPTools registers a server's tools with every agent allowed to
+// use it. It runs again whenever the server reconnects or changes its tool
+// list; the server's previous adapters are removed first, so tools it no
+// longer offers go away.
+func (al *AgentLoop) registerMCPTools(server string, serverTools []mcp.Tool) {
+	for _, agentID := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok || !agent.allowsMCPServer(server) {
+			continue
+		}
+		for _, name := range agent.Tools.List() {
+			if tool, _ := agent.Tools.Get(name); isMCPToolOf(tool, server) {
+				agent.Tools.Unregister(name)
+			}
+		}
+		for _, t := range serverTools {
+			agent.Tools.Register(tools.NewMCPTool(al.mcp, server, t))
+		}
+		logger.InfoCF("agent", "Registered MCP tools",
+			map[string]interface{}{
+				"agent_id": agentID,
+				"server":   server,
+				"count":    len(serverTools),
+			})
+	}
+}
+
+func isMCPToolOf(tool tools.Tool, server string) bool {
+	t, ok := tool.(*tools.MCPTool)
+	return ok && t.Server() == server
+}
+
+// mcpHandler exposes an agent to MCP hosts: its tool registry, minus tools
+// that only make sense inside a conversation, plus a chat tool that runs a
+// full agent turn. Calls go through the agent's own tool instances and the
+// approval policy, so restrict_to_workspace, the exec deny patterns and
+// approval patterns still apply.
+type mcpHandler struct {
+	al    *AgentLoop
+	agent *AgentInstance
+}
+
+// MCPHandler returns the tool handler for `picoclaw mcp serve`. It serves
+// the agent that direct (CLI) messages are routed to.
+func (al *AgentLoop) MCPHandler() mcp.ToolHandler {
+	agent, _, _ := al.resolveSession(bus.InboundMessage{Channel: "cli", ChatID: "direct"})
+	return &mcpHandler{al: al, agent: agent}
+}
+
+// exposed reports whether a registry tool is offered over MCP. Proxied MCP
+// tools are left out to avoid loops between hosts, and async or messaging
+// tools because their results are delivered to a chat rather than returned.
+func (h *mcpHandler) exposed(tool tools.Tool) bool {
+	if _, ok := tool.(*tools.MCPTool); ok {
+		return false
+	}
+	if _, ok := tool.(tools.AsyncTool); ok {
+		return false
+	}
+	return tool.Name() != "message"
+}
+
+func (h *mcpHandler) ListTools() []mcp.Tool {
+	names := h.agent.Tools.List()
+	sort.Strings(names)
+
+	list := []mcp.Tool{{
+		Name:        "chat",
+		Description: "Send a message to the picoclaw agent and get its reply. The agent keeps conversation history per session.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"message": map[string]interface{}{
+					"type":        "string",
+					"description": "Message for the agent",
+				},
+				"session": map[string]interface{}{
+					"type":        "string",
+					"description": "Conversation to continue (default: \"default\")",
+				},
+				"branch": map[string]interface{}{
+					"type":        "string",
+					"description": "Branch of the conversation to continue; a new name forks the active branch (default: the active branch)",
+				},
+			},
+			"required": []string{"message"},
+		},
+	}}
+	for _, name := range names {
+		tool, ok := h.agent.Tools.Get(name)
+		if !ok || !h.exposed(tool) {
+			continue
+		}
+		list = append(list, mcp.Tool{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: tool.Parameters(),
+		})
+	}
+	return list
+}
+
+func (h *mcpHandler) CallTool(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	if name == "chat" {
+		return h.chat(ctx, args)
+	}
+
+	tool, ok := h.agent.Tools.Get(name)
+	if !ok || !h.exposed(tool) {
+		return nil, fmt.Errorf("unknown tool: %s", name)
+	}
+	// Through the approval policy like the agent's own calls. There is no
+	// one to ask here, so calls that need approval are refused.
+	result := h.al.executeToolCalls(ctx, h.agent, processOptions{
+		SessionKey: fmt.Sprintf("agent:%s:mcp", h.agent.ID),
+		Channel:    "cli",
+		ChatID:     "direct",
+	}, []providers.ToolCall{{ID: "mcp", Name: name, Arguments: args}}, nil)[0]
+	text := result.ForLLM
+	if text == "" {
+		text = result.ForUser
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{{Type: "text", Text: text}},
+		IsError: result.IsError,
+	}, nil
+}
+
+func (h *mcpHandler) chat(ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	message, _ := args["message"].(string)
+	if strings.TrimSpace(message) == "" {
+		return nil, fmt.Errorf("message is required")
+	}
+	session, _ := args["session"].(string)
+	if session == "" {
+		session = "default"
+	}
+	sessionKey := fmt.Sprintf("agent:%s:mcp:%s", h.agent.ID, session)
+
+	branch, _ := args["branch"].(string)
+
+	response, err := h.al.ProcessDirect(ctx, message, sessionKey, branch)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{{Type: "text", Text: fmt.Sprintf("Error: %v", err)}},
+			IsError: true,
+		}, nil
+	}
+	return &mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: response}}}, nil
+}
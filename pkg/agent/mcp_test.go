@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/mcp"
+)
+
+func TestRegisterMCPTools_AllowLists(t *testing.T) {
+	cfg := testCfg([]config.AgentConfig{
+		{ID: "main", Default: true, Workspace: t.TempDir()},
+		{ID: "research", Workspace: t.TempDir(), MCP: []string{"search"}},
+		{ID: "offline", Workspace: t.TempDir(), MCP: []string{}},
+	})
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	al.registerMCPTools("fs", []mcp.Tool{{Name: "read"}})
+	al.registerMCPTools("search", []mcp.Tool{{Name: "query"}})
+
+	tests := []struct {
+		agent string
+		tool  string
+		want  bool
+	}{
+		{"main", "mcp_fs_read", true},
+		{"main", "mcp_search_query", true},
+		{"research", "mcp_fs_read", false},
+		{"research", "mcp_search_query", true},
+		{"offline", "mcp_fs_read", false},
+		{"offline", "mcp_search_query", false},
+	}
+	for _, tt := range tests {
+		agent, ok := al.registry.GetAgent(tt.agent)
+		if !ok {
+			t.Fatalf("agent %q not found", tt.agent)
+		}
+		if _, got := agent.Tools.Get(tt.tool); got != tt.want {
+			t.Errorf("%s has %s = %v, want %v", tt.agent, tt.tool, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterMCPTools_ReplacesServerTools(t *testing.T) {
+	cfg := testCfg(nil)
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	tools := al.registry.GetDefaultAgent().Tools
+
+	al.registerMCPTools("fs", []mcp.Tool{{Name: "read"}, {Name: "write"}})
+	al.registerMCPTools("search", []mcp.Tool{{Name: "query"}})
+	al.registerMCPTools("fs", []mcp.Tool{{Name: "read"}})
+
+	for name, want := range map[string]bool{
+		"mcp_fs_read":      true,
+		"mcp_fs_write":     false,
+		"mcp_search_query": true,
+	} {
+		if _, got := tools.Get(name); got != want {
+			t.Errorf("has %s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMCPHandler_ExposesRestrictedTools(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := testCfg(nil)
+	cfg.Agents.Defaults.Workspace = workspace
+	cfg.Agents.Defaults.RestrictToWorkspace = true
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	handler := al.MCPHandler()
+
+	names := make(map[string]bool)
+	for _, tool := range handler.ListTools() {
+		names[tool.Name] = true
+	}
+	for _, want := range []string{"chat", "read_file", "exec"} {
+		if !names[want] {
+			t.Errorf("tool %q should be exposed", want)
+		}
+	}
+	for _, hidden := range []string{"message", "spawn"} {
+		if names[hidden] {
+			t.Errorf("tool %q should not be exposed", hidden)
+		}
+	}
+
+	ctx := context.Background()
+	result, err := handler.CallTool(ctx, "read_file", map[string]interface{}{"path": "/etc/hostname"})
+	if err != nil {
+		t.Fatalf("CallTool(read_file) error: %v", err)
+	}
+	if !result.IsError || !strings.Contains(result.Content[0].Text, "outside the workspace") {
+		t.Errorf("read outside workspace = %+v, want access denied", result)
+	}
+
+	result, err = handler.CallTool(ctx, "exec", map[string]interface{}{"command": "rm -rf /"})
+	if err != nil {
+		t.Fatalf("CallTool(exec) error: %v", err)
+	}
+	if !result.IsError {
+		t.Errorf("denied command should fail, got %+v", result)
+	}
+
+	if _, err := handler.CallTool(ctx, "message", map[string]interface{}{"content": "x"}); err == nil {
+		t.Error("hidden tools should not be callable")
+	}
+
+	result, err = handler.CallTool(ctx, "chat", map[string]interface{}{"message": "hello", "session": "host"})
+	if err != nil {
+		t.Fatalf("CallTool(chat) error: %v", err)
+	}
+	if result.IsError || result.Content[0].Text != "Mock response" {
+		t.Errorf("chat = %+v", result)
+	}
+	agent := al.registry.GetDefaultAgent()
+	if history := agent.Sessions.GetHistory("agent:main:mcp:host"); len(history) == 0 {
+		t.Error("chat should record history under the mcp session")
+	}
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxImageBytes caps the size of a local image attached to a turn.
+const maxImageBytes = 20 << 20
+
+// loadImageParts turns the images among media into content parts. Local
+// files are inlined as base64 data URLs and http(s) URLs are passed through;
+// anything that isn't an image is skipped.
+func loadImageParts(media []string) []providers.ContentPart {
+	var parts []providers.ContentPart
+	for _, m := range media {
+		if strings.HasPrefix(m, "http://") || strings.HasPrefix(m, "https://") {
+			if utils.IsImageFile(m, "") {
+				parts = append(parts, providers.ContentPart{Type: providers.PartImage, ImageURL: m})
+			}
+			continue
+		}
+		if !utils.IsImageFile(m, "") {
+			continue
+		}
+
+		dataURL, err := imageDataURL(m)
+		if err != nil {
+			logger.WarnCF("agent", "Skipping image attachment",
+				map[string]interface{}{
+					"path":  m,
+					"error": err.Error(),
+				})
+			continue
+		}
+		parts = append(parts, providers.ContentPart{Type: providers.PartImage, ImageURL: dataURL})
+	}
+	return parts
+}
+
+func imageDataURL(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxImageBytes {
+		return "", fmt.Errorf("image is %d bytes, limit is %d", info.Size(), maxImageBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	mediaType := http.DetectContentType(data)
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("content type %s is not an image", mediaType)
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// removeDownloadedImages deletes images that channels downloaded into the
+// media temp dir and handed over with the message. Other media is owned and
+// cleaned up by the channel.
+func removeDownloadedImages(media []string) {
+	dir := utils.MediaDir()
+	for _, m := range media {
+		if !utils.IsImageFile(m, "") {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, m); err != nil || strings.HasPrefix(rel, "..") || filepath.IsAbs(rel) {
+			continue
+		}
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			logger.DebugCF("agent", "Failed to cleanup image", map[string]interface{}{
+				"file":  m,
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// hasImages reports whether any message carries image parts.
+func hasImages(messages []providers.Message) bool {
+	for _, m := range messages {
+		if m.HasImages() {
+			return true
+		}
+	}
+	return false
+}
+
+// carryImages copies the image parts of the turn's user message in from onto
+// the matching user message in to, which was rebuilt from stored history,
+// where messages keep only their text.
+func carryImages(from, to []providers.Message) {
+	for i := len(from) - 1; i >= 0; i-- {
+		if from[i].Role != "user" || !from[i].HasImages() {
+			continue
+		}
+		for j := len(to) - 1; j >= 0; j-- {
+			if to[j].Role == "user" && to[j].Content == from[i].Content {
+				to[j].Parts = from[i].Parts
+				return
+			}
+		}
+		return
+	}
+}
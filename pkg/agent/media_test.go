@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func writeTestImage(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pngHeader, 0644); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	return path
+}
+
+func TestBuildMessages_AttachesImages(t *testing.T) {
+	dir := t.TempDir()
+	img := writeTestImage(t, dir, "photo.png")
+	audio := filepath.Join(dir, "voice.ogg")
+	os.WriteFile(audio, []byte("OggS"), 0644)
+
+	cb := NewContextBuilder(dir)
+	messages := cb.BuildMessages(nil, "", "what is this? [image: photo]",
+		[]string{img, audio, "https://cdn.example.com/cat.jpg?ex=1", "https://cdn.example.com/doc.pdf"}, "", "")
+
+	user := messages[len(messages)-1]
+	if user.Content != "what is this? [image: photo]" {
+		t.Errorf("Content = %q", user.Content)
+	}
+	if len(user.Parts) != 3 {
+		t.Fatalf("len(Parts) = %d, want text + 2 images", len(user.Parts))
+	}
+	if user.Parts[0].Type != providers.PartText || user.Parts[0].Text != user.Content {
+		t.Errorf("first part = %+v, want the text", user.Parts[0])
+	}
+	if !strings.HasPrefix(user.Parts[1].ImageURL, "data:image/png;base64,") {
+		t.Errorf("local image = %q, want png data URL", user.Parts[1].ImageURL)
+	}
+	if user.Parts[2].ImageURL != "https://cdn.example.com/cat.jpg?ex=1" {
+		t.Errorf("remote image = %q, want URL passed through", user.Parts[2].ImageURL)
+	}
+}
+
+func TestBuildMessages_NoImagesKeepsPlainContent(t *testing.T) {
+	cb := NewContextBuilder(t.TempDir())
+	messages := cb.BuildMessages(nil, "", "hello", []string{"/nonexistent/photo.jpg"}, "", "")
+	if parts := messages[len(messages)-1].Parts; parts != nil {
+		t.Errorf("Parts = %+v, want nil", parts)
+	}
+}
+
+func TestRemoveDownloadedImages_OnlyMediaDir(t *testing.T) {
+	if err := os.MkdirAll(utils.MediaDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	downloaded := writeTestImage(t, utils.MediaDir(), "picoclaw-test-remove.png")
+	userFile := writeTestImage(t, t.TempDir(), "keep.png")
+
+	removeDownloadedImages([]string{downloaded, userFile})
+
+	if _, err := os.Stat(downloaded); !os.IsNotExist(err) {
+		t.Error("expected downloaded image to be removed")
+		os.Remove(downloaded)
+	}
+	if _, err := os.Stat(userFile); err != nil {
+		t.Error("files outside the media dir must be left alone")
+	}
+}
+
+func TestAgentLoop_RoutesImageTurnsToImageModel(t *testing.T) {
+	provider := &scriptedProvider{}
+	al, _ := newTestLoop(t, provider, func(cfg *config.Config) {
+		cfg.Agents.Defaults.ImageModel = "vision-model"
+	})
+	workspace := al.registry.GetDefaultAgent().Workspace
+
+	img := writeTestImage(t, workspace, "photo.png")
+	ctx := context.Background()
+	al.processMessage(ctx, bus.InboundMessage{Channel: "test", SenderID: "u1", ChatID: "c1", Content: "look", Media: []string{img}})
+	al.processMessage(ctx, bus.InboundMessage{Channel: "test", SenderID: "u1", ChatID: "c1", Content: "and now text"})
+
+	if len(provider.models) != 2 || provider.models[0] != "vision-model" || provider.models[1] != "test-model" {
+		t.Errorf("models = %v, want [vision-model test-model]", provider.models)
+	}
+}
+
+func TestAgentLoop_ContextOverflowRetryKeepsImages(t *testing.T) {
+	var attached []bool
+	provider := &scriptedProvider{reply: func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		attached = append(attached, hasImages(messages))
+		if call == 1 {
+			return nil, fmt.Errorf("context_length_exceeded: maximum context length is 8192 tokens")
+		}
+		return &providers.LLMResponse{Content: "a cat"}, nil
+	}}
+	al, _ := newTestLoop(t, provider, nil)
+	img := writeTestImage(t, al.registry.GetDefaultAgent().Workspace, "photo.png")
+
+	response, err := al.processMessage(context.Background(), bus.InboundMessage{Channel: "test", SenderID: "u1", ChatID: "c1", Content: "what is this?", Media: []string{img}})
+	if err != nil || response != "a cat" {
+		t.Fatalf("processMessage() = %q, %v", response, err)
+	}
+	if len(attached) != 2 || !attached[0] || !attached[1] {
+		t.Errorf("images attached per call = %v, want the retry to keep them", attached)
+	}
+}
@@ -7,12 +7,20 @@
 package agent
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/memory"
+	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
+// memorySearchTimeout bounds retrieval for the system prompt, which may
+// call an embedding endpoint.
+const memorySearchTimeout = 15 * time.Second
+
 // MemoryStore manages persistent memory for the agent.
 // - Long-term memory: memory/MEMORY.md
 // - Daily notes: memory/YYYYMM/YYYYMMDD.md
@@ -20,6 +28,7 @@ type MemoryStore struct {
 	workspace  string
 	memoryDir  string
 	memoryFile string
+	files      *memory.Store
 }
 
 // NewMemoryStore creates a new MemoryStore with the given workspace path.
@@ -28,13 +37,11 @@ func NewMemoryStore(workspace string) *MemoryStore {
 	memoryDir := filepath.Join(workspace, "memory")
 	memoryFile := filepath.Join(memoryDir, "MEMORY.md")
 
-	// Ensure memory directory exists
-	os.MkdirAll(memoryDir, 0755)
-
 	return &MemoryStore{
 		workspace:  workspace,
 		memoryDir:  memoryDir,
 		memoryFile: memoryFile,
+		files:      memory.NewStore(memoryDir), // Ensures the memory directory exists
 	}
 }
 
@@ -73,28 +80,7 @@ func (ms *MemoryStore) ReadToday() string {
 // AppendToday appends content to today's daily note.
 // If the file doesn't exist, it creates a new file with a date header.
 func (ms *MemoryStore) AppendToday(content string) error {
-	todayFile := ms.getTodayFile()
-
-	// Ensure month directory exists
-	monthDir := filepath.Dir(todayFile)
-	os.MkdirAll(monthDir, 0755)
-
-	var existingContent string
-	if data, err := os.ReadFile(todayFile); err == nil {
-		existingContent = string(data)
-	}
-
-	var newContent string
-	if existingContent == "" {
-		// Add header for new day
-		header := fmt.Sprintf("# %s\n\n", time.Now().Format("2006-01-02"))
-		newContent = header + content
-	} else {
-		// Append to existing content
-		newContent = existingContent + "\n" + content
-	}
-
-	return os.WriteFile(todayFile, []byte(newContent), 0644)
+	return ms.files.AppendDaily(content)
 }
 
 // GetRecentDailyNotes returns daily notes from the last N days.
@@ -128,34 +114,23 @@ func (ms *MemoryStore) GetRecentDailyNotes(days int) string {
 	return result
 }
 
-// GetMemoryContext returns formatted memory context for the agent prompt.
-// Includes long-term memory and recent daily notes.
-func (ms *MemoryStore) GetMemoryContext() string {
-	var parts []string
-
-	// Long-term memory
-	longTerm := ms.ReadLongTerm()
-	if longTerm != "" {
-		parts = append(parts, "## Long-term Memory\n\n"+longTerm)
-	}
-
-	// Recent daily notes (last 3 days)
-	recentNotes := ms.GetRecentDailyNotes(3)
-	if recentNotes != "" {
-		parts = append(parts, "## Recent Daily Notes\n\n"+recentNotes)
-	}
-
-	if len(parts) == 0 {
+// GetMemoryContext returns the memory snippets most relevant to query,
+// at most topK of them, formatted for the agent prompt. It returns "" when
+// nothing relevant is found.
+func (ms *MemoryStore) GetMemoryContext(query string, topK int) string {
+	ctx, cancel := context.WithTimeout(context.Background(), memorySearchTimeout)
+	defer cancel()
+
+	results, err := ms.files.Index().Search(ctx, query, topK)
+	if err != nil {
+		logger.WarnCF("agent", "Memory search failed", map[string]interface{}{
+			"error": err.Error(),
+		})
 		return ""
 	}
-
-	// Join parts with separator
-	var result string
-	for i, part := range parts {
-		if i > 0 {
-			result += "\n\n---\n\n"
-		}
-		result += part
+	if len(results) == 0 {
+		return ""
 	}
-	return fmt.Sprintf("# Memory\n\n%s", result)
+	return "Relevant snippets from memory/MEMORY.md and daily notes. Use memory_search to look up anything else.\n\n" +
+		tools.FormatMemoryResults(results)
 }
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestBuildMessages_IncludesOnlyRelevantMemory(t *testing.T) {
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "memory"), 0755)
+	os.WriteFile(filepath.Join(workspace, "memory", "MEMORY.md"), []byte(
+		"## Home\n\nThe wifi password is hunter2.\n\n## Pets\n\nThe cat is called Miso."), 0644)
+
+	cb := NewContextBuilder(workspace)
+	system := cb.BuildMessages(nil, "", "what's the wifi password?", nil, "", "")[0].Content
+	if !strings.Contains(system, "hunter2") {
+		t.Error("system prompt is missing the relevant memory")
+	}
+	if strings.Contains(system, "Miso") {
+		t.Error("system prompt includes an unrelated memory")
+	}
+
+	// A retry without a new message reuses the last user message.
+	history := []providers.Message{{Role: "user", Content: "what is my cat called?"}}
+	system = cb.BuildMessages(history, "", "", nil, "", "")[0].Content
+	if !strings.Contains(system, "Miso") {
+		t.Error("retry prompt is missing the memory for the last user message")
+	}
+}
@@ -2,7 +2,12 @@ package agent
 
 import (
 	"context"
+	"strings"
+	"sync"
+	"testing"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
@@ -18,3 +23,79 @@ func (m *mockProvider) Chat(ctx context.Context, messages []providers.Message, t
 func (m *mockProvider) GetDefaultModel() string {
 	return "mock-model"
 }
+
+// scriptedProvider records the model, last message and offered tools of
+// every call and answers with reply, given the 1-based number of the call.
+// A nil reply answers "ok". reply runs outside the lock, so it may block.
+// Streamed calls count in streamed as well.
+type scriptedProvider struct {
+	reply func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error)
+
+	mu       sync.Mutex
+	models   []string
+	prompts  []string
+	tools    [][]string
+	streamed int
+}
+
+func (m *scriptedProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	var names []string
+	for _, def := range tools {
+		names = append(names, def.Function.Name)
+	}
+	m.mu.Lock()
+	m.models = append(m.models, model)
+	m.prompts = append(m.prompts, messages[len(messages)-1].Content)
+	m.tools = append(m.tools, names)
+	call := len(m.models)
+	m.mu.Unlock()
+
+	if m.reply == nil {
+		return &providers.LLMResponse{Content: "ok"}, nil
+	}
+	return m.reply(ctx, call, messages, model)
+}
+
+// ChatStream answers as Chat does, delivering the content word by word.
+func (m *scriptedProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}, onChunk providers.StreamCallback) (*providers.LLMResponse, error) {
+	m.mu.Lock()
+	m.streamed++
+	m.mu.Unlock()
+
+	response, err := m.Chat(ctx, messages, tools, model, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range strings.SplitAfter(response.Content, " ") {
+		if word != "" {
+			onChunk(providers.StreamChunk{ContentDelta: word})
+		}
+	}
+	return response, nil
+}
+
+func (m *scriptedProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+// newTestLoop returns an AgentLoop with one default agent, working in a
+// temporary workspace and talking to provider. configure, if not nil,
+// adjusts the config before the loop is built.
+func newTestLoop(t *testing.T, provider providers.LLMProvider, configure func(cfg *config.Config)) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	msgBus := bus.NewMessageBus()
+	return NewAgentLoop(cfg, msgBus, provider), msgBus
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+// saveTrace finishes t and stores it in the agent's trace store. t is nil
+// when the turn is not being recorded.
+func (al *AgentLoop) saveTrace(agent *AgentInstance, t *trace.Trace, response string, err error) {
+	if t == nil {
+		return
+	}
+	t.Finish(response, err)
+	if err := agent.Traces.Save(t); err != nil {
+		logger.WarnCF("agent", "Failed to save trace", map[string]interface{}{
+			"trace_id": t.ID,
+			"error":    err.Error(),
+		})
+		return
+	}
+	logger.DebugCF("agent", "Trace saved", map[string]interface{}{
+		"agent_id": agent.ID,
+		"trace_id": t.ID,
+		"steps":    len(t.Steps),
+	})
+}
+
+// TraceStores returns the trace store of every configured agent, keyed by
+// agent ID, whether or not tracing is on.
+func TraceStores(cfg *config.Config) map[string]*trace.Store {
+	agentConfigs := cfg.Agents.List
+	if len(agentConfigs) == 0 {
+		agentConfigs = []config.AgentConfig{{ID: "main", Default: true}}
+	}
+
+	stores := make(map[string]*trace.Store, len(agentConfigs))
+	for i := range agentConfigs {
+		ac := &agentConfigs[i]
+		workspace := resolveAgentWorkspace(ac, &cfg.Agents.Defaults)
+		stores[routing.NormalizeAgentID(ac.ID)] = trace.NewStore(workspace, cfg.Agents.Defaults.MaxTraces)
+	}
+	return stores
+}
+
+// ReplayTrace runs the turn recorded in t again with the current code and
+// configuration, and returns the trace of the new run. The LLM is replaced
+// by the responses recorded in t and every tool by the results recorded
+// there, so no chat model is called and no tool runs; what may differ is
+// what picoclaw sends to the LLM. MCP servers are not started: their tools
+// are offered without descriptions. The replayed session is kept in memory,
+// and nothing is saved to the agent's sessions, usage ledger or trace store.
+func ReplayTrace(ctx context.Context, cfg *config.Config, t *trace.Trace) (*trace.Trace, error) {
+	replayCfg := *cfg
+	replayCfg.Session.Store = "memory"
+	replayCfg.Tools.MCP.Servers = nil
+	replayCfg.Tools.AuditLog = false
+	replayCfg.Tools.Approval.Enabled = false
+	replayCfg.Agents.Defaults.Trace = false
+
+	al := NewAgentLoop(&replayCfg, bus.NewMessageBus(), trace.NewReplayProvider(t))
+	al.state, al.ledger = nil, nil
+	// With no model_list entries, every model resolves to the replay provider.
+	al.providers = providers.NewProviderPool(&config.Config{})
+
+	agent, ok := al.registry.GetAgent(t.AgentID)
+	if !ok {
+		return nil, fmt.Errorf("agent %s is not configured", t.AgentID)
+	}
+	agent.Tools = recordedTools(agent.Tools, t)
+	agent.ContextBuilder.SetToolsRegistry(agent.Tools)
+	agent.ContextBuilder.now = func() time.Time { return t.Start }
+
+	sessionKey := fmt.Sprintf("agent:%s:trace-replay-%s", agent.ID, t.ID)
+	agent.Sessions.GetOrCreate(sessionKey)
+	agent.Sessions.SetHistory(sessionKey, t.History)
+	agent.Sessions.SetSummary(sessionKey, t.Summary)
+
+	replay := trace.New(agent.ID, t.SessionKey, t.Channel, t.ChatID, t.UserMessage)
+	response, err := al.runAgentLoop(ctx, agent, processOptions{
+		SessionKey:      sessionKey,
+		Channel:         t.Channel,
+		ChatID:          t.ChatID,
+		UserMessage:     t.UserMessage,
+		Media:           t.Media,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		Trace:           replay,
+	})
+	replay.Finish(response, err)
+	return replay, nil
+}
+
+// recordedTools returns a registry offering the same tools as registry, and
+// any others offered in t, each answering with the results recorded in t.
+func recordedTools(registry *tools.ToolRegistry, t *trace.Trace) *tools.ToolRegistry {
+	results := make(map[string][]trace.ToolResult)
+	for _, step := range t.Steps {
+		for _, name := range step.Tools {
+			if _, ok := results[name]; !ok {
+				results[name] = nil
+			}
+		}
+		for _, result := range step.ToolResults {
+			results[result.Name] = append(results[result.Name], result)
+		}
+	}
+
+	replay := tools.NewToolRegistry()
+	for _, name := range registry.List() {
+		tool, _ := registry.Get(name)
+		replay.Register(&recordedTool{name: name, description: tool.Description(), parameters: tool.Parameters(), results: results[name]})
+		delete(results, name)
+	}
+	for name, recorded := range results {
+		replay.Register(&recordedTool{name: name, parameters: map[string]interface{}{"type": "object"}, results: recorded})
+	}
+	return replay
+}
+
+// recordedTool stands in for a tool during a replay, returning its recorded
+// results in order.
+type recordedTool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+
+	mu      sync.Mutex
+	results []trace.ToolResult
+}
+
+func (t *recordedTool) Name() string                       { return t.name }
+func (t *recordedTool) Description() string                { return t.description }
+func (t *recordedTool) Parameters() map[string]interface{} { return t.parameters }
+
+func (t *recordedTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.results) == 0 {
+		return tools.ErrorResult(fmt.Sprintf("the trace has no further result for %s", t.name))
+	}
+	result := t.results[0]
+	t.results = t.results[1:]
+	if result.IsError {
+		return tools.ErrorResult(result.Content)
+	}
+	return tools.NewToolResult(result.Content)
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+func TestTrace_RecordAndReplay(t *testing.T) {
+	al, _ := newTestLoop(t, &scriptedProvider{reply: execOnce("echo hello")}, func(cfg *config.Config) {
+		cfg.Agents.Defaults.Trace = true
+	})
+	cfg := al.cfg
+	agent := al.registry.GetDefaultAgent()
+
+	if _, err := al.ProcessDirectWithChannel(context.Background(), "list files", "agent:main:trace", "telegram", "42"); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := agent.Traces.List()
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("traces = %v, %v; want one", ids, err)
+	}
+	recorded, err := agent.Traces.Load(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded.Steps) != 2 || !strings.Contains(recorded.Response, "hello") {
+		t.Fatalf("trace has %d steps and response %q", len(recorded.Steps), recorded.Response)
+	}
+	if results := recorded.Steps[0].ToolResults; len(results) != 1 || results[0].Name != "exec" || results[0].Content != recorded.Response {
+		t.Errorf("tool results = %+v", results)
+	}
+
+	sessionsDir := filepath.Join(agent.Workspace, "sessions")
+	before := dirContents(t, sessionsDir)
+	replayed, err := ReplayTrace(context.Background(), cfg, recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := dirContents(t, sessionsDir); after != before {
+		t.Errorf("replay changed the sessions dir:\n%s\nwas:\n%s", after, before)
+	}
+	if diffs := trace.Diff(recorded, replayed); len(diffs) != 0 {
+		t.Errorf("replay differs from the recording:\n%s", strings.Join(diffs, "\n"))
+	}
+	if ids, _ := agent.Traces.List(); len(ids) != 1 {
+		t.Errorf("replay saved a trace: %v", ids)
+	}
+
+	// A different tool result changes what the second call sends.
+	recorded.Steps[0].ToolResults[0].Content = "goodbye"
+	replayed, err = ReplayTrace(context.Background(), cfg, recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := trace.Diff(recorded, replayed); !strings.Contains(strings.Join(diffs, "\n"), "step 2: message") {
+		t.Errorf("diffs = %v, want step 2 to differ", diffs)
+	}
+}
+
+// dirContents returns the names and contents of the files in dir.
+func dirContents(t *testing.T, dir string) string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	for _, e := range entries {
+		data, _ := os.ReadFile(filepath.Join(dir, e.Name()))
+		fmt.Fprintf(&sb, "%s: %s\n", e.Name(), data)
+	}
+	return sb.String()
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// defaultHistoryCount is how many messages /history shows without an argument.
+const defaultHistoryCount = 10
+
+// sessionCommand answers /new, /history, /summary, /export and /forget for
+// the conversation msg belongs to. /new and /forget act on all of its
+// branches, the rest on the branch msg was sent to.
+func (al *AgentLoop) sessionCommand(msg bus.InboundMessage, cmd string, args []string) string {
+	agent, root, _ := al.resolveSession(msg)
+	sessions := agent.Sessions
+	sessionKey, err := al.branchKey(agent, root, msg.Metadata["branch"])
+	if err != nil {
+		return err.Error()
+	}
+
+	switch cmd {
+	case "/new":
+		archived, err := sessions.Archive(root)
+		if err != nil {
+			return fmt.Sprintf("Failed to archive conversation: %v", err)
+		}
+		if archived == "" {
+			return "Started a new conversation."
+		}
+		return fmt.Sprintf("Started a new conversation. The previous one was archived as %s.", archived)
+
+	case "/forget":
+		if err := sessions.DeleteTree(root); err != nil {
+			return fmt.Sprintf("Failed to forget conversation: %v", err)
+		}
+		return "Forgot this conversation. Long-term memory is unchanged."
+
+	case "/history":
+		n := defaultHistoryCount
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v <= 0 {
+				return "Usage: /history [count]"
+			}
+			n = v
+		}
+		s := sessions.Get(sessionKey)
+		if s == nil || len(s.Messages) == 0 {
+			return "No messages in this conversation yet."
+		}
+		return formatHistory(s, n)
+
+	case "/summary":
+		s := sessions.Get(sessionKey)
+		if s == nil || s.Summary == "" {
+			return "This conversation has not been summarized yet."
+		}
+		if n := s.Covered(); n > 0 {
+			return fmt.Sprintf("Summary of the %d earlier messages:\n\n%s", n, s.Summary)
+		}
+		return "Summary of earlier conversation:\n\n" + s.Summary
+
+	case "/export":
+		format := "md"
+		if len(args) > 0 {
+			format = strings.ToLower(args[0])
+		}
+		if format != "md" && format != "json" {
+			return "Usage: /export [md|json]"
+		}
+		s := sessions.Get(sessionKey)
+		if s == nil || len(s.Messages) == 0 {
+			return "Nothing to export: this conversation is empty."
+		}
+		path, err := exportSession(agent.Workspace, s, format)
+		if err != nil {
+			return fmt.Sprintf("Failed to export conversation: %v", err)
+		}
+		caption := fmt.Sprintf("Exported %d messages to %s", len(s.Messages), path)
+		if constants.IsInternalChannel(msg.Channel) {
+			return caption
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: caption,
+			Files:   []string{path},
+		})
+		return ""
+	}
+
+	return ""
+}
+
+// formatHistory lists the last n messages of a session, one line each.
+func formatHistory(s *session.Session, n int) string {
+	messages := s.Messages
+	if len(messages) > n {
+		messages = messages[len(messages)-n:]
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Last %d of %d messages:\n", len(messages), len(s.Messages))
+	for _, m := range messages {
+		text := strings.Join(strings.Fields(m.Content), " ")
+		if text == "" && len(m.ToolCalls) > 0 {
+			names := make([]string, 0, len(m.ToolCalls))
+			for _, tc := range m.ToolCalls {
+				if tc.Function != nil {
+					names = append(names, tc.Function.Name)
+				} else {
+					names = append(names, tc.Name)
+				}
+			}
+			text = "(calls " + strings.Join(names, ", ") + ")"
+		}
+		if m.Turn > 0 {
+			fmt.Fprintf(&sb, "\n#%d [%s] %s", m.Turn, m.Role, utils.Truncate(text, 200))
+		} else {
+			fmt.Fprintf(&sb, "\n[%s] %s", m.Role, utils.Truncate(text, 200))
+		}
+	}
+	return sb.String()
+}
+
+// exportSession writes a session to <workspace>/exports and returns the path.
+func exportSession(workspace string, s *session.Session, format string) (string, error) {
+	var data []byte
+	switch format {
+	case "json":
+		var err error
+		if data, err = session.ExportJSON(s); err != nil {
+			return "", err
+		}
+	default:
+		data = []byte(session.ExportMarkdown(s))
+	}
+
+	dir := filepath.Join(workspace, "exports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer(":", "_", "/", "_", `\`, "_").Replace(s.Key)
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format))
+	return path, os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSessionCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &simpleMockProvider{response: "Hi there"})
+
+	send := func(content string) string {
+		t.Helper()
+		msg := bus.InboundMessage{Channel: "telegram", SenderID: "u1", ChatID: "c1", Content: content}
+		response, err := al.processMessage(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("processMessage(%q) error: %v", content, err)
+		}
+		return response
+	}
+
+	send("hello")
+
+	if got := send("/history"); !strings.Contains(got, "[user] hello") || !strings.Contains(got, "[assistant] Hi there") {
+		t.Errorf("/history = %q", got)
+	}
+	if got := send("/history 1"); !strings.Contains(got, "Last 1 of 2") || strings.Contains(got, "hello") {
+		t.Errorf("/history 1 = %q", got)
+	}
+	if got := send("/summary"); !strings.Contains(got, "not been summarized") {
+		t.Errorf("/summary = %q", got)
+	}
+
+	// /export replies with a file instead of text.
+	if got := send("/export"); got != "" {
+		t.Errorf("/export response = %q, want the reply sent as a file", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || len(out.Files) != 1 || out.ChatID != "c1" {
+		t.Fatalf("outbound = %+v", out)
+	}
+	data, err := os.ReadFile(out.Files[0])
+	if err != nil || !strings.Contains(string(data), "### User\n\nhello") {
+		t.Errorf("export file = %q, %v", data, err)
+	}
+
+	if got := send("/new"); !strings.Contains(got, "archived") {
+		t.Errorf("/new = %q", got)
+	}
+	if got := send("/history"); !strings.Contains(got, "No messages") {
+		t.Errorf("/history after /new = %q", got)
+	}
+	infos, _ := al.registry.GetDefaultAgent().Sessions.List()
+	if len(infos) != 1 || !strings.Contains(infos[0].Key, ":archived:") {
+		t.Errorf("sessions after /new = %+v", infos)
+	}
+
+	send("hello again")
+	send("/forget")
+	if got := send("/history"); !strings.Contains(got, "No messages") {
+		t.Errorf("/history after /forget = %q", got)
+	}
+}
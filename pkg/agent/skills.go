@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// skillsCommand answers /skills with the skills offered to the agent the
+// chat of msg is routed to, where each comes from and what it overrides.
+func (al *AgentLoop) skillsCommand(msg bus.InboundMessage) string {
+	agent, _, _ := al.resolveSession(msg)
+	loader := agent.ContextBuilder.skillsLoader
+
+	installed := loader.ListSkills()
+	available := loader.AvailableSkills()
+
+	var sb strings.Builder
+	if len(available) == 0 {
+		fmt.Fprintf(&sb, "Agent %s has no skills.", agent.ID)
+	} else {
+		fmt.Fprintf(&sb, "Skills of agent %s:", agent.ID)
+		for _, s := range available {
+			fmt.Fprintf(&sb, "\n- %s (%s", s.Name, s.Source)
+			if len(s.Shadows) > 0 {
+				fmt.Fprintf(&sb, ", overrides %s", strings.Join(s.Shadows, ", "))
+			}
+			sb.WriteString(")")
+			if s.Description != "" {
+				sb.WriteString(": " + s.Description)
+			}
+		}
+	}
+	if hidden := len(installed) - len(available); hidden > 0 {
+		fmt.Fprintf(&sb, "\n\n%d more installed, not enabled for this agent.", hidden)
+	}
+	return sb.String()
+}
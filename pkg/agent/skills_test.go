@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSkillsFilter(t *testing.T) {
+	home, workspace := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	for dir, skills := range map[string][]string{
+		filepath.Join(home, ".picoclaw", "skills"): {"weather", "tmux"},
+		filepath.Join(workspace, "skills"):         {"weather", "github-issues"},
+	} {
+		for _, name := range skills {
+			path := filepath.Join(dir, name, "SKILL.md")
+			os.MkdirAll(filepath.Dir(path), 0755)
+			content := "---\nname: " + name + "\ndescription: The " + name + " skill\n---\n"
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: workspace, Model: "test-model"},
+			List:     []config.AgentConfig{{ID: "main", Default: true, Skills: []string{"weather", "github-*"}}},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	agent := al.registry.GetDefaultAgent()
+
+	prompt := agent.ContextBuilder.BuildSystemPrompt("")
+	if !strings.Contains(prompt, "<name>github-issues</name>") || strings.Contains(prompt, "tmux") ||
+		!strings.Contains(prompt, filepath.Join(workspace, "skills", "weather", "SKILL.md")) ||
+		strings.Contains(prompt, filepath.Join(home, ".picoclaw", "skills", "weather")) {
+		t.Errorf("system prompt offers the wrong skills:\n%s", prompt)
+	}
+
+	reply, handled := al.handleCommand(context.Background(), bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "/skills"})
+	want := "Skills of agent main:\n" +
+		"- github-issues (workspace): The github-issues skill\n" +
+		"- weather (workspace, overrides global): The weather skill\n\n" +
+		"1 more installed, not enabled for this agent."
+	if !handled || reply != want {
+		t.Errorf("/skills = %q, want %q", reply, want)
+	}
+}
@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// streamInterval is the minimum delay between partial updates for one reply.
+// Channels edit a message per update, so this keeps us under their rate limits.
+const streamInterval = time.Second
+
+// streamSeq numbers the turns whose replies may be streamed.
+var streamSeq atomic.Uint64
+
+type streamIDKey struct{}
+
+// withStream returns a context for a turn whose reply is streamed to the
+// channel under a new stream ID, and that ID.
+func withStream(ctx context.Context) (context.Context, string) {
+	id := strconv.FormatUint(streamSeq.Add(1), 10)
+	return context.WithValue(ctx, streamIDKey{}, id), id
+}
+
+// streamIDFromContext returns the stream ID set by withStream, if any.
+func streamIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(streamIDKey{}).(string)
+	return id
+}
+
+// replyStream receives the chunks of each LLM call in a turn. Reset is
+// called before every call, including retries and fallback attempts.
+type replyStream interface {
+	Reset()
+	OnChunk(chunk providers.StreamChunk)
+}
+
+// streamPublisher turns provider stream chunks into throttled partial
+// outbound messages carrying the text accumulated so far.
+type streamPublisher struct {
+	bus      *bus.MessageBus
+	channel  string
+	chatID   string
+	streamID string
+	interval time.Duration
+
+	mu       sync.Mutex
+	content  strings.Builder
+	lastSent time.Time
+}
+
+func newStreamPublisher(msgBus *bus.MessageBus, channel, chatID, streamID string) *streamPublisher {
+	return &streamPublisher{
+		bus:      msgBus,
+		channel:  channel,
+		chatID:   chatID,
+		streamID: streamID,
+		interval: streamInterval,
+	}
+}
+
+// Reset discards accumulated text; called before each LLM request so retries
+// and later iterations start from an empty preview.
+func (p *streamPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.content.Reset()
+}
+
+func (p *streamPublisher) OnChunk(chunk providers.StreamChunk) {
+	if chunk.ContentDelta == "" {
+		return
+	}
+
+	p.mu.Lock()
+	p.content.WriteString(chunk.ContentDelta)
+	if time.Since(p.lastSent) < p.interval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSent = time.Now()
+	content := p.content.String()
+	p.mu.Unlock()
+
+	p.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  p.channel,
+		ChatID:   p.chatID,
+		Content:  content,
+		Partial:  true,
+		StreamID: p.streamID,
+	})
+}
+
+// deltaStream forwards text deltas to a callback, for callers that render
+// the reply themselves (the OpenAI-compatible API). Text from an earlier
+// call in the turn, written before tool calls, is kept apart from the next
+// call's text by a blank line.
+type deltaStream struct {
+	onDelta   func(string)
+	wrote     bool // the current call produced text
+	separated bool // text was written by an earlier call
+}
+
+func (d *deltaStream) Reset() {
+	if d.wrote {
+		d.separated = true
+	}
+	d.wrote = false
+}
+
+func (d *deltaStream) OnChunk(chunk providers.StreamChunk) {
+	if chunk.ContentDelta == "" {
+		return
+	}
+	if !d.wrote && d.separated {
+		d.onDelta("\n\n")
+	}
+	d.wrote = true
+	d.onDelta(chunk.ContentDelta)
+}
+
+// streamPublisherFor returns the stream for the reply to opts, or nil when
+// streaming is disabled, the turn was not started with withStream, or the
+// target channel cannot render partial replies.
+func (al *AgentLoop) streamPublisherFor(ctx context.Context, opts processOptions) replyStream {
+	if opts.OnDelta != nil {
+		return &deltaStream{onDelta: opts.OnDelta}
+	}
+	streamID := streamIDFromContext(ctx)
+	if !opts.Stream || streamID == "" || !al.streamsTo(opts.Channel) {
+		return nil
+	}
+	return newStreamPublisher(al.bus, opts.Channel, opts.ChatID, streamID)
+}
+
+// streamsTo reports whether replies to channel are streamed.
+func (al *AgentLoop) streamsTo(channel string) bool {
+	if !al.cfg.Agents.Defaults.Streaming || constants.IsInternalChannel(channel) || al.channelManager == nil {
+		return false
+	}
+	return al.channelManager.SupportsStreaming(channel)
+}
+
+// endStream tells the channel that the turn streamed as streamID is over,
+// so it stops tracking the message it was editing. It is published whether
+// or not a final reply was, since the message tool may have answered
+// instead or the turn may have failed.
+func (al *AgentLoop) endStream(channel, chatID, streamID string) {
+	if !al.streamsTo(channel) {
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:   channel,
+		ChatID:    chatID,
+		StreamID:  streamID,
+		StreamEnd: true,
+	})
+}
+
+// chatWithProvider uses the streaming API when the provider supports it and
+// a stream callback is set, falling back to a regular Chat call otherwise.
+func chatWithProvider(ctx context.Context, provider providers.LLMProvider, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}, onChunk providers.StreamCallback) (*providers.LLMResponse, error) {
+	if sp, ok := provider.(providers.StreamingProvider); ok && onChunk != nil {
+		return sp.ChatStream(ctx, messages, tools, model, options, onChunk)
+	}
+	return provider.Chat(ctx, messages, tools, model, options)
+}
@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+type fakeStreamingChannel struct {
+	*channels.BaseChannel
+}
+
+func (c *fakeStreamingChannel) Start(ctx context.Context) error { return nil }
+func (c *fakeStreamingChannel) Stop(ctx context.Context) error  { return nil }
+func (c *fakeStreamingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+func (c *fakeStreamingChannel) SendPartial(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+func (c *fakeStreamingChannel) EndStream(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+
+// withStreaming turns streaming on or off.
+func withStreaming(on bool) func(cfg *config.Config) {
+	return func(cfg *config.Config) { cfg.Agents.Defaults.Streaming = on }
+}
+
+// addStreamingChannel gives al a channel manager with a streaming channel
+// named "fake".
+func addStreamingChannel(t *testing.T, al *AgentLoop, msgBus *bus.MessageBus) {
+	t.Helper()
+	cm, err := channels.NewManager(al.cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	cm.RegisterChannel("fake", &fakeStreamingChannel{
+		BaseChannel: channels.NewBaseChannel("fake", nil, msgBus, nil),
+	})
+	al.SetChannelManager(cm)
+}
+
+// drainOutbound returns the outbound messages queued so far.
+func drainOutbound(msgBus *bus.MessageBus) []bus.OutboundMessage {
+	var out []bus.OutboundMessage
+	for {
+		msg, ok := msgBus.PollOutbound()
+		if !ok {
+			return out
+		}
+		out = append(out, msg)
+	}
+}
+
+func TestAgentLoop_StreamsPartialReplies(t *testing.T) {
+	provider := &scriptedProvider{reply: func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		return &providers.LLMResponse{Content: "Hello, world"}, nil
+	}}
+	al, msgBus := newTestLoop(t, provider, withStreaming(true))
+	addStreamingChannel(t, al, msgBus)
+
+	al.handleInbound(context.Background(), bus.InboundMessage{Channel: "fake", SenderID: "user1", ChatID: "chat1", Content: "hi"})
+
+	if provider.streamed != 1 {
+		t.Fatalf("streamed calls = %d, want ChatStream to be used", provider.streamed)
+	}
+	out := drainOutbound(msgBus)
+	if len(out) != 3 {
+		t.Fatalf("outbound = %+v, want partial, final and end of stream", out)
+	}
+	partial, final, end := out[0], out[1], out[2]
+	if !partial.Partial || partial.ChatID != "chat1" || partial.Content != "Hello, " || partial.StreamID == "" {
+		t.Errorf("partial = %+v", partial)
+	}
+	if final.Partial || final.Content != "Hello, world" || final.StreamID != partial.StreamID {
+		t.Errorf("final = %+v, want the partial's stream ID", final)
+	}
+	if !end.StreamEnd || end.StreamID != partial.StreamID || end.Content != "" {
+		t.Errorf("end = %+v", end)
+	}
+}
+
+func TestAgentLoop_StreamEndsWithoutFinalSend(t *testing.T) {
+	// The first turn answers through the message tool, so its final reply
+	// is not sent and only the end of stream clears the preview.
+	provider := &scriptedProvider{reply: func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		if call == 1 {
+			return &providers.LLMResponse{Content: "Telling them", ToolCalls: []providers.ToolCall{{
+				ID: "call-1", Name: "message", Arguments: map[string]interface{}{"content": "from the tool"},
+			}}}, nil
+		}
+		return &providers.LLMResponse{Content: "done"}, nil
+	}}
+	al, msgBus := newTestLoop(t, provider, withStreaming(true))
+	addStreamingChannel(t, al, msgBus)
+	msg := bus.InboundMessage{Channel: "fake", SenderID: "user1", ChatID: "chat1", Content: "hi"}
+
+	al.handleInbound(context.Background(), msg)
+	first := drainOutbound(msgBus)
+	var streamID string
+	for _, out := range first {
+		if out.Partial {
+			streamID = out.StreamID
+		}
+		if !out.Partial && !out.StreamEnd && out.Content != "from the tool" {
+			t.Errorf("final reply sent after the message tool answered: %+v", out)
+		}
+	}
+	if last := first[len(first)-1]; streamID == "" || !last.StreamEnd || last.StreamID != streamID {
+		t.Fatalf("first turn outbound = %+v, want it to end its stream", first)
+	}
+
+	al.handleInbound(context.Background(), msg)
+	for _, out := range drainOutbound(msgBus) {
+		if out.StreamID == streamID {
+			t.Errorf("second turn reuses the first turn's stream: %+v", out)
+		}
+	}
+}
+
+func TestAgentLoop_StreamingDisabled(t *testing.T) {
+	provider := &scriptedProvider{}
+	al, msgBus := newTestLoop(t, provider, withStreaming(false))
+	addStreamingChannel(t, al, msgBus)
+
+	al.handleInbound(context.Background(), bus.InboundMessage{Channel: "fake", SenderID: "user1", ChatID: "chat1", Content: "hi"})
+
+	if provider.streamed != 0 {
+		t.Fatalf("streamed calls = %d, want Chat to be used", provider.streamed)
+	}
+	if out := drainOutbound(msgBus); len(out) != 1 || out[0].Content != "ok" || out[0].Partial || out[0].StreamEnd {
+		t.Fatalf("outbound = %+v, want only the final reply", out)
+	}
+}
+
+func TestStreamPublisher_Throttles(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	p := newStreamPublisher(msgBus, "fake", "chat1", "1")
+	p.interval = time.Hour
+
+	p.OnChunk(providers.StreamChunk{ContentDelta: "a"})
+	p.OnChunk(providers.StreamChunk{ContentDelta: "b"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || msg.Content != "a" {
+		t.Fatalf("expected first chunk to be published immediately, got %+v", msg)
+	}
+	if _, ok := msgBus.SubscribeOutbound(ctx); ok {
+		t.Fatal("expected second chunk to be throttled")
+	}
+}
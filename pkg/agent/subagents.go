@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// subagentLimits returns how deeply subagents may nest and how many one
+// agent may run at once.
+func subagentLimits(defaults *config.AgentDefaults) (maxDepth, maxParallel int) {
+	maxDepth = defaults.MaxSubagentDepth
+	if maxDepth == 0 {
+		maxDepth = 1
+	}
+	maxParallel = defaults.MaxParallelSubagents
+	if maxParallel == 0 {
+		maxParallel = 4
+	}
+	return maxDepth, maxParallel
+}
+
+// subagentTimeout returns how long a subagent task may run.
+func subagentTimeout(defaults *config.AgentDefaults) time.Duration {
+	if defaults.SubagentTimeout > 0 {
+		return time.Duration(defaults.SubagentTimeout) * time.Second
+	}
+	return 10 * time.Minute
+}
+
+// subagentOnlyTools are the tools a subagent does not get: it cannot start
+// background subagents of its own, so it has none to manage either.
+var subagentOnlyTools = []string{"spawn", "subagent_status", "subagent_cancel", "subagent_wait"}
+
+// PersistSubagentTasks keeps every agent's subagent task records in its
+// workspace, so that tasks cut short by a restart are reported as
+// interrupted when the next run calls this. Only the long-running gateway
+// does; other commands share the workspace and would mistake its running
+// tasks for interrupted ones.
+func (al *AgentLoop) PersistSubagentTasks() {
+	for _, agentID := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok || agent.SubagentTasks == nil {
+			continue
+		}
+		if err := agent.SubagentTasks.Persist(); err != nil {
+			logger.WarnCF("agent", "Failed to load subagent tasks", map[string]interface{}{
+				"agent_id": agentID,
+				"error":    err.Error(),
+			})
+		}
+	}
+}
+
+// subagentResolver returns how subagents started by parent run: as the
+// agent they name, or as parent when they name none. A subagent gets that
+// agent's workspace, skills, memory and tools, less subagentOnlyTools, and
+// its subagents.model in place of its model when one is set. Its tool calls
+// need approval like the agent's own.
+func (al *AgentLoop) subagentResolver(parent *AgentInstance) tools.SubagentResolver {
+	return func(agentID, task string) (*tools.SubagentTarget, error) {
+		target := parent
+		if agentID != "" {
+			var ok bool
+			if target, ok = al.registry.GetAgent(agentID); !ok {
+				return nil, fmt.Errorf("agent %q is not configured", agentID)
+			}
+		}
+
+		var llm providers.LLMProvider
+		var model, modelID string
+		if sub := target.Subagents; sub != nil && sub.Model != nil && strings.TrimSpace(sub.Model.Primary) != "" {
+			model = strings.TrimSpace(sub.Model.Primary)
+			llm, modelID = al.namedModelProvider(target, model)
+		} else {
+			llm, modelID = al.primaryProvider(target)
+			model = target.Model
+			if len(target.Candidates) > 0 {
+				model = candidateModel(target, target.Candidates[0].Provider, target.Candidates[0].Model)
+			}
+		}
+
+		// A copy of the agent running with the reduced registry, for approvals
+		runner := *target
+		runner.Tools = target.Tools.Without(subagentOnlyTools...)
+
+		return &tools.SubagentTarget{
+			AgentID:      target.ID,
+			SystemPrompt: target.ContextBuilder.BuildSubagentPrompt(task, runner.Tools),
+			Loop: tools.ToolLoopConfig{
+				Provider:      llm,
+				Model:         modelID,
+				Chat:          al.subagentChat(target, llm, model, modelID),
+				Tools:         runner.Tools,
+				MaxIterations: target.MaxIterations,
+				LLMOptions: map[string]any{
+					"max_tokens":  target.MaxTokens,
+					"temperature": target.Temperature,
+				},
+				ExecuteCalls: func(ctx context.Context, calls []providers.ToolCall, channel, chatID string) []*tools.ToolResult {
+					caller := tools.CallerFromContext(ctx)
+					return al.executeToolCalls(ctx, &runner, processOptions{
+						SessionKey: caller.SessionKey,
+						SenderID:   caller.SenderID,
+						Channel:    channel,
+						ChatID:     chatID,
+					}, calls, nil)
+				},
+			},
+		}, nil
+	}
+}
+
+// subagentChat returns the LLM call of subagents running as target, on
+// model (the name usage is recorded under) and modelID. Their tokens count
+// against the session that started them: each call is recorded in the
+// usage ledger under target and that session, and once the session's daily
+// budget is spent calls move to the budget model or are refused.
+func (al *AgentLoop) subagentChat(target *AgentInstance, llm providers.LLMProvider, model, modelID string) func(context.Context, []providers.Message, []providers.ToolDefinition, map[string]any) (*providers.LLMResponse, error) {
+	return func(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, options map[string]any) (*providers.LLMResponse, error) {
+		sessionKey := tools.CallerFromContext(ctx).SessionKey
+		llm, model, modelID := llm, model, modelID
+		downgrade, refusal := al.checkBudget(sessionKey)
+		if refusal != "" {
+			return nil, errors.New(refusal)
+		}
+		if downgrade != "" {
+			model = downgrade
+			llm, modelID = al.namedModelProvider(target, downgrade)
+		}
+
+		response, err := llm.Chat(ctx, messages, defs, modelID, options)
+		if err != nil {
+			return nil, err
+		}
+		channel, _ := tools.ToolContext(ctx, "", "")
+		al.recordUsage(target, sessionKey, channel, model, modelID, response.Usage)
+		return response, nil
+	}
+}
+
+// tasksCommand answers /tasks for the chat msg came from: with no argument
+// it lists the subagent tasks started there, "/tasks <id>" shows one with
+// its result and "/tasks cancel <id>" stops one.
+func (al *AgentLoop) tasksCommand(msg bus.InboundMessage, args []string) string {
+	agent, _, _ := al.resolveSession(msg)
+	manager := agent.SubagentTasks
+	if manager == nil {
+		return "Background tasks are not available."
+	}
+	inChat := func(task *tools.SubagentTask) bool {
+		return task.OriginChannel == msg.Channel && task.OriginChatID == msg.ChatID
+	}
+
+	if len(args) == 0 {
+		var lines []string
+		for _, task := range manager.ListTasks() {
+			if inChat(task) {
+				lines = append(lines, tools.FormatSubagentTask(task))
+			}
+		}
+		if len(lines) == 0 {
+			return "No background tasks in this chat."
+		}
+		return "Background tasks:\n" + strings.Join(lines, "\n")
+	}
+
+	cancel := args[0] == "cancel"
+	if cancel {
+		if len(args) < 2 {
+			return "Usage: /tasks cancel <id>"
+		}
+		args = args[1:]
+	}
+	task, ok := manager.GetTask(args[0])
+	if !ok || !inChat(task) {
+		return fmt.Sprintf("No task %s in this chat.", args[0])
+	}
+	if cancel {
+		if err := manager.Cancel(task.ID); err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("Cancelled task %s.", task.ID)
+	}
+	if task.Status == "running" {
+		return tools.FormatSubagentTask(task)
+	}
+	return tools.FormatSubagentTask(task) + "\n\n" + task.Result
+}
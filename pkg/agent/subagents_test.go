@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestSubagent_RunsAsTargetAgent(t *testing.T) {
+	researchWorkspace := t.TempDir()
+	// The system prompt is the first message of each call.
+	var systemPrompts []string
+	provider := &scriptedProvider{reply: func(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+		systemPrompts = append(systemPrompts, messages[0].Content)
+		return execOnce("rm -rf data")(ctx, call, messages, model)
+	}}
+	al, _ := newTestLoop(t, provider, func(cfg *config.Config) {
+		cfg.Agents.Defaults.Model = "main-model"
+		cfg.Agents.List = []config.AgentConfig{
+			{ID: "main", Default: true, Subagents: &config.SubagentsConfig{AllowAgents: []string{"researcher"}}},
+			{
+				ID:        "researcher",
+				Workspace: researchWorkspace,
+				Model:     &config.AgentModelConfig{Primary: "research-model"},
+				Subagents: &config.SubagentsConfig{Model: &config.AgentModelConfig{Primary: "cheap-model"}},
+			},
+		}
+		cfg.Tools.Approval = config.ApprovalConfig{Enabled: true, ExecPatterns: []string{`\brm\b`}}
+	})
+	mainAgent, _ := al.registry.GetAgent("main")
+	researcher, _ := al.registry.GetAgent("researcher")
+	exec := &fakeExecTool{}
+	researcher.Tools.Register(exec)
+
+	done := make(chan *tools.ToolResult, 1)
+	result := mainAgent.Tools.ExecuteWithContext(context.Background(), "spawn",
+		map[string]interface{}{"task": "clean up", "agent_id": "researcher"}, "cli", "direct",
+		func(ctx context.Context, result *tools.ToolResult) { done <- result })
+	if result.IsError {
+		t.Fatalf("spawn failed: %s", result.ForLLM)
+	}
+
+	var final *tools.ToolResult
+	select {
+	case final = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("subagent did not finish")
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if len(provider.models) != 2 || provider.models[0] != "cheap-model" {
+		t.Errorf("models = %v, want researcher's subagents.model", provider.models)
+	}
+	if prompt := systemPrompts[0]; !strings.Contains(prompt, researchWorkspace) || !strings.Contains(prompt, "# Subagent") || strings.Contains(prompt, "`spawn`") {
+		t.Errorf("system prompt is not the researcher's subagent prompt:\n%s", prompt)
+	}
+	offered := strings.Join(provider.tools[0], ",")
+	if !strings.Contains(offered, "exec") || strings.Contains(offered, "spawn") {
+		t.Errorf("tools offered = %s, want researcher's without spawn", offered)
+	}
+	if len(exec.ran) != 0 {
+		t.Errorf("exec ran %v without approval", exec.ran)
+	}
+	if !strings.Contains(final.ForLLM, "needs approval") {
+		t.Errorf("result = %q, want the refusal", final.ForLLM)
+	}
+
+	if result := mainAgent.Tools.ExecuteWithContext(context.Background(), "spawn",
+		map[string]interface{}{"task": "x", "agent_id": "ghost"}, "cli", "direct", nil); !result.IsError {
+		t.Error("spawned a subagent for an agent not in allow_agents")
+	}
+
+	msg := bus.InboundMessage{Channel: "cli", SenderID: "user", ChatID: "direct"}
+	if list := al.tasksCommand(msg, nil); !strings.Contains(list, "subagent-1 completed") || !strings.Contains(list, "[researcher] clean up") {
+		t.Errorf("/tasks = %q", list)
+	}
+	if show := al.tasksCommand(msg, []string{"subagent-1"}); !strings.Contains(show, "needs approval") {
+		t.Errorf("/tasks subagent-1 = %q", show)
+	}
+	msg.ChatID = "other"
+	if list := al.tasksCommand(msg, nil); list != "No background tasks in this chat." {
+		t.Errorf("/tasks in another chat = %q", list)
+	}
+}
+
+func TestSubagent_UsageCountsAgainstCallerBudget(t *testing.T) {
+	provider := &scriptedProvider{reply: usageReply}
+	al, _ := newTestLoop(t, provider, func(cfg *config.Config) {
+		withBudget(100, "")(cfg)
+		cfg.Agents.List = []config.AgentConfig{
+			{ID: "main", Default: true, Subagents: &config.SubagentsConfig{AllowAgents: []string{"researcher"}}},
+			{ID: "researcher", Workspace: t.TempDir(), Model: &config.AgentModelConfig{Primary: "research-model"}},
+		}
+	})
+	mainAgent, _ := al.registry.GetAgent("main")
+	ctx := tools.WithToolContext(context.Background(), "test", "c1")
+	ctx = tools.WithCaller(ctx, tools.Caller{AgentID: "main", SessionKey: "agent:main:test:c1"})
+
+	spawn := func() *tools.ToolResult {
+		t.Helper()
+		done := make(chan *tools.ToolResult, 1)
+		result := mainAgent.Tools.ExecuteWithContext(ctx, "spawn",
+			map[string]interface{}{"task": "look it up", "agent_id": "researcher"}, "test", "c1",
+			func(ctx context.Context, result *tools.ToolResult) { done <- result })
+		if result.IsError {
+			t.Fatalf("spawn failed: %s", result.ForLLM)
+		}
+		select {
+		case final := <-done:
+			return final
+		case <-time.After(2 * time.Second):
+			t.Fatal("subagent did not finish")
+			return nil
+		}
+	}
+
+	spawn()
+	records, _ := al.ledger.Records(time.Time{})
+	if len(records) != 1 {
+		t.Fatalf("len(records) = %d, want the subagent's call", len(records))
+	}
+	if r := records[0]; r.AgentID != "researcher" || r.SessionKey != "agent:main:test:c1" || r.Channel != "test" || r.Model != "research-model" || r.TotalTokens() != 100 {
+		t.Errorf("record = %+v", r)
+	}
+
+	// The caller's budget is now spent, so the next subagent is refused.
+	if final := spawn(); !strings.Contains(final.ForLLM, "budget") {
+		t.Errorf("result = %q, want the budget refusal", final.ForLLM)
+	}
+	if len(provider.models) != 1 {
+		t.Errorf("provider calls = %d, want 1", len(provider.models))
+	}
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// summaryKeepTurns is how many recent turns stay verbatim after a
+	// summary, as long as they fit in a quarter of the context window.
+	summaryKeepTurns = 2
+	// Limits on what the summarizer sees of each message, in runes.
+	summaryMessageChars    = 4000
+	summaryToolArgsChars   = 300
+	summaryToolResultChars = 500
+)
+
+// summaryPrompt asks for the running summary to be updated with new
+// messages. Tool outcomes are called out because the tool results
+// themselves are gone once the messages are compacted.
+const summaryPrompt = `Update the running summary of a conversation with the new messages below.
+Keep facts, decisions, user preferences and open tasks. Record the outcome of every meaningful tool call: files written or edited (with paths), commands run and what they returned, jobs scheduled, messages sent, and errors that are not resolved yet. Drop small talk and intermediate steps.
+Reply with the updated summary only.`
+
+// summarizeSession folds the older turns of a session into its summary. Only
+// messages since the last checkpoint are read: they are split at turn
+// boundaries into chunks that fit the summary model, and each chunk is
+// folded into the running summary and compacted away before the next one.
+func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	history := agent.Sessions.GetHistory(sessionKey)
+	cut := al.compactionPoint(agent, history)
+	if cut == 0 {
+		return
+	}
+
+	summaryModel := agent.SummaryModel
+	if summaryModel == "" {
+		summaryModel = agent.Model
+	}
+	window, _ := resolveContextBudget(al.cfg, summaryModel)
+
+	summary := agent.Sessions.GetSummary(sessionKey)
+	compacted := 0
+	defer func() {
+		if compacted > 0 {
+			agent.Sessions.Save(sessionKey)
+		}
+	}()
+	for _, chunk := range splitTurns(history[:cut], window/2, agent.ContextBuilder.CountTokens) {
+		next, err := al.summarizeBatch(ctx, agent, sessionKey, chunk, summary)
+		if err != nil || strings.TrimSpace(next) == "" {
+			logger.WarnCF("agent", "Summarization stopped", map[string]interface{}{
+				"session_key": sessionKey,
+				"compacted":   compacted,
+				"error":       fmt.Sprintf("%v", err),
+			})
+			return
+		}
+		if !agent.Sessions.Compact(sessionKey, chunk, next) {
+			// History was rewritten meanwhile, e.g. by forced compression.
+			return
+		}
+		summary = next
+		compacted += len(chunk)
+	}
+
+	logger.InfoCF("agent", "Summarized session history", map[string]interface{}{
+		"session_key":   sessionKey,
+		"compacted":     compacted,
+		"summary_model": summaryModel,
+	})
+}
+
+// compactionPoint returns the index history is summarized up to: the start of
+// the oldest turn kept verbatim. The last turn is always kept, and up to
+// summaryKeepTurns while they fit in a quarter of the context window.
+func (al *AgentLoop) compactionPoint(agent *AgentInstance, history []providers.Message) int {
+	keepTokens := agent.ContextWindow / 4
+	cut := len(history)
+	for kept := 0; kept < summaryKeepTurns; kept++ {
+		start := previousTurnStart(history, cut)
+		if start < 0 {
+			break
+		}
+		if kept > 0 && agent.ContextBuilder.CountTokens(history[start:]) > keepTokens {
+			break
+		}
+		cut = start
+	}
+	if cut == len(history) {
+		return 0
+	}
+	return cut
+}
+
+// previousTurnStart returns the index of the last user message before end,
+// or -1 if there is none.
+func previousTurnStart(history []providers.Message, end int) int {
+	for i := end - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitTurns splits messages at turn boundaries into chunks of at most
+// maxTokens. A turn larger than maxTokens becomes a chunk of its own.
+func splitTurns(messages []providers.Message, maxTokens int, count func([]providers.Message) int) [][]providers.Message {
+	var chunks [][]providers.Message
+	start := 0
+	for start < len(messages) {
+		end := start
+		for end < len(messages) {
+			next := end + 1
+			for next < len(messages) && messages[next].Role != "user" {
+				next++
+			}
+			if end > start && count(messages[start:next]) > maxTokens {
+				break
+			}
+			end = next
+		}
+		chunks = append(chunks, messages[start:end])
+		start = end
+	}
+	return chunks
+}
+
+// summarizeBatch folds batch into the running summary.
+func (al *AgentLoop) summarizeBatch(ctx context.Context, agent *AgentInstance, sessionKey string, batch []providers.Message, existingSummary string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString(summaryPrompt)
+	sb.WriteString("\n\nCURRENT SUMMARY:\n")
+	if existingSummary != "" {
+		sb.WriteString(existingSummary)
+	} else {
+		sb.WriteString("(none)")
+	}
+	sb.WriteString("\n\nNEW MESSAGES:\n")
+	sb.WriteString(summaryTranscript(batch))
+
+	return al.summaryChat(ctx, agent, sessionKey, sb.String())
+}
+
+// summaryTranscript renders messages for the summarizer, including tool calls
+// with their arguments and the start of each tool result.
+func summaryTranscript(messages []providers.Message) string {
+	toolNames := make(map[string]string)
+	var sb strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case "tool":
+			name := toolNames[m.ToolCallID]
+			if name == "" {
+				name = "tool"
+			}
+			fmt.Fprintf(&sb, "result of %s: %s\n", name, utils.Truncate(m.Content, summaryToolResultChars))
+		default:
+			if strings.TrimSpace(m.Content) != "" {
+				fmt.Fprintf(&sb, "%s: %s\n", m.Role, utils.Truncate(m.Content, summaryMessageChars))
+			}
+			for _, tc := range m.ToolCalls {
+				name, args := tc.Name, ""
+				if tc.Function != nil {
+					name, args = tc.Function.Name, tc.Function.Arguments
+				} else if len(tc.Arguments) > 0 {
+					data, _ := json.Marshal(tc.Arguments)
+					args = string(data)
+				}
+				toolNames[tc.ID] = name
+				fmt.Fprintf(&sb, "%s called %s(%s)\n", m.Role, name, utils.Truncate(args, summaryToolArgsChars))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// summaryChat sends a summarization prompt to the summary model, or the
+// agent's primary model if none is set, and records its usage against the
+// session.
+func (al *AgentLoop) summaryChat(ctx context.Context, agent *AgentInstance, sessionKey, prompt string) (string, error) {
+	var llm providers.LLMProvider
+	var model, modelID string
+	if agent.SummaryModel != "" {
+		llm, modelID = al.namedModelProvider(agent, agent.SummaryModel)
+		model = agent.SummaryModel
+	} else {
+		llm, modelID = al.primaryProvider(agent)
+		model = agent.Model
+		if len(agent.Candidates) > 0 {
+			model = candidateModel(agent, agent.Candidates[0].Provider, agent.Candidates[0].Model)
+		}
+	}
+
+	response, err := llm.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, modelID, map[string]interface{}{
+		"max_tokens":  1024,
+		"temperature": 0.3,
+	})
+	if err != nil {
+		return "", err
+	}
+	al.recordUsage(agent, sessionKey, "", model, modelID, response.Usage)
+	return response.Content, nil
+}
+
+// forceCompression drops the oldest half of the history when the context
+// window overflows. It cuts at a turn boundary so tool calls keep their
+// results, always keeps the current turn, and notes the drop in the summary.
+func (al *AgentLoop) forceCompression(agent *AgentInstance, sessionKey string) {
+	history := agent.Sessions.GetHistory(sessionKey)
+	current := previousTurnStart(history, len(history))
+	if current <= 0 {
+		return
+	}
+
+	cut := current / 2
+	for cut < current && history[cut].Role != "user" {
+		cut++
+	}
+	if cut == 0 {
+		cut = current
+	}
+
+	note := fmt.Sprintf("[%d earlier messages were dropped to fit the context window]", cut)
+	summary := strings.TrimSpace(agent.Sessions.GetSummary(sessionKey) + "\n\n" + note)
+	if !agent.Sessions.Compact(sessionKey, history[:cut], summary) {
+		return
+	}
+	agent.Sessions.Save(sessionKey)
+
+	logger.WarnCF("agent", "Forced compression executed", map[string]interface{}{
+		"session_key":  sessionKey,
+		"dropped_msgs": cut,
+		"new_count":    len(history) - cut,
+	})
+}
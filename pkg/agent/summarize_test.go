@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// summaryReply answers every prompt with a numbered summary.
+func summaryReply(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{Content: "summary " + string(rune('0'+call))}, nil
+}
+
+// toolTurn is a user request answered with one write_file call.
+func toolTurn(n string) []providers.Message {
+	return []providers.Message{
+		{Role: "user", Content: "write note " + n},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{
+			ID: "call-" + n, Type: "function",
+			Function: &providers.FunctionCall{Name: "write_file", Arguments: `{"path":"notes/` + n + `.md"}`},
+		}}},
+		{Role: "tool", Content: "File written: notes/" + n + ".md", ToolCallID: "call-" + n},
+		{Role: "assistant", Content: "Saved note " + n},
+	}
+}
+
+func TestSummarizeSession_IsToolAwareAndIncremental(t *testing.T) {
+	provider := &scriptedProvider{reply: summaryReply}
+	al, _ := newTestLoop(t, provider, nil)
+	agent := al.registry.GetDefaultAgent()
+	key := "agent:main:test"
+
+	agent.Sessions.GetOrCreate(key)
+	var history []providers.Message
+	for _, n := range []string{"a", "b", "c", "d"} {
+		history = append(history, toolTurn(n)...)
+	}
+	agent.Sessions.SetHistory(key, history)
+
+	al.summarizeSession(agent, key)
+
+	if len(provider.prompts) != 1 {
+		t.Fatalf("summary calls = %d, want 1", len(provider.prompts))
+	}
+	prompt := provider.prompts[0]
+	for _, want := range []string{
+		`assistant called write_file({"path":"notes/a.md"})`,
+		"result of write_file: File written: notes/b.md",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "notes/c.md") {
+		t.Error("prompt includes a turn that should stay verbatim")
+	}
+
+	s := agent.Sessions.Get(key)
+	if len(s.Messages) != 8 || s.Messages[0].Content != "write note c" {
+		t.Fatalf("history after summary starts with %+v (%d messages), want the last two turns", s.Messages[0], len(s.Messages))
+	}
+	if s.Summary != "summary 1" || s.Covered() != 8 {
+		t.Errorf("summary = %q covering %d, want \"summary 1\" covering 8", s.Summary, s.Covered())
+	}
+
+	// The next summary reads only the messages since the checkpoint.
+	for _, n := range []string{"e", "f"} {
+		for _, m := range toolTurn(n) {
+			agent.Sessions.AddFullMessage(key, m)
+		}
+	}
+	al.summarizeSession(agent, key)
+
+	if len(provider.prompts) != 2 {
+		t.Fatalf("summary calls = %d, want 2", len(provider.prompts))
+	}
+	prompt = provider.prompts[1]
+	if !strings.Contains(prompt, "CURRENT SUMMARY:\nsummary 1") {
+		t.Errorf("second prompt does not build on the first summary:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "notes/a.md") || !strings.Contains(prompt, "notes/d.md") {
+		t.Errorf("second prompt should cover exactly turns c and d:\n%s", prompt)
+	}
+	if s := agent.Sessions.Get(key); s.Covered() != 16 || len(s.Checkpoints) != 2 {
+		t.Errorf("covered = %d with %d checkpoints, want 16 with 2", s.Covered(), len(s.Checkpoints))
+	}
+}
+
+func TestSummarizeSession_UsesSummaryModel(t *testing.T) {
+	provider := &scriptedProvider{reply: summaryReply}
+	al, _ := newTestLoop(t, provider, func(cfg *config.Config) {
+		cfg.Agents.Defaults.SummaryModel = "cheap-model"
+	})
+	agent := al.registry.GetDefaultAgent()
+	key := "agent:main:test"
+
+	agent.Sessions.GetOrCreate(key)
+	agent.Sessions.SetHistory(key, append(append(toolTurn("a"), toolTurn("b")...), toolTurn("c")...))
+	al.summarizeSession(agent, key)
+
+	if len(provider.models) != 1 || provider.models[0] != "cheap-model" {
+		t.Errorf("summary models = %v, want [cheap-model]", provider.models)
+	}
+}
+
+func TestSplitTurns(t *testing.T) {
+	var messages []providers.Message
+	for _, n := range []string{"a", "b", "c"} {
+		messages = append(messages, toolTurn(n)...)
+	}
+	count := func(msgs []providers.Message) int { return len(msgs) }
+
+	chunks := splitTurns(messages, 8, count)
+	if len(chunks) != 2 || len(chunks[0]) != 8 || len(chunks[1]) != 4 {
+		t.Fatalf("chunk sizes = %v, want [8 4]", chunkSizes(chunks))
+	}
+	for _, chunk := range chunks {
+		if chunk[0].Role != "user" {
+			t.Errorf("chunk starts with %s, want a user message", chunk[0].Role)
+		}
+	}
+
+	// A turn larger than the limit is a chunk of its own.
+	if chunks := splitTurns(messages, 2, count); len(chunks) != 3 {
+		t.Errorf("chunk sizes = %v, want one per turn", chunkSizes(chunks))
+	}
+}
+
+func chunkSizes(chunks [][]providers.Message) []int {
+	sizes := make([]int, len(chunks))
+	for i, c := range chunks {
+		sizes[i] = len(c)
+	}
+	return sizes
+}
+
+func TestForceCompression_CutsAtTurnBoundary(t *testing.T) {
+	al, _ := newTestLoop(t, &scriptedProvider{reply: summaryReply}, nil)
+	agent := al.registry.GetDefaultAgent()
+	key := "agent:main:test"
+
+	agent.Sessions.GetOrCreate(key)
+	history := append(append(toolTurn("a"), toolTurn("b")...), toolTurn("c")...)
+	history = append(history, providers.Message{Role: "user", Content: "current"})
+	agent.Sessions.SetHistory(key, history)
+
+	al.forceCompression(agent, key)
+
+	s := agent.Sessions.Get(key)
+	if s.Messages[0].Role != "user" {
+		t.Errorf("history starts with a %s message, want user", s.Messages[0].Role)
+	}
+	if last := s.Messages[len(s.Messages)-1]; last.Content != "current" {
+		t.Errorf("current turn was dropped: last message %+v", last)
+	}
+	// Half of the 12 earlier messages, rounded up to the next turn.
+	if len(s.Messages) != 5 || !strings.Contains(s.Summary, "8 earlier messages were dropped") {
+		t.Errorf("kept %d messages with summary %q, want 5 and a note about 8 dropped", len(s.Messages), s.Summary)
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// recordUsage adds one LLM call to the usage ledger. model is the name the
+// call is reported under; modelID is the ID sent to the provider, used as a
+// second key when pricing.
+func (al *AgentLoop) recordUsage(agent *AgentInstance, sessionKey, channel, model, modelID string, u *providers.UsageInfo) {
+	if al.ledger == nil || u == nil {
+		return
+	}
+	record := usage.Record{
+		AgentID:          agent.ID,
+		SessionKey:       sessionKey,
+		Channel:          channel,
+		Model:            model,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+	}
+	record.Cost = al.prices.Cost(record.PromptTokens, record.CompletionTokens, model, modelID)
+	if err := al.ledger.Add(record); err != nil {
+		logger.WarnCF("agent", "Failed to record usage", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// candidateModel returns the name usage is recorded under for a candidate:
+// the reference it was configured with (usually a model_list model_name),
+// or provider/model when it isn't one of the agent's candidates.
+func candidateModel(agent *AgentInstance, provider, model string) string {
+	for _, candidates := range [][]providers.FallbackCandidate{agent.Candidates, agent.ImageCandidates} {
+		for _, c := range candidates {
+			if c.Provider == provider && c.Model == model && c.Ref != "" {
+				return c.Ref
+			}
+		}
+	}
+	if provider == "" {
+		return model
+	}
+	return providers.ModelKey(provider, model)
+}
+
+// checkBudget applies agents.defaults.daily_token_budget to a session. It
+// returns the model to downgrade to, or a refusal message when no
+// budget_model is configured. Both are empty while the session is in budget.
+func (al *AgentLoop) checkBudget(sessionKey string) (downgrade string, refusal string) {
+	defaults := al.cfg.Agents.Defaults
+	if al.ledger == nil || defaults.DailyTokenBudget <= 0 {
+		return "", ""
+	}
+	used := al.ledger.SessionTokensToday(sessionKey)
+	if used < defaults.DailyTokenBudget {
+		return "", ""
+	}
+
+	logger.InfoCF("agent", "Daily token budget exhausted",
+		map[string]interface{}{
+			"session_key":  sessionKey,
+			"used":         used,
+			"budget":       defaults.DailyTokenBudget,
+			"budget_model": defaults.BudgetModel,
+		})
+	if defaults.BudgetModel != "" {
+		return defaults.BudgetModel, ""
+	}
+	return "", fmt.Sprintf("Daily token budget for this conversation is used up (%d/%d tokens). It resets at midnight.",
+		used, defaults.DailyTokenBudget)
+}
+
+// usageCommand answers /usage [today|week].
+func (al *AgentLoop) usageCommand(msg bus.InboundMessage, args []string) string {
+	if al.ledger == nil {
+		return "Usage tracking is not available"
+	}
+
+	period := "today"
+	if len(args) > 0 {
+		period = args[0]
+	}
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var since time.Time
+	switch period {
+	case "today":
+		since = midnight
+	case "week":
+		since = midnight.AddDate(0, 0, -6)
+	default:
+		return "Usage: /usage [today|week]"
+	}
+
+	records, err := al.ledger.Records(since)
+	if err != nil {
+		return fmt.Sprintf("Failed to read usage: %v", err)
+	}
+
+	_, sessionKey, _ := al.resolveSession(msg)
+	var session []usage.Record
+	for _, r := range records {
+		if r.SessionKey == sessionKey {
+			session = append(session, r)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Usage (%s)\n", period)
+	fmt.Fprintf(&sb, "This conversation: %s\n", usage.Sum(session))
+	fmt.Fprintf(&sb, "All conversations: %s\n", usage.Sum(records))
+	for _, g := range usage.GroupBy(records, usage.ByModel) {
+		fmt.Fprintf(&sb, "  %s: %s\n", g.Key, g.Totals)
+	}
+	if budget := al.cfg.Agents.Defaults.DailyTokenBudget; budget > 0 {
+		fmt.Fprintf(&sb, "Daily budget: %d/%d tokens used", al.ledger.SessionTokensToday(sessionKey), budget)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
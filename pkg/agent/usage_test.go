@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// usageReply answers "ok" and reports 100 tokens used.
+func usageReply(ctx context.Context, call int, messages []providers.Message, model string) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{
+		Content: "ok",
+		Usage:   &providers.UsageInfo{PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100},
+	}, nil
+}
+
+// withBudget sets the daily token budget and the model it downgrades to,
+// and prices test-model.
+func withBudget(budget int, budgetModel string) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Agents.Defaults.DailyTokenBudget = budget
+		cfg.Agents.Defaults.BudgetModel = budgetModel
+		cfg.ModelList = []config.ModelConfig{
+			// Priced by bare model ID; the provider itself is the mock.
+			{ModelName: "priced", Model: "anthropic/test-model", InputPrice: 1, OutputPrice: 2},
+		}
+	}
+}
+
+func TestAgentLoop_RecordsUsage(t *testing.T) {
+	al, _ := newTestLoop(t, &scriptedProvider{reply: usageReply}, withBudget(0, ""))
+	msg := bus.InboundMessage{Channel: "test", SenderID: "u1", ChatID: "c1", Content: "hi"}
+
+	if _, err := al.processMessage(context.Background(), msg); err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+
+	records, err := al.ledger.Records(time.Time{})
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("len(records) = %d, want 1", len(records))
+	}
+	r := records[0]
+	if r.AgentID != "main" || r.Channel != "test" || r.SessionKey == "" {
+		t.Errorf("record keys = %+v", r)
+	}
+	if r.TotalTokens() != 100 {
+		t.Errorf("TotalTokens() = %d, want 100", r.TotalTokens())
+	}
+	if want := (60*1.0 + 40*2.0) / 1e6; r.Cost != want {
+		t.Errorf("Cost = %v, want %v", r.Cost, want)
+	}
+
+	reply, _ := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "test", SenderID: "u1", ChatID: "c1", Content: "/usage",
+	})
+	if !strings.Contains(reply, "This conversation: 100 tokens") {
+		t.Errorf("/usage reply = %q", reply)
+	}
+}
+
+func TestAgentLoop_BudgetRefuses(t *testing.T) {
+	provider := &scriptedProvider{reply: usageReply}
+	al, _ := newTestLoop(t, provider, withBudget(100, ""))
+	msg := bus.InboundMessage{Channel: "test", SenderID: "u1", ChatID: "c1", Content: "hi"}
+
+	al.processMessage(context.Background(), msg)
+	reply, err := al.processMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+	if !strings.Contains(reply, "budget") {
+		t.Errorf("reply = %q, want budget refusal", reply)
+	}
+	if len(provider.models) != 1 {
+		t.Errorf("provider calls = %d, want 1", len(provider.models))
+	}
+}
+
+func TestAgentLoop_BudgetDowngrades(t *testing.T) {
+	provider := &scriptedProvider{reply: usageReply}
+	al, _ := newTestLoop(t, provider, withBudget(100, "cheap-model"))
+	msg := bus.InboundMessage{Channel: "test", SenderID: "u1", ChatID: "c1", Content: "hi"}
+
+	al.processMessage(context.Background(), msg)
+	reply, _ := al.processMessage(context.Background(), msg)
+	if reply != "ok" {
+		t.Errorf("reply = %q, want ok", reply)
+	}
+	if len(provider.models) != 2 || provider.models[1] != "cheap-model" {
+		t.Errorf("models = %v, want second call on cheap-model", provider.models)
+	}
+}
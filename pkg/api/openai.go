@@ -0,0 +1,311 @@
+// Package api serves an OpenAI-compatible HTTP API in front of the agent
+// loop, so OpenAI SDK clients and chat UIs can talk to picoclaw agents.
+// Each agent in agents.list appears as a model named by its ID.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// SessionHeader selects the conversation a request continues. Without it
+// the request's "user" field is used, and failing that a shared default.
+const SessionHeader = "X-Session-Id"
+
+// BranchHeader selects a branch of the session. A name the session does not
+// have yet forks its active branch; without it the active branch is used.
+const BranchHeader = "X-Session-Branch"
+
+// Backend runs agent turns for the API.
+type Backend interface {
+	AgentIDs() []string
+	DefaultAgentID() string
+	ProcessRequest(ctx context.Context, req agent.DirectRequest) (string, error)
+}
+
+// Handler serves /v1/models and /v1/chat/completions.
+type Handler struct {
+	backend Backend
+	token   string
+	mux     *http.ServeMux
+	created int64
+}
+
+// NewHandler returns the API handler. token must be non-empty; every
+// request has to present it as a bearer token.
+func NewHandler(backend Backend, token string) *Handler {
+	h := &Handler{
+		backend: backend,
+		token:   token,
+		mux:     http.NewServeMux(),
+		created: time.Now().Unix(),
+	}
+	h.mux.HandleFunc("/v1/models", h.handleModels)
+	h.mux.HandleFunc("/v1/chat/completions", h.handleChatCompletions)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "Invalid or missing bearer token")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+type model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func (h *Handler) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use GET")
+		return
+	}
+	ids := h.backend.AgentIDs()
+	models := make([]model, 0, len(ids))
+	for _, id := range ids {
+		models = append(models, model{ID: id, Object: "model", Created: h.created, OwnedBy: "picoclaw"})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": models})
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	User     string        `json:"user"`
+}
+
+func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Use POST")
+		return
+	}
+
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	agentID, ok := h.resolveModel(req.Model)
+	if !ok {
+		writeError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("The model %q does not exist", req.Model))
+		return
+	}
+	content, ok := lastUserMessage(req.Messages)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must contain a user message with text")
+		return
+	}
+
+	session := r.Header.Get(SessionHeader)
+	if session == "" {
+		session = req.User
+	}
+	if session == "" {
+		session = "default"
+	}
+
+	// Agent turns can take minutes; lift the listener's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	completion := completionMeta{
+		ID:      "chatcmpl-" + uuid.NewString(),
+		Created: time.Now().Unix(),
+		Model:   agentID,
+	}
+	dr := agent.DirectRequest{
+		AgentID:    agentID,
+		SessionKey: "api:" + session,
+		Branch:     r.Header.Get(BranchHeader),
+		Content:    content,
+		Channel:    "api",
+		ChatID:     session,
+	}
+
+	logger.InfoCF("api", "Chat completion request",
+		map[string]interface{}{
+			"agent_id": agentID,
+			"session":  session,
+			"branch":   dr.Branch,
+			"stream":   req.Stream,
+		})
+
+	if req.Stream {
+		h.stream(w, r, dr, completion)
+		return
+	}
+
+	reply, err := h.backend.ProcessRequest(r.Context(), dr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      completion.ID,
+		"object":  "chat.completion",
+		"created": completion.Created,
+		"model":   completion.Model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]interface{}{"role": "assistant", "content": reply},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+type completionMeta struct {
+	ID      string
+	Created int64
+	Model   string
+}
+
+// stream answers with server-sent chat.completion.chunk events. When the
+// model doesn't stream, the whole reply is sent as one chunk at the end.
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request, dr agent.DirectRequest, meta completionMeta) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	var mu sync.Mutex
+	streamed := false
+	send := func(delta map[string]interface{}, finish interface{}) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id":      meta.ID,
+			"object":  "chat.completion.chunk",
+			"created": meta.Created,
+			"model":   meta.Model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"delta":         delta,
+				"finish_reason": finish,
+			}},
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		rc.Flush()
+	}
+
+	send(map[string]interface{}{"role": "assistant", "content": ""}, nil)
+	dr.OnDelta = func(delta string) {
+		mu.Lock()
+		streamed = true
+		mu.Unlock()
+		send(map[string]interface{}{"content": delta}, nil)
+	}
+
+	reply, err := h.backend.ProcessRequest(r.Context(), dr)
+	if err != nil {
+		data, _ := json.Marshal(errorBody("server_error", err.Error()))
+		mu.Lock()
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		mu.Unlock()
+	} else {
+		mu.Lock()
+		replied := streamed
+		mu.Unlock()
+		if !replied && reply != "" {
+			send(map[string]interface{}{"content": reply}, nil)
+		}
+		send(map[string]interface{}{}, "stop")
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	rc.Flush()
+}
+
+// resolveModel maps a requested model to an agent ID. An empty model, or
+// the generic "picoclaw", means the default agent.
+func (h *Handler) resolveModel(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "picoclaw/")
+	if name == "" || name == "picoclaw" {
+		return h.backend.DefaultAgentID(), true
+	}
+	for _, id := range h.backend.AgentIDs() {
+		if id == name {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// lastUserMessage returns the text of the last user message. Earlier
+// messages are ignored: the agent keeps its own history for the session.
+// Content may be a string or an array of parts, of which text parts count.
+func lastUserMessage(messages []chatMessage) (string, bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(messages[i].Content, &text); err == nil {
+			return text, strings.TrimSpace(text) != ""
+		}
+		var parts []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(messages[i].Content, &parts); err != nil {
+			return "", false
+		}
+		var texts []string
+		for _, p := range parts {
+			if p.Type == "text" && p.Text != "" {
+				texts = append(texts, p.Text)
+			}
+		}
+		text = strings.Join(texts, "\n")
+		return text, text != ""
+	}
+	return "", false
+}
+
+func errorBody(code, message string) map[string]interface{} {
+	errType := "invalid_request_error"
+	if code == "server_error" {
+		errType = "server_error"
+	}
+	return map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+			"code":    code,
+		},
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorBody(code, message))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
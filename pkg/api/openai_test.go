@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+)
+
+type fakeBackend struct {
+	requests []agent.DirectRequest
+	deltas   []string
+	reply    string
+	err      error
+}
+
+func (f *fakeBackend) AgentIDs() []string     { return []string{"main", "research"} }
+func (f *fakeBackend) DefaultAgentID() string { return "main" }
+
+func (f *fakeBackend) ProcessRequest(ctx context.Context, req agent.DirectRequest) (string, error) {
+	f.requests = append(f.requests, req)
+	if req.OnDelta != nil {
+		for _, d := range f.deltas {
+			req.OnDelta(d)
+		}
+	}
+	return f.reply, f.err
+}
+
+func doRequest(t *testing.T, h http.Handler, method, path, token, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_RequiresToken(t *testing.T) {
+	h := NewHandler(&fakeBackend{}, "secret")
+	for _, token := range []string{"", "wrong"} {
+		rec := doRequest(t, h, http.MethodGet, "/v1/models", token, "", nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, rec.Code)
+		}
+	}
+}
+
+func TestHandler_Models(t *testing.T) {
+	h := NewHandler(&fakeBackend{}, "secret")
+	rec := doRequest(t, h, http.MethodGet, "/v1/models", "secret", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var body struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body.Object != "list" || len(body.Data) != 2 || body.Data[0].ID != "main" || body.Data[1].ID != "research" {
+		t.Errorf("models = %+v", body)
+	}
+}
+
+func TestHandler_ChatCompletion(t *testing.T) {
+	backend := &fakeBackend{reply: "Hi there"}
+	h := NewHandler(backend, "secret")
+
+	body := `{"model":"research","messages":[
+		{"role":"system","content":"ignored"},
+		{"role":"user","content":"first"},
+		{"role":"assistant","content":"..."},
+		{"role":"user","content":[{"type":"text","text":"second"},{"type":"image_url","image_url":{"url":"x"}}]}
+	],"user":"alice"}`
+	rec := doRequest(t, h, http.MethodPost, "/v1/chat/completions", "secret", body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Object != "chat.completion" || resp.Model != "research" || len(resp.Choices) != 1 {
+		t.Fatalf("response = %s", rec.Body.String())
+	}
+	if resp.Choices[0].Message.Content != "Hi there" || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choice = %+v", resp.Choices[0])
+	}
+
+	req := backend.requests[0]
+	if req.AgentID != "research" || req.Content != "second" || req.SessionKey != "api:alice" || req.Channel != "api" {
+		t.Errorf("request = %+v", req)
+	}
+}
+
+func TestHandler_SessionHeaderWinsOverUser(t *testing.T) {
+	backend := &fakeBackend{reply: "ok"}
+	h := NewHandler(backend, "secret")
+	body := `{"model":"","messages":[{"role":"user","content":"hi"}],"user":"alice"}`
+	doRequest(t, h, http.MethodPost, "/v1/chat/completions", "secret", body, map[string]string{SessionHeader: "thread-7", BranchHeader: "alt"})
+	doRequest(t, h, http.MethodPost, "/v1/chat/completions", "secret", `{"messages":[{"role":"user","content":"hi"}]}`, nil)
+
+	if got := backend.requests[0]; got.SessionKey != "api:thread-7" || got.Branch != "alt" || got.AgentID != "main" {
+		t.Errorf("header request = %+v", got)
+	}
+	if got := backend.requests[1].SessionKey; got != "api:default" {
+		t.Errorf("session without header or user = %q, want api:default", got)
+	}
+}
+
+func TestHandler_ChatCompletionErrors(t *testing.T) {
+	h := NewHandler(&fakeBackend{err: errors.New("provider down")}, "secret")
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"model":"nope","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound},
+		{`{"model":"main","messages":[{"role":"system","content":"hi"}]}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+		{`{"model":"main","messages":[{"role":"user","content":"hi"}]}`, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		rec := doRequest(t, h, http.MethodPost, "/v1/chat/completions", "secret", tt.body, nil)
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.body, rec.Code, tt.code)
+		}
+		if !strings.Contains(rec.Body.String(), `"error"`) {
+			t.Errorf("%s: body should be an OpenAI error: %s", tt.body, rec.Body.String())
+		}
+	}
+}
+
+// readChunks parses an SSE response into chunk payloads, stopping at [DONE].
+func readChunks(t *testing.T, body string) []map[string]interface{} {
+	t.Helper()
+	var chunks []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	done := false
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Error("stream should end with [DONE]")
+	}
+	return chunks
+}
+
+func chunkDelta(chunk map[string]interface{}) (content string, finish interface{}) {
+	choice := chunk["choices"].([]interface{})[0].(map[string]interface{})
+	delta := choice["delta"].(map[string]interface{})
+	content, _ = delta["content"].(string)
+	return content, choice["finish_reason"]
+}
+
+func TestHandler_Streaming(t *testing.T) {
+	backend := &fakeBackend{deltas: []string{"Hel", "lo"}, reply: "Hello"}
+	h := NewHandler(backend, "secret")
+	rec := doRequest(t, h, http.MethodPost, "/v1/chat/completions", "secret",
+		`{"model":"main","stream":true,"messages":[{"role":"user","content":"hi"}]}`, nil)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	chunks := readChunks(t, rec.Body.String())
+	var text strings.Builder
+	for _, c := range chunks {
+		if c["object"] != "chat.completion.chunk" {
+			t.Errorf("object = %v", c["object"])
+		}
+		content, _ := chunkDelta(c)
+		text.WriteString(content)
+	}
+	if text.String() != "Hello" {
+		t.Errorf("streamed text = %q, want Hello", text.String())
+	}
+	if _, finish := chunkDelta(chunks[len(chunks)-1]); finish != "stop" {
+		t.Errorf("last finish_reason = %v, want stop", finish)
+	}
+}
+
+func TestHandler_StreamingWithoutDeltas(t *testing.T) {
+	backend := &fakeBackend{reply: "whole reply"}
+	h := NewHandler(backend, "secret")
+	rec := doRequest(t, h, http.MethodPost, "/v1/chat/completions", "secret",
+		`{"model":"main","stream":true,"messages":[{"role":"user","content":"hi"}]}`, nil)
+
+	var text strings.Builder
+	for _, c := range readChunks(t, rec.Body.String()) {
+		content, _ := chunkDelta(c)
+		text.WriteString(content)
+	}
+	if text.String() != "whole reply" {
+		t.Errorf("streamed text = %q, want the whole reply", text.String())
+	}
+}
@@ -57,6 +57,16 @@ func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, b
 	}
 }
 
+// PollOutbound returns a queued outbound message without waiting for one.
+func (mb *MessageBus) PollOutbound() (OutboundMessage, bool) {
+	select {
+	case msg := <-mb.outbound:
+		return msg, true
+	default:
+		return OutboundMessage{}, false
+	}
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
@@ -14,6 +14,28 @@ type OutboundMessage struct {
 	Channel string `json:"channel"`
 	ChatID  string `json:"chat_id"`
 	Content string `json:"content"`
+	// Partial marks an in-progress streamed reply. Content holds the text
+	// generated so far; a final non-partial message always follows.
+	Partial bool `json:"partial,omitempty"`
+	// StreamID identifies the turn a streamed reply belongs to. Partial
+	// updates and the final reply of one turn carry the same ID.
+	StreamID string `json:"stream_id,omitempty"`
+	// StreamEnd ends stream StreamID and carries no content. It follows the
+	// turn whether or not a final reply was sent.
+	StreamEnd bool `json:"stream_end,omitempty"`
+	// Files are local paths to send as attachments, with Content as the
+	// caption. Channels that cannot upload files send Content alone.
+	Files []string `json:"files,omitempty"`
+	// Buttons are shown below Content on channels that support them.
+	// Other channels send Content alone, so it should say how to reply.
+	Buttons []Button `json:"buttons,omitempty"`
+}
+
+// Button is an inline button on an outbound message. Pressing it sends Data
+// back as the content of an inbound message from the user who pressed it.
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data"`
 }
 
 type MessageHandler func(InboundMessage) error
@@ -16,6 +16,32 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// StreamingChannel is implemented by channels that can render a reply
+// progressively by editing a message in place. SendPartial receives the
+// accumulated text so far; the final text is still delivered through Send,
+// with the same msg.StreamID. EndStream is called once the turn is over,
+// also when no final reply was sent, so the channel can forget the message
+// it was editing for msg.StreamID.
+type StreamingChannel interface {
+	Channel
+	SendPartial(ctx context.Context, msg bus.OutboundMessage) error
+	EndStream(ctx context.Context, msg bus.OutboundMessage) error
+}
+
+// FileChannel is implemented by channels that can upload files. SendFile
+// sends msg.Files with msg.Content as the caption.
+type FileChannel interface {
+	Channel
+	SendFile(ctx context.Context, msg bus.OutboundMessage) error
+}
+
+// ButtonChannel is implemented by channels that can attach buttons to a
+// message. SendButtons sends msg.Content with msg.Buttons below it.
+type ButtonChannel interface {
+	Channel
+	SendButtons(ctx context.Context, msg bus.OutboundMessage) error
+}
+
 type BaseChannel struct {
 	config    interface{}
 	bus       *bus.MessageBus
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +30,8 @@ type DiscordChannel struct {
 	ctx         context.Context
 	typingMu    sync.Mutex
 	typingStop  map[string]chan struct{} // chatID → stop signal
+	streamMu    sync.Mutex
+	streamMsgs  map[string]string // stream ID → message ID being edited while streaming
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -45,6 +49,7 @@ func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordC
 		transcriber: nil,
 		ctx:         context.Background(),
 		typingStop:  make(map[string]chan struct{}),
+		streamMsgs:  make(map[string]string),
 	}, nil
 }
 
@@ -64,6 +69,7 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 
 	c.ctx = ctx
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(c.handleInteraction)
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -121,6 +127,13 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 
 	chunks := utils.SplitMessage(msg.Content, 2000) // Split messages into chunks, Discord length limit: 2000 chars
 
+	// Replace the streamed preview with the first chunk when one exists
+	if messageID := c.takeStreamMessage(msg.StreamID); messageID != "" {
+		if _, err := c.session.ChannelMessageEdit(channelID, messageID, chunks[0]); err == nil {
+			chunks = chunks[1:]
+		}
+	}
+
 	for _, chunk := range chunks {
 		if err := c.sendChunk(ctx, channelID, chunk); err != nil {
 			return err
@@ -130,6 +143,120 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	return nil
 }
 
+// SendFile uploads msg.Files in one message. A streamed preview is replaced
+// with msg.Content; otherwise msg.Content goes with the files.
+func (c *DiscordChannel) SendFile(ctx context.Context, msg bus.OutboundMessage) error {
+	c.stopTyping(msg.ChatID)
+
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+
+	channelID := msg.ChatID
+	if channelID == "" {
+		return fmt.Errorf("channel ID is empty")
+	}
+
+	content := utils.Truncate(msg.Content, 2000) // Discord message length limit
+	if messageID := c.takeStreamMessage(msg.StreamID); messageID != "" {
+		if _, err := c.session.ChannelMessageEdit(channelID, messageID, content); err == nil {
+			content = ""
+		}
+	}
+
+	send := &discordgo.MessageSend{Content: content}
+	for _, path := range msg.Files {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		send.Files = append(send.Files, &discordgo.File{Name: filepath.Base(path), Reader: f})
+	}
+
+	if _, err := c.session.ChannelMessageSendComplex(channelID, send, discordgo.WithContext(ctx)); err != nil {
+		return fmt.Errorf("failed to send discord files: %w", err)
+	}
+	return nil
+}
+
+// SendButtons sends msg.Content with msg.Buttons in an action row below it.
+// Each button's custom ID carries its data back through handleInteraction.
+func (c *DiscordChannel) SendButtons(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+
+	channelID := msg.ChatID
+	if channelID == "" {
+		return fmt.Errorf("channel ID is empty")
+	}
+
+	buttons := make([]discordgo.MessageComponent, 0, len(msg.Buttons))
+	for _, b := range msg.Buttons {
+		buttons = append(buttons, discordgo.Button{Label: b.Text, Style: discordgo.SecondaryButton, CustomID: b.Data})
+	}
+	send := &discordgo.MessageSend{
+		Content:    utils.Truncate(msg.Content, 2000), // Discord message length limit
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}},
+	}
+
+	if _, err := c.session.ChannelMessageSendComplex(channelID, send, discordgo.WithContext(ctx)); err != nil {
+		return fmt.Errorf("failed to send discord message: %w", err)
+	}
+	return nil
+}
+
+// SendPartial posts the streamed reply on the first update and edits that
+// message on subsequent ones. Previews longer than one message are truncated.
+func (c *DiscordChannel) SendPartial(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+
+	channelID := msg.ChatID
+	content := utils.Truncate(msg.Content, 2000)
+	if channelID == "" || strings.TrimSpace(content) == "" {
+		return nil
+	}
+
+	c.streamMu.Lock()
+	messageID := c.streamMsgs[msg.StreamID]
+	c.streamMu.Unlock()
+
+	if messageID != "" {
+		_, err := c.session.ChannelMessageEdit(channelID, messageID, content)
+		return err
+	}
+
+	sent, err := c.session.ChannelMessageSend(channelID, content)
+	if err != nil {
+		return err
+	}
+	c.streamMu.Lock()
+	c.streamMsgs[msg.StreamID] = sent.ID
+	c.streamMu.Unlock()
+	return nil
+}
+
+// EndStream forgets the message streamed for msg.StreamID, which is left as
+// it is when no final reply replaced it.
+func (c *DiscordChannel) EndStream(ctx context.Context, msg bus.OutboundMessage) error {
+	c.takeStreamMessage(msg.StreamID)
+	return nil
+}
+
+func (c *DiscordChannel) takeStreamMessage(streamID string) string {
+	if streamID == "" {
+		return ""
+	}
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	messageID := c.streamMsgs[streamID]
+	delete(c.streamMsgs, streamID)
+	return messageID
+}
+
 func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content string) error {
 	// 使用传入的 ctx 进行超时控制
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
@@ -282,6 +409,62 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	c.HandleMessage(senderID, m.ChannelID, content, mediaPaths, metadata)
 }
 
+// handleInteraction turns a press of a SendButtons button into an inbound
+// message carrying the button's custom ID, and removes the buttons so they
+// can be pressed only once.
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i == nil || i.Type != discordgo.InteractionMessageComponent || i.Message == nil {
+		return
+	}
+
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+
+	if !c.IsAllowed(user.ID) {
+		logger.DebugCF("discord", "Interaction rejected by allowlist", map[string]any{
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    i.Message.Content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		logger.DebugCF("discord", "Failed to respond to interaction", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	peerKind := "channel"
+	peerID := i.ChannelID
+	if i.GuildID == "" {
+		peerKind = "direct"
+		peerID = user.ID
+	}
+
+	metadata := map[string]string{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"guild_id":   i.GuildID,
+		"channel_id": i.ChannelID,
+		"is_dm":      fmt.Sprintf("%t", i.GuildID == ""),
+		"peer_kind":  peerKind,
+		"peer_id":    peerID,
+	}
+
+	c.HandleMessage(user.ID, i.ChannelID, i.MessageComponentData().CustomID, nil, metadata)
+}
+
 // startTyping starts a continuous typing indicator loop for the given chatID.
 // It stops any existing typing loop for that chatID before starting a new one.
 func (c *DiscordChannel) startTyping(chatID string) {
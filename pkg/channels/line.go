@@ -330,7 +330,7 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 	case "image":
 		localPath := c.downloadContent(msg.ID, "image.jpg")
 		if localPath != "" {
-			localFiles = append(localFiles, localPath)
+			// Not cleaned up here: the agent attaches the image and removes it.
 			mediaPaths = append(mediaPaths, localPath)
 			content = "[image]"
 		}
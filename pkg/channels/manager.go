@@ -27,6 +27,8 @@ type Manager struct {
 
 type asyncTask struct {
 	cancel context.CancelFunc
+	stop   context.CancelFunc // Ends waiting for new work; what is queued still runs
+	done   chan struct{}
 }
 
 func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error) {
@@ -176,6 +178,19 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Webhook.Enabled && m.config.Channels.Webhook.Token != "" {
+		logger.DebugC("channels", "Attempting to initialize webhook channel")
+		webhook, err := NewWebhookChannel(m.config.Channels.Webhook, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize webhook channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["webhook"] = webhook
+			logger.InfoC("channels", "Webhook channel enabled successfully")
+		}
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
 	})
@@ -194,10 +209,13 @@ func (m *Manager) StartAll(ctx context.Context) error {
 
 	logger.InfoC("channels", "Starting all channels")
 
-	dispatchCtx, cancel := context.WithCancel(ctx)
-	m.dispatchTask = &asyncTask{cancel: cancel}
+	// Delivery outlives ctx, so that the replies of sessions drained on
+	// shutdown still go out; StopAll ends it.
+	dispatchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	waitCtx, stop := context.WithCancel(dispatchCtx)
+	m.dispatchTask = &asyncTask{cancel: cancel, stop: stop, done: make(chan struct{})}
 
-	go m.dispatchOutbound(dispatchCtx)
+	go m.dispatchOutbound(dispatchCtx, waitCtx, m.dispatchTask.done)
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]interface{}{
@@ -215,17 +233,27 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	return nil
 }
 
+// StopAll delivers the outbound messages still queued, waiting until ctx
+// ends at most, then stops every channel.
 func (m *Manager) StopAll(ctx context.Context) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	logger.InfoC("channels", "Stopping all channels")
 
-	if m.dispatchTask != nil {
-		m.dispatchTask.cancel()
-		m.dispatchTask = nil
+	m.mu.Lock()
+	task := m.dispatchTask
+	m.dispatchTask = nil
+	m.mu.Unlock()
+	if task != nil {
+		task.stop()
+		select {
+		case <-task.done:
+		case <-ctx.Done():
+		}
+		task.cancel()
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Stopping channel", map[string]interface{}{
 			"channel": name,
@@ -242,44 +270,111 @@ func (m *Manager) StopAll(ctx context.Context) error {
 	return nil
 }
 
-func (m *Manager) dispatchOutbound(ctx context.Context) {
+// dispatchOutbound delivers outbound messages to their channels until
+// waitCtx ends, then delivers those still queued and closes done. Sends use
+// ctx, whose end aborts delivery at once.
+func (m *Manager) dispatchOutbound(ctx, waitCtx context.Context, done chan struct{}) {
+	defer close(done)
 	logger.InfoC("channels", "Outbound dispatcher started")
 
 	for {
-		select {
-		case <-ctx.Done():
-			logger.InfoC("channels", "Outbound dispatcher stopped")
-			return
-		default:
-			msg, ok := m.bus.SubscribeOutbound(ctx)
-			if !ok {
-				continue
-			}
+		msg, ok := m.bus.SubscribeOutbound(waitCtx)
+		if !ok {
+			break
+		}
+		m.deliver(ctx, msg)
+	}
+	for ctx.Err() == nil {
+		msg, ok := m.bus.PollOutbound()
+		if !ok {
+			break
+		}
+		m.deliver(ctx, msg)
+	}
+	logger.InfoC("channels", "Outbound dispatcher stopped")
+}
 
-			// Silently skip internal channels
-			if constants.IsInternalChannel(msg.Channel) {
-				continue
-			}
+// deliver sends msg to its channel.
+func (m *Manager) deliver(ctx context.Context, msg bus.OutboundMessage) {
+	// Silently skip internal channels
+	if constants.IsInternalChannel(msg.Channel) {
+		return
+	}
+
+	m.mu.RLock()
+	channel, exists := m.channels[msg.Channel]
+	m.mu.RUnlock()
 
-			m.mu.RLock()
-			channel, exists := m.channels[msg.Channel]
-			m.mu.RUnlock()
+	if !exists {
+		logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
+			"channel": msg.Channel,
+		})
+		return
+	}
 
-			if !exists {
-				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
+	if msg.StreamEnd {
+		if sc, ok := channel.(StreamingChannel); ok {
+			if err := sc.EndStream(ctx, msg); err != nil {
+				logger.DebugCF("channels", "Error ending stream on channel", map[string]interface{}{
 					"channel": msg.Channel,
+					"error":   err.Error(),
 				})
-				continue
 			}
+		}
+		return
+	}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+	if msg.Partial {
+		// Partial updates are best-effort; channels that cannot edit
+		// messages simply wait for the final reply.
+		if sc, ok := channel.(StreamingChannel); ok {
+			if err := sc.SendPartial(ctx, msg); err != nil {
+				logger.DebugCF("channels", "Error sending partial message to channel", map[string]interface{}{
 					"channel": msg.Channel,
 					"error":   err.Error(),
 				})
 			}
 		}
+		return
 	}
+
+	if fc, ok := channel.(FileChannel); ok && len(msg.Files) > 0 {
+		err := fc.SendFile(ctx, msg)
+		if err == nil {
+			return
+		}
+		logger.WarnCF("channels", "Error sending file, sending text only", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+	}
+
+	// Channels without buttons get the text alone.
+	if bc, ok := channel.(ButtonChannel); ok && len(msg.Buttons) > 0 {
+		err := bc.SendButtons(ctx, msg)
+		if err == nil {
+			return
+		}
+		logger.WarnCF("channels", "Error sending buttons, sending text only", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+	}
+
+	if err := channel.Send(ctx, msg); err != nil {
+		logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// SupportsStreaming reports whether the named channel can render partial replies.
+func (m *Manager) SupportsStreaming(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.channels[name].(StreamingChannel)
+	return ok
 }
 
 func (m *Manager) GetChannel(name string) (Channel, bool) {
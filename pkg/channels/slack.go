@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +31,7 @@ type SlackChannel struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+	streamMsgs   sync.Map // stream ID -> timestamp of the message updated while streaming
 }
 
 type slackMessageRef struct {
@@ -127,18 +129,21 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		opts = append(opts, slack.MsgOptionTS(threadTS))
 	}
 
+	if ts, ok := c.streamMsgs.LoadAndDelete(msg.StreamID); ok {
+		// Replace the streamed preview in place; fall back to a new post on failure
+		_, _, _, err := c.api.UpdateMessageContext(ctx, channelID, ts.(string), slack.MsgOptionText(msg.Content, false))
+		if err == nil {
+			c.ackMessage(msg.ChatID)
+			return nil
+		}
+	}
+
 	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to send slack message: %w", err)
 	}
 
-	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
-		msgRef := ref.(slackMessageRef)
-		c.api.AddReaction("white_check_mark", slack.ItemRef{
-			Channel:   msgRef.ChannelID,
-			Timestamp: msgRef.Timestamp,
-		})
-	}
+	c.ackMessage(msg.ChatID)
 
 	logger.DebugCF("slack", "Message sent", map[string]interface{}{
 		"channel_id": channelID,
@@ -148,6 +153,141 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// SendButtons posts msg.Content with msg.Buttons in an actions block below
+// it. Each button's value carries its data back through handleInteractive.
+func (c *SlackChannel) SendButtons(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(msg.ChatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
+	}
+
+	buttons := make([]slack.BlockElement, 0, len(msg.Buttons))
+	for i, b := range msg.Buttons {
+		text := slack.NewTextBlockObject(slack.PlainTextType, b.Text, false, false)
+		buttons = append(buttons, slack.NewButtonBlockElement(fmt.Sprintf("button_%d", i), b.Data, text))
+	}
+
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(msg.Content, false),
+		slack.MsgOptionBlocks(slackTextSection(msg.Content), slack.NewActionBlock("", buttons...)),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+
+	if _, _, err := c.api.PostMessageContext(ctx, channelID, opts...); err != nil {
+		return fmt.Errorf("failed to send slack message: %w", err)
+	}
+	return nil
+}
+
+// slackTextSection renders text as a section block, within Slack's limit on
+// section text.
+func slackTextSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, utils.Truncate(text, 3000), false, false), nil, nil)
+}
+
+// SendFile uploads msg.Files to the chat, the first with msg.Content as its
+// comment. A streamed preview is replaced with msg.Content instead.
+func (c *SlackChannel) SendFile(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(msg.ChatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
+	}
+
+	comment := msg.Content
+	if ts, ok := c.streamMsgs.LoadAndDelete(msg.StreamID); ok {
+		_, _, _, err := c.api.UpdateMessageContext(ctx, channelID, ts.(string), slack.MsgOptionText(msg.Content, false))
+		if err == nil {
+			comment = ""
+		}
+	}
+
+	for _, path := range msg.Files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+			Reader:          f,
+			FileSize:        int(info.Size()),
+			Filename:        filepath.Base(path),
+			InitialComment:  comment,
+			Channel:         channelID,
+			ThreadTimestamp: threadTS,
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to upload slack file: %w", err)
+		}
+		comment = ""
+	}
+
+	c.ackMessage(msg.ChatID)
+	return nil
+}
+
+// SendPartial posts the streamed reply once and then updates that message
+// in place as more text arrives.
+func (c *SlackChannel) SendPartial(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(msg.ChatID)
+	if channelID == "" || strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	if ts, ok := c.streamMsgs.Load(msg.StreamID); ok {
+		_, _, _, err := c.api.UpdateMessageContext(ctx, channelID, ts.(string), slack.MsgOptionText(msg.Content, false))
+		return err
+	}
+
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(msg.Content, false),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+
+	_, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+	if err != nil {
+		return err
+	}
+	c.streamMsgs.Store(msg.StreamID, ts)
+	return nil
+}
+
+// EndStream forgets the message streamed for msg.StreamID, which is left as
+// it is when no final reply replaced it.
+func (c *SlackChannel) EndStream(ctx context.Context, msg bus.OutboundMessage) error {
+	c.streamMsgs.Delete(msg.StreamID)
+	return nil
+}
+
+func (c *SlackChannel) ackMessage(chatID string) {
+	if ref, ok := c.pendingAcks.LoadAndDelete(chatID); ok {
+		msgRef := ref.(slackMessageRef)
+		c.api.AddReaction("white_check_mark", slack.ItemRef{
+			Channel:   msgRef.ChannelID,
+			Timestamp: msgRef.Timestamp,
+		})
+	}
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -163,9 +303,7 @@ func (c *SlackChannel) eventLoop() {
 			case socketmode.EventTypeSlashCommand:
 				c.handleSlashCommand(event)
 			case socketmode.EventTypeInteractive:
-				if event.Request != nil {
-					c.socketClient.Ack(*event.Request)
-				}
+				c.handleInteractive(event)
 			}
 		}
 	}
@@ -252,7 +390,10 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 			if localPath == "" {
 				continue
 			}
-			localFiles = append(localFiles, localPath)
+			// Images are left for the agent, which attaches and removes them.
+			if !utils.IsImageFile(file.Name, file.Mimetype) {
+				localFiles = append(localFiles, localPath)
+			}
 			mediaPaths = append(mediaPaths, localPath)
 
 			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() {
@@ -409,6 +550,61 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
 }
 
+// handleInteractive turns a press of a SendButtons button into an inbound
+// message carrying the button's value, and removes the buttons so they can
+// be pressed only once.
+func (c *SlackChannel) handleInteractive(event socketmode.Event) {
+	if event.Request != nil {
+		c.socketClient.Ack(*event.Request)
+	}
+
+	callback, ok := event.Data.(slack.InteractionCallback)
+	if !ok || callback.Type != slack.InteractionTypeBlockActions || len(callback.ActionCallback.BlockActions) == 0 {
+		return
+	}
+
+	senderID := callback.User.ID
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("slack", "Interaction rejected by allowlist", map[string]interface{}{
+			"user_id": senderID,
+		})
+		return
+	}
+
+	channelID := callback.Container.ChannelID
+	threadTS := callback.Container.ThreadTs
+	chatID := channelID
+	if threadTS != "" {
+		chatID = channelID + "/" + threadTS
+	}
+
+	if _, _, _, err := c.api.UpdateMessage(channelID, callback.Container.MessageTs,
+		slack.MsgOptionText(callback.Message.Text, false),
+		slack.MsgOptionBlocks(slackTextSection(callback.Message.Text))); err != nil {
+		logger.DebugCF("slack", "Failed to remove buttons", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	peerKind := "channel"
+	peerID := channelID
+	if strings.HasPrefix(channelID, "D") {
+		peerKind = "direct"
+		peerID = senderID
+	}
+
+	metadata := map[string]string{
+		"channel_id": channelID,
+		"thread_ts":  threadTS,
+		"platform":   "slack",
+		"peer_kind":  peerKind,
+		"peer_id":    peerID,
+		"team_id":    c.teamID,
+	}
+
+	c.HandleMessage(senderID, chatID, callback.ActionCallback.BlockActions[0].Value, nil, metadata)
+}
+
 func (c *SlackChannel) downloadSlackFile(file slack.File) string {
 	downloadURL := file.URLPrivateDownload
 	if downloadURL == "" {
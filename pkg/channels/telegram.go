@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
@@ -32,6 +33,7 @@ type TelegramChannel struct {
 	chatIDs      map[string]int64
 	transcriber  *voice.GroqTranscriber
 	placeholders sync.Map // chatID -> messageID
+	streamMsgs   sync.Map // stream ID -> messageID being edited while streaming
 	stopThinking sync.Map // chatID -> thinkingCancel
 }
 
@@ -126,6 +128,10 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleCallbackQuery(ctx, query)
+	}, th.AnyCallbackQueryWithMessage())
+
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]interface{}{
 		"username": c.bot.Username(),
@@ -156,20 +162,13 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("invalid chat ID: %w", err)
 	}
 
-	// Stop thinking animation
-	if stop, ok := c.stopThinking.Load(msg.ChatID); ok {
-		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
-		}
-		c.stopThinking.Delete(msg.ChatID)
-	}
+	c.stopThinkingAnimation(msg.ChatID)
 
 	htmlContent := markdownToTelegramHTML(msg.Content)
 
-	// Try to edit placeholder
-	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
-		c.placeholders.Delete(msg.ChatID)
-		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
+	// Try to edit the streamed preview or placeholder
+	if pID, ok := c.takePlaceholder(msg); ok {
+		editMsg := tu.EditMessageText(tu.ID(chatID), pID, htmlContent)
 		editMsg.ParseMode = telego.ModeHTML
 
 		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
@@ -193,6 +192,183 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
+// SendFile uploads msg.Files as documents. The "Thinking..." placeholder
+// is replaced with msg.Content, or the first document carries it as caption.
+func (c *TelegramChannel) SendFile(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+
+	chatID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	c.stopThinkingAnimation(msg.ChatID)
+
+	caption := msg.Content
+	if pID, ok := c.takePlaceholder(msg); ok {
+		if _, err := c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID, msg.Content)); err == nil {
+			caption = ""
+		}
+	}
+
+	for _, path := range msg.Files {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		doc := tu.Document(tu.ID(chatID), tu.FileFromReader(f, filepath.Base(path)))
+		doc.Caption = utils.Truncate(caption, 1024) // Telegram caption length limit
+		_, err = c.bot.SendDocument(ctx, doc)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to send document: %w", err)
+		}
+		caption = ""
+	}
+	return nil
+}
+
+// SendButtons sends msg.Content as plain text with msg.Buttons as an inline
+// keyboard, leaving the "Thinking..." placeholder for the final reply.
+func (c *TelegramChannel) SendButtons(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+
+	chatID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	row := make([]telego.InlineKeyboardButton, 0, len(msg.Buttons))
+	for _, b := range msg.Buttons {
+		row = append(row, tu.InlineKeyboardButton(b.Text).WithCallbackData(b.Data))
+	}
+	tgMsg := tu.Message(tu.ID(chatID), utils.Truncate(msg.Content, 4096)).
+		WithReplyMarkup(tu.InlineKeyboard(row))
+	_, err = c.bot.SendMessage(ctx, tgMsg)
+	return err
+}
+
+// handleCallbackQuery turns a press of a SendButtons button into an inbound
+// message carrying the button's data, and removes the keyboard so it can be
+// pressed only once.
+func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, query telego.CallbackQuery) error {
+	user := query.From
+	senderID := fmt.Sprintf("%d", user.ID)
+	if user.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", user.ID, user.Username)
+	}
+
+	if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID)); err != nil {
+		logger.DebugCF("telegram", "Failed to answer callback query", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("telegram", "Callback query rejected by allowlist", map[string]interface{}{
+			"user_id": senderID,
+		})
+		return nil
+	}
+
+	chat := query.Message.GetChat()
+	if _, err := c.bot.EditMessageReplyMarkup(ctx, tu.EditMessageReplyMarkup(tu.ID(chat.ID), query.Message.GetMessageID(), nil)); err != nil {
+		logger.DebugCF("telegram", "Failed to remove inline keyboard", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	peerKind := "direct"
+	peerID := fmt.Sprintf("%d", user.ID)
+	if chat.Type != "private" {
+		peerKind = "group"
+		peerID = fmt.Sprintf("%d", chat.ID)
+	}
+
+	metadata := map[string]string{
+		"user_id":    fmt.Sprintf("%d", user.ID),
+		"username":   user.Username,
+		"first_name": user.FirstName,
+		"is_group":   fmt.Sprintf("%t", chat.Type != "private"),
+		"peer_kind":  peerKind,
+		"peer_id":    peerID,
+	}
+
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chat.ID), query.Data, nil, metadata)
+	return nil
+}
+
+func (c *TelegramChannel) stopThinkingAnimation(chatID string) {
+	if stop, ok := c.stopThinking.Load(chatID); ok {
+		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
+			cf.Cancel()
+		}
+		c.stopThinking.Delete(chatID)
+	}
+}
+
+// SendPartial edits the "Thinking..." placeholder with the reply streamed so
+// far; the stream keeps that message until it ends. Partial text is sent as
+// plain text since the markdown may be incomplete.
+func (c *TelegramChannel) SendPartial(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+
+	chatID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	content := utils.Truncate(msg.Content, 4096) // Telegram message length limit
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+
+	if pID, ok := c.streamMsgs.Load(msg.StreamID); ok {
+		_, err = c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID.(int), content))
+		return err
+	}
+	if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+		c.streamMsgs.Store(msg.StreamID, pID)
+		_, err = c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID.(int), content))
+		return err
+	}
+
+	// No placeholder: start a message so the final reply replaces it.
+	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), content))
+	if err != nil {
+		return err
+	}
+	c.streamMsgs.Store(msg.StreamID, pMsg.MessageID)
+	return nil
+}
+
+// EndStream forgets the message streamed for msg.StreamID, which is left as
+// it is when no final reply replaced it.
+func (c *TelegramChannel) EndStream(ctx context.Context, msg bus.OutboundMessage) error {
+	c.streamMsgs.Delete(msg.StreamID)
+	return nil
+}
+
+// takePlaceholder returns the message a reply should replace: the preview
+// streamed for msg.StreamID, or else the chat's "Thinking..." placeholder.
+func (c *TelegramChannel) takePlaceholder(msg bus.OutboundMessage) (int, bool) {
+	if msg.StreamID != "" {
+		if pID, ok := c.streamMsgs.LoadAndDelete(msg.StreamID); ok {
+			return pID.(int), true
+		}
+	}
+	if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+		return pID.(int), true
+	}
+	return 0, false
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
@@ -250,7 +426,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		photo := message.Photo[len(message.Photo)-1]
 		photoPath := c.downloadPhoto(ctx, photo.FileID)
 		if photoPath != "" {
-			localFiles = append(localFiles, photoPath)
+			// Not cleaned up here: the agent attaches the image and removes it.
 			mediaPaths = append(mediaPaths, photoPath)
 			if content != "" {
 				content += "\n"
@@ -40,6 +40,18 @@ func (c *cmd) Help(ctx context.Context, message telego.Message) error {
 /help - Show this help message
 /show [model|channel] - Show current configuration
 /list [models|channels] - List available options
+/usage [today|week] - Show token usage
+/new - Archive this conversation and start a new one
+/history [count] - Show recent messages
+/summary - Show the summary of earlier messages
+/export [md|json] - Export this conversation as a file
+/forget - Delete this conversation
+/undo [turns] - Remove the last turn
+/retry [model] - Run the last message again
+/branch [name] - List, create or switch branches
+/approve [id], /deny [id] - Answer a tool approval request
+/tasks [id|cancel id] - List, show or cancel background tasks
+/skills - List the skills of this chat's agent
 	`
 	_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
 		ChatID: telego.ChatID{ID: message.Chat.ID},
@@ -0,0 +1,352 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	webhookSignatureHeader = "X-Picoclaw-Signature"
+	webhookTimestampHeader = "X-Picoclaw-Timestamp"
+	webhookMaxBodyBytes    = 1 << 20
+)
+
+// WebhookChannel implements the Channel interface for arbitrary HTTP
+// clients. Messages arrive as authenticated JSON POSTs; replies are either
+// written back in the HTTP response (sync) or POSTed to the configured
+// callback URL with an HMAC-SHA256 signature (async).
+type WebhookChannel struct {
+	*BaseChannel
+	config     config.WebhookConfig
+	httpServer *http.Server
+	client     *http.Client
+
+	mu      sync.Mutex
+	waiters map[string][]chan string // chatID -> sync requests awaiting a reply, oldest first
+}
+
+// webhookRequest is the JSON body accepted by the webhook endpoint.
+type webhookRequest struct {
+	Sender   string            `json:"sender"`
+	ChatID   string            `json:"chat_id"`
+	Content  string            `json:"content"`
+	Media    []string          `json:"media"`
+	Metadata map[string]string `json:"metadata"`
+	// Sync overrides the reply mode: true waits for the reply in the
+	// response, false acknowledges and delivers it to the callback URL.
+	Sync *bool `json:"sync"`
+}
+
+// webhookReply is the body of sync responses and async callbacks.
+type webhookReply struct {
+	Channel   string `json:"channel"`
+	ChatID    string `json:"chat_id"`
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// NewWebhookChannel creates a new webhook channel instance.
+func NewWebhookChannel(cfg config.WebhookConfig, messageBus *bus.MessageBus) (*WebhookChannel, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("webhook token is required")
+	}
+	if cfg.CallbackURL != "" && cfg.Secret == "" {
+		return nil, fmt.Errorf("webhook secret is required when callback_url is set")
+	}
+
+	base := NewBaseChannel("webhook", cfg, messageBus, cfg.AllowFrom)
+
+	return &WebhookChannel{
+		BaseChannel: base,
+		config:      cfg,
+		client:      &http.Client{Timeout: 15 * time.Second},
+		waiters:     make(map[string][]chan string),
+	}, nil
+}
+
+// Start launches the HTTP server.
+func (c *WebhookChannel) Start(ctx context.Context) error {
+	logger.InfoC("webhook", "Starting webhook channel")
+
+	mux := http.NewServeMux()
+	path := c.config.Path
+	if path == "" {
+		path = "/webhook"
+	}
+	mux.HandleFunc(path, c.webhookHandler)
+
+	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
+	c.httpServer = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		logger.InfoCF("webhook", "Webhook server listening", map[string]interface{}{
+			"addr": addr,
+			"path": path,
+		})
+		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("webhook", "Webhook server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	c.setRunning(true)
+	logger.InfoC("webhook", "Webhook channel started")
+	return nil
+}
+
+// Stop gracefully shuts down the HTTP server.
+func (c *WebhookChannel) Stop(ctx context.Context) error {
+	logger.InfoC("webhook", "Stopping webhook channel")
+
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := c.httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.ErrorCF("webhook", "Webhook server shutdown error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	c.setRunning(false)
+	logger.InfoC("webhook", "Webhook channel stopped")
+	return nil
+}
+
+// Send hands the reply to the oldest sync request waiting on the chat, or
+// POSTs it to the callback URL when nobody is waiting.
+func (c *WebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if waiter := c.popWaiter(msg.ChatID); waiter != nil {
+		waiter <- msg.Content
+		return nil
+	}
+
+	if c.config.CallbackURL == "" {
+		return fmt.Errorf("no pending request or callback_url for webhook chat %s", msg.ChatID)
+	}
+	return c.postCallback(ctx, msg)
+}
+
+// webhookHandler handles incoming webhook requests.
+func (c *WebhookChannel) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeWebhookError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.config.Token)) != 1 {
+		logger.WarnC("webhook", "Rejected request with invalid token")
+		writeWebhookError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webhookMaxBodyBytes)).Decode(&req); err != nil {
+		writeWebhookError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeWebhookError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !c.IsAllowed(req.Sender) {
+		writeWebhookError(w, http.StatusForbidden, "sender not allowed")
+		return
+	}
+
+	syncReply := c.config.CallbackURL == ""
+	if req.Sync != nil {
+		syncReply = *req.Sync
+	}
+	if !syncReply && c.config.CallbackURL == "" {
+		writeWebhookError(w, http.StatusBadRequest, "async replies need callback_url to be configured")
+		return
+	}
+
+	metadata := make(map[string]string, len(req.Metadata)+2)
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	if _, ok := metadata["peer_kind"]; !ok {
+		if req.ChatID == req.Sender {
+			metadata["peer_kind"] = "direct"
+			metadata["peer_id"] = req.Sender
+		} else {
+			metadata["peer_kind"] = "group"
+			metadata["peer_id"] = req.ChatID
+		}
+	}
+
+	logger.DebugCF("webhook", "Received message", map[string]interface{}{
+		"sender":  req.Sender,
+		"chat_id": req.ChatID,
+		"sync":    syncReply,
+	})
+
+	if !syncReply {
+		c.HandleMessage(req.Sender, req.ChatID, req.Content, req.Media, metadata)
+		writeWebhookJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "chat_id": req.ChatID})
+		return
+	}
+
+	// Register before publishing so a fast reply cannot slip past us.
+	waiter := c.addWaiter(req.ChatID)
+	c.HandleMessage(req.Sender, req.ChatID, req.Content, req.Media, metadata)
+
+	timeout := time.Duration(c.config.SyncTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case content := <-waiter:
+		writeWebhookJSON(w, http.StatusOK, webhookReply{
+			Channel:   "webhook",
+			ChatID:    req.ChatID,
+			Content:   content,
+			Timestamp: time.Now().Unix(),
+		})
+	case <-timer.C:
+		c.removeWaiter(req.ChatID, waiter)
+		writeWebhookError(w, http.StatusGatewayTimeout, "timed out waiting for the reply")
+	case <-r.Context().Done():
+		c.removeWaiter(req.ChatID, waiter)
+	}
+}
+
+func (req *webhookRequest) validate() error {
+	if req.Sender == "" {
+		return fmt.Errorf("sender is required")
+	}
+	if req.ChatID == "" {
+		req.ChatID = req.Sender
+	}
+	if strings.TrimSpace(req.Content) == "" && len(req.Media) == 0 {
+		return fmt.Errorf("content or media is required")
+	}
+	// Media is handed to the agent as-is, so only remote URLs are accepted;
+	// a local path would let callers read files on this machine.
+	for _, m := range req.Media {
+		if !strings.HasPrefix(m, "http://") && !strings.HasPrefix(m, "https://") {
+			return fmt.Errorf("media must be http(s) URLs: %q", m)
+		}
+	}
+	return nil
+}
+
+func (c *WebhookChannel) addWaiter(chatID string) chan string {
+	ch := make(chan string, 1)
+	c.mu.Lock()
+	c.waiters[chatID] = append(c.waiters[chatID], ch)
+	c.mu.Unlock()
+	return ch
+}
+
+func (c *WebhookChannel) popWaiter(chatID string) chan string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.waiters[chatID]
+	if len(queue) == 0 {
+		return nil
+	}
+	if len(queue) == 1 {
+		delete(c.waiters, chatID)
+	} else {
+		c.waiters[chatID] = queue[1:]
+	}
+	return queue[0]
+}
+
+func (c *WebhookChannel) removeWaiter(chatID string, ch chan string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.waiters[chatID]
+	for i, w := range queue {
+		if w == ch {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(c.waiters, chatID)
+	} else {
+		c.waiters[chatID] = queue
+	}
+}
+
+// postCallback delivers a reply to the callback URL. The body is signed as
+// HMAC-SHA256(secret, timestamp + "." + body), sent hex-encoded in
+// X-Picoclaw-Signature as "sha256=<hex>" alongside X-Picoclaw-Timestamp.
+func (c *WebhookChannel) postCallback(ctx context.Context, msg bus.OutboundMessage) error {
+	now := time.Now().Unix()
+	body, err := json.Marshal(webhookReply{
+		Channel:   "webhook",
+		ChatID:    msg.ChatID,
+		Content:   msg.Content,
+		Timestamp: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(now, 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signWebhook(c.config.Secret, timestamp, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook callback: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func writeWebhookError(w http.ResponseWriter, status int, message string) {
+	writeWebhookJSON(w, status, map[string]string{"error": message})
+}
+
+func writeWebhookJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,182 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestWebhookChannel(t *testing.T, cfg config.WebhookConfig) (*WebhookChannel, *bus.MessageBus) {
+	t.Helper()
+	if cfg.Token == "" {
+		cfg.Token = "tok"
+	}
+	msgBus := bus.NewMessageBus()
+	ch, err := NewWebhookChannel(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewWebhookChannel() error: %v", err)
+	}
+	return ch, msgBus
+}
+
+func postWebhook(ch *WebhookChannel, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	ch.webhookHandler(rec, req)
+	return rec
+}
+
+func TestNewWebhookChannel(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	if _, err := NewWebhookChannel(config.WebhookConfig{}, msgBus); err == nil {
+		t.Error("missing token should be rejected")
+	}
+	if _, err := NewWebhookChannel(config.WebhookConfig{Token: "tok", CallbackURL: "http://x"}, msgBus); err == nil {
+		t.Error("callback_url without secret should be rejected")
+	}
+}
+
+func TestWebhookChannel_RejectsBadRequests(t *testing.T) {
+	ch, _ := newTestWebhookChannel(t, config.WebhookConfig{AllowFrom: config.FlexibleStringSlice{"alice"}})
+
+	tests := []struct {
+		name  string
+		token string
+		body  string
+		code  int
+	}{
+		{"no token", "", `{"sender":"alice","content":"hi"}`, http.StatusUnauthorized},
+		{"wrong token", "nope", `{"sender":"alice","content":"hi"}`, http.StatusUnauthorized},
+		{"bad json", "tok", `{`, http.StatusBadRequest},
+		{"no sender", "tok", `{"content":"hi"}`, http.StatusBadRequest},
+		{"no content", "tok", `{"sender":"alice"}`, http.StatusBadRequest},
+		{"local media", "tok", `{"sender":"alice","media":["/etc/passwd"]}`, http.StatusBadRequest},
+		{"async without callback", "tok", `{"sender":"alice","content":"hi","sync":false}`, http.StatusBadRequest},
+		{"not allowed", "tok", `{"sender":"mallory","content":"hi"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postWebhook(ch, tt.token, tt.body); rec.Code != tt.code {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookChannel_SyncReply(t *testing.T) {
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{})
+
+	go func() {
+		msg, ok := msgBus.ConsumeInbound(context.Background())
+		if !ok {
+			return
+		}
+		ch.Send(context.Background(), bus.OutboundMessage{
+			Channel: "webhook",
+			ChatID:  msg.ChatID,
+			Content: "echo: " + msg.Content,
+		})
+	}()
+
+	rec := postWebhook(ch, "tok", `{"sender":"alice","chat_id":"room1","content":"hi",
+		"media":["https://example.com/cat.png"],"metadata":{"source":"ci"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var reply webhookReply
+	json.Unmarshal(rec.Body.Bytes(), &reply)
+	if reply.ChatID != "room1" || reply.Content != "echo: hi" {
+		t.Errorf("reply = %+v", reply)
+	}
+}
+
+func TestWebhookChannel_SyncInboundMessage(t *testing.T) {
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{SyncTimeout: 1})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- postWebhook(ch, "tok", `{"sender":"alice","content":"hi",
+			"media":["https://example.com/cat.png"],"metadata":{"source":"ci"}}`)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message published")
+	}
+	if msg.Channel != "webhook" || msg.SenderID != "alice" || msg.ChatID != "alice" || msg.Content != "hi" {
+		t.Errorf("inbound = %+v", msg)
+	}
+	if len(msg.Media) != 1 || msg.Metadata["source"] != "ci" || msg.Metadata["peer_kind"] != "direct" {
+		t.Errorf("media/metadata = %v %v", msg.Media, msg.Metadata)
+	}
+
+	// Nobody replies: the request times out and the waiter is dropped.
+	if rec := <-done; rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", rec.Code)
+	}
+	if err := ch.Send(context.Background(), bus.OutboundMessage{Channel: "webhook", ChatID: "alice", Content: "late"}); err == nil {
+		t.Error("late reply without callback_url should fail")
+	}
+}
+
+func TestWebhookChannel_AsyncCallback(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer callback.Close()
+
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{CallbackURL: callback.URL, Secret: "shh"})
+
+	rec := postWebhook(ch, "tok", `{"sender":"alice","chat_id":"room1","content":"hi"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", rec.Code)
+	}
+	msg, _ := msgBus.ConsumeInbound(context.Background())
+	if msg.Metadata["peer_kind"] != "group" || msg.Metadata["peer_id"] != "room1" {
+		t.Errorf("metadata = %v", msg.Metadata)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{Channel: "webhook", ChatID: "room1", Content: "done"}); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	req, body := <-received, <-bodies
+
+	timestamp := req.Header.Get(webhookTimestampHeader)
+	if got, want := req.Header.Get(webhookSignatureHeader), signWebhook("shh", timestamp, body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	var reply webhookReply
+	json.Unmarshal(body, &reply)
+	if reply.ChatID != "room1" || reply.Content != "done" || reply.Channel != "webhook" {
+		t.Errorf("callback body = %s", body)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	got := signWebhook("secret", "1700000000", []byte(`{"a":1}`))
+	want := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+	if got == signWebhook("secret", "1700000001", []byte(`{"a":1}`)) {
+		t.Error("signature should cover the timestamp")
+	}
+}
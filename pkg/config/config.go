@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -77,7 +80,7 @@ func (c Config) MarshalJSON() ([]byte, error) {
 	}
 
 	// Only include session if not empty
-	if c.Session.DMScope != "" || len(c.Session.IdentityLinks) > 0 {
+	if !c.Session.IsEmpty() {
 		aux.Session = &c.Session
 	}
 
@@ -134,8 +137,18 @@ type AgentConfig struct {
 	Name      string            `json:"name,omitempty"`
 	Workspace string            `json:"workspace,omitempty"`
 	Model     *AgentModelConfig `json:"model,omitempty"`
-	Skills    []string          `json:"skills,omitempty"`
+	Skills    []string          `json:"skills,omitempty"` // Skills offered to this agent, by name or glob pattern; nil means all
 	Subagents *SubagentsConfig  `json:"subagents,omitempty"`
+	MCP       []string          `json:"mcp,omitempty"` // MCP servers this agent may use; nil means all
+	Tools     *AgentToolsConfig `json:"tools,omitempty"`
+}
+
+// AgentToolsConfig limits the tools an agent gets by name. Both lists hold
+// glob patterns such as "web_*"; deny wins over allow, and an empty allow
+// list allows every tool.
+type AgentToolsConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
 }
 
 type SubagentsConfig struct {
@@ -164,19 +177,40 @@ type AgentBinding struct {
 type SessionConfig struct {
 	DMScope       string              `json:"dm_scope,omitempty"`
 	IdentityLinks map[string][]string `json:"identity_links,omitempty"`
+	Store         string              `json:"store,omitempty"`        // "json" (default), "jsonl", "sqlite" or "memory"
+	MaxAgeDays    int                 `json:"max_age_days,omitempty"` // Delete sessions idle this long; 0 keeps them
+	MaxMessages   int                 `json:"max_messages,omitempty"` // Drop older messages beyond this; 0 keeps all
+}
+
+// IsEmpty reports whether no session option is set.
+func (c SessionConfig) IsEmpty() bool {
+	return c.DMScope == "" && len(c.IdentityLinks) == 0 && c.Store == "" && c.MaxAgeDays == 0 && c.MaxMessages == 0
 }
 
 type AgentDefaults struct {
-	Workspace           string   `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool     `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string   `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	Model               string   `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
-	ModelFallbacks      []string `json:"model_fallbacks,omitempty"`
-	ImageModel          string   `json:"image_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
-	ImageModelFallbacks []string `json:"image_model_fallbacks,omitempty"`
-	MaxTokens           int      `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	Temperature         *float64 `json:"temperature,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int      `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Workspace             string   `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace   bool     `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider              string   `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	Model                 string   `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
+	ModelFallbacks        []string `json:"model_fallbacks,omitempty"`
+	ImageModel            string   `json:"image_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
+	ImageModelFallbacks   []string `json:"image_model_fallbacks,omitempty"`
+	MaxTokens             int      `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	Temperature           *float64 `json:"temperature,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	MaxToolIterations     int      `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Streaming             bool     `json:"streaming" env:"PICOCLAW_AGENTS_DEFAULTS_STREAMING"`
+	MaxConcurrentSessions int      `json:"max_concurrent_sessions" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_CONCURRENT_SESSIONS"`
+	MaxParallelTools      int      `json:"max_parallel_tools" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_PARALLEL_TOOLS"`                   // Read-only tool calls run at once; 1 runs every call in turn
+	DailyTokenBudget      int      `json:"daily_token_budget,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_DAILY_TOKEN_BUDGET"`         // Per session; 0 = unlimited
+	BudgetModel           string   `json:"budget_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_BUDGET_MODEL"`                     // Downgrade target once the budget is spent; empty refuses instead
+	MemoryTopK            int      `json:"memory_top_k,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MEMORY_TOP_K"`                     // Memory snippets per prompt; 0 = 5
+	EmbeddingModel        string   `json:"embedding_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_EMBEDDING_MODEL"`               // model_list entry for memory embeddings; empty = keyword search only
+	SummaryModel          string   `json:"summary_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARY_MODEL"`                   // model_list entry for history summaries; empty = the agent's model
+	Trace                 bool     `json:"trace,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_TRACE"`                                   // Record every turn under <workspace>/traces
+	MaxTraces             int      `json:"max_traces,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TRACES"`                         // Traces kept per workspace; 0 = 100
+	MaxSubagentDepth      int      `json:"max_subagent_depth,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_SUBAGENT_DEPTH"`         // Levels of nested subagents; 0 = 1, so subagents start none of their own
+	MaxParallelSubagents  int      `json:"max_parallel_subagents,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_PARALLEL_SUBAGENTS"` // Subagents one agent runs at once; 0 = 4
+	SubagentTimeout       int      `json:"subagent_timeout,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUBAGENT_TIMEOUT"`             // Seconds a subagent task may run; 0 = 600
 }
 
 type ChannelsConfig struct {
@@ -190,6 +224,7 @@ type ChannelsConfig struct {
 	Slack    SlackConfig    `json:"slack"`
 	LINE     LINEConfig     `json:"line"`
 	OneBot   OneBotConfig   `json:"onebot"`
+	Webhook  WebhookConfig  `json:"webhook"`
 }
 
 type WhatsAppConfig struct {
@@ -258,6 +293,20 @@ type LINEConfig struct {
 	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_LINE_ALLOW_FROM"`
 }
 
+// WebhookConfig configures the generic HTTP webhook channel. Replies are
+// returned in the HTTP response, or POSTed to CallbackURL signed with Secret.
+type WebhookConfig struct {
+	Enabled     bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WEBHOOK_ENABLED"`
+	Host        string              `json:"host" env:"PICOCLAW_CHANNELS_WEBHOOK_HOST"`
+	Port        int                 `json:"port" env:"PICOCLAW_CHANNELS_WEBHOOK_PORT"`
+	Path        string              `json:"path" env:"PICOCLAW_CHANNELS_WEBHOOK_PATH"`
+	Token       string              `json:"token" env:"PICOCLAW_CHANNELS_WEBHOOK_TOKEN"`
+	CallbackURL string              `json:"callback_url" env:"PICOCLAW_CHANNELS_WEBHOOK_CALLBACK_URL"`
+	Secret      string              `json:"secret" env:"PICOCLAW_CHANNELS_WEBHOOK_SECRET"`
+	SyncTimeout int                 `json:"sync_timeout" env:"PICOCLAW_CHANNELS_WEBHOOK_SYNC_TIMEOUT"` // seconds
+	AllowFrom   FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WEBHOOK_ALLOW_FROM"`
+}
+
 type OneBotConfig struct {
 	Enabled            bool                `json:"enabled" env:"PICOCLAW_CHANNELS_ONEBOT_ENABLED"`
 	WSUrl              string              `json:"ws_url" env:"PICOCLAW_CHANNELS_ONEBOT_WS_URL"`
@@ -365,6 +414,14 @@ type ModelConfig struct {
 	// Optional optimizations
 	RPM            int    `json:"rpm,omitempty"`              // Requests per minute limit
 	MaxTokensField string `json:"max_tokens_field,omitempty"` // Field name for max tokens (e.g., "max_completion_tokens")
+
+	// Optional pricing for usage accounting, in USD per million tokens
+	InputPrice  float64 `json:"input_price,omitempty"`
+	OutputPrice float64 `json:"output_price,omitempty"`
+
+	// Optional context budgeting metadata
+	ContextWindow int    `json:"context_window,omitempty"` // Total tokens the model accepts (input + output)
+	Tokenizer     string `json:"tokenizer,omitempty"`      // "cl100k_base" (default) or "heuristic"
 }
 
 // Validate checks if the ModelConfig has all required fields.
@@ -379,8 +436,16 @@ func (c *ModelConfig) Validate() error {
 }
 
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host string           `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port int              `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	API  GatewayAPIConfig `json:"api"`
+}
+
+// GatewayAPIConfig enables the OpenAI-compatible /v1 endpoints on the
+// gateway listener. Requests must carry Token as a bearer token.
+type GatewayAPIConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GATEWAY_API_ENABLED"`
+	Token   string `json:"token" env:"PICOCLAW_GATEWAY_API_TOKEN"`
 }
 
 type BraveConfig struct {
@@ -415,10 +480,53 @@ type ExecConfig struct {
 	CustomDenyPatterns []string `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
 }
 
+// MCPServerConfig describes one Model Context Protocol server. Stdio servers
+// are started from Command; http (streamable HTTP) and sse servers are
+// reached at URL.
+type MCPServerConfig struct {
+	Type    string            `json:"type,omitempty"` // "stdio", "http" or "sse"; inferred from command/url when empty
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout int               `json:"timeout,omitempty"` // Seconds per request; 0 means 60
+}
+
+// TransportType returns Type, or the transport implied by the other fields.
+func (c MCPServerConfig) TransportType() string {
+	if c.Type != "" {
+		return c.Type
+	}
+	if c.Command == "" && c.URL != "" {
+		return "http"
+	}
+	return "stdio"
+}
+
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `json:"servers,omitempty"`
+}
+
+// ApprovalConfig lists tool calls that wait for someone in the originating
+// chat to approve them before they run.
+type ApprovalConfig struct {
+	Enabled        bool     `json:"enabled" env:"PICOCLAW_TOOLS_APPROVAL_ENABLED"`
+	TimeoutSeconds int      `json:"timeout_seconds" env:"PICOCLAW_TOOLS_APPROVAL_TIMEOUT_SECONDS"`   // Unanswered requests are denied after this; 0 = 300
+	Tools          []string `json:"tools" env:"PICOCLAW_TOOLS_APPROVAL_TOOLS"`                       // Tools whose every call needs approval
+	ExecPatterns   []string `json:"exec_patterns" env:"PICOCLAW_TOOLS_APPROVAL_EXEC_PATTERNS"`       // exec commands matching any of these regexes need approval
+	WriteAllowDirs []string `json:"write_allow_dirs" env:"PICOCLAW_TOOLS_APPROVAL_WRITE_ALLOW_DIRS"` // File writes outside these dirs (relative to the workspace) need approval; empty = none do
+	HardwareWrites bool     `json:"hardware_writes" env:"PICOCLAW_TOOLS_APPROVAL_HARDWARE_WRITES"`   // i2c writes and spi transfers need approval
+	Approvers      []string `json:"approvers" env:"PICOCLAW_TOOLS_APPROVAL_APPROVERS"`               // Sender IDs that may answer any request; others only answer their own
+}
+
 type ToolsConfig struct {
-	Web  WebToolsConfig  `json:"web"`
-	Cron CronToolsConfig `json:"cron"`
-	Exec ExecConfig      `json:"exec"`
+	Web      WebToolsConfig  `json:"web"`
+	Cron     CronToolsConfig `json:"cron"`
+	Exec     ExecConfig      `json:"exec"`
+	MCP      MCPConfig       `json:"mcp"`
+	Approval ApprovalConfig  `json:"approval"`
+	AuditLog bool            `json:"audit_log" env:"PICOCLAW_TOOLS_AUDIT_LOG"` // Record every tool call in <workspace>/audit/tools.jsonl
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -450,6 +558,14 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := cfg.ValidateAgentTools(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ValidateApproval(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
@@ -536,6 +652,14 @@ func expandHome(path string) string {
 // If multiple configs exist with the same model_name, it uses round-robin
 // selection for load balancing. Returns an error if the model is not found.
 func (c *Config) GetModelConfig(modelName string) (*ModelConfig, error) {
+	return c.GetAvailableModelConfig(modelName, nil)
+}
+
+// GetAvailableModelConfig is GetModelConfig with an availability check: the
+// round-robin skips entries for which available returns false, so duplicates
+// of a model_name are balanced across the entries that can take a request.
+// If no entry is available, the plain round-robin pick is returned.
+func (c *Config) GetAvailableModelConfig(modelName string, available func(*ModelConfig) bool) (*ModelConfig, error) {
 	matches := c.findMatches(modelName)
 	if len(matches) == 0 {
 		return nil, fmt.Errorf("model %q not found in model_list or providers", modelName)
@@ -545,7 +669,16 @@ func (c *Config) GetModelConfig(modelName string) (*ModelConfig, error) {
 	}
 
 	// Multiple configs - use round-robin for load balancing
-	idx := rrCounter.Add(1) % uint64(len(matches))
+	start := rrCounter.Add(1)
+	if available != nil {
+		for i := uint64(0); i < uint64(len(matches)); i++ {
+			idx := (start + i) % uint64(len(matches))
+			if available(&matches[idx]) {
+				return &matches[idx], nil
+			}
+		}
+	}
+	idx := start % uint64(len(matches))
 	return &matches[idx], nil
 }
 
@@ -582,6 +715,105 @@ func (c *Config) HasProvidersConfig() bool {
 		v.Qwen.APIKey != "" || v.Qwen.APIBase != ""
 }
 
+// ValidateAgentTools checks that the tool allow and deny patterns of every
+// agent are valid globs. A malformed pattern would match nothing, so a
+// deny list holding one would silently let tools through.
+func (c *Config) ValidateAgentTools() error {
+	for i, agent := range c.Agents.List {
+		if agent.Tools == nil {
+			continue
+		}
+		for field, patterns := range map[string][]string{"allow": agent.Tools.Allow, "deny": agent.Tools.Deny} {
+			for _, pattern := range patterns {
+				if err := checkGlob(pattern); err != nil {
+					return fmt.Errorf("agents.list[%d].tools.%s: %q: %w", i, field, pattern, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkGlob reports whether pattern is a well-formed path.Match glob. Match
+// only checks as much of a pattern as it reads, and accepts ranges such as
+// [z-a] that can never match, so every bracket expression is walked here.
+func checkGlob(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			end, err := checkGlobClass(pattern[i+1:])
+			if err != nil {
+				return err
+			}
+			i += end + 1
+		}
+	}
+	return nil
+}
+
+// checkGlobClass checks a bracket expression, given the text after its '[',
+// and returns the index of its closing ']'.
+func checkGlobClass(class string) (int, error) {
+	i := 0
+	if len(class) > 0 && class[0] == '^' {
+		i++
+	}
+	// char reads one possibly escaped character of the class, following
+	// path.Match in rejecting a bare '-' or ']'.
+	char := func() (rune, error) {
+		if i >= len(class) || class[i] == '-' || class[i] == ']' {
+			return 0, path.ErrBadPattern
+		}
+		if class[i] == '\\' {
+			if i++; i >= len(class) {
+				return 0, path.ErrBadPattern
+			}
+		}
+		r, n := utf8.DecodeRuneInString(class[i:])
+		i += n
+		return r, nil
+	}
+	for n := 0; ; n++ {
+		if i >= len(class) {
+			return 0, path.ErrBadPattern
+		}
+		if class[i] == ']' && n > 0 {
+			return i, nil
+		}
+		lo, err := char()
+		if err != nil {
+			return 0, err
+		}
+		if i < len(class) && class[i] == '-' {
+			i++
+			hi, err := char()
+			if err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%w: empty range %c-%c", path.ErrBadPattern, lo, hi)
+			}
+		}
+	}
+}
+
+// ValidateApproval checks that tools.approval.exec_patterns are valid
+// regular expressions. A pattern that failed to compile would be skipped,
+// so the commands it was meant to catch would run without approval.
+func (c *Config) ValidateApproval() error {
+	for i, pattern := range c.Tools.Approval.ExecPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("tools.approval.exec_patterns[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
 // ValidateModelList validates all ModelConfig entries in the model_list.
 // It checks that each model config is valid.
 // Note: Multiple entries with the same model_name are allowed for load balancing.
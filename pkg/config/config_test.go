@@ -2,9 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -392,3 +394,77 @@ func TestLoadConfig_OpenAIWebSearchCanBeDisabled(t *testing.T) {
 		t.Fatal("OpenAI codex web search should be false when disabled in config file")
 	}
 }
+
+func TestLoadConfig_MCPServers(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	data := `{
+		"agents": {"list": [{"id": "main"}, {"id": "research", "mcp": ["search"]}]},
+		"tools": {"mcp": {"servers": {
+			"fs": {"command": "npx", "args": ["-y", "@modelcontextprotocol/server-filesystem", "/tmp"], "env": {"DEBUG": "1"}},
+			"search": {"url": "https://mcp.example.com/mcp", "headers": {"Authorization": "Bearer x"}},
+			"legacy": {"type": "sse", "url": "https://old.example.com/sse"}
+		}}}
+	}`
+	if err := os.WriteFile(configPath, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	servers := cfg.Tools.MCP.Servers
+	if len(servers) != 3 {
+		t.Fatalf("servers = %d, want 3", len(servers))
+	}
+	if got := servers["fs"].TransportType(); got != "stdio" {
+		t.Errorf("fs transport = %q, want stdio", got)
+	}
+	if got := servers["search"].TransportType(); got != "http" {
+		t.Errorf("search transport = %q, want http", got)
+	}
+	if got := servers["legacy"].TransportType(); got != "sse" {
+		t.Errorf("legacy transport = %q, want sse", got)
+	}
+	if servers["fs"].Env["DEBUG"] != "1" || len(servers["fs"].Args) != 3 {
+		t.Errorf("fs = %+v", servers["fs"])
+	}
+	if cfg.Agents.List[0].MCP != nil {
+		t.Errorf("main mcp = %v, want nil (all servers)", cfg.Agents.List[0].MCP)
+	}
+	if got := cfg.Agents.List[1].MCP; len(got) != 1 || got[0] != "search" {
+		t.Errorf("research mcp = %v, want [search]", got)
+	}
+}
+
+func TestLoadConfig_RejectsBadToolPattern(t *testing.T) {
+	// path.Match only reports these once it reads that far, or never
+	for _, pattern := range []string{"exec[", "*[z-a]", "web_[a-]*", "*[^]"} {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "config.json")
+		data := fmt.Sprintf(`{"agents": {"list": [{"id": "main", "tools": {"allow": ["web_*", "[a-c]*", "mcp_\\*"], "deny": [%q]}}]}}`, pattern)
+		if err := os.WriteFile(configPath, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile() error: %v", err)
+		}
+
+		_, err := LoadConfig(configPath)
+		if err == nil || !strings.Contains(err.Error(), "agents.list[0].tools.deny") {
+			t.Errorf("LoadConfig() with deny %q error = %v, want the bad deny pattern reported", pattern, err)
+		}
+	}
+}
+
+func TestLoadConfig_RejectsBadExecPattern(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	data := `{"tools": {"approval": {"enabled": true, "exec_patterns": ["\\bsudo\\b", "(rm"]}}}`
+	if err := os.WriteFile(configPath, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "tools.approval.exec_patterns[1]") {
+		t.Errorf("LoadConfig() error = %v, want the bad exec pattern reported", err)
+	}
+}
@@ -10,13 +10,16 @@ func DefaultConfig() *Config {
 	return &Config{
 		Agents: AgentsConfig{
 			Defaults: AgentDefaults{
-				Workspace:           "~/.picoclaw/workspace",
-				RestrictToWorkspace: true,
-				Provider:            "",
-				Model:               "glm-4.7",
-				MaxTokens:           8192,
-				Temperature:         nil, // nil means use provider default
-				MaxToolIterations:   20,
+				Workspace:             "~/.picoclaw/workspace",
+				RestrictToWorkspace:   true,
+				Provider:              "",
+				Model:                 "glm-4.7",
+				MaxTokens:             8192,
+				Temperature:           nil, // nil means use provider default
+				MaxToolIterations:     20,
+				Streaming:             true,
+				MaxConcurrentSessions: 4,
+				MaxParallelTools:      4,
 			},
 		},
 		Bindings: []AgentBinding{},
@@ -88,6 +91,14 @@ func DefaultConfig() *Config {
 				GroupTriggerPrefix: []string{},
 				AllowFrom:          FlexibleStringSlice{},
 			},
+			Webhook: WebhookConfig{
+				Enabled:     false,
+				Host:        "0.0.0.0",
+				Port:        18792,
+				Path:        "/webhook",
+				SyncTimeout: 120,
+				AllowFrom:   FlexibleStringSlice{},
+			},
 		},
 		Providers: ProvidersConfig{
 			OpenAI: OpenAIProviderConfig{WebSearch: true},
@@ -262,6 +273,19 @@ func DefaultConfig() *Config {
 			Cron: CronToolsConfig{
 				ExecTimeoutMinutes: 5,
 			},
+			Approval: ApprovalConfig{
+				Enabled:        false,
+				TimeoutSeconds: 300,
+				ExecPatterns: []string{
+					`\bsudo\b`,
+					`\brm\b`,
+					`\bgit\s+push\b`,
+					`\b(curl|wget)\b.*\|\s*(ba|z)?sh\b`,
+					`\b(apt|apt-get|pip|npm)\s+(install|remove|uninstall)\b`,
+				},
+				HardwareWrites: true,
+			},
+			AuditLog: true,
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
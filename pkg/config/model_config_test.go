@@ -233,3 +233,30 @@ func TestConfig_ValidateModelList(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAvailableModelConfig_SkipsUnavailable(t *testing.T) {
+	cfg := &Config{
+		ModelList: []ModelConfig{
+			{ModelName: "lb-model", Model: "openai/gpt-4o-1", APIKey: "key1"},
+			{ModelName: "lb-model", Model: "openai/gpt-4o-2", APIKey: "key2"},
+			{ModelName: "lb-model", Model: "openai/gpt-4o-3", APIKey: "key3"},
+		},
+	}
+
+	available := func(mc *ModelConfig) bool { return mc.APIKey != "key2" }
+	for i := 0; i < 9; i++ {
+		result, err := cfg.GetAvailableModelConfig("lb-model", available)
+		if err != nil {
+			t.Fatalf("GetAvailableModelConfig() error = %v", err)
+		}
+		if result.APIKey == "key2" {
+			t.Fatal("round-robin returned an unavailable entry")
+		}
+	}
+
+	// With nothing available, the plain round-robin pick is returned.
+	result, err := cfg.GetAvailableModelConfig("lb-model", func(*ModelConfig) bool { return false })
+	if err != nil || result == nil {
+		t.Fatalf("GetAvailableModelConfig() = %v, %v; want a fallback pick", result, err)
+	}
+}
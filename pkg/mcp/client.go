@@ -0,0 +1,271 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// errClosed is returned for calls on a connection that has gone away.
+var errClosed = errors.New("connection closed")
+
+// transport moves JSON-RPC messages between the client and one server.
+// Incoming messages are passed to the handler given to start; done is
+// closed once the connection is lost for good.
+type transport interface {
+	start(ctx context.Context, handle func(*message)) error
+	send(ctx context.Context, data []byte) error
+	done() <-chan struct{}
+	close() error
+}
+
+// Client is a connection to one MCP server. It is safe for concurrent use.
+type Client struct {
+	name      string
+	transport transport
+	timeout   time.Duration
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan *Response
+
+	// OnNotification, when set before Connect, receives notifications
+	// from the server.
+	OnNotification func(method string, params json.RawMessage)
+
+	serverInfo   Implementation
+	instructions string
+}
+
+// NewClient creates a client for a configured server. Nothing is started
+// until Connect.
+func NewClient(name string, cfg config.MCPServerConfig) (*Client, error) {
+	var t transport
+	switch cfg.TransportType() {
+	case "stdio":
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("mcp server %q: command is required", name)
+		}
+		t = newStdioTransport(name, cfg.Command, cfg.Args, cfg.Env)
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("mcp server %q: url is required", name)
+		}
+		t = newHTTPTransport(cfg.URL, cfg.Headers)
+	case "sse":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("mcp server %q: url is required", name)
+		}
+		t = newSSETransport(cfg.URL, cfg.Headers)
+	default:
+		return nil, fmt.Errorf("mcp server %q: unknown type %q", name, cfg.Type)
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	return &Client{
+		name:      name,
+		transport: t,
+		timeout:   timeout,
+		pending:   make(map[string]chan *Response),
+	}, nil
+}
+
+// Connect starts the transport and performs the initialize handshake.
+func (c *Client) Connect(ctx context.Context) error {
+	if err := c.transport.start(ctx, c.dispatch); err != nil {
+		return err
+	}
+
+	params := initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      Implementation{Name: "picoclaw", Version: "1.0"},
+	}
+	var result initializeResult
+	if err := c.call(ctx, "initialize", params, &result); err != nil {
+		c.transport.close()
+		return fmt.Errorf("initialize: %w", err)
+	}
+	c.serverInfo = result.ServerInfo
+	c.instructions = result.Instructions
+
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		c.transport.close()
+		return fmt.Errorf("initialized notification: %w", err)
+	}
+
+	logger.InfoCF("mcp", "Connected to MCP server",
+		map[string]interface{}{
+			"server":   c.name,
+			"name":     result.ServerInfo.Name,
+			"version":  result.ServerInfo.Version,
+			"protocol": result.ProtocolVersion,
+		})
+	return nil
+}
+
+// ServerInfo returns the name and version the server reported.
+func (c *Client) ServerInfo() Implementation {
+	return c.serverInfo
+}
+
+// Instructions returns the usage hints the server sent on initialize, if any.
+func (c *Client) Instructions() string {
+	return c.instructions
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var result listToolsResult
+		if err := c.call(ctx, "tools/list", listToolsParams{Cursor: cursor}, &result); err != nil {
+			return nil, fmt.Errorf("tools/list: %w", err)
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" || result.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes a tool. Failures the tool reports itself come back as a
+// result with IsError set; err is reserved for protocol and transport errors.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", callToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Done is closed when the connection is lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.transport.done()
+}
+
+// Close shuts the connection down, stopping the server process for stdio.
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	rawID := json.RawMessage(id)
+	req := Request{JSONRPC: "2.0", ID: &rawID, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode params: %w", err)
+		}
+		req.Params = data
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	ch := make(chan *Response, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.transport.send(ctx, data); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("failed to decode result: %w", err)
+			}
+		}
+		return nil
+	case <-c.transport.done():
+		return errClosed
+	case <-ctx.Done():
+		if method != "initialize" {
+			c.notify(context.Background(), "notifications/cancelled",
+				map[string]interface{}{"requestId": rawID, "reason": ctx.Err().Error()})
+		}
+		return ctx.Err()
+	}
+}
+
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	req := Request{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode params: %w", err)
+		}
+		req.Params = data
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	return c.transport.send(ctx, data)
+}
+
+// dispatch routes an incoming message: responses go to the waiting call,
+// notifications to OnNotification, and server requests get an answer
+// (an empty result for ping, method-not-found for anything else).
+func (c *Client) dispatch(msg *message) {
+	if msg.isResponse() {
+		c.mu.Lock()
+		ch, ok := c.pending[string(*msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			select {
+			case ch <- msg.response():
+			default: // duplicate response
+			}
+		}
+		return
+	}
+
+	if msg.ID == nil {
+		if c.OnNotification != nil && msg.Method != "" {
+			c.OnNotification(msg.Method, msg.Params)
+		}
+		return
+	}
+
+	resp := Response{JSONRPC: "2.0", ID: msg.ID}
+	if msg.Method == "ping" {
+		resp.Result = json.RawMessage("{}")
+	} else {
+		resp.Error = &RPCError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	go c.transport.send(context.Background(), data)
+}
@@ -0,0 +1,372 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeResult answers one request the way a small MCP server would: two
+// pages of tools, an echo tool, and a tool that reports an error.
+func fakeResult(method string, params json.RawMessage) (interface{}, *RPCError) {
+	switch method {
+	case "initialize":
+		return initializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      Implementation{Name: "fake", Version: "0.1"},
+		}, nil
+	case "tools/list":
+		var p listToolsParams
+		json.Unmarshal(params, &p)
+		if p.Cursor == "" {
+			return listToolsResult{
+				Tools:      []Tool{{Name: "echo", Description: "Echo text", InputSchema: map[string]interface{}{"type": "object"}}},
+				NextCursor: "page2",
+			}, nil
+		}
+		return listToolsResult{Tools: []Tool{{Name: "fail"}, {Name: "crash"}}}, nil
+	case "tools/call":
+		var p callToolParams
+		json.Unmarshal(params, &p)
+		switch p.Name {
+		case "echo":
+			return CallToolResult{Content: []Content{{Type: "text", Text: fmt.Sprint(p.Arguments["text"])}}}, nil
+		case "fail":
+			return CallToolResult{Content: []Content{{Type: "text", Text: "boom"}}, IsError: true}, nil
+		}
+		return nil, &RPCError{Code: codeInvalidParams, Message: "unknown tool " + p.Name}
+	}
+	return nil, &RPCError{Code: codeMethodNotFound, Message: "method not found"}
+}
+
+func fakeResponse(msg *message) []byte {
+	result, rpcErr := fakeResult(msg.Method, msg.Params)
+	resp := Response{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result, _ = json.Marshal(result)
+	}
+	data, _ := json.Marshal(resp)
+	return data
+}
+
+// TestHelperProcess is the stdio server started by the stdio tests.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("PICOCLAW_MCP_HELPER") != "1" {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "fake server starting")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.ID == nil {
+			continue
+		}
+		if msg.Method == "tools/call" && strings.Contains(string(msg.Params), `"crash"`) {
+			os.Exit(3)
+		}
+		os.Stdout.Write(append(fakeResponse(&msg), '\n'))
+	}
+	os.Exit(0)
+}
+
+func helperServer() config.MCPServerConfig {
+	return config.MCPServerConfig{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperProcess"},
+		Env:     map[string]string{"PICOCLAW_MCP_HELPER": "1"},
+		Timeout: 10,
+	}
+}
+
+func checkClient(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+
+	if c.ServerInfo().Name != "fake" {
+		t.Errorf("server name = %q, want fake", c.ServerInfo().Name)
+	}
+
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	if len(tools) != 3 || tools[0].Name != "echo" || tools[2].Name != "crash" {
+		t.Fatalf("tools = %+v, want echo, fail, crash across two pages", tools)
+	}
+
+	result, err := c.CallTool(ctx, "echo", map[string]interface{}{"text": "hello"})
+	if err != nil {
+		t.Fatalf("CallTool(echo) error: %v", err)
+	}
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Text != "hello" {
+		t.Errorf("echo result = %+v", result)
+	}
+
+	result, err = c.CallTool(ctx, "fail", nil)
+	if err != nil {
+		t.Fatalf("CallTool(fail) error: %v", err)
+	}
+	if !result.IsError {
+		t.Errorf("fail result should have IsError set")
+	}
+
+	if _, err := c.CallTool(ctx, "missing", nil); err == nil {
+		t.Errorf("CallTool(missing) should return the RPC error")
+	}
+}
+
+func TestClient_Stdio(t *testing.T) {
+	c, err := NewClient("fake", helperServer())
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer c.Close()
+
+	checkClient(t, c)
+}
+
+func TestClient_StdioCrashClosesConnection(t *testing.T) {
+	c, err := NewClient("fake", helperServer())
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.CallTool(context.Background(), "crash", nil); err == nil {
+		t.Fatal("CallTool(crash) should fail when the server exits")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done() not closed after the server exited")
+	}
+}
+
+func TestClient_StreamableHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var sessions []string
+	deleted := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			mu.Lock()
+			deleted = true
+			mu.Unlock()
+			return
+		}
+
+		var msg message
+		json.NewDecoder(r.Body).Decode(&msg)
+		mu.Lock()
+		sessions = append(sessions, r.Header.Get(sessionHeader))
+		mu.Unlock()
+
+		switch {
+		case msg.ID == nil:
+			w.WriteHeader(http.StatusAccepted)
+		case msg.Method == "initialize":
+			w.Header().Set(sessionHeader, "sess-1")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(fakeResponse(&msg))
+		case msg.Method == "tools/call":
+			// Answer over SSE, with a notification ahead of the response.
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", fakeResponse(&msg))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(fakeResponse(&msg))
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient("remote", config.MCPServerConfig{
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	var notifications []string
+	c.OnNotification = func(method string, _ json.RawMessage) {
+		notifications = append(notifications, method)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+
+	checkClient(t, c)
+	c.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, s := range sessions[1:] {
+		if s != "sess-1" {
+			t.Errorf("request %d sent session %q, want sess-1", i+1, s)
+		}
+	}
+	if !deleted {
+		t.Error("Close() should end the session with DELETE")
+	}
+	if len(notifications) == 0 || notifications[0] != "notifications/progress" {
+		t.Errorf("notifications = %v, want notifications/progress", notifications)
+	}
+}
+
+func TestClient_StreamableHTTPSessionExpired(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg message
+		json.NewDecoder(r.Body).Decode(&msg)
+		switch {
+		case msg.Method == "initialize":
+			w.Header().Set(sessionHeader, "sess-1")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(fakeResponse(&msg))
+		case msg.ID == nil:
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient("remote", config.MCPServerConfig{URL: srv.URL})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	if _, err := c.ListTools(context.Background()); err == nil {
+		t.Fatal("ListTools() should fail once the session is gone")
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("Done() should be closed after the session expired")
+	}
+}
+
+func TestClient_LegacySSE(t *testing.T) {
+	responses := make(chan []byte, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		fmt.Fprintf(w, "event: endpoint\ndata: /messages?session=abc\n\n")
+		flusher.Flush()
+		for {
+			select {
+			case data := <-responses:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("session") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var msg message
+		json.NewDecoder(r.Body).Decode(&msg)
+		if msg.ID != nil {
+			responses <- fakeResponse(&msg)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := NewClient("legacy", config.MCPServerConfig{Type: "sse", URL: srv.URL + "/sse"})
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer c.Close()
+
+	checkClient(t, c)
+}
+
+func TestClient_AnswersServerPing(t *testing.T) {
+	sent := make(chan []byte, 1)
+	c := &Client{
+		transport: &recordingTransport{sent: sent, doneCh: make(chan struct{})},
+		pending:   make(map[string]chan *Response),
+	}
+	id := json.RawMessage(`7`)
+	c.dispatch(&message{JSONRPC: "2.0", ID: &id, Method: "ping"})
+
+	select {
+	case data := <-sent:
+		if string(data) != `{"jsonrpc":"2.0","id":7,"result":{}}` {
+			t.Errorf("ping reply = %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no reply to ping")
+	}
+}
+
+type recordingTransport struct {
+	sent   chan []byte
+	doneCh chan struct{}
+}
+
+func (t *recordingTransport) start(context.Context, func(*message)) error { return nil }
+func (t *recordingTransport) send(_ context.Context, data []byte) error {
+	t.sent <- data
+	return nil
+}
+func (t *recordingTransport) done() <-chan struct{} { return t.doneCh }
+func (t *recordingTransport) close() error          { return nil }
+
+func TestNewClient_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.MCPServerConfig
+	}{
+		{"no command", config.MCPServerConfig{Type: "stdio"}},
+		{"no url", config.MCPServerConfig{Type: "http"}},
+		{"unknown type", config.MCPServerConfig{Type: "grpc", URL: "x"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewClient("x", tt.cfg); err == nil {
+			t.Errorf("%s: NewClient() should fail", tt.name)
+		}
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := ": comment\nevent: endpoint\ndata: /a\n\ndata: line1\ndata: line2\n\ndata: tail"
+	var got []string
+	readSSE(strings.NewReader(stream), func(event, data string) bool {
+		got = append(got, event+"|"+data)
+		return true
+	})
+	want := []string{"endpoint|/a", "|line1\nline2", "|tail"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
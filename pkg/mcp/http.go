@@ -0,0 +1,331 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// sessionHeader carries the session ID of a streamable HTTP connection.
+const sessionHeader = "Mcp-Session-Id"
+
+// httpTransport implements the streamable HTTP transport: every message is
+// POSTed to one endpoint, which answers with JSON or an SSE stream.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	handle  func(*message)
+
+	mu        sync.Mutex
+	sessionID string
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func newHTTPTransport(endpoint string, headers map[string]string) *httpTransport {
+	return &httpTransport{
+		url:     endpoint,
+		headers: headers,
+		client:  &http.Client{},
+		doneCh:  make(chan struct{}),
+	}
+}
+
+func (t *httpTransport) start(ctx context.Context, handle func(*message)) error {
+	t.handle = handle
+	return nil
+}
+
+func (t *httpTransport) send(ctx context.Context, data []byte) error {
+	select {
+	case <-t.doneCh:
+		return errClosed
+	default:
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(sessionHeader); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && t.session() != "":
+		// The server dropped our session; the owner has to reconnect.
+		t.shutdown()
+		return fmt.Errorf("session expired")
+	case resp.StatusCode == http.StatusAccepted:
+		return nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return readSSE(resp.Body, func(event, data string) bool {
+			if event == "" || event == "message" {
+				for _, msg := range decodeMessages([]byte(data)) {
+					t.handle(msg)
+				}
+			}
+			return true
+		})
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	for _, msg := range decodeMessages(body) {
+		t.handle(msg)
+	}
+	return nil
+}
+
+func (t *httpTransport) session() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if id := t.session(); id != "" {
+		req.Header.Set(sessionHeader, id)
+	}
+}
+
+func (t *httpTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+func (t *httpTransport) shutdown() {
+	t.closeOnce.Do(func() { close(t.doneCh) })
+}
+
+// close ends the session on the server, when there is one, and marks the
+// transport done.
+func (t *httpTransport) close() error {
+	if t.session() != "" {
+		if req, err := http.NewRequest(http.MethodDelete, t.url, nil); err == nil {
+			t.setHeaders(req)
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	t.shutdown()
+	return nil
+}
+
+// sseTransport implements the older HTTP+SSE transport: the client holds a
+// GET event stream open, the server names a POST endpoint in an "endpoint"
+// event, and responses come back over the stream.
+type sseTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	postURL string
+	cancel  context.CancelFunc
+	doneCh  chan struct{}
+}
+
+func newSSETransport(endpoint string, headers map[string]string) *sseTransport {
+	return &sseTransport{
+		url:     endpoint,
+		headers: headers,
+		client:  &http.Client{},
+		doneCh:  make(chan struct{}),
+	}
+}
+
+func (t *sseTransport) start(ctx context.Context, handle func(*message)) error {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, t.url, nil)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to open event stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("event stream returned %d", resp.StatusCode)
+	}
+
+	endpoint := make(chan string, 1)
+	go func() {
+		defer close(t.doneCh)
+		defer resp.Body.Close()
+		readSSE(resp.Body, func(event, data string) bool {
+			switch event {
+			case "endpoint":
+				select {
+				case endpoint <- strings.TrimSpace(data):
+				default:
+				}
+			case "", "message":
+				for _, msg := range decodeMessages([]byte(data)) {
+					handle(msg)
+				}
+			}
+			return true
+		})
+	}()
+
+	select {
+	case ep := <-endpoint:
+		base, err := url.Parse(t.url)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("invalid url: %w", err)
+		}
+		ref, err := url.Parse(ep)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("invalid endpoint %q: %w", ep, err)
+		}
+		t.postURL = base.ResolveReference(ref).String()
+		return nil
+	case <-t.doneCh:
+		return fmt.Errorf("event stream closed before endpoint event")
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, data []byte) error {
+	select {
+	case <-t.doneCh:
+		return errClosed
+	default:
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.postURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (t *sseTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+func (t *sseTransport) close() error {
+	if t.cancel != nil {
+		t.cancel()
+		<-t.doneCh
+	}
+	return nil
+}
+
+// readSSE parses a server-sent event stream, calling fn for each event
+// until fn returns false or the stream ends.
+func readSSE(r io.Reader, fn func(event, data string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 && !fn(event, strings.Join(data, "\n")) {
+				return nil
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if len(data) > 0 {
+		fn(event, strings.Join(data, "\n"))
+	}
+	return scanner.Err()
+}
+
+// decodeMessages decodes a single JSON-RPC message or a batch. Anything
+// else yields nothing.
+func decodeMessages(data []byte) []*message {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '[' {
+		var batch []*message
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil
+		}
+		return batch
+	}
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil
+	}
+	return []*message{&msg}
+}
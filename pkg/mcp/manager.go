@@ -0,0 +1,208 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// ToolsFunc receives the tools of a server each time it (re)connects or
+// reports that its tool list changed.
+type ToolsFunc func(server string, tools []Tool)
+
+// Manager keeps a connection to every configured server, reconnecting
+// with backoff when one drops (for stdio, when the process exits).
+type Manager struct {
+	servers map[string]config.MCPServerConfig
+	onTools ToolsFunc
+
+	mu      sync.RWMutex
+	clients map[string]*Client
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewManager(cfg config.MCPConfig) *Manager {
+	return &Manager{
+		servers: cfg.Servers,
+		clients: make(map[string]*Client),
+	}
+}
+
+// Servers returns the configured server names, sorted.
+func (m *Manager) Servers() []string {
+	names := make([]string, 0, len(m.servers))
+	for name := range m.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start connects to every server in the background and returns once each
+// has connected or failed its first attempt, or ctx is done, so tools from
+// servers that are up are registered before the first message. Servers
+// that failed or are still connecting keep at it until Close.
+func (m *Manager) Start(ctx context.Context, onTools ToolsFunc) {
+	m.onTools = onTools
+	runCtx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	var ready sync.WaitGroup
+	for _, name := range m.Servers() {
+		ready.Add(1)
+		m.wg.Add(1)
+		go func(name string) {
+			defer m.wg.Done()
+			m.run(runCtx, name, m.servers[name], ready.Done)
+		}(name)
+	}
+
+	allReady := make(chan struct{})
+	go func() {
+		ready.Wait()
+		close(allReady)
+	}()
+	select {
+	case <-allReady:
+	case <-ctx.Done():
+	}
+}
+
+// CallTool calls a tool on a connected server.
+func (m *Manager) CallTool(ctx context.Context, server, tool string, args map[string]interface{}) (*CallToolResult, error) {
+	m.mu.RLock()
+	client, ok := m.clients[server]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("mcp server %q is not connected", server)
+	}
+	return client.CallTool(ctx, tool, args)
+}
+
+// Close disconnects from every server and stops reconnecting.
+func (m *Manager) Close() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.wg.Wait()
+}
+
+// run connects to one server until ctx is canceled. ready is called after
+// the first attempt.
+func (m *Manager) run(ctx context.Context, name string, cfg config.MCPServerConfig, ready func()) {
+	var readyOnce sync.Once
+	defer readyOnce.Do(ready)
+
+	backoff := minBackoff
+	for {
+		client, tools, err := m.connect(ctx, name, cfg)
+		readyOnce.Do(ready)
+		if err != nil {
+			logger.WarnCF("mcp", "Failed to connect to MCP server",
+				map[string]interface{}{
+					"server": name,
+					"error":  err.Error(),
+					"retry":  backoff.String(),
+				})
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		connected := time.Now()
+		m.mu.Lock()
+		m.clients[name] = client
+		m.mu.Unlock()
+		if m.onTools != nil {
+			m.onTools(name, tools)
+		}
+
+		select {
+		case <-ctx.Done():
+			client.Close()
+			return
+		case <-client.Done():
+		}
+
+		m.mu.Lock()
+		delete(m.clients, name)
+		m.mu.Unlock()
+		client.Close()
+
+		// A server that stayed up for a while gets a fast reconnect; one
+		// that keeps crashing right after starting keeps backing off.
+		if time.Since(connected) > maxBackoff {
+			backoff = minBackoff
+		}
+		logger.WarnCF("mcp", "MCP server disconnected, reconnecting",
+			map[string]interface{}{
+				"server": name,
+				"retry":  backoff.String(),
+			})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (m *Manager) connect(ctx context.Context, name string, cfg config.MCPServerConfig) (*Client, []Tool, error) {
+	client, err := NewClient(name, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.OnNotification = func(method string, _ json.RawMessage) {
+		if method == "notifications/tools/list_changed" {
+			go m.refreshTools(ctx, name, client)
+		}
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, nil, err
+	}
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	logger.InfoCF("mcp", "Loaded MCP tools",
+		map[string]interface{}{
+			"server": name,
+			"count":  len(tools),
+		})
+	return client, tools, nil
+}
+
+func (m *Manager) refreshTools(ctx context.Context, name string, client *Client) {
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		logger.WarnCF("mcp", "Failed to refresh MCP tools",
+			map[string]interface{}{
+				"server": name,
+				"error":  err.Error(),
+			})
+		return
+	}
+	if m.onTools != nil {
+		m.onTools(name, tools)
+	}
+}
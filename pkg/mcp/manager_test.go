@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestManager_ReconnectsAfterCrash(t *testing.T) {
+	m := NewManager(config.MCPConfig{Servers: map[string]config.MCPServerConfig{"fake": helperServer()}})
+	loads := make(chan []Tool, 4)
+	m.Start(context.Background(), func(server string, tools []Tool) {
+		if server != "fake" {
+			t.Errorf("server = %q, want fake", server)
+		}
+		loads <- tools
+	})
+	defer m.Close()
+
+	select {
+	case tools := <-loads:
+		if len(tools) != 3 {
+			t.Fatalf("tools = %d, want 3", len(tools))
+		}
+	default:
+		t.Fatal("Start() should return after tools are loaded")
+	}
+
+	ctx := context.Background()
+	if _, err := m.CallTool(ctx, "fake", "crash", nil); err == nil {
+		t.Fatal("CallTool(crash) should fail")
+	}
+
+	select {
+	case <-loads:
+	case <-time.After(10 * time.Second):
+		t.Fatal("tools not reloaded after reconnect")
+	}
+	result, err := m.CallTool(ctx, "fake", "echo", map[string]interface{}{"text": "back"})
+	if err != nil {
+		t.Fatalf("CallTool after reconnect error: %v", err)
+	}
+	if result.Content[0].Text != "back" {
+		t.Errorf("echo = %q, want back", result.Content[0].Text)
+	}
+}
+
+func TestManager_UnreachableServer(t *testing.T) {
+	m := NewManager(config.MCPConfig{Servers: map[string]config.MCPServerConfig{
+		"missing": {Command: "/nonexistent/mcp-server"},
+	}})
+	called := false
+	m.Start(context.Background(), func(string, []Tool) { called = true })
+	defer m.Close()
+
+	if called {
+		t.Error("onTools should not run for a server that failed to start")
+	}
+	if _, err := m.CallTool(context.Background(), "missing", "x", nil); err == nil {
+		t.Error("CallTool on a disconnected server should fail")
+	}
+}
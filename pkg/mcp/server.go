@@ -0,0 +1,238 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ToolHandler supplies the tools a Server exposes.
+type ToolHandler interface {
+	ListTools() []Tool
+	CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error)
+}
+
+// Server answers MCP requests from a host over stdio or streamable HTTP.
+// Only the tools capability is offered.
+type Server struct {
+	info         Implementation
+	instructions string
+	handler      ToolHandler
+
+	// Token, when set, is the bearer token HTTP clients must present.
+	Token string
+
+	mu       sync.Mutex
+	sessions map[string]bool
+}
+
+func NewServer(info Implementation, instructions string, handler ToolHandler) *Server {
+	return &Server{
+		info:         info,
+		instructions: instructions,
+		handler:      handler,
+		sessions:     make(map[string]bool),
+	}
+}
+
+// ServeStdio reads newline-delimited requests from r and writes responses
+// to w until r is exhausted or ctx is canceled. Requests are handled
+// concurrently, so a slow tool doesn't hold up pings or other calls.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	write := func(resp *Response) {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		w.Write(append(data, '\n'))
+	}
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line := strings.TrimSpace(string(line)); line != "" {
+			msgs := decodeMessages([]byte(line))
+			if msgs == nil {
+				write(&Response{JSONRPC: "2.0", Error: &RPCError{Code: codeParseError, Message: "parse error"}})
+			}
+			for _, msg := range msgs {
+				wg.Add(1)
+				go func(msg *message) {
+					defer wg.Done()
+					if resp := s.handle(ctx, msg); resp != nil {
+						write(resp)
+					}
+				}(msg)
+			}
+		}
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// ServeHTTP implements the streamable HTTP transport with plain JSON
+// responses. initialize opens a session whose ID later requests must send.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte(s.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	sessionID := r.Header.Get(sessionHeader)
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, sessionID)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	msgs := decodeMessages(body)
+	if msgs == nil {
+		writeJSON(w, &Response{JSONRPC: "2.0", Error: &RPCError{Code: codeParseError, Message: "parse error"}})
+		return
+	}
+
+	initializing := len(msgs) == 1 && msgs[0].Method == "initialize"
+	if initializing {
+		sessionID = uuid.NewString()
+		s.mu.Lock()
+		s.sessions[sessionID] = true
+		s.mu.Unlock()
+		w.Header().Set(sessionHeader, sessionID)
+	} else {
+		s.mu.Lock()
+		known := s.sessions[sessionID]
+		s.mu.Unlock()
+		if !known {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	var responses []*Response
+	for _, msg := range msgs {
+		if resp := s.handle(r.Context(), msg); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case len(msgs) == 1 && body[0] != '[':
+		writeJSON(w, responses[0])
+	default:
+		writeJSON(w, responses)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handle answers one message. Notifications and stray responses get nil.
+func (s *Server) handle(ctx context.Context, msg *message) *Response {
+	if msg.ID == nil || msg.Method == "" {
+		return nil
+	}
+
+	result, rpcErr := s.dispatch(ctx, msg.Method, msg.Params)
+	resp := &Response{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &RPCError{Code: codeInternalError, Message: err.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+	return resp
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (interface{}, *RPCError) {
+	switch method {
+	case "initialize":
+		var p initializeParams
+		if len(params) > 0 {
+			json.Unmarshal(params, &p)
+		}
+		logger.InfoCF("mcp", "MCP client connected",
+			map[string]interface{}{
+				"client":   p.ClientInfo.Name,
+				"version":  p.ClientInfo.Version,
+				"protocol": p.ProtocolVersion,
+			})
+		return initializeResult{
+			ProtocolVersion: negotiateVersion(p.ProtocolVersion),
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      s.info,
+			Instructions:    s.instructions,
+		}, nil
+
+	case "ping":
+		return map[string]interface{}{}, nil
+
+	case "tools/list":
+		return listToolsResult{Tools: s.handler.ListTools()}, nil
+
+	case "tools/call":
+		var p callToolParams
+		if err := json.Unmarshal(params, &p); err != nil || p.Name == "" {
+			return nil, &RPCError{Code: codeInvalidParams, Message: "invalid tools/call params"}
+		}
+		result, err := s.handler.CallTool(ctx, p.Name, p.Arguments)
+		if err != nil {
+			return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return result, nil
+	}
+	return nil, &RPCError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", method)}
+}
+
+// negotiateVersion echoes the client's protocol version when it is one we
+// understand, and offers ours otherwise.
+func negotiateVersion(requested string) string {
+	switch requested {
+	case "2024-11-05", "2025-03-26", "2025-06-18":
+		return requested
+	}
+	return ProtocolVersion
+}
@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fakeHandler struct{}
+
+func (fakeHandler) ListTools() []Tool {
+	return []Tool{{Name: "echo", InputSchema: map[string]interface{}{"type": "object"}}}
+}
+
+func (fakeHandler) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error) {
+	if name != "echo" {
+		return nil, fmt.Errorf("unknown tool: %s", name)
+	}
+	return &CallToolResult{Content: []Content{{Type: "text", Text: fmt.Sprint(args["text"])}}}, nil
+}
+
+func newTestServer() *Server {
+	return NewServer(Implementation{Name: "picoclaw", Version: "test"}, "test server", fakeHandler{})
+}
+
+func TestServer_Stdio(t *testing.T) {
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"host","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`,
+		`not json`,
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if err := newTestServer().ServeStdio(context.Background(), strings.NewReader(input), &out); err != nil {
+		t.Fatalf("ServeStdio() error: %v", err)
+	}
+
+	responses := make(map[string]Response)
+	var parseErrors int
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp Response
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid response line %q: %v", line, err)
+		}
+		if resp.ID == nil {
+			parseErrors++
+			continue
+		}
+		responses[string(*resp.ID)] = resp
+	}
+	if len(responses) != 4 || parseErrors != 1 {
+		t.Fatalf("got %d responses and %d parse errors, want 4 and 1: %s", len(responses), parseErrors, out.String())
+	}
+
+	var init initializeResult
+	json.Unmarshal(responses["1"].Result, &init)
+	if init.ProtocolVersion != "2024-11-05" || init.ServerInfo.Name != "picoclaw" {
+		t.Errorf("initialize result = %+v", init)
+	}
+	var call CallToolResult
+	json.Unmarshal(responses["3"].Result, &call)
+	if len(call.Content) != 1 || call.Content[0].Text != "hi" {
+		t.Errorf("tools/call result = %+v", call)
+	}
+	if responses["4"].Error == nil || responses["4"].Error.Code != codeMethodNotFound {
+		t.Errorf("resources/list should be method-not-found, got %+v", responses["4"])
+	}
+}
+
+func TestServer_HTTPRoundTrip(t *testing.T) {
+	server := newTestServer()
+	server.Token = "secret"
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	c, err := NewClient("picoclaw", config.MCPServerConfig{
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer c.Close()
+
+	if c.Instructions() != "test server" {
+		t.Errorf("instructions = %q", c.Instructions())
+	}
+	tools, err := c.ListTools(context.Background())
+	if err != nil || len(tools) != 1 {
+		t.Fatalf("ListTools() = %v, %v", tools, err)
+	}
+	result, err := c.CallTool(context.Background(), "echo", map[string]interface{}{"text": "over http"})
+	if err != nil {
+		t.Fatalf("CallTool() error: %v", err)
+	}
+	if result.Content[0].Text != "over http" {
+		t.Errorf("echo = %q", result.Content[0].Text)
+	}
+	if _, err := c.CallTool(context.Background(), "missing", nil); err == nil {
+		t.Error("CallTool(missing) should fail")
+	}
+}
+
+func TestServer_HTTPAuthAndSessions(t *testing.T) {
+	server := newTestServer()
+	server.Token = "secret"
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	post := func(body, token, session string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if session != "" {
+			req.Header.Set(sessionHeader, session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST error: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	list := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
+	if resp := post(list, "wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("bad token status = %d, want 401", resp.StatusCode)
+	}
+	if resp := post(list, "secret", "nope"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session status = %d, want 404", resp.StatusCode)
+	}
+
+	resp := post(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`, "secret", "")
+	session := resp.Header.Get(sessionHeader)
+	if session == "" {
+		t.Fatal("initialize should return a session ID")
+	}
+	if resp := post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`, "secret", session); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("notification status = %d, want 202", resp.StatusCode)
+	}
+	if resp := post(list, "secret", session); resp.StatusCode != http.StatusOK {
+		t.Errorf("tools/list status = %d, want 200", resp.StatusCode)
+	}
+}
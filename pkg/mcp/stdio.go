@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// stdioTransport runs the server as a child process and exchanges
+// newline-delimited JSON-RPC messages over its stdin and stdout.
+type stdioTransport struct {
+	name    string
+	command string
+	args    []string
+	env     map[string]string
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	doneCh  chan struct{}
+}
+
+func newStdioTransport(name, command string, args []string, env map[string]string) *stdioTransport {
+	return &stdioTransport{
+		name:    name,
+		command: command,
+		args:    args,
+		env:     env,
+		doneCh:  make(chan struct{}),
+	}
+}
+
+func (t *stdioTransport) start(ctx context.Context, handle func(*message)) error {
+	cmd := exec.Command(t.command, t.args...)
+	cmd.Env = os.Environ()
+	for k, v := range t.env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stderr: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", t.command, err)
+	}
+	t.cmd = cmd
+	t.stdin = stdin
+
+	go t.logStderr(stderr)
+	go func() {
+		readLines(stdout, handle)
+		err := cmd.Wait()
+		logger.WarnCF("mcp", "MCP server process exited",
+			map[string]interface{}{
+				"server": t.name,
+				"error":  fmt.Sprint(err),
+			})
+		close(t.doneCh)
+	}()
+	return nil
+}
+
+// readLines decodes one message per line until r is exhausted. Lines that
+// aren't JSON-RPC (stray log output) are ignored.
+func readLines(r io.Reader, handle func(*message)) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			for _, msg := range decodeMessages(line) {
+				handle(msg)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *stdioTransport) logStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		logger.DebugCF("mcp", "MCP server stderr",
+			map[string]interface{}{
+				"server": t.name,
+				"line":   scanner.Text(),
+			})
+	}
+}
+
+func (t *stdioTransport) send(ctx context.Context, data []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	select {
+	case <-t.doneCh:
+		return errClosed
+	default:
+	}
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", t.name, err)
+	}
+	return nil
+}
+
+func (t *stdioTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+// close closes the server's stdin, which well-behaved servers take as the
+// signal to exit, and kills the process if it is still running shortly after.
+func (t *stdioTransport) close() error {
+	if t.cmd == nil {
+		return nil
+	}
+	t.writeMu.Lock()
+	t.stdin.Close()
+	t.writeMu.Unlock()
+
+	select {
+	case <-t.doneCh:
+	case <-time.After(2 * time.Second):
+		t.cmd.Process.Kill()
+		<-t.doneCh
+	}
+	return nil
+}
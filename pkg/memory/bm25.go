@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters; the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// stopwords are frequent English words that carry no retrieval signal.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "do": true, "for": true, "from": true,
+	"has": true, "have": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "of": true, "on": true, "or": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "what": true, "when": true,
+	"where": true, "which": true, "who": true, "with": true, "you": true, "your": true,
+}
+
+// tokenize lowercases text and splits it into words, dropping stopwords and
+// single letters such as the "s" of "what's". Han, kana and hangul are
+// emitted one rune per token, since those scripts don't use spaces.
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	emit := func() {
+		if word.Len() == 0 {
+			return
+		}
+		if w := word.String(); !stopwords[w] && !(len(w) == 1 && w[0] >= 'a' && w[0] <= 'z') {
+			tokens = append(tokens, w)
+		}
+		word.Reset()
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			emit()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			emit()
+		}
+	}
+	emit()
+	return tokens
+}
+
+// bm25 is an in-memory BM25 index over a fixed set of documents.
+type bm25 struct {
+	termFreqs []map[string]int
+	lengths   []int
+	docFreq   map[string]int
+	avgLen    float64
+}
+
+func newBM25(docs []string) *bm25 {
+	idx := &bm25{
+		termFreqs: make([]map[string]int, len(docs)),
+		lengths:   make([]int, len(docs)),
+		docFreq:   make(map[string]int),
+	}
+	total := 0
+	for i, doc := range docs {
+		tf := make(map[string]int)
+		tokens := tokenize(doc)
+		for _, t := range tokens {
+			tf[t]++
+		}
+		for t := range tf {
+			idx.docFreq[t]++
+		}
+		idx.termFreqs[i] = tf
+		idx.lengths[i] = len(tokens)
+		total += len(tokens)
+	}
+	if len(docs) > 0 {
+		idx.avgLen = float64(total) / float64(len(docs))
+	}
+	return idx
+}
+
+// scores returns the BM25 score of every document for query.
+func (idx *bm25) scores(query string) []float64 {
+	scores := make([]float64, len(idx.termFreqs))
+	n := float64(len(idx.termFreqs))
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		df := float64(idx.docFreq[term])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i, tf := range idx.termFreqs {
+			f := float64(tf[term])
+			if f == 0 {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*float64(idx.lengths[i])/idx.avgLen
+			scores[i] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+	return scores
+}
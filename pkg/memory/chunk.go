@@ -0,0 +1,122 @@
+// Package memory indexes an agent's memory files (MEMORY.md and daily
+// notes) so only the snippets relevant to a message reach the prompt.
+// Retrieval is BM25 over markdown chunks, optionally blended with vector
+// similarity from an embedding model.
+package memory
+
+import (
+	"strings"
+)
+
+// maxChunkChars is the size chunks are packed up to. Longer paragraphs
+// are split on line boundaries.
+const maxChunkChars = 800
+
+// Chunk is a retrievable piece of a memory file.
+type Chunk struct {
+	Source  string `json:"source"`            // Path relative to the memory dir, e.g. "MEMORY.md"
+	Heading string `json:"heading,omitempty"` // Enclosing markdown headings, joined with " > "
+	Line    int    `json:"line"`              // 1-based line the chunk starts on
+	Text    string `json:"text"`
+}
+
+// chunkMarkdown splits a markdown document into chunks that never cross a
+// heading and pack whole paragraphs up to maxChunkChars.
+func chunkMarkdown(source, content string) []Chunk {
+	type heading struct {
+		level int
+		title string
+	}
+	var chunks []Chunk
+	var headings []heading
+	var buf []string
+	bufLine := 0
+
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(buf, "\n"))
+		if text != "" {
+			titles := make([]string, len(headings))
+			for i, h := range headings {
+				titles[i] = h.title
+			}
+			chunks = append(chunks, Chunk{
+				Source:  source,
+				Heading: strings.Join(titles, " > "),
+				Line:    bufLine,
+				Text:    text,
+			})
+		}
+		buf = buf[:0]
+		bufLine = 0
+	}
+	size := func() int {
+		n := 0
+		for _, l := range buf {
+			n += len(l) + 1
+		}
+		return n
+	}
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if level, title := parseHeading(line); level > 0 {
+			flush()
+			for len(headings) > 0 && headings[len(headings)-1].level >= level {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, heading{level, title})
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			// Paragraph break: close the chunk if the next paragraph
+			// would overflow it.
+			next := i + 1
+			for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+				next++
+			}
+			if size()+paragraphLen(lines[next:]) > maxChunkChars {
+				flush()
+			} else if len(buf) > 0 {
+				buf = append(buf, "")
+			}
+			continue
+		}
+
+		if len(buf) > 0 && size()+len(line) > maxChunkChars {
+			flush()
+		}
+		if len(buf) == 0 {
+			bufLine = i + 1
+		}
+		buf = append(buf, line)
+	}
+	flush()
+	return chunks
+}
+
+// parseHeading returns the level and title of an ATX heading line.
+func parseHeading(line string) (int, string) {
+	trimmed := strings.TrimLeft(line, "#")
+	level := len(line) - len(trimmed)
+	if level == 0 || level > 6 || !strings.HasPrefix(trimmed, " ") {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(trimmed)
+}
+
+// paragraphLen is the length of the paragraph at the start of lines.
+func paragraphLen(lines []string) int {
+	n := 0
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			break
+		}
+		if level, _ := parseHeading(l); level > 0 {
+			break
+		}
+		n += len(l) + 1
+	}
+	return n
+}
@@ -0,0 +1,334 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// indexDir holds the embedding cache inside the memory dir.
+	indexDir = ".index"
+	// embedBatch is how many chunks are embedded per request.
+	embedBatch = 64
+	// minSimilarity is the cosine similarity a chunk needs to be returned
+	// on vector similarity alone, without sharing a term with the query.
+	minSimilarity = 0.3
+)
+
+var errUnexpectedEmbeddings = errors.New("embedding response does not match the input")
+
+// Embedder turns texts into vectors, such as an OpenAI-compatible
+// /embeddings endpoint.
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Result is a chunk matching a query.
+type Result struct {
+	Chunk
+	Score float64 `json:"score"`
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// Index searches the markdown files under a memory dir. It re-reads them
+// whenever one changes, so writes through any means are picked up on the
+// next search.
+type Index struct {
+	dir      string
+	embedder Embedder
+
+	mu      sync.Mutex
+	files   map[string]fileStamp
+	chunks  []Chunk
+	lexical *bm25
+	vectors map[string][]float32 // Chunk hash -> embedding from embedder
+	loaded  bool                 // Embedding cache read from disk
+}
+
+// NewIndex returns an index over the memory files in dir.
+func NewIndex(dir string) *Index {
+	return &Index{dir: dir, vectors: make(map[string][]float32)}
+}
+
+// SetEmbedder enables vector similarity. Without one, search is BM25 only.
+func (ix *Index) SetEmbedder(e Embedder) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.embedder = e
+	ix.vectors = make(map[string][]float32)
+	ix.loaded = false
+}
+
+// Search returns up to k chunks relevant to query, best first. Embedding
+// errors are logged and the search falls back to BM25.
+func (ix *Index) Search(ctx context.Context, query string, k int) ([]Result, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if err := ix.refresh(); err != nil {
+		return nil, err
+	}
+	if len(ix.chunks) == 0 || strings.TrimSpace(query) == "" || k <= 0 {
+		return nil, nil
+	}
+
+	lexical := ix.lexical.scores(query)
+	maxLexical := 0.0
+	for _, s := range lexical {
+		maxLexical = math.Max(maxLexical, s)
+	}
+
+	var similarity []float64
+	if ix.embedder != nil {
+		var err error
+		if similarity, err = ix.similarity(ctx, query); err != nil {
+			logger.WarnCF("memory", "Embedding search failed, using keyword search only",
+				map[string]interface{}{
+					"model": ix.embedder.Model(),
+					"error": err.Error(),
+				})
+			similarity = nil
+		}
+	}
+
+	var results []Result
+	for i, chunk := range ix.chunks {
+		lex := 0.0
+		if maxLexical > 0 {
+			lex = lexical[i] / maxLexical
+		}
+		score := lex
+		if similarity != nil {
+			if lex == 0 && similarity[i] < minSimilarity {
+				continue
+			}
+			score = 0.5*lex + 0.5*math.Max(similarity[i], 0)
+		}
+		if score <= 0 {
+			continue
+		}
+		results = append(results, Result{Chunk: chunk, Score: score})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// refresh re-chunks the memory files if any was added, changed or removed.
+func (ix *Index) refresh() error {
+	stamps := make(map[string]fileStamp)
+	err := filepath.WalkDir(ix.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == indexDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stamps[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if ix.lexical != nil && sameStamps(stamps, ix.files) {
+		return nil
+	}
+
+	paths := make([]string, 0, len(stamps))
+	for path := range stamps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var chunks []Chunk
+	docs := []string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(ix.dir, path)
+		for _, c := range chunkMarkdown(filepath.ToSlash(rel), string(data)) {
+			chunks = append(chunks, c)
+			docs = append(docs, c.Heading+"\n"+c.Text)
+		}
+	}
+
+	ix.files = stamps
+	ix.chunks = chunks
+	ix.lexical = newBM25(docs)
+	return nil
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, s := range a {
+		if t, ok := b[path]; !ok || t.size != s.size || !t.modTime.Equal(s.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// similarity embeds any chunks not yet embedded, then returns the cosine
+// similarity of each chunk to query.
+func (ix *Index) similarity(ctx context.Context, query string) ([]float64, error) {
+	if !ix.loaded {
+		ix.loadVectors()
+		ix.loaded = true
+	}
+
+	var missing []string
+	var missingKeys []string
+	for _, c := range ix.chunks {
+		key := chunkKey(c)
+		if _, ok := ix.vectors[key]; !ok {
+			missing = append(missing, embedText(c))
+			missingKeys = append(missingKeys, key)
+		}
+	}
+	for start := 0; start < len(missing); start += embedBatch {
+		end := min(start+embedBatch, len(missing))
+		vecs, err := ix.embedder.Embed(ctx, missing[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(vecs) != end-start {
+			return nil, errUnexpectedEmbeddings
+		}
+		for i, v := range vecs {
+			ix.vectors[missingKeys[start+i]] = v
+		}
+	}
+	if len(missing) > 0 {
+		ix.saveVectors()
+	}
+
+	qv, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(qv) != 1 {
+		return nil, errUnexpectedEmbeddings
+	}
+
+	sims := make([]float64, len(ix.chunks))
+	for i, c := range ix.chunks {
+		sims[i] = cosine(qv[0], ix.vectors[chunkKey(c)])
+	}
+	return sims, nil
+}
+
+type vectorCache struct {
+	Model   string               `json:"model"`
+	Vectors map[string][]float32 `json:"vectors"`
+}
+
+func (ix *Index) cachePath() string {
+	return filepath.Join(ix.dir, indexDir, "embeddings.json")
+}
+
+func (ix *Index) loadVectors() {
+	data, err := os.ReadFile(ix.cachePath())
+	if err != nil {
+		return
+	}
+	var cache vectorCache
+	if json.Unmarshal(data, &cache) != nil || cache.Model != ix.embedder.Model() {
+		return
+	}
+	for k, v := range cache.Vectors {
+		ix.vectors[k] = v
+	}
+}
+
+// saveVectors writes the embeddings of current chunks, dropping stale ones.
+func (ix *Index) saveVectors() {
+	cache := vectorCache{Model: ix.embedder.Model(), Vectors: make(map[string][]float32)}
+	for _, c := range ix.chunks {
+		key := chunkKey(c)
+		if v, ok := ix.vectors[key]; ok {
+			cache.Vectors[key] = v
+		}
+	}
+	ix.vectors = cache.Vectors
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.cachePath()), 0755); err != nil {
+		return
+	}
+	if err := os.WriteFile(ix.cachePath(), data, 0644); err != nil {
+		logger.WarnCF("memory", "Failed to write embedding cache", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func embedText(c Chunk) string {
+	if c.Heading == "" {
+		return c.Text
+	}
+	return c.Heading + "\n" + c.Text
+}
+
+func chunkKey(c Chunk) string {
+	sum := sha256.Sum256([]byte(embedText(c)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,204 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChunkMarkdown(t *testing.T) {
+	doc := "# Me\n\nIntro line.\n\n## Preferences\n\n- likes green tea\n- hates olives\n\n### Music\n\nJazz on weekends.\n\n## Work\n\nEmbedded engineer."
+	chunks := chunkMarkdown("MEMORY.md", doc)
+
+	want := []struct{ heading, text string }{
+		{"Me", "Intro line."},
+		{"Me > Preferences", "- likes green tea\n- hates olives"},
+		{"Me > Preferences > Music", "Jazz on weekends."},
+		{"Me > Work", "Embedded engineer."},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks: %+v", len(chunks), chunks)
+	}
+	for i, w := range want {
+		if chunks[i].Heading != w.heading || chunks[i].Text != w.text {
+			t.Errorf("chunk %d = %q / %q, want %q / %q", i, chunks[i].Heading, chunks[i].Text, w.heading, w.text)
+		}
+	}
+	if chunks[1].Line != 7 {
+		t.Errorf("Preferences chunk starts on line %d, want 7", chunks[1].Line)
+	}
+}
+
+func TestChunkMarkdown_SplitsLongSections(t *testing.T) {
+	para := strings.Repeat("word ", 100) // ~500 chars
+	chunks := chunkMarkdown("x.md", para+"\n\n"+para+"\n\n"+para)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	for _, c := range chunks {
+		if len(c.Text) > maxChunkChars {
+			t.Errorf("chunk of %d chars exceeds the limit", len(c.Text))
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := strings.Join(tokenize("The Wi-Fi password is 'hunter2'! 我喜欢茶"), ",")
+	if got != "wi,fi,password,hunter2,我,喜,欢,茶" {
+		t.Errorf("tokenize = %s", got)
+	}
+}
+
+func TestIndex_KeywordSearch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "MEMORY.md"), "## Home\n\nThe wifi password is hunter2.\n\n## Family\n\nSister Anna lives in Berlin.")
+	writeFile(t, filepath.Join(dir, "202610", "20261015.md"), "# 2026-10-15\n\nBooked flights to Berlin for Anna's birthday.")
+
+	ix := NewIndex(dir)
+	results, err := ix.Search(context.Background(), "what's the wifi password?", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Text, "hunter2") || results[0].Source != "MEMORY.md" {
+		t.Fatalf("results = %+v", results)
+	}
+
+	results, _ = ix.Search(context.Background(), "Anna Berlin", 1)
+	if len(results) != 1 {
+		t.Fatalf("limit not applied: %+v", results)
+	}
+
+	// Files changed on disk are picked up by the next search.
+	writeFile(t, filepath.Join(dir, "MEMORY.md"), "## Home\n\nRouter moved to the attic.")
+	results, _ = ix.Search(context.Background(), "wifi password", 5)
+	if len(results) != 0 {
+		t.Errorf("stale results after edit: %+v", results)
+	}
+	results, _ = ix.Search(context.Background(), "attic", 5)
+	if len(results) != 1 {
+		t.Errorf("new content not indexed: %+v", results)
+	}
+}
+
+// fakeEmbedder maps texts to vectors by keyword: one dimension per topic.
+type fakeEmbedder struct {
+	calls int
+	err   error
+}
+
+func (f *fakeEmbedder) Model() string { return "fake" }
+
+func (f *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		lower := strings.ToLower(text)
+		v := []float32{0.01, 0.01}
+		if strings.Contains(lower, "tea") || strings.Contains(lower, "drink") || strings.Contains(lower, "beverage") {
+			v[0] = 1
+		}
+		if strings.Contains(lower, "car") || strings.Contains(lower, "vehicle") {
+			v[1] = 1
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func TestIndex_EmbeddingSearch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "MEMORY.md"), "## Preferences\n\nLikes green tea without sugar.\n\n## Stuff\n\nDrives a red car.")
+
+	embedder := &fakeEmbedder{}
+	ix := NewIndex(dir)
+	ix.SetEmbedder(embedder)
+
+	// No shared keyword with either chunk: only vectors can match.
+	results, err := ix.Search(context.Background(), "favourite beverage", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Text, "green tea") {
+		t.Fatalf("results = %+v", results)
+	}
+
+	// Chunk vectors are cached on disk and reused by a fresh index.
+	if _, err := os.Stat(filepath.Join(dir, indexDir, "embeddings.json")); err != nil {
+		t.Fatalf("embedding cache not written: %v", err)
+	}
+	fresh := &fakeEmbedder{}
+	ix2 := NewIndex(dir)
+	ix2.SetEmbedder(fresh)
+	ix2.Search(context.Background(), "vehicle", 5)
+	if fresh.calls != 1 {
+		t.Errorf("fresh index made %d embedding calls, want 1 (query only)", fresh.calls)
+	}
+}
+
+func TestIndex_EmbeddingFailureFallsBackToKeywords(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "MEMORY.md"), "Likes green tea.")
+
+	ix := NewIndex(dir)
+	ix.SetEmbedder(&fakeEmbedder{err: errors.New("endpoint down")})
+	results, err := ix.Search(context.Background(), "green tea", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("results = %+v, want the keyword match", results)
+	}
+}
+
+func TestStore_AppendLongTerm(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	steps := []struct{ section, content string }{
+		{"", "# Memory"},
+		{"Preferences", "- likes tea"},
+		{"Family", "- sister Anna"},
+		{"preferences", "- hates olives"},
+	}
+	for _, s := range steps {
+		if err := store.AppendLongTerm(s.section, s.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(store.LongTermPath())
+	want := "# Memory\n\n## Preferences\n\n- likes tea\n- hates olives\n\n## Family\n\n- sister Anna\n"
+	if string(data) != want {
+		t.Errorf("MEMORY.md =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestStore_AppendDaily(t *testing.T) {
+	store := NewStore(t.TempDir())
+	store.AppendDaily("first")
+	store.AppendDaily("second")
+
+	data, err := os.ReadFile(store.DailyPath(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# " + time.Now().Format("2006-01-02") + "\n\nfirst\nsecond"
+	if string(data) != want {
+		t.Errorf("daily note = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store reads and writes the memory files of a workspace:
+//   - Long-term memory: memory/MEMORY.md
+//   - Daily notes: memory/YYYYMM/YYYYMMDD.md
+type Store struct {
+	dir   string
+	mu    sync.Mutex
+	index *Index
+}
+
+// NewStore returns the store for the memory dir, creating it if needed.
+func NewStore(dir string) *Store {
+	os.MkdirAll(dir, 0755)
+	return &Store{dir: dir, index: NewIndex(dir)}
+}
+
+// Dir returns the memory directory.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Index returns the search index over the store's files.
+func (s *Store) Index() *Index {
+	return s.index
+}
+
+// LongTermPath returns the path of MEMORY.md.
+func (s *Store) LongTermPath() string {
+	return filepath.Join(s.dir, "MEMORY.md")
+}
+
+// DailyPath returns the path of the daily note for t.
+func (s *Store) DailyPath(t time.Time) string {
+	day := t.Format("20060102") // YYYYMMDD
+	return filepath.Join(s.dir, day[:6], day+".md")
+}
+
+// AppendLongTerm adds content to MEMORY.md. With a section, content goes at
+// the end of the section of that title, which is created if missing.
+func (s *Store) AppendLongTerm(section, content string) error {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return errors.New("content is empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := ""
+	if data, err := os.ReadFile(s.LongTermPath()); err == nil {
+		existing = string(data)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.WriteFile(s.LongTermPath(), []byte(insertInSection(existing, section, content)), 0644)
+}
+
+// AppendDaily appends content to today's daily note. A new note starts
+// with a date header.
+func (s *Store) AppendDaily(content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	path := s.DailyPath(now)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	var existing string
+	if data, err := os.ReadFile(path); err == nil {
+		existing = string(data)
+	}
+
+	var updated string
+	if existing == "" {
+		updated = fmt.Sprintf("# %s\n\n", now.Format("2006-01-02")) + content
+	} else {
+		updated = existing + "\n" + content
+	}
+	return os.WriteFile(path, []byte(updated), 0644)
+}
+
+// insertInSection places content at the end of the named section of doc,
+// or at the end of doc when section is empty.
+func insertInSection(doc, section, content string) string {
+	lines := strings.Split(strings.TrimRight(doc, "\n"), "\n")
+	if doc == "" {
+		lines = nil
+	}
+
+	if section == "" {
+		return joinBlock(lines, content)
+	}
+
+	start, level := -1, 0
+	for i, line := range lines {
+		if l, title := parseHeading(line); l > 0 && strings.EqualFold(title, section) {
+			start, level = i, l
+			break
+		}
+	}
+	if start < 0 {
+		return joinBlock(lines, "## "+section+"\n\n"+content)
+	}
+
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		if l, _ := parseHeading(lines[i]); l > 0 && l <= level {
+			end = i
+			break
+		}
+	}
+	for end > start+1 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+
+	out := append([]string{}, lines[:end]...)
+	if end == start+1 || !isListItem(lines[end-1]) || !isListItem(content) {
+		out = append(out, "")
+	}
+	out = append(out, content)
+	rest := lines[end:]
+	if len(rest) > 0 && strings.TrimSpace(rest[0]) != "" {
+		out = append(out, "")
+	}
+	out = append(out, rest...)
+	return strings.Join(out, "\n") + "\n"
+}
+
+// isListItem reports whether line is a markdown bullet, so further bullets
+// can follow it without a blank line.
+func isListItem(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")
+}
+
+// joinBlock appends block to lines as a new paragraph.
+func joinBlock(lines []string, block string) string {
+	doc := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if doc == "" {
+		return block + "\n"
+	}
+	return doc + "\n\n" + block + "\n"
+}
@@ -62,13 +62,9 @@ func NewProviderWithTokenSourceAndBaseURL(token string, tokenSource func() (stri
 }
 
 func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
-	var opts []option.RequestOption
-	if p.tokenSource != nil {
-		tok, err := p.tokenSource()
-		if err != nil {
-			return nil, fmt.Errorf("refreshing token: %w", err)
-		}
-		opts = append(opts, option.WithAuthToken(tok))
+	opts, err := p.requestOptions()
+	if err != nil {
+		return nil, err
 	}
 
 	params, err := buildParams(messages, tools, model, options)
@@ -84,6 +80,18 @@ func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDef
 	return parseResponse(resp), nil
 }
 
+func (p *Provider) requestOptions() ([]option.RequestOption, error) {
+	var opts []option.RequestOption
+	if p.tokenSource != nil {
+		tok, err := p.tokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("refreshing token: %w", err)
+		}
+		opts = append(opts, option.WithAuthToken(tok))
+	}
+	return opts, nil
+}
+
 func (p *Provider) GetDefaultModel() string {
 	return "claude-sonnet-4.6"
 }
@@ -92,6 +100,24 @@ func (p *Provider) BaseURL() string {
 	return p.baseURL
 }
 
+// contentBlocks converts multimodal parts to text and image blocks.
+func contentBlocks(parts []protocoltypes.ContentPart) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case protocoltypes.PartText:
+			blocks = append(blocks, anthropic.NewTextBlock(part.Text))
+		case protocoltypes.PartImage:
+			if mediaType, data, ok := protocoltypes.ParseDataURL(part.ImageURL); ok {
+				blocks = append(blocks, anthropic.NewImageBlockBase64(mediaType, data))
+			} else {
+				blocks = append(blocks, anthropic.NewImageBlock(anthropic.URLImageSourceParam{URL: part.ImageURL}))
+			}
+		}
+	}
+	return blocks
+}
+
 func buildParams(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (anthropic.MessageNewParams, error) {
 	var system []anthropic.TextBlockParam
 	var anthropicMessages []anthropic.MessageParam
@@ -105,6 +131,8 @@ func buildParams(messages []Message, tools []ToolDefinition, model string, optio
 				anthropicMessages = append(anthropicMessages,
 					anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
 				)
+			} else if len(msg.Parts) > 0 {
+				anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(contentBlocks(msg.Parts)...))
 			} else {
 				anthropicMessages = append(anthropicMessages,
 					anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
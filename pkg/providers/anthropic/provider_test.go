@@ -9,6 +9,8 @@ import (
 
 	"github.com/anthropics/anthropic-sdk-go"
 	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 func TestBuildParams_BasicMessage(t *testing.T) {
@@ -263,3 +265,33 @@ func createAnthropicTestClient(baseURL, token string) *anthropic.Client {
 	)
 	return &c
 }
+
+func TestBuildParams_ImageParts(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "describe", Parts: []protocoltypes.ContentPart{
+			{Type: protocoltypes.PartText, Text: "describe"},
+			{Type: protocoltypes.PartImage, ImageURL: "data:image/jpeg;base64,/9j/AA=="},
+			{Type: protocoltypes.PartImage, ImageURL: "https://example.com/cat.png"},
+		}},
+	}
+	params, err := buildParams(messages, nil, "claude-sonnet-4.6", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+
+	blocks := params.Messages[0].Content
+	if len(blocks) != 3 {
+		t.Fatalf("len(blocks) = %d, want 3", len(blocks))
+	}
+	inline := blocks[1].OfImage
+	if inline == nil || inline.Source.OfBase64 == nil {
+		t.Fatal("expected base64 image block")
+	}
+	if inline.Source.OfBase64.Data != "/9j/AA==" || inline.Source.OfBase64.MediaType != "image/jpeg" {
+		t.Errorf("base64 source = %+v", inline.Source.OfBase64)
+	}
+	linked := blocks[2].OfImage
+	if linked == nil || linked.Source.OfURL == nil || linked.Source.OfURL.URL != "https://example.com/cat.png" {
+		t.Error("expected URL image block")
+	}
+}
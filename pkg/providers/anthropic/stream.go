@@ -0,0 +1,76 @@
+package anthropicprovider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+type StreamChunk = protocoltypes.StreamChunk
+type ToolCallDelta = protocoltypes.ToolCallDelta
+
+// ChatStream streams a Messages API response, calling onChunk for every text
+// and tool-input delta. The final response is built from the accumulated message.
+func (p *Provider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk func(StreamChunk)) (*LLMResponse, error) {
+	opts, err := p.requestOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := buildParams(messages, tools, model, options)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := p.client.Messages.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+
+	message := anthropic.Message{}
+	// Maps content block index to tool call position so deltas can be keyed
+	// the same way as OpenAI-style tool call fragments.
+	toolIndex := make(map[int64]int)
+
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return nil, fmt.Errorf("claude stream: %w", err)
+		}
+		if onChunk == nil {
+			continue
+		}
+
+		switch ev := event.AsAny().(type) {
+		case anthropic.ContentBlockStartEvent:
+			if ev.ContentBlock.Type == "tool_use" {
+				idx := len(toolIndex)
+				toolIndex[ev.Index] = idx
+				onChunk(StreamChunk{ToolCallDeltas: []ToolCallDelta{{
+					Index: idx,
+					ID:    ev.ContentBlock.ID,
+					Name:  ev.ContentBlock.Name,
+				}}})
+			}
+		case anthropic.ContentBlockDeltaEvent:
+			switch delta := ev.Delta.AsAny().(type) {
+			case anthropic.TextDelta:
+				if delta.Text != "" {
+					onChunk(StreamChunk{ContentDelta: delta.Text})
+				}
+			case anthropic.InputJSONDelta:
+				if delta.PartialJSON != "" {
+					onChunk(StreamChunk{ToolCallDeltas: []ToolCallDelta{{
+						Index:          toolIndex[ev.Index],
+						ArgumentsDelta: delta.PartialJSON,
+					}}})
+				}
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("claude API call: %w", err)
+	}
+
+	return parseResponse(&message), nil
+}
@@ -0,0 +1,80 @@
+package anthropicprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProvider_ChatStreamRoundTrip(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_test","type":"message","role":"assistant","model":"claude-sonnet-4.6","content":[],"stop_reason":null,"usage":{"input_tokens":12,"output_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"SF\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			var header struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(ev), &header)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", header.Type, ev)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewProviderWithClient(createAnthropicTestClient(server.URL, "test-token"))
+
+	var text strings.Builder
+	var args strings.Builder
+	var toolName string
+	resp, err := provider.ChatStream(t.Context(), []Message{{Role: "user", Content: "weather?"}}, nil, "claude-sonnet-4.6",
+		map[string]interface{}{"max_tokens": 1024}, func(chunk StreamChunk) {
+			text.WriteString(chunk.ContentDelta)
+			for _, d := range chunk.ToolCallDeltas {
+				if d.Name != "" {
+					toolName = d.Name
+				}
+				args.WriteString(d.ArgumentsDelta)
+			}
+		})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+
+	if text.String() != "Let me check." {
+		t.Errorf("streamed text = %q, want %q", text.String(), "Let me check.")
+	}
+	if toolName != "get_weather" || args.String() != `{"city":"SF"}` {
+		t.Errorf("streamed tool call = %q %q", toolName, args.String())
+	}
+	if resp.Content != "Let me check." {
+		t.Errorf("Content = %q, want %q", resp.Content, "Let me check.")
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want %q", resp.FinishReason, "tool_calls")
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["city"] != "SF" {
+		t.Fatalf("ToolCalls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 20 {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 const (
@@ -164,6 +165,12 @@ type antigravityPart struct {
 	ThoughtSignatureSnake string                       `json:"thought_signature,omitempty"`
 	FunctionCall          *antigravityFunctionCall     `json:"functionCall,omitempty"`
 	FunctionResponse      *antigravityFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData            *antigravityInlineData       `json:"inlineData,omitempty"`
+}
+
+type antigravityInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
 }
 
 type antigravityFunctionCall struct {
@@ -195,6 +202,25 @@ type antigravityGenConfig struct {
 	Temperature     float64 `json:"temperature,omitempty"`
 }
 
+// antigravityContentParts converts multimodal parts to Gemini parts. Images
+// must be inline data; URL images are passed as a text reference instead.
+func antigravityContentParts(parts []ContentPart) []antigravityPart {
+	out := make([]antigravityPart, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case PartText:
+			out = append(out, antigravityPart{Text: part.Text})
+		case PartImage:
+			if mediaType, data, ok := protocoltypes.ParseDataURL(part.ImageURL); ok {
+				out = append(out, antigravityPart{InlineData: &antigravityInlineData{MimeType: mediaType, Data: data}})
+			} else {
+				out = append(out, antigravityPart{Text: fmt.Sprintf("[image: %s]", part.ImageURL)})
+			}
+		}
+	}
+	return out
+}
+
 func (p *AntigravityProvider) buildRequest(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) antigravityRequest {
 	req := antigravityRequest{}
 	toolCallNames := make(map[string]string)
@@ -221,6 +247,11 @@ func (p *AntigravityProvider) buildRequest(messages []Message, tools []ToolDefin
 						},
 					}},
 				})
+			} else if len(msg.Parts) > 0 {
+				req.Contents = append(req.Contents, antigravityContent{
+					Role:  "user",
+					Parts: antigravityContentParts(msg.Parts),
+				})
 			} else {
 				req.Contents = append(req.Contents, antigravityContent{
 					Role:  "user",
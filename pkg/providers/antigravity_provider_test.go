@@ -54,3 +54,27 @@ func TestResolveToolResponseNameInfersNameFromGeneratedCallID(t *testing.T) {
 		t.Fatalf("expected inferred tool name search_docs, got %q", got)
 	}
 }
+
+func TestBuildRequestInlinesImageParts(t *testing.T) {
+	p := &AntigravityProvider{}
+
+	messages := []Message{
+		{Role: "user", Content: "what is this?", Parts: []ContentPart{
+			{Type: PartText, Text: "what is this?"},
+			{Type: PartImage, ImageURL: "data:image/png;base64,iVBORw0K"},
+			{Type: PartImage, ImageURL: "https://example.com/cat.png"},
+		}},
+	}
+
+	req := p.buildRequest(messages, nil, "", nil)
+	parts := req.Contents[0].Parts
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+	if parts[1].InlineData == nil || parts[1].InlineData.MimeType != "image/png" || parts[1].InlineData.Data != "iVBORw0K" {
+		t.Fatalf("expected inline png data, got %+v", parts[1].InlineData)
+	}
+	if parts[2].Text != "[image: https://example.com/cat.png]" {
+		t.Fatalf("expected URL image as text reference, got %q", parts[2].Text)
+	}
+}
@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// EmbeddingClient calls an OpenAI-compatible /embeddings endpoint.
+type EmbeddingClient struct {
+	apiKey     string
+	apiBase    string
+	model      string
+	httpClient *http.Client
+}
+
+// NewEmbeddingClient creates a client for a model_list entry. Only
+// OpenAI-compatible protocols are supported.
+func NewEmbeddingClient(cfg *config.ModelConfig) (*EmbeddingClient, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	protocol, modelID := ExtractProtocol(cfg.Model)
+	apiBase := cfg.APIBase
+	if apiBase == "" {
+		apiBase = getDefaultAPIBase(protocol)
+	}
+	if apiBase == "" || protocol == "anthropic" {
+		return nil, fmt.Errorf("protocol %q has no OpenAI-compatible embeddings endpoint", protocol)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	if cfg.Proxy != "" {
+		parsed, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", cfg.Proxy, err)
+		}
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(parsed)}
+	}
+
+	return &EmbeddingClient{
+		apiKey:     cfg.APIKey,
+		apiBase:    strings.TrimRight(apiBase, "/"),
+		model:      modelID,
+		httpClient: client,
+	}, nil
+}
+
+// Model returns the embedding model ID.
+func (c *EmbeddingClient) Model() string {
+	return c.model
+}
+
+// Embed returns one vector per text, in input order.
+func (c *EmbeddingClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": c.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiBase+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(data))
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse embeddings response: %w", err)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings response has %d vectors for %d inputs", len(parsed.Data), len(texts))
+	}
+
+	sort.Slice(parsed.Data, func(i, j int) bool { return parsed.Data[i].Index < parsed.Data[j].Index })
+	vectors := make([][]float32, len(parsed.Data))
+	for i, d := range parsed.Data {
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
+}
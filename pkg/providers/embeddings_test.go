@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestEmbeddingClient_Embed(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		// Out of order on purpose: vectors must come back in input order.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewEmbeddingClient(&config.ModelConfig{
+		Model:   "openai/text-embedding-3-small",
+		APIBase: server.URL + "/v1/",
+		APIKey:  "sk-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Model() != "text-embedding-3-small" {
+		t.Errorf("Model() = %q", client.Model())
+	}
+
+	vectors, err := client.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["model"] != "text-embedding-3-small" {
+		t.Errorf("request model = %v", got["model"])
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("vectors = %v", vectors)
+	}
+}
+
+func TestEmbeddingClient_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Fail") != "" {
+			http.Error(w, `{"error":"bad"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1]}]}`))
+	}))
+	defer server.Close()
+
+	client, _ := NewEmbeddingClient(&config.ModelConfig{Model: "openai/e", APIBase: server.URL})
+	if _, err := client.Embed(context.Background(), []string{"a", "b"}); err == nil {
+		t.Error("expected error when vector count does not match input")
+	}
+
+	if _, err := NewEmbeddingClient(&config.ModelConfig{Model: "anthropic/claude"}); err == nil {
+		t.Error("expected error for anthropic protocol")
+	}
+}
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"strings"
 )
@@ -78,6 +79,45 @@ var (
 		substr("invalid request format"),
 	}
 
+	// contextOverflowPatterns hold how each API family reports a request
+	// that does not fit the model's context window. These arrive as plain
+	// 400s, so they are checked before the status code.
+	contextOverflowPatterns = map[string][]errorPattern{
+		"openai": {
+			substr("context_length_exceeded"),
+			rxp(`maximum context length is \d+ tokens`),
+			substr("exceeds the context window of this model"),
+		},
+		"anthropic": {
+			substr("prompt is too long"),
+			rxp(`exceed context limit: \d+ \+ \d+ > \d+`),
+		},
+		"gemini": {
+			rxp(`input token count \(\d+\) exceeds the maximum number of tokens allowed`),
+		},
+		// Wordings of OpenAI-compatible servers that don't reuse OpenAI's.
+		"compatible": {
+			substr("range of input length should be"),                  // Qwen / DashScope
+			substr("exceeded model token limit"),                       // Moonshot
+			rxp(`too large for model with \d+ maximum context length`), // Mistral
+			substr("prompt exceeds max length"),                        // Zhipu
+			substr("exceed max message tokens"),                        // Volcengine Ark
+		},
+	}
+
+	// contextOverflowFamilies maps first-party providers to the one API
+	// family whose errors they return. Other providers, mostly gateways
+	// relaying upstream errors, are checked against every family.
+	contextOverflowFamilies = map[string]string{
+		"openai":             "openai",
+		"codex-cli":          "openai",
+		"anthropic":          "anthropic",
+		"claude-cli":         "anthropic",
+		"gemini":             "gemini",
+		"antigravity":        "gemini",
+		"google-antigravity": "gemini",
+	}
+
 	imageDimensionPatterns = []errorPattern{
 		rxp(`image dimensions exceed max`),
 	}
@@ -106,6 +146,12 @@ func ClassifyError(err error, provider, model string) *FailoverError {
 		return nil
 	}
 
+	// Already classified (e.g. by a provider or the rate limiter).
+	var failErr *FailoverError
+	if errors.As(err, &failErr) {
+		return failErr
+	}
+
 	// Context deadline exceeded: treat as timeout, always fallback.
 	if err == context.DeadlineExceeded {
 		return &FailoverError{
@@ -118,6 +164,17 @@ func ClassifyError(err error, provider, model string) *FailoverError {
 
 	msg := strings.ToLower(err.Error())
 
+	// Context overflow: non-retriable, the caller has to shrink the request.
+	if IsContextOverflowError(msg, provider) {
+		return &FailoverError{
+			Reason:   FailoverContextOverflow,
+			Provider: provider,
+			Model:    model,
+			Status:   extractHTTPStatus(msg),
+			Wrapped:  err,
+		}
+	}
+
 	// Image dimension/size errors: non-retriable, non-fallback.
 	if IsImageDimensionError(msg) || IsImageSizeError(msg) {
 		return &FailoverError{
@@ -215,6 +272,20 @@ func extractHTTPStatus(msg string) int {
 	return 0
 }
 
+// IsContextOverflowError returns true if the message from provider says the
+// request exceeded the model's context window.
+func IsContextOverflowError(msg, provider string) bool {
+	if family, ok := contextOverflowFamilies[NormalizeProvider(provider)]; ok {
+		return matchesAny(msg, contextOverflowPatterns[family])
+	}
+	for _, patterns := range contextOverflowPatterns {
+		if matchesAny(msg, patterns) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsImageDimensionError returns true if the message indicates an image dimension error.
 func IsImageDimensionError(msg string) bool {
 	return matchesAny(msg, imageDimensionPatterns)
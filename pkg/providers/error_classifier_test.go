@@ -232,6 +232,118 @@ func TestClassifyError_ImageSizeError(t *testing.T) {
 	}
 }
 
+// Context overflow errors as the providers return them, with the recorded
+// response bodies of each API.
+var contextOverflowErrors = []struct {
+	name     string
+	provider string
+	err      string
+}{
+	{
+		name:     "openai chat completions",
+		provider: "openai",
+		err: "API request failed:\n  Status: 400\n  Body:   " +
+			`{"error":{"message":"This model's maximum context length is 128000 tokens. However, your messages resulted in 131547 tokens. Please reduce the length of the messages.","type":"invalid_request_error","param":"messages","code":"context_length_exceeded"}}`,
+	},
+	{
+		name:     "openai responses",
+		provider: "openai",
+		err: "API request failed:\n  Status: 400\n  Body:   " +
+			`{"error":{"message":"Your input exceeds the context window of this model. Please adjust your input and try again.","type":"invalid_request_error","param":"input","code":"context_length_exceeded"}}`,
+	},
+	{
+		name:     "anthropic prompt too long",
+		provider: "anthropic",
+		err: `claude API call: POST "https://api.anthropic.com/v1/messages": 400 Bad Request ` +
+			`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 208719 tokens > 200000 maximum"}}`,
+	},
+	{
+		name:     "anthropic input plus max_tokens",
+		provider: "anthropic",
+		err: `claude API call: POST "https://api.anthropic.com/v1/messages": 400 Bad Request ` +
+			`{"type":"error","error":{"type":"invalid_request_error","message":"input length and ` + "`max_tokens`" + ` exceed context limit: 195021 + 8192 > 200000, decrease input length or ` + "`max_tokens`" + ` and try again"}}`,
+	},
+	{
+		name:     "gemini via openai-compatible endpoint",
+		provider: "gemini",
+		err: "API request failed:\n  Status: 400\n  Body:   " +
+			`[{"error":{"code":400,"message":"The input token count (1198764) exceeds the maximum number of tokens allowed (1048576).","status":"INVALID_ARGUMENT"}}]`,
+	},
+	{
+		name:     "gemini via antigravity",
+		provider: "antigravity",
+		err:      "antigravity API error (INVALID_ARGUMENT): The input token count (1198764) exceeds the maximum number of tokens allowed (1048576).",
+	},
+	{
+		name:     "qwen via gateway",
+		provider: "qwen",
+		err: "API request failed:\n  Status: 400\n  Body:   " +
+			`{"error":{"message":"<400> InternalError.Algo.InvalidParameter: Range of input length should be [1, 129024]","type":"invalid_request_error","param":null,"code":"invalid_parameter_error"}}`,
+	},
+	{
+		name:     "moonshot",
+		provider: "moonshot",
+		err: "API request failed:\n  Status: 400\n  Body:   " +
+			`{"error":{"message":"Invalid request: Your request exceeded model token limit: 131072","type":"invalid_request_error"}}`,
+	},
+	{
+		name:     "anthropic model behind openrouter",
+		provider: "openrouter",
+		err: "API request failed:\n  Status: 400\n  Body:   " +
+			`{"error":{"message":"prompt is too long: 210330 tokens > 200000 maximum","code":400}}`,
+	},
+}
+
+func TestClassifyError_ContextOverflow(t *testing.T) {
+	for _, tt := range contextOverflowErrors {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ClassifyError(errors.New(tt.err), tt.provider, "model")
+			if result == nil {
+				t.Fatal("expected non-nil")
+			}
+			if result.Reason != FailoverContextOverflow {
+				t.Errorf("reason = %q, want context_overflow", result.Reason)
+			}
+			if result.IsRetriable() {
+				t.Error("context overflow should not be retriable")
+			}
+		})
+	}
+}
+
+func TestClassifyError_NotContextOverflow(t *testing.T) {
+	tests := []struct {
+		provider string
+		err      string
+		want     FailoverReason
+	}{
+		// Mentions tokens, but it is a rate limit.
+		{"openai", "API request failed:\n  Status: 429\n  Body:   " +
+			`{"error":{"message":"Rate limit reached for gpt-4o on tokens per min (TPM): Limit 30000, Used 21000, Requested 12000.","type":"tokens","code":"rate_limit_exceeded"}}`,
+			FailoverRateLimit},
+		// Mentions a token, but it is an auth failure.
+		{"anthropic", `claude API call: POST "https://api.anthropic.com/v1/messages": 401 Unauthorized ` +
+			`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			FailoverAuth},
+		{"gemini", "API request failed:\n  Status: 400\n  Body:   " +
+			`[{"error":{"code":400,"message":"Invalid value at 'contents[0].parts[0]' (length)","status":"INVALID_ARGUMENT"}}]`,
+			FailoverFormat},
+		// Anthropic wording from a provider that only returns OpenAI errors.
+		{"openai", "API request failed:\n  Status: 400\n  Body:   prompt is too long", FailoverFormat},
+	}
+
+	for _, tt := range tests {
+		result := ClassifyError(errors.New(tt.err), tt.provider, "model")
+		if result == nil {
+			t.Errorf("%s: expected non-nil", tt.err)
+			continue
+		}
+		if result.Reason != tt.want {
+			t.Errorf("%s: reason = %q, want %q", tt.err, result.Reason, tt.want)
+		}
+	}
+}
+
 func TestClassifyError_UnknownError(t *testing.T) {
 	err := errors.New("some completely random error")
 	result := ClassifyError(err, "openai", "gpt-4")
@@ -265,6 +377,7 @@ func TestFailoverError_IsRetriable(t *testing.T) {
 		{FailoverTimeout, true},
 		{FailoverOverloaded, true},
 		{FailoverFormat, false},
+		{FailoverContextOverflow, false},
 		{FailoverUnknown, true},
 	}
 
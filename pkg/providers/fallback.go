@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -16,6 +17,12 @@ type FallbackChain struct {
 type FallbackCandidate struct {
 	Provider string
 	Model    string
+	Ref      string // Reference it was resolved from (e.g. a model_list model_name)
+}
+
+// Key identifies the candidate for cooldown tracking.
+func (c FallbackCandidate) Key() string {
+	return ModelKey(c.Provider, c.Model)
 }
 
 // FallbackResult contains the successful response and metadata about all attempts.
@@ -33,7 +40,7 @@ type FallbackAttempt struct {
 	Error    error
 	Reason   FailoverReason
 	Duration time.Duration
-	Skipped  bool // true if skipped due to cooldown
+	Skipped  bool // true if skipped due to cooldown or exhausted RPM budget
 }
 
 // NewFallbackChain creates a new fallback chain with the given cooldown tracker.
@@ -59,6 +66,7 @@ func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandid
 		candidates = append(candidates, FallbackCandidate{
 			Provider: ref.Provider,
 			Model:    ref.Model,
+			Ref:      strings.TrimSpace(raw),
 		})
 	}
 
@@ -75,9 +83,13 @@ func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandid
 
 // Execute runs the fallback chain for text/chat requests.
 // It tries each candidate in order, respecting cooldowns and error classification.
+// Cooldowns are tracked per candidate (provider/model), so one failing model
+// does not take down other models served by the same provider.
 //
 // Behavior:
 //   - Candidates in cooldown are skipped (logged as skipped attempt).
+//   - Candidates whose RPM budget is exhausted are skipped without waiting,
+//     except the last one, which waits for budget instead of failing.
 //   - context.Canceled aborts immediately (user abort, no fallback).
 //   - Non-retriable errors (format) abort immediately.
 //   - Retriable errors trigger fallback to next candidate.
@@ -103,26 +115,31 @@ func (fc *FallbackChain) Execute(
 		}
 
 		// Check cooldown.
-		if !fc.cooldown.IsAvailable(candidate.Provider) {
-			remaining := fc.cooldown.CooldownRemaining(candidate.Provider)
+		key := candidate.Key()
+		if !fc.cooldown.IsAvailable(key) {
+			remaining := fc.cooldown.CooldownRemaining(key)
 			result.Attempts = append(result.Attempts, FallbackAttempt{
 				Provider: candidate.Provider,
 				Model:    candidate.Model,
 				Skipped:  true,
 				Reason:   FailoverRateLimit,
-				Error:    fmt.Errorf("provider %s in cooldown (%s remaining)", candidate.Provider, remaining.Round(time.Second)),
+				Error:    fmt.Errorf("%s in cooldown (%s remaining)", key, remaining.Round(time.Second)),
 			})
 			continue
 		}
 
 		// Execute the run function.
+		runCtx := ctx
+		if i < len(candidates)-1 {
+			runCtx = withRPMFailFast(ctx)
+		}
 		start := time.Now()
-		resp, err := run(ctx, candidate.Provider, candidate.Model)
+		resp, err := run(runCtx, candidate.Provider, candidate.Model)
 		elapsed := time.Since(start)
 
 		if err == nil {
 			// Success.
-			fc.cooldown.MarkSuccess(candidate.Provider)
+			fc.cooldown.MarkSuccess(key)
 			result.Response = resp
 			result.Provider = candidate.Provider
 			result.Model = candidate.Model
@@ -140,6 +157,18 @@ func (fc *FallbackChain) Execute(
 			return nil, context.Canceled
 		}
 
+		// Local RPM budget exhausted: nothing was sent, so don't cool down the model.
+		if errors.Is(err, ErrRPMExhausted) {
+			result.Attempts = append(result.Attempts, FallbackAttempt{
+				Provider: candidate.Provider,
+				Model:    candidate.Model,
+				Skipped:  true,
+				Reason:   FailoverRateLimit,
+				Error:    err,
+			})
+			continue
+		}
+
 		// Classify the error.
 		failErr := ClassifyError(err, candidate.Provider, candidate.Model)
 
@@ -168,7 +197,7 @@ func (fc *FallbackChain) Execute(
 		}
 
 		// Retriable error: mark failure and continue to next candidate.
-		fc.cooldown.MarkFailure(candidate.Provider, failErr.Reason)
+		fc.cooldown.MarkFailure(key, failErr.Reason)
 		result.Attempts = append(result.Attempts, FallbackAttempt{
 			Provider: candidate.Provider,
 			Model:    candidate.Model,
@@ -183,7 +212,7 @@ func (fc *FallbackChain) Execute(
 		}
 	}
 
-	// All candidates were skipped (all in cooldown).
+	// All candidates were skipped (cooldown or RPM budget).
 	return nil, &FallbackExhaustedError{Attempts: result.Attempts}
 }
 
@@ -247,6 +276,23 @@ func (fc *FallbackChain) ExecuteImage(
 			}
 		}
 
+		// Context overflow: the next model gets the same oversized request.
+		if IsContextOverflowError(errMsg, candidate.Provider) {
+			result.Attempts = append(result.Attempts, FallbackAttempt{
+				Provider: candidate.Provider,
+				Model:    candidate.Model,
+				Error:    err,
+				Reason:   FailoverContextOverflow,
+				Duration: elapsed,
+			})
+			return nil, &FailoverError{
+				Reason:   FailoverContextOverflow,
+				Provider: candidate.Provider,
+				Model:    candidate.Model,
+				Wrapped:  err,
+			}
+		}
+
 		// Any other error: record and try next.
 		result.Attempts = append(result.Attempts, FallbackAttempt{
 			Provider: candidate.Provider,
@@ -273,7 +319,7 @@ func (e *FallbackExhaustedError) Error() string {
 	sb.WriteString(fmt.Sprintf("fallback: all %d candidates failed:", len(e.Attempts)))
 	for i, a := range e.Attempts {
 		if a.Skipped {
-			sb.WriteString(fmt.Sprintf("\n  [%d] %s/%s: skipped (cooldown)", i+1, a.Provider, a.Model))
+			sb.WriteString(fmt.Sprintf("\n  [%d] %s/%s: skipped (%v)", i+1, a.Provider, a.Model, a.Error))
 		} else {
 			sb.WriteString(fmt.Sprintf("\n  [%d] %s/%s: %v (reason=%s, %s)",
 				i+1, a.Provider, a.Model, a.Error, a.Reason, a.Duration.Round(time.Millisecond)))
@@ -158,13 +158,44 @@ func TestFallback_NonRetriableError(t *testing.T) {
 	}
 }
 
+func TestFallback_ContextOverflowError(t *testing.T) {
+	ct := NewCooldownTracker()
+	fc := NewFallbackChain(ct)
+
+	candidates := []FallbackCandidate{
+		makeCandidate("anthropic", "claude"),
+		makeCandidate("openai", "gpt-4"),
+	}
+
+	attempt := 0
+	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+		attempt++
+		return nil, errors.New(`400 Bad Request {"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 208719 tokens > 200000 maximum"}}`)
+	}
+
+	_, err := fc.Execute(context.Background(), candidates, run)
+	var fe *FailoverError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected FailoverError, got %T", err)
+	}
+	if fe.Reason != FailoverContextOverflow {
+		t.Errorf("reason = %q, want context_overflow", fe.Reason)
+	}
+	if attempt != 1 {
+		t.Errorf("attempt = %d, want 1 (context overflow should not try next)", attempt)
+	}
+	if !ct.IsAvailable(candidates[0].Key()) {
+		t.Error("context overflow should not put the model in cooldown")
+	}
+}
+
 func TestFallback_CooldownSkip(t *testing.T) {
 	now := time.Now()
 	ct, _ := newTestTracker(now)
 	fc := NewFallbackChain(ct)
 
 	// Put openai in cooldown
-	ct.MarkFailure("openai", FailoverRateLimit)
+	ct.MarkFailure(ModelKey("openai", "gpt-4"), FailoverRateLimit)
 
 	candidates := []FallbackCandidate{
 		makeCandidate("openai", "gpt-4"),
@@ -202,8 +233,8 @@ func TestFallback_AllInCooldown(t *testing.T) {
 	fc := NewFallbackChain(ct)
 
 	// Put all providers in cooldown
-	ct.MarkFailure("openai", FailoverRateLimit)
-	ct.MarkFailure("anthropic", FailoverBilling)
+	ct.MarkFailure(ModelKey("openai", "gpt-4"), FailoverRateLimit)
+	ct.MarkFailure(ModelKey("anthropic", "claude"), FailoverBilling)
 
 	candidates := []FallbackCandidate{
 		makeCandidate("openai", "gpt-4"),
@@ -284,7 +315,7 @@ func TestFallback_SuccessResetsCooldown(t *testing.T) {
 	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
 		attempt++
 		if attempt == 1 {
-			ct.MarkFailure("openai", FailoverRateLimit) // simulate failure tracked elsewhere
+			ct.MarkFailure(ModelKey("openai", "gpt-4"), FailoverRateLimit) // simulate failure tracked elsewhere
 		}
 		return &LLMResponse{Content: "ok", FinishReason: "stop"}, nil
 	}
@@ -293,7 +324,7 @@ func TestFallback_SuccessResetsCooldown(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !ct.IsAvailable("openai") {
+	if !ct.IsAvailable(ModelKey("openai", "gpt-4")) {
 		t.Error("success should reset cooldown")
 	}
 }
@@ -362,6 +393,31 @@ func TestImageFallback_SizeError(t *testing.T) {
 	}
 }
 
+func TestImageFallback_ContextOverflowError(t *testing.T) {
+	ct := NewCooldownTracker()
+	fc := NewFallbackChain(ct)
+
+	candidates := []FallbackCandidate{
+		makeCandidate("openai", "gpt-4o"),
+		makeCandidate("anthropic", "claude"),
+	}
+
+	attempt := 0
+	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+		attempt++
+		return nil, errors.New(`{"error":{"message":"This model's maximum context length is 128000 tokens.","code":"context_length_exceeded"}}`)
+	}
+
+	_, err := fc.ExecuteImage(context.Background(), candidates, run)
+	var fe *FailoverError
+	if !errors.As(err, &fe) || fe.Reason != FailoverContextOverflow {
+		t.Fatalf("err = %v, want context_overflow FailoverError", err)
+	}
+	if attempt != 1 {
+		t.Errorf("attempt = %d, want 1", attempt)
+	}
+}
+
 func TestImageFallback_RetryOnOtherErrors(t *testing.T) {
 	ct := NewCooldownTracker()
 	fc := NewFallbackChain(ct)
@@ -61,15 +61,26 @@ func NewProviderWithMaxTokensField(apiKey, apiBase, proxy, maxTokensField string
 }
 
 func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
-	if p.apiBase == "" {
-		return nil, fmt.Errorf("API base not configured")
+	resp, err := p.doRequest(ctx, p.buildRequestBody(messages, tools, model, options))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	return parseResponse(body)
+}
+
+func (p *Provider) buildRequestBody(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) map[string]interface{} {
 	model = normalizeModel(model, p.apiBase)
 
 	requestBody := map[string]interface{}{
 		"model":    model,
-		"messages": messages,
+		"messages": serializeMessages(messages),
 	}
 
 	if len(tools) > 0 {
@@ -102,6 +113,56 @@ func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDef
 		}
 	}
 
+	return requestBody
+}
+
+// openaiMessage is a message whose content is an array of parts, the form
+// OpenAI-compatible APIs accept for images.
+type openaiMessage struct {
+	Role       string                   `json:"role"`
+	Content    []map[string]interface{} `json:"content"`
+	ToolCalls  []ToolCall               `json:"tool_calls,omitempty"`
+	ToolCallID string                   `json:"tool_call_id,omitempty"`
+}
+
+// serializeMessages encodes multimodal messages as content-part arrays and
+// leaves plain-text messages unchanged.
+func serializeMessages(messages []Message) []interface{} {
+	out := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		if len(msg.Parts) == 0 {
+			out = append(out, msg)
+			continue
+		}
+		content := make([]map[string]interface{}, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case protocoltypes.PartText:
+				content = append(content, map[string]interface{}{"type": "text", "text": part.Text})
+			case protocoltypes.PartImage:
+				content = append(content, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": part.ImageURL},
+				})
+			}
+		}
+		out = append(out, openaiMessage{
+			Role:       msg.Role,
+			Content:    content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+		})
+	}
+	return out
+}
+
+// doRequest posts requestBody to the chat completions endpoint. On success the
+// caller owns the returned response body; non-200 responses are turned into errors.
+func (p *Provider) doRequest(ctx context.Context, requestBody map[string]interface{}) (*http.Response, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -121,18 +182,17 @@ func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDef
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
 		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
 	}
 
-	return parseResponse(body)
+	return resp, nil
 }
 
 func parseResponse(body []byte) (*LLMResponse, error) {
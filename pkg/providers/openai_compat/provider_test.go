@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 func TestProviderChat_UsesMaxCompletionTokensForGLM(t *testing.T) {
@@ -275,3 +277,50 @@ func TestNormalizeModel_UsesAPIBase(t *testing.T) {
 		t.Fatalf("normalizeModel(openrouter) = %q, want %q", got, "openrouter/auto")
 	}
 }
+
+func TestProviderChat_EncodesImageParts(t *testing.T) {
+	var requestBody struct {
+		Messages []map[string]interface{} `json:"messages"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"a cat"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	messages := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "what is this?", Parts: []protocoltypes.ContentPart{
+			{Type: protocoltypes.PartText, Text: "what is this?"},
+			{Type: protocoltypes.PartImage, ImageURL: "data:image/png;base64,AAAA"},
+		}},
+	}
+	if _, err := p.Chat(t.Context(), messages, nil, "gpt-4o", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if content, ok := requestBody.Messages[0]["content"].(string); !ok || content != "sys" {
+		t.Errorf("plain message content = %v, want string", requestBody.Messages[0]["content"])
+	}
+	if _, ok := requestBody.Messages[0]["parts"]; ok {
+		t.Error("parts should not be sent to the API")
+	}
+
+	parts, ok := requestBody.Messages[1]["content"].([]interface{})
+	if !ok || len(parts) != 2 {
+		t.Fatalf("multimodal content = %v, want 2 parts", requestBody.Messages[1]["content"])
+	}
+	image := parts[1].(map[string]interface{})
+	if image["type"] != "image_url" {
+		t.Errorf("part type = %v, want image_url", image["type"])
+	}
+	if url := image["image_url"].(map[string]interface{})["url"]; url != "data:image/png;base64,AAAA" {
+		t.Errorf("image url = %v", url)
+	}
+}
@@ -0,0 +1,185 @@
+package openai_compat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+type StreamChunk = protocoltypes.StreamChunk
+type ToolCallDelta = protocoltypes.ToolCallDelta
+
+// streamEvent is a single "data:" payload of a chat completions SSE stream.
+type streamEvent struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function *struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+				ExtraContent *struct {
+					Google *struct {
+						ThoughtSignature string `json:"thought_signature"`
+					} `json:"google"`
+				} `json:"extra_content"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *UsageInfo `json:"usage"`
+}
+
+// partialToolCall accumulates the fragments of one streamed tool call.
+type partialToolCall struct {
+	id               string
+	name             string
+	arguments        strings.Builder
+	thoughtSignature string
+}
+
+// ChatStream sends the request with "stream": true and reads the server-sent
+// events as they arrive, calling onChunk for each content or tool-call delta.
+// The returned response is assembled from the whole stream.
+func (p *Provider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk func(StreamChunk)) (*LLMResponse, error) {
+	requestBody := p.buildRequestBody(messages, tools, model, options)
+	requestBody["stream"] = true
+	requestBody["stream_options"] = map[string]interface{}{"include_usage": true}
+
+	resp, err := p.doRequest(ctx, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return parseStream(resp.Body, onChunk)
+}
+
+func parseStream(reader io.Reader, onChunk func(StreamChunk)) (*LLMResponse, error) {
+	var content strings.Builder
+	var usage *UsageInfo
+	finishReason := ""
+	calls := make(map[int]*partialToolCall)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var event streamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+		if len(event.Choices) == 0 {
+			continue
+		}
+
+		choice := event.Choices[0]
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			finishReason = *choice.FinishReason
+		}
+
+		chunk := StreamChunk{ContentDelta: choice.Delta.Content}
+		content.WriteString(choice.Delta.Content)
+
+		for _, tc := range choice.Delta.ToolCalls {
+			call, ok := calls[tc.Index]
+			if !ok {
+				call = &partialToolCall{}
+				calls[tc.Index] = call
+			}
+			delta := ToolCallDelta{Index: tc.Index, ID: tc.ID}
+			if tc.ID != "" {
+				call.id = tc.ID
+			}
+			if tc.Function != nil {
+				if tc.Function.Name != "" {
+					call.name = tc.Function.Name
+					delta.Name = tc.Function.Name
+				}
+				call.arguments.WriteString(tc.Function.Arguments)
+				delta.ArgumentsDelta = tc.Function.Arguments
+			}
+			if tc.ExtraContent != nil && tc.ExtraContent.Google != nil && tc.ExtraContent.Google.ThoughtSignature != "" {
+				call.thoughtSignature = tc.ExtraContent.Google.ThoughtSignature
+			}
+			chunk.ToolCallDeltas = append(chunk.ToolCallDeltas, delta)
+		}
+
+		if onChunk != nil && (chunk.ContentDelta != "" || len(chunk.ToolCallDeltas) > 0) {
+			onChunk(chunk)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	toolCalls := make([]ToolCall, 0, len(calls))
+	for _, idx := range indexes {
+		call := calls[idx]
+		arguments := make(map[string]interface{})
+		if raw := call.arguments.String(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+				log.Printf("openai_compat: failed to decode streamed tool call arguments for %q: %v", call.name, err)
+				arguments["raw"] = raw
+			}
+		}
+
+		toolCall := ToolCall{
+			ID:               call.id,
+			Name:             call.name,
+			Arguments:        arguments,
+			ThoughtSignature: call.thoughtSignature,
+		}
+		if call.thoughtSignature != "" {
+			toolCall.ExtraContent = &ExtraContent{
+				Google: &GoogleExtra{
+					ThoughtSignature: call.thoughtSignature,
+				},
+			}
+		}
+		toolCalls = append(toolCalls, toolCall)
+	}
+
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+
+	return &LLMResponse{
+		Content:      content.String(),
+		ToolCalls:    toolCalls,
+		FinishReason: finishReason,
+		Usage:        usage,
+	}, nil
+}
@@ -0,0 +1,128 @@
+package providers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// ProviderPool creates one provider per model_list entry and reuses it, so
+// every fallback candidate is dispatched to the endpoint it was configured with.
+// Entries with an rpm limit get their own token bucket; load-balanced
+// duplicates of a model_name therefore each have an independent budget.
+type ProviderPool struct {
+	cfg *config.Config
+
+	mu       sync.Mutex
+	entries  map[config.ModelConfig]*pooledProvider
+	limiters map[config.ModelConfig]*tokenBucket
+}
+
+type pooledProvider struct {
+	provider LLMProvider
+	modelID  string
+}
+
+// NewProviderPool creates an empty pool backed by cfg.ModelList.
+func NewProviderPool(cfg *config.Config) *ProviderPool {
+	return &ProviderPool{
+		cfg:      cfg,
+		entries:  make(map[config.ModelConfig]*pooledProvider),
+		limiters: make(map[config.ModelConfig]*tokenBucket),
+	}
+}
+
+// Lookup finds the model_list entry for a candidate. The candidate's Ref is
+// tried as a model_name first, then the candidate's "provider/model" is
+// matched against each entry's model field. When several entries share a
+// model_name, the round-robin prefers entries with RPM budget left.
+func (p *ProviderPool) Lookup(c FallbackCandidate) (*config.ModelConfig, bool) {
+	if p == nil || p.cfg == nil {
+		return nil, false
+	}
+
+	for _, name := range []string{c.Ref, c.Model} {
+		if name == "" {
+			continue
+		}
+		if mc, err := p.cfg.GetAvailableModelConfig(name, p.available); err == nil {
+			return mc, true
+		}
+	}
+
+	key := c.Key()
+	for i := range p.cfg.ModelList {
+		protocol, modelID := ExtractProtocol(p.cfg.ModelList[i].Model)
+		if ModelKey(protocol, modelID) != key {
+			continue
+		}
+		if name := p.cfg.ModelList[i].ModelName; name != "" {
+			if mc, err := p.cfg.GetAvailableModelConfig(name, p.available); err == nil {
+				return mc, true
+			}
+		}
+		mc := p.cfg.ModelList[i]
+		return &mc, true
+	}
+
+	return nil, false
+}
+
+// Get returns the provider for a model_list entry, creating it on first use,
+// along with the model ID to send to it. Entries with an rpm limit are
+// wrapped so every request takes a token from the entry's bucket.
+func (p *ProviderPool) Get(mc *config.ModelConfig) (LLMProvider, string, error) {
+	entry := p.entryKey(mc)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pp, ok := p.entries[entry]; ok {
+		return pp.provider, pp.modelID, nil
+	}
+
+	provider, modelID, err := CreateProviderFromConfig(&entry)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create provider for model %q: %w", entry.ModelName, err)
+	}
+	if bucket := p.limiterLocked(entry); bucket != nil {
+		provider = newRateLimitedProvider(provider, bucket, entry.ModelName)
+	}
+	p.entries[entry] = &pooledProvider{provider: provider, modelID: modelID}
+	return provider, modelID, nil
+}
+
+// available reports whether the entry has RPM budget left. Entries without
+// an rpm limit are always available.
+func (p *ProviderPool) available(mc *config.ModelConfig) bool {
+	entry := p.entryKey(mc)
+
+	p.mu.Lock()
+	bucket := p.limiterLocked(entry)
+	p.mu.Unlock()
+
+	return bucket == nil || bucket.Available()
+}
+
+// limiterLocked returns the bucket for entry, creating it on first use.
+// It must be called with mu held.
+func (p *ProviderPool) limiterLocked(entry config.ModelConfig) *tokenBucket {
+	if entry.RPM <= 0 {
+		return nil
+	}
+	bucket, ok := p.limiters[entry]
+	if !ok {
+		bucket = newTokenBucket(entry.RPM)
+		p.limiters[entry] = bucket
+	}
+	return bucket
+}
+
+func (p *ProviderPool) entryKey(mc *config.ModelConfig) config.ModelConfig {
+	entry := *mc
+	if entry.Workspace == "" {
+		entry.Workspace = p.cfg.WorkspacePath()
+	}
+	return entry
+}
@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestProviderPool_LookupByModelName(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "fast", Model: "openai/gpt-4o-mini", APIKey: "k1"},
+			{ModelName: "smart", Model: "anthropic/claude-sonnet-4.6", APIKey: "k2"},
+		},
+	}
+	pool := NewProviderPool(cfg)
+
+	candidates := ResolveCandidates(ModelConfig{Primary: "fast", Fallbacks: []string{"smart"}}, "")
+	mc, ok := pool.Lookup(candidates[1])
+	if !ok {
+		t.Fatal("expected model_list entry for 'smart'")
+	}
+	if mc.Model != "anthropic/claude-sonnet-4.6" {
+		t.Errorf("Model = %q, want anthropic/claude-sonnet-4.6", mc.Model)
+	}
+}
+
+func TestProviderPool_LookupByModelField(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "gpt", Model: "openai/gpt-4o", APIKey: "k1"},
+		},
+	}
+	pool := NewProviderPool(cfg)
+
+	mc, ok := pool.Lookup(FallbackCandidate{Provider: "openai", Model: "gpt-4o"})
+	if !ok {
+		t.Fatal("expected match on model field")
+	}
+	if mc.ModelName != "gpt" {
+		t.Errorf("ModelName = %q, want gpt", mc.ModelName)
+	}
+
+	if _, ok := pool.Lookup(FallbackCandidate{Provider: "groq", Model: "llama-3"}); ok {
+		t.Error("expected no match for unknown candidate")
+	}
+}
+
+func TestProviderPool_GetReusesProvider(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "a", Model: "openai/gpt-4o", APIKey: "k1", APIBase: "https://a.example/v1"},
+			{ModelName: "b", Model: "openai/gpt-4o", APIKey: "k2", APIBase: "https://b.example/v1"},
+		},
+	}
+	pool := NewProviderPool(cfg)
+
+	p1, modelID, err := pool.Get(&cfg.ModelList[0])
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if modelID != "gpt-4o" {
+		t.Errorf("modelID = %q, want gpt-4o", modelID)
+	}
+	p1again, _, _ := pool.Get(&cfg.ModelList[0])
+	if p1 != p1again {
+		t.Error("expected the same provider instance for the same entry")
+	}
+	p2, _, _ := pool.Get(&cfg.ModelList[1])
+	if p1 == p2 {
+		t.Error("expected distinct providers for distinct entries")
+	}
+}
+
+func TestProviderPool_DuplicatesHaveOwnRPMBudget(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "lb", Model: "openai/gpt-4o", APIKey: "k1", APIBase: "https://a.example/v1", RPM: 1},
+			{ModelName: "lb", Model: "openai/gpt-4o", APIKey: "k2", APIBase: "https://b.example/v1", RPM: 1},
+		},
+	}
+	pool := NewProviderPool(cfg)
+	candidate := FallbackCandidate{Model: "lb", Ref: "lb"}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		mc, ok := pool.Lookup(candidate)
+		if !ok {
+			t.Fatal("expected model_list entry for 'lb'")
+		}
+		seen[mc.APIKey] = true
+		// Spend the entry's only token.
+		if !pool.available(mc) {
+			t.Fatalf("lookup %d returned an exhausted entry", i)
+		}
+		pool.limiters[pool.entryKey(mc)].TryTake()
+	}
+	if !seen["k1"] || !seen["k2"] {
+		t.Errorf("expected both duplicates to be used, got %v", seen)
+	}
+}
+
+func TestProviderPool_GetWrapsRateLimitedEntries(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "limited", Model: "openai/gpt-4o", APIKey: "k1", RPM: 10},
+			{ModelName: "free", Model: "openai/gpt-4o-mini", APIKey: "k2"},
+		},
+	}
+	pool := NewProviderPool(cfg)
+
+	p, _, err := pool.Get(&cfg.ModelList[0])
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if _, ok := p.(*rateLimitedStreamingProvider); !ok {
+		t.Errorf("provider = %T, want rate-limited streaming wrapper", p)
+	}
+	p, _, _ = pool.Get(&cfg.ModelList[1])
+	if _, ok := p.(*rateLimitedStreamingProvider); ok {
+		t.Error("entries without rpm should not be wrapped")
+	}
+}
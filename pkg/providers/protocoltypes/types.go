@@ -1,5 +1,7 @@
 package protocoltypes
 
+import "strings"
+
 type ToolCall struct {
 	ID               string                 `json:"id"`
 	Type             string                 `json:"type,omitempty"`
@@ -38,10 +40,52 @@ type UsageInfo struct {
 }
 
 type Message struct {
-	Role       string     `json:"role"`
-	Content    string     `json:"content"`
-	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
-	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	Parts      []ContentPart `json:"parts,omitempty"` // Multimodal content; when set, providers send it instead of Content
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+}
+
+// Content part types.
+const (
+	PartText  = "text"
+	PartImage = "image"
+)
+
+// ContentPart is one piece of a multimodal message: text, or an image given
+// as an http(s) URL or a base64 data: URL.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// HasImages reports whether the message carries image parts.
+func (m Message) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == PartImage {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDataURL splits a base64 data: URL into its media type and encoded payload.
+func ParseDataURL(u string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(u, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(meta, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mediaType, data, true
 }
 
 type ToolDefinition struct {
@@ -54,3 +98,18 @@ type ToolFunctionDefinition struct {
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
 }
+
+// StreamChunk is one incremental piece of a streamed LLM response.
+// ContentDelta holds newly generated text; ToolCallDeltas carry partial
+// tool calls whose Arguments arrive as raw JSON fragments keyed by Index.
+type StreamChunk struct {
+	ContentDelta   string          `json:"content_delta,omitempty"`
+	ToolCallDeltas []ToolCallDelta `json:"tool_call_deltas,omitempty"`
+}
+
+type ToolCallDelta struct {
+	Index          int    `json:"index"`
+	ID             string `json:"id,omitempty"`
+	Name           string `json:"name,omitempty"`
+	ArgumentsDelta string `json:"arguments_delta,omitempty"`
+}
@@ -0,0 +1,176 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrRPMExhausted is returned (wrapped in a FailoverError) when a model_list
+// entry has no request budget left and the caller asked not to wait for it.
+var ErrRPMExhausted = errors.New("rpm budget exhausted")
+
+// tokenBucket limits requests per minute. It holds up to rpm tokens and
+// refills continuously at rpm tokens per minute. Thread-safe.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	last     time.Time
+	nowFunc  func() time.Time // for testing
+}
+
+func newTokenBucket(rpm int) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(rpm),
+		tokens:   float64(rpm),
+		rate:     float64(rpm) / 60,
+		last:     time.Now(),
+		nowFunc:  time.Now,
+	}
+}
+
+// refill must be called with mu held.
+func (b *tokenBucket) refill() time.Time {
+	now := b.nowFunc()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+	return now
+}
+
+// Available reports whether a request could be made now without consuming a token.
+func (b *tokenBucket) Available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= 1
+}
+
+// TryTake consumes a token if one is available.
+func (b *tokenBucket) TryTake() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Delay returns how long until the next token becomes available.
+func (b *tokenBucket) Delay() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Wait blocks until a token is available and consumes it, or returns the
+// context's error.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		if b.TryTake() {
+			return nil
+		}
+		timer := time.NewTimer(b.Delay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+type rpmFailFastKey struct{}
+
+// withRPMFailFast marks ctx so rate-limited providers return ErrRPMExhausted
+// instead of waiting. FallbackChain sets it for every candidate but the last,
+// so an exhausted model fails over rather than stalling the request.
+func withRPMFailFast(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rpmFailFastKey{}, true)
+}
+
+func rpmFailFast(ctx context.Context) bool {
+	v, _ := ctx.Value(rpmFailFastKey{}).(bool)
+	return v
+}
+
+// rateLimitedProvider takes a token from its model_list entry's bucket
+// before every request.
+type rateLimitedProvider struct {
+	LLMProvider
+	bucket    *tokenBucket
+	modelName string
+}
+
+// rateLimitedStreamingProvider is rateLimitedProvider for providers that can stream.
+type rateLimitedStreamingProvider struct {
+	*rateLimitedProvider
+	streaming StreamingProvider
+}
+
+func newRateLimitedProvider(provider LLMProvider, bucket *tokenBucket, modelName string) LLMProvider {
+	rl := &rateLimitedProvider{LLMProvider: provider, bucket: bucket, modelName: modelName}
+	if sp, ok := provider.(StreamingProvider); ok {
+		return &rateLimitedStreamingProvider{rateLimitedProvider: rl, streaming: sp}
+	}
+	return rl
+}
+
+func (p *rateLimitedProvider) acquire(ctx context.Context, model string) error {
+	if p.bucket.TryTake() {
+		return nil
+	}
+	if rpmFailFast(ctx) {
+		return &FailoverError{
+			Reason:  FailoverRateLimit,
+			Model:   model,
+			Wrapped: ErrRPMExhausted,
+		}
+	}
+	logger.DebugCF("providers", "RPM budget exhausted, waiting",
+		map[string]interface{}{
+			"model_name": p.modelName,
+			"wait":       p.bucket.Delay().String(),
+		})
+	return p.bucket.Wait(ctx)
+}
+
+func (p *rateLimitedProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]interface{},
+) (*LLMResponse, error) {
+	if err := p.acquire(ctx, model); err != nil {
+		return nil, err
+	}
+	return p.LLMProvider.Chat(ctx, messages, tools, model, options)
+}
+
+func (p *rateLimitedStreamingProvider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]interface{},
+	onChunk StreamCallback,
+) (*LLMResponse, error) {
+	if err := p.acquire(ctx, model); err != nil {
+		return nil, err
+	}
+	return p.streaming.ChatStream(ctx, messages, tools, model, options, onChunk)
+}
@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.calls++
+	return &LLMResponse{Content: "ok", FinishReason: "stop"}, nil
+}
+
+func (p *countingProvider) GetDefaultModel() string { return "" }
+
+func newTestBucket(rpm int, now *time.Time) *tokenBucket {
+	b := newTokenBucket(rpm)
+	b.nowFunc = func() time.Time { return *now }
+	b.last = *now
+	return b
+}
+
+func TestTokenBucket_BurstThenRefill(t *testing.T) {
+	now := time.Now()
+	b := newTestBucket(2, &now)
+
+	if !b.TryTake() || !b.TryTake() {
+		t.Fatal("expected a burst of rpm requests to be allowed")
+	}
+	if b.TryTake() {
+		t.Fatal("expected third request to be refused")
+	}
+	if b.Available() {
+		t.Error("Available() = true with an empty bucket")
+	}
+	if d := b.Delay(); d != 30*time.Second {
+		t.Errorf("Delay() = %v, want 30s", d)
+	}
+
+	now = now.Add(30 * time.Second)
+	if !b.TryTake() {
+		t.Error("expected a token after refill")
+	}
+	if b.TryTake() {
+		t.Error("expected only one token after 30s at 2 rpm")
+	}
+}
+
+func TestTokenBucket_RefillCapped(t *testing.T) {
+	now := time.Now()
+	b := newTestBucket(1, &now)
+	b.TryTake()
+
+	now = now.Add(time.Hour)
+	if !b.TryTake() {
+		t.Fatal("expected a token after refill")
+	}
+	if b.TryTake() {
+		t.Error("bucket refilled beyond its capacity")
+	}
+}
+
+func TestTokenBucket_WaitHonorsContext(t *testing.T) {
+	b := newTokenBucket(1)
+	b.TryTake()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestRateLimitedProvider_FailFast(t *testing.T) {
+	inner := &countingProvider{}
+	b := newTokenBucket(1)
+	p := newRateLimitedProvider(inner, b, "test")
+
+	if _, err := p.Chat(context.Background(), nil, nil, "m", nil); err != nil {
+		t.Fatalf("first Chat() error: %v", err)
+	}
+
+	_, err := p.Chat(withRPMFailFast(context.Background()), nil, nil, "m", nil)
+	if !errors.Is(err, ErrRPMExhausted) {
+		t.Fatalf("error = %v, want ErrRPMExhausted", err)
+	}
+	var failErr *FailoverError
+	if !errors.As(err, &failErr) || failErr.Reason != FailoverRateLimit {
+		t.Errorf("error = %v, want rate_limit FailoverError", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("inner calls = %d, want 1", inner.calls)
+	}
+}
+
+func TestRateLimitedProvider_PreservesStreaming(t *testing.T) {
+	if _, ok := newRateLimitedProvider(&countingProvider{}, newTokenBucket(1), "a").(StreamingProvider); ok {
+		t.Error("non-streaming provider should not become streaming")
+	}
+}
+
+func TestFallback_RPMExhaustedFailsOverWithoutCooldown(t *testing.T) {
+	ct := NewCooldownTracker()
+	fc := NewFallbackChain(ct)
+
+	limited := newRateLimitedProvider(&countingProvider{}, newTokenBucket(1), "primary")
+	backup := &countingProvider{}
+	candidates := []FallbackCandidate{
+		makeCandidate("openai", "gpt-4"),
+		makeCandidate("groq", "llama"),
+	}
+	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+		if provider == "openai" {
+			return limited.Chat(ctx, nil, nil, model, nil)
+		}
+		return backup.Chat(ctx, nil, nil, model, nil)
+	}
+
+	if _, err := fc.Execute(context.Background(), candidates, run); err != nil {
+		t.Fatalf("first Execute() error: %v", err)
+	}
+
+	result, err := fc.Execute(context.Background(), candidates, run)
+	if err != nil {
+		t.Fatalf("second Execute() error: %v", err)
+	}
+	if result.Provider != "groq" {
+		t.Errorf("provider = %q, want groq", result.Provider)
+	}
+	if len(result.Attempts) != 1 || !result.Attempts[0].Skipped {
+		t.Errorf("attempts = %+v, want one skipped attempt", result.Attempts)
+	}
+	if !ct.IsAvailable(ModelKey("openai", "gpt-4")) {
+		t.Error("exhausted RPM budget should not put the model in cooldown")
+	}
+}
+
+func TestFallback_LastCandidateWaitsForRPM(t *testing.T) {
+	fc := NewFallbackChain(NewCooldownTracker())
+
+	limited := newRateLimitedProvider(&countingProvider{}, newTokenBucket(1), "only")
+	limited.Chat(context.Background(), nil, nil, "m", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := fc.Execute(ctx, []FallbackCandidate{makeCandidate("openai", "gpt-4")},
+		func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+			return limited.Chat(ctx, nil, nil, model, nil)
+		})
+	if errors.Is(err, ErrRPMExhausted) {
+		t.Fatal("last candidate should wait for budget, not fail fast")
+	}
+	if err == nil {
+		t.Fatal("expected the wait to end with the context deadline")
+	}
+}
@@ -0,0 +1,241 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MainBranch names the branch stored under the session's own key.
+const MainBranch = "main"
+
+// branchSep joins a session key and a branch name into the branch's key.
+const branchSep = "#"
+
+// BranchKey returns the key branch name of the session root is stored under.
+func BranchKey(root, name string) string {
+	if name == "" || name == MainBranch {
+		return root
+	}
+	return root + branchSep + name
+}
+
+// SplitBranchKey splits a key into its root session key and branch name.
+func SplitBranchKey(key string) (root, name string) {
+	if i := strings.Index(key, branchSep); i >= 0 {
+		return key[:i], key[i+len(branchSep):]
+	}
+	return key, MainBranch
+}
+
+// BranchInfo describes one branch of a session.
+type BranchInfo struct {
+	Name     string `json:"name"`
+	Key      string `json:"key"`
+	Parent   string `json:"parent,omitempty"` // Branch it was forked from
+	ForkTurn int    `json:"fork_turn,omitempty"`
+	Turns    int    `json:"turns"`
+	Messages int    `json:"messages"`
+	Active   bool   `json:"active"`
+}
+
+func validBranchName(name string) error {
+	if name == "" || name == MainBranch {
+		return fmt.Errorf("branch name %q is reserved", name)
+	}
+	if strings.ContainsAny(name, branchSep+`/\:`) || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' }) >= 0 {
+		return fmt.Errorf("branch name %q may not contain spaces, '#', ':' or slashes", name)
+	}
+	return nil
+}
+
+// ActiveBranch returns the name of the branch of root new messages go to.
+func (sm *SessionManager) ActiveBranch(root string) string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session := sm.get(root); session != nil && session.Active != "" {
+		return session.Active
+	}
+	return MainBranch
+}
+
+// ActiveKey returns the key of the active branch of root.
+func (sm *SessionManager) ActiveKey(root string) string {
+	return BranchKey(root, sm.ActiveBranch(root))
+}
+
+// Fork creates branch name of root from the active branch, copying its
+// history up to and including turn; 0 copies all of it. The active branch is
+// left unchanged. It returns the new branch's key.
+func (sm *SessionManager) Fork(root, name string, turn int) (string, error) {
+	if err := validBranchName(name); err != nil {
+		return "", err
+	}
+	key := BranchKey(root, name)
+
+	sm.mu.Lock()
+	if sm.get(key) != nil {
+		sm.mu.Unlock()
+		return "", fmt.Errorf("branch %q already exists", name)
+	}
+	parentKey := root
+	if r := sm.get(root); r != nil && r.Active != "" {
+		parentKey = BranchKey(root, r.Active)
+	}
+
+	branch := &Session{Key: key, Messages: []Message{}, Created: time.Now(), Parent: parentKey}
+	if parent := sm.get(parentKey); parent != nil {
+		p := parent.clone()
+		if turn <= 0 || turn > p.Turns {
+			turn = p.Turns
+		}
+		end := len(p.Messages)
+		for end > 0 && p.Messages[end-1].Turn > turn {
+			end--
+		}
+		branch.Messages = p.Messages[:end]
+		branch.Summary = p.Summary
+		branch.Checkpoints = p.Checkpoints
+		branch.Turns = turn
+	}
+	branch.ForkTurn = turn
+	branch.Updated = branch.Created
+	branch.markRewrite()
+	sm.cache(branch)
+	sm.mu.Unlock()
+
+	return key, sm.Save(key)
+}
+
+// SwitchBranch makes name the active branch of root.
+func (sm *SessionManager) SwitchBranch(root, name string) error {
+	if name == "" {
+		name = MainBranch
+	}
+
+	sm.mu.Lock()
+	if name != MainBranch && sm.get(BranchKey(root, name)) == nil {
+		sm.mu.Unlock()
+		return fmt.Errorf("no branch named %q", name)
+	}
+	session := sm.get(root)
+	if session == nil {
+		session = &Session{Key: root, Messages: []Message{}, Created: time.Now()}
+		sm.cache(session)
+	}
+	session.Active = name
+	if name == MainBranch {
+		session.Active = ""
+	}
+	session.markRewrite()
+	sm.mu.Unlock()
+
+	return sm.Save(root)
+}
+
+// branchKeys returns the keys of the branches of root other than main,
+// sorted, whether saved or not.
+func (sm *SessionManager) branchKeys(root string) ([]string, error) {
+	infos, err := sm.store.List()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if strings.HasPrefix(key, root+branchSep) && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, info := range infos {
+		add(info.Key)
+	}
+	sm.mu.Lock()
+	for key := range sm.sessions {
+		add(key)
+	}
+	sm.mu.Unlock()
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Branches lists the branches of root, main first and the rest by name.
+func (sm *SessionManager) Branches(root string) ([]BranchInfo, error) {
+	others, err := sm.branchKeys(root)
+	if err != nil {
+		return nil, err
+	}
+	keys := append([]string{root}, others...)
+
+	active := sm.ActiveBranch(root)
+	branches := make([]BranchInfo, 0, len(keys))
+	for _, key := range keys {
+		s := sm.Get(key)
+		if s == nil {
+			if key != root {
+				continue
+			}
+			s = &Session{Key: root}
+		}
+		_, name := SplitBranchKey(key)
+		info := BranchInfo{
+			Name:     name,
+			Key:      key,
+			ForkTurn: s.ForkTurn,
+			Turns:    s.Turns,
+			Messages: len(s.Messages),
+			Active:   name == active,
+		}
+		if s.Parent != "" {
+			_, info.Parent = SplitBranchKey(s.Parent)
+		}
+		branches = append(branches, info)
+	}
+	return branches, nil
+}
+
+// DropTurns removes the last n turns of a session and returns their
+// messages, oldest first, or nil if it has no turns left.
+func (sm *SessionManager) DropTurns(key string, n int) []Message {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.get(key)
+	if session == nil || len(session.Messages) == 0 || n <= 0 {
+		return nil
+	}
+	// Turn IDs are never reused, so count turns rather than subtract IDs.
+	cut := len(session.Messages)
+	for turns := 0; turns < n && cut > 0 && session.Messages[cut-1].Turn > 0; turns++ {
+		turn := session.Messages[cut-1].Turn
+		for cut > 0 && session.Messages[cut-1].Turn == turn {
+			cut--
+		}
+	}
+	if cut == len(session.Messages) {
+		return nil
+	}
+
+	dropped := append([]Message(nil), session.Messages[cut:]...)
+	session.Messages = append([]Message(nil), session.Messages[:cut]...)
+	session.Updated = time.Now()
+	session.markRewrite()
+	return dropped
+}
+
+// DeleteTree removes root and all of its branches.
+func (sm *SessionManager) DeleteTree(root string) error {
+	keys, err := sm.branchKeys(root)
+	if err != nil {
+		return err
+	}
+	for _, key := range append(keys, root) {
+		if err := sm.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// addTurn appends a user message and its reply to key.
+func addTurn(sm *SessionManager, key, text string) {
+	sm.AddMessage(key, "user", text)
+	sm.AddMessage(key, "assistant", "re: "+text)
+}
+
+func TestSessionManager_NumbersTurns(t *testing.T) {
+	sm := NewSessionManager("")
+	addTurn(sm, "chat", "one")
+	sm.AddFullMessage("chat", providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1", Name: "list_dir"}}})
+	sm.AddFullMessage("chat", providers.Message{Role: "tool", Content: "a.txt", ToolCallID: "1"})
+	addTurn(sm, "chat", "two")
+
+	var turns []int
+	for _, m := range sm.Get("chat").Messages {
+		turns = append(turns, m.Turn)
+	}
+	if got := fmt.Sprint(turns); got != "[1 1 1 1 2 2]" {
+		t.Errorf("turns = %s, want [1 1 1 1 2 2]", got)
+	}
+
+	// History set without turn IDs, e.g. loaded from an old session, is numbered.
+	sm.SetHistory("chat", []providers.Message{
+		{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"}, {Role: "user", Content: "c"},
+	})
+	if s := sm.Get("chat"); s.Turns != 2 || s.Messages[2].Turn != 2 {
+		t.Errorf("after SetHistory: turns = %d, messages = %+v", s.Turns, s.Messages)
+	}
+}
+
+func TestSessionManager_DropTurns(t *testing.T) {
+	sm := NewSessionManager("")
+	for _, text := range []string{"one", "two", "three"} {
+		addTurn(sm, "chat", text)
+	}
+
+	dropped := sm.DropTurns("chat", 2)
+	if len(dropped) != 4 || dropped[0].Content != "two" {
+		t.Fatalf("dropped = %+v, want turns two and three", dropped)
+	}
+	if history := sm.GetHistory("chat"); len(history) != 2 || history[0].Content != "one" {
+		t.Errorf("history = %+v, want turn one", history)
+	}
+
+	// Turn IDs are not reused after an undo.
+	addTurn(sm, "chat", "four")
+	if messages := sm.Get("chat").Messages; messages[2].Turn != 4 {
+		t.Errorf("new turn ID = %d, want 4", messages[2].Turn)
+	}
+	if dropped := sm.DropTurns("chat", 5); len(dropped) != 4 {
+		t.Errorf("dropping more turns than exist removed %d messages, want 4", len(dropped))
+	}
+	if dropped := sm.DropTurns("chat", 1); dropped != nil {
+		t.Errorf("DropTurns(empty) = %+v", dropped)
+	}
+}
+
+func TestSessionManager_ForkAndSwitch(t *testing.T) {
+	for _, kind := range []string{"json", "jsonl"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := OpenStore(kind, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sm := NewSessionManagerWithStore(store)
+			for _, text := range []string{"one", "two", "three"} {
+				addTurn(sm, "chat", text)
+			}
+			sm.Save("chat")
+
+			key, err := sm.Fork("chat", "alt", 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != "chat#alt" {
+				t.Errorf("branch key = %q", key)
+			}
+			if history := sm.GetHistory(key); len(history) != 4 || history[3].Content != "re: two" {
+				t.Errorf("branch history = %+v, want turns one and two", history)
+			}
+			if _, err := sm.Fork("chat", "alt", 0); err == nil {
+				t.Error("Fork() of an existing branch should fail")
+			}
+			if _, err := sm.Fork("chat", "bad name", 0); err == nil {
+				t.Error("Fork() should reject names with spaces")
+			}
+
+			// Forking does not switch; switching routes ActiveKey to the branch.
+			if got := sm.ActiveKey("chat"); got != "chat" {
+				t.Errorf("ActiveKey after fork = %q, want chat", got)
+			}
+			if err := sm.SwitchBranch("chat", "alt"); err != nil {
+				t.Fatal(err)
+			}
+			if err := sm.SwitchBranch("chat", "ghost"); err == nil {
+				t.Error("SwitchBranch() to a missing branch should fail")
+			}
+			addTurn(sm, sm.ActiveKey("chat"), "three again")
+			sm.Save("chat#alt")
+
+			// Branch state survives a reload.
+			reloaded := NewSessionManagerWithStore(store)
+			if got := reloaded.ActiveBranch("chat"); got != "alt" {
+				t.Errorf("active branch after reload = %q, want alt", got)
+			}
+			branches, err := reloaded.Branches("chat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(branches) != 2 || branches[0].Name != MainBranch || branches[1].Name != "alt" {
+				t.Fatalf("branches = %+v", branches)
+			}
+			alt := branches[1]
+			if !alt.Active || alt.Parent != MainBranch || alt.ForkTurn != 2 || alt.Messages != 6 || alt.Turns != 3 {
+				t.Errorf("alt = %+v", alt)
+			}
+			if main := reloaded.GetHistory("chat"); len(main) != 6 || main[4].Content != "three" {
+				t.Errorf("main history changed: %+v", main)
+			}
+		})
+	}
+}
+
+func TestSessionManager_ArchiveAndDeleteTree(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	addTurn(sm, "chat", "one")
+	sm.Save("chat")
+	if _, err := sm.Fork("chat", "alt", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	archived, err := sm.Archive("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Get("chat") != nil || sm.Get("chat#alt") != nil {
+		t.Error("branches still present after archive")
+	}
+	alt := sm.Get(archived + "#alt")
+	if alt == nil || alt.Parent != archived {
+		t.Fatalf("archived branch = %+v, want parent %q", alt, archived)
+	}
+
+	if err := sm.DeleteTree(archived); err != nil {
+		t.Fatal(err)
+	}
+	if sm.Get(archived) != nil || sm.Get(archived+"#alt") != nil {
+		t.Error("DeleteTree left sessions behind")
+	}
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// ExportMarkdown renders a session as a readable markdown transcript.
+func ExportMarkdown(s *Session) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Session %s\n\n", s.Key)
+	fmt.Fprintf(&sb, "- Created: %s\n", s.Created.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "- Updated: %s\n", s.Updated.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "- Messages: %d\n", len(s.Messages))
+
+	if s.Summary != "" {
+		sb.WriteString("\n## Summary\n\n")
+		sb.WriteString(strings.TrimSpace(s.Summary))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n## Transcript\n")
+	for _, msg := range s.Messages {
+		sb.WriteString("\n### ")
+		sb.WriteString(roleTitle(msg.Message))
+		sb.WriteString("\n\n")
+		content := strings.TrimSpace(msg.Content)
+		if content != "" {
+			if msg.Role == "tool" {
+				sb.WriteString("```\n" + content + "\n```\n")
+			} else {
+				sb.WriteString(content + "\n")
+			}
+		}
+		for i, tc := range msg.ToolCalls {
+			if i == 0 && content != "" {
+				sb.WriteString("\n")
+			}
+			name, args := toolCallText(tc)
+			fmt.Fprintf(&sb, "- Called `%s` with `%s`\n", name, args)
+		}
+	}
+	return sb.String()
+}
+
+// ExportJSON renders a session as indented JSON.
+func ExportJSON(s *Session) ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func roleTitle(msg providers.Message) string {
+	switch msg.Role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "tool":
+		return "Tool result"
+	case "system":
+		return "System"
+	default:
+		return msg.Role
+	}
+}
+
+// toolCallText returns the name and JSON arguments of a tool call, which
+// may be stored in either the flat or the OpenAI function form.
+func toolCallText(tc providers.ToolCall) (string, string) {
+	if tc.Function != nil {
+		return tc.Function.Name, tc.Function.Arguments
+	}
+	if len(tc.Arguments) == 0 {
+		return tc.Name, "{}"
+	}
+	args, _ := json.Marshal(tc.Arguments)
+	return tc.Name, string(args)
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// indexFile is the name of the session index in a store directory.
+const indexFile = ".index"
+
+// sessionIndex keeps the Info of every session in a store, so that listing
+// sessions reads neither their files nor their messages. It is journaled to
+// indexFile: each change appends one line, and the journal is rewritten
+// compactly once it has grown well past one line per session. Callers
+// serialize access.
+type sessionIndex struct {
+	dir     string
+	ext     string // Extension of the store's session files
+	infos   map[string]Info
+	records int // Lines in the journal
+}
+
+// indexRecord is one line of the index journal.
+type indexRecord struct {
+	Info
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// openIndex loads the index of the store in dir and reconciles it with the
+// session files there: files the index does not know, such as those written
+// before the index existed, are read with read and added; entries whose
+// file is gone are dropped.
+func openIndex(dir, ext string, read func(path string) (*Session, error)) *sessionIndex {
+	idx := &sessionIndex{dir: dir, ext: ext, infos: make(map[string]Info)}
+	idx.load()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return idx
+	}
+	indexed := make(map[string]bool, len(idx.infos))
+	for key := range idx.infos {
+		indexed[sanitizeFilename(key)+ext] = true
+	}
+	present := make(map[string]bool, len(files))
+	changed := false
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || filepath.Ext(name) != ext || strings.HasPrefix(name, ".") {
+			continue
+		}
+		present[name] = true
+		if indexed[name] {
+			continue
+		}
+		session, err := read(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		idx.infos[session.Key] = sessionInfo(session)
+		changed = true
+	}
+	for key := range idx.infos {
+		if !present[sanitizeFilename(key)+ext] {
+			delete(idx.infos, key)
+			changed = true
+		}
+	}
+	if changed {
+		idx.compact()
+	}
+	return idx
+}
+
+// load replays the journal. Unreadable lines, such as a torn last line, are
+// skipped; reconciling with the files repairs what they held.
+func (idx *sessionIndex) load() {
+	data, err := os.ReadFile(filepath.Join(idx.dir, indexFile))
+	if err != nil {
+		return
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for sc.Scan() {
+		var rec indexRecord
+		if json.Unmarshal(sc.Bytes(), &rec) != nil || rec.Key == "" {
+			continue
+		}
+		idx.records++
+		if rec.Deleted {
+			delete(idx.infos, rec.Key)
+		} else {
+			idx.infos[rec.Key] = rec.Info
+		}
+	}
+}
+
+func (idx *sessionIndex) put(info Info) {
+	idx.infos[info.Key] = info
+	idx.append(indexRecord{Info: info})
+}
+
+func (idx *sessionIndex) remove(key string) {
+	if _, ok := idx.infos[key]; !ok {
+		return
+	}
+	delete(idx.infos, key)
+	idx.append(indexRecord{Info: Info{Key: key}, Deleted: true})
+}
+
+// list returns the indexed sessions ordered by key.
+func (idx *sessionIndex) list() []Info {
+	infos := make([]Info, 0, len(idx.infos))
+	for _, info := range idx.infos {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
+// append journals rec, compacting the journal when it has grown to more
+// than twice the number of sessions. The index is only an accelerator, so
+// failures are logged rather than returned: the next open rebuilds what
+// was lost from the session files.
+func (idx *sessionIndex) append(rec indexRecord) {
+	if idx.records+1 > 2*len(idx.infos)+64 {
+		idx.compact()
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(filepath.Join(idx.dir, indexFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err == nil {
+			_, err = f.Write(append(data, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		idx.warn(err)
+		return
+	}
+	idx.records++
+}
+
+// compact rewrites the journal with one line per session.
+func (idx *sessionIndex) compact() {
+	var buf bytes.Buffer
+	for _, info := range idx.list() {
+		data, err := json.Marshal(indexRecord{Info: info})
+		if err != nil {
+			idx.warn(err)
+			return
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(filepath.Join(idx.dir, indexFile), buf.Bytes()); err != nil {
+		idx.warn(err)
+		return
+	}
+	idx.records = len(idx.infos)
+}
+
+func (idx *sessionIndex) warn(err error) {
+	logger.WarnCF("session", "Failed to update session index", map[string]interface{}{
+		"dir":   idx.dir,
+		"error": err.Error(),
+	})
+}
+
+// sessionInfo describes s for the index.
+func sessionInfo(s *Session) Info {
+	return Info{
+		Key:      s.Key,
+		Messages: len(s.Messages),
+		Summary:  s.Summary != "",
+		Created:  s.Created,
+		Updated:  s.Updated,
+	}
+}
@@ -0,0 +1,157 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// JSONStore keeps each session in its own JSON file, rewritten in full on
+// every save. It is simple and human-readable but costs a whole-file write
+// per turn; LogStore is the better fit for long-lived sessions on flash.
+type JSONStore struct {
+	dir   string
+	mu    sync.Mutex
+	index *sessionIndex
+}
+
+// NewJSONStore returns a JSONStore rooted at dir. An empty dir keeps
+// nothing: loads find no sessions and saves are no-ops.
+func NewJSONStore(dir string) *JSONStore {
+	s := &JSONStore{dir: dir}
+	if dir != "" {
+		os.MkdirAll(dir, 0755)
+		s.index = openIndex(dir, ".json", readJSONSession)
+	}
+	return s
+}
+
+func (s *JSONStore) Load(key string) (*Session, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+	path, err := sessionPath(s.dir, key, ".json")
+	if err != nil {
+		return nil, err
+	}
+	session, err := readJSONSession(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.Key != key {
+		// Two keys differing only in ':' vs '_' share a file name.
+		return nil, nil
+	}
+	return session, nil
+}
+
+func (s *JSONStore) Append(session *Session, from int) error {
+	return s.Save(session)
+}
+
+func (s *JSONStore) Save(session *Session) error {
+	if s.dir == "" {
+		return nil
+	}
+	path, err := sessionPath(s.dir, session.Key, ".json")
+	if err != nil {
+		return err
+	}
+
+	snapshot := *session
+	if snapshot.Messages == nil {
+		snapshot.Messages = []Message{}
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	s.index.put(sessionInfo(session))
+	return nil
+}
+
+func (s *JSONStore) Delete(key string) error {
+	if s.dir == "" {
+		return nil
+	}
+	path, err := sessionPath(s.dir, key, ".json")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.index.remove(key)
+	return nil
+}
+
+// List answers from the session index without reading any session.
+func (s *JSONStore) List() ([]Info, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index.list(), nil
+}
+
+func (s *JSONStore) Search(query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	var results []SearchResult
+	err := s.each(func(session *Session) {
+		results = append(results, matchMessages(session.Key, session.Updated, session.Messages, terms)...)
+	})
+	return rankResults(results, limit), err
+}
+
+func (s *JSONStore) Close() error { return nil }
+
+// each calls fn with every readable session file in the store.
+func (s *JSONStore) each(fn func(*Session)) error {
+	if s.dir == "" {
+		return nil
+	}
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		session, err := readJSONSession(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		fn(session)
+	}
+	return nil
+}
+
+func readJSONSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
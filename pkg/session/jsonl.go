@@ -0,0 +1,310 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// LogStore keeps each session as an append-only JSON Lines file: a header
+// record followed by one record per message. A turn appends only its new
+// messages; the file is rewritten only when history is replaced, such as
+// after summarization or pruning. A torn final line from a power cut is
+// skipped on load.
+type LogStore struct {
+	dir   string
+	mu    sync.Mutex
+	index *sessionIndex
+}
+
+// logRecord is one line of a session log.
+type logRecord struct {
+	Type        string       `json:"type"` // "session" or "message"
+	Time        time.Time    `json:"time"`
+	Key         string       `json:"key,omitempty"`
+	Summary     string       `json:"summary,omitempty"`
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"`
+	Created     time.Time    `json:"created,omitzero"`
+	Turns       int          `json:"turns,omitempty"`
+	Parent      string       `json:"parent,omitempty"`
+	ForkTurn    int          `json:"fork_turn,omitempty"`
+	Active      string       `json:"active,omitempty"`
+	Message     *Message     `json:"message,omitempty"`
+}
+
+// NewLogStore returns a LogStore rooted at dir. Sessions left behind by the
+// JSON store are imported once and their files renamed to *.json.migrated.
+func NewLogStore(dir string) (*LogStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &LogStore{dir: dir}
+	s.migrateJSON()
+	s.index = openIndex(dir, ".jsonl", readLog)
+	return s, nil
+}
+
+func (s *LogStore) Load(key string) (*Session, error) {
+	path, err := sessionPath(s.dir, key, ".jsonl")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := readLog(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.Key != key {
+		return nil, nil
+	}
+	return session, nil
+}
+
+func (s *LogStore) Append(session *Session, from int) error {
+	path, err := sessionPath(s.dir, session.Key, ".jsonl")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(path); from <= 0 || err != nil {
+		return s.write(path, session)
+	}
+	if from >= len(session.Messages) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for i := from; i < len(session.Messages); i++ {
+		if err := encodeRecord(&buf, logRecord{Type: "message", Time: session.Updated, Message: &session.Messages[i]}); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.index.put(sessionInfo(session))
+	return nil
+}
+
+func (s *LogStore) Save(session *Session) error {
+	path, err := sessionPath(s.dir, session.Key, ".jsonl")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(path, session)
+}
+
+func (s *LogStore) write(path string, session *Session) error {
+	var buf bytes.Buffer
+	header := logRecord{
+		Type:        "session",
+		Time:        session.Updated,
+		Key:         session.Key,
+		Summary:     session.Summary,
+		Checkpoints: session.Checkpoints,
+		Created:     session.Created,
+		Turns:       session.Turns,
+		Parent:      session.Parent,
+		ForkTurn:    session.ForkTurn,
+		Active:      session.Active,
+	}
+	if err := encodeRecord(&buf, header); err != nil {
+		return err
+	}
+	for i := range session.Messages {
+		if err := encodeRecord(&buf, logRecord{Type: "message", Time: session.Updated, Message: &session.Messages[i]}); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return err
+	}
+	// Sessions migrated before the index is opened are found by openIndex.
+	if s.index != nil {
+		s.index.put(sessionInfo(session))
+	}
+	return nil
+}
+
+func (s *LogStore) Delete(key string) error {
+	path, err := sessionPath(s.dir, key, ".jsonl")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.index.remove(key)
+	return nil
+}
+
+// List answers from the session index without reading any session.
+func (s *LogStore) List() ([]Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index.list(), nil
+}
+
+func (s *LogStore) Search(query string, limit int) ([]SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terms := searchTerms(query)
+	var results []SearchResult
+	err := s.each(func(session *Session) {
+		results = append(results, matchMessages(session.Key, session.Updated, session.Messages, terms)...)
+	})
+	return rankResults(results, limit), err
+}
+
+func (s *LogStore) Close() error { return nil }
+
+func (s *LogStore) each(fn func(*Session)) error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".jsonl" {
+			continue
+		}
+		session, err := readLog(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		fn(session)
+	}
+	return nil
+}
+
+// migrateJSON imports sessions saved by JSONStore into the log format.
+func (s *LogStore) migrateJSON() {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		jsonPath := filepath.Join(s.dir, file.Name())
+		session, err := readJSONSession(jsonPath)
+		if err != nil {
+			continue
+		}
+		logPath, err := sessionPath(s.dir, session.Key, ".jsonl")
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(logPath); err == nil {
+			continue
+		}
+		if err := s.write(logPath, session); err != nil {
+			logger.WarnCF("session", "Failed to migrate JSON session", map[string]interface{}{
+				"key":   session.Key,
+				"error": err.Error(),
+			})
+			continue
+		}
+		os.Rename(jsonPath, jsonPath+".migrated")
+	}
+}
+
+func encodeRecord(buf *bytes.Buffer, rec logRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	buf.WriteByte('\n')
+	return nil
+}
+
+// readLog rebuilds a session from its log. Lines that don't parse are
+// skipped so a torn write loses at most the message being written.
+func readLog(path string) (*Session, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	session := &Session{Messages: []Message{}}
+	r := bufio.NewReader(f)
+	sawHeader := false
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var rec logRecord
+			if jerr := json.Unmarshal(line, &rec); jerr != nil {
+				logger.WarnCF("session", "Skipping unreadable session log line", map[string]interface{}{
+					"file":  filepath.Base(path),
+					"error": jerr.Error(),
+				})
+			} else {
+				switch rec.Type {
+				case "session":
+					sawHeader = true
+					session.Key = rec.Key
+					session.Summary = rec.Summary
+					session.Checkpoints = rec.Checkpoints
+					session.Turns = rec.Turns
+					session.Parent = rec.Parent
+					session.ForkTurn = rec.ForkTurn
+					session.Active = rec.Active
+					session.Created = rec.Created
+				case "message":
+					if rec.Message != nil {
+						session.Messages = append(session.Messages, *rec.Message)
+					}
+				}
+				if rec.Time.After(session.Updated) {
+					session.Updated = rec.Time
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !sawHeader {
+		return nil, errors.New("session log has no header: " + strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+	}
+	return session, nil
+}
@@ -0,0 +1,139 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestLogStore_AppendsOnlyNewMessages(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLogStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSessionManagerWithStore(store)
+
+	key := "telegram:42"
+	sm.AddMessage(key, "user", "one")
+	sm.AddMessage(key, "assistant", "two")
+	sm.Save(key)
+	path := filepath.Join(dir, "telegram_42.jsonl")
+	before, _ := os.ReadFile(path)
+
+	sm.AddMessage(key, "user", "three")
+	sm.Save(key)
+	after, _ := os.ReadFile(path)
+
+	if !strings.HasPrefix(string(after), string(before)) {
+		t.Fatal("append should leave existing records untouched")
+	}
+	if lines := strings.Count(string(after), "\n"); lines != 4 {
+		t.Errorf("log has %d lines, want header + 3 messages", lines)
+	}
+	// Turn IDs are stored beside the message fields, as before they moved
+	// out of providers.Message.
+	if !strings.Contains(string(after), `"role":"user","content":"three","turn":2`) {
+		t.Errorf("log does not record the turn with the message:\n%s", after)
+	}
+
+	// A summary replaces history, so the log is rewritten.
+	sm.SetSummary(key, "counting")
+	sm.TruncateHistory(key, 1)
+	sm.Save(key)
+	reloaded, err := store.Load(key)
+	if err != nil || reloaded == nil {
+		t.Fatalf("Load() = %v, %v", reloaded, err)
+	}
+	if reloaded.Summary != "counting" || len(reloaded.Messages) != 1 || reloaded.Messages[0].Content != "three" || reloaded.Messages[0].Turn != 2 {
+		t.Errorf("reloaded = %+v", reloaded)
+	}
+}
+
+func TestLogStore_SkipsTornLine(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewLogStore(dir)
+	store.Save(&Session{Key: "k", Messages: []Message{{Message: providers.Message{Role: "user", Content: "kept"}}}})
+
+	f, _ := os.OpenFile(filepath.Join(dir, "k.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"type":"message","message":{"role":"assist`)
+	f.Close()
+
+	session, err := store.Load("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Messages) != 1 || session.Messages[0].Content != "kept" {
+		t.Errorf("messages = %+v", session.Messages)
+	}
+}
+
+func TestLogStore_MigratesJSONSessions(t *testing.T) {
+	dir := t.TempDir()
+	legacy := NewSessionManager(dir)
+	legacy.AddMessage("discord:7", "user", "from json")
+	legacy.Save("discord:7")
+
+	store, err := NewLogStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _ := store.Load("discord:7")
+	if session == nil || len(session.Messages) != 1 || session.Messages[0].Content != "from json" {
+		t.Fatalf("migrated session = %+v", session)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "discord_7.json.migrated")); err != nil {
+		t.Errorf("JSON file should be renamed after migration: %v", err)
+	}
+}
+
+func TestOpenStore_UnknownKind(t *testing.T) {
+	if _, err := OpenStore("sqlite3", t.TempDir()); err == nil {
+		t.Error("unknown store kind should be rejected")
+	}
+}
+
+func TestStores_ListFromIndex(t *testing.T) {
+	for _, kind := range []string{"json", "jsonl"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := OpenStore(kind, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ext := "." + kind
+			sm := NewSessionManagerWithStore(store)
+			for _, key := range []string{"telegram:1", "telegram:2", "telegram:3"} {
+				sm.AddMessage(key, "user", "hello")
+				sm.Save(key)
+			}
+			sm.AddMessage("telegram:1", "assistant", "hi")
+			sm.Save("telegram:1")
+			sm.Delete("telegram:2")
+
+			// Listing must not read the sessions, so a garbled file goes unnoticed.
+			os.WriteFile(filepath.Join(dir, "telegram_3"+ext), []byte("garbage"), 0644)
+			infos, _ := store.List()
+			if len(infos) != 2 || infos[0].Key != "telegram:1" || infos[0].Messages != 2 || infos[1].Key != "telegram:3" {
+				t.Fatalf("List() = %+v", infos)
+			}
+
+			// Reopening reconciles the index with the files changed behind its back.
+			os.Remove(filepath.Join(dir, "telegram_3"+ext))
+			otherDir := t.TempDir()
+			other, _ := OpenStore(kind, otherDir)
+			other.Save(&Session{Key: "slack:9", Messages: []Message{{Message: providers.Message{Role: "user", Content: "x"}}}})
+			data, _ := os.ReadFile(filepath.Join(otherDir, "slack_9"+ext))
+			os.WriteFile(filepath.Join(dir, "slack_9"+ext), data, 0644)
+
+			reopened, _ := OpenStore(kind, dir)
+			infos, _ = reopened.List()
+			if len(infos) != 2 || infos[0].Key != "slack:9" || infos[1].Key != "telegram:1" {
+				t.Errorf("List() after reopening = %+v", infos)
+			}
+		})
+	}
+}
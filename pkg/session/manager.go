@@ -1,60 +1,194 @@
 package session
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
+// maxCachedSessions bounds how many sessions stay in memory. Sessions with
+// nothing left to save are evicted least recently used first and reloaded
+// from the store on demand.
+const maxCachedSessions = 64
+
+// pruneInterval is how often Save applies the retention policy.
+const pruneInterval = time.Hour
+
+// maxCheckpoints bounds how many summary checkpoints a session keeps.
+const maxCheckpoints = 10
+
 type Session struct {
-	Key      string              `json:"key"`
-	Messages []providers.Message `json:"messages"`
-	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	Key         string       `json:"key"`
+	Messages    []Message    `json:"messages"`
+	Summary     string       `json:"summary,omitempty"`
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"` // Recent compactions, oldest first
+	Created     time.Time    `json:"created"`
+	Updated     time.Time    `json:"updated"`
+	Turns       int          `json:"turns,omitempty"`     // Last turn ID handed out
+	Parent      string       `json:"parent,omitempty"`    // Branches: key of the session forked from
+	ForkTurn    int          `json:"fork_turn,omitempty"` // Branches: last turn shared with Parent
+	Active      string       `json:"active,omitempty"`    // Roots: branch new messages go to; empty is MainBranch
+
+	persisted int       // Leading messages already in the store
+	rewrite   bool      // History or summary replaced; the store needs a full save
+	gen       int       // Bumped on every rewrite, so Save can tell if one raced it
+	lastUsed  time.Time // For cache eviction
+}
+
+// Message is a message as a session records it: what providers are sent,
+// plus the turn it belongs to. It is stored flat, the turn beside the
+// message's own fields.
+type Message struct {
+	providers.Message
+	Turn int `json:"turn,omitempty"`
+}
+
+// providerMessages returns the messages of records without their turns.
+func providerMessages(records []Message) []providers.Message {
+	messages := make([]providers.Message, len(records))
+	for i, r := range records {
+		messages[i] = r.Message
+	}
+	return messages
+}
+
+// Checkpoint records a compaction: the summary it produced and how many
+// messages had been folded into summaries by then.
+type Checkpoint struct {
+	Summary  string    `json:"summary"`
+	Messages int       `json:"messages"`
+	Created  time.Time `json:"created"`
+}
+
+// clone returns a copy of s that shares no slices with it.
+func (s *Session) clone() *Session {
+	c := *s
+	c.Messages = append([]Message(nil), s.Messages...)
+	c.Checkpoints = append([]Checkpoint(nil), s.Checkpoints...)
+	return &c
+}
+
+// numberTurns gives messages loaded or set without a turn ID one: a user
+// message opens the next turn and other messages join the one before.
+func (s *Session) numberTurns() {
+	turn := 0
+	for i := range s.Messages {
+		m := &s.Messages[i]
+		if m.Turn == 0 {
+			if m.Role == "user" {
+				turn++
+			}
+			m.Turn = turn
+		}
+		turn = m.Turn
+	}
+	s.Turns = max(s.Turns, turn)
+}
+
+// Covered returns how many messages the session's summary stands in for.
+func (s *Session) Covered() int {
+	if len(s.Checkpoints) == 0 {
+		return 0
+	}
+	return s.Checkpoints[len(s.Checkpoints)-1].Messages
 }
 
 type SessionManager struct {
-	sessions map[string]*Session
-	mu       sync.RWMutex
-	storage  string
+	sessions  map[string]*Session
+	mu        sync.Mutex
+	store     Store
+	retention RetentionPolicy
+	lastPrune time.Time
 }
 
+// NewSessionManager returns a manager backed by a JSONStore in storage.
+// An empty storage keeps sessions in memory only.
 func NewSessionManager(storage string) *SessionManager {
-	sm := &SessionManager{
+	return NewSessionManagerWithStore(NewJSONStore(storage))
+}
+
+// NewSessionManagerWithStore returns a manager backed by store.
+func NewSessionManagerWithStore(store Store) *SessionManager {
+	return &SessionManager{
 		sessions: make(map[string]*Session),
-		storage:  storage,
+		store:    store,
 	}
+}
 
-	if storage != "" {
-		os.MkdirAll(storage, 0755)
-		sm.loadSessions()
+// SetRetention sets the policy Prune applies. Save prunes at most hourly.
+func (sm *SessionManager) SetRetention(policy RetentionPolicy) {
+	sm.mu.Lock()
+	sm.retention = policy
+	sm.mu.Unlock()
+}
+
+// get returns the cached session for key, loading it from the store on
+// first use. It returns nil if the session exists nowhere. Callers hold mu.
+func (sm *SessionManager) get(key string) *Session {
+	if session, ok := sm.sessions[key]; ok {
+		session.lastUsed = time.Now()
+		return session
+	}
+
+	session, err := sm.store.Load(key)
+	if err != nil {
+		logger.WarnCF("session", "Failed to load session", map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		})
+		return nil
 	}
+	if session == nil {
+		return nil
+	}
+	session.persisted = len(session.Messages)
+	session.numberTurns()
+	sm.cache(session)
+	return session
+}
 
-	return sm
+// cache adds session to the cache, evicting clean sessions over the limit.
+// Callers hold mu.
+func (sm *SessionManager) cache(session *Session) {
+	session.lastUsed = time.Now()
+	sm.sessions[session.Key] = session
+
+	for len(sm.sessions) > maxCachedSessions {
+		var oldest *Session
+		for _, s := range sm.sessions {
+			if s == session || s.rewrite || s.persisted != len(s.Messages) {
+				continue
+			}
+			if oldest == nil || s.lastUsed.Before(oldest.lastUsed) {
+				oldest = s
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(sm.sessions, oldest.Key)
+	}
 }
 
 func (sm *SessionManager) GetOrCreate(key string) *Session {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
-	if ok {
+	if session := sm.get(key); session != nil {
 		return session
 	}
 
-	session = &Session{
+	session := &Session{
 		Key:      key,
-		Messages: []providers.Message{},
+		Messages: []Message{},
 		Created:  time.Now(),
 		Updated:  time.Now(),
 	}
-	sm.sessions[key] = session
+	sm.cache(session)
 
 	return session
 }
@@ -72,40 +206,41 @@ func (sm *SessionManager) AddFullMessage(sessionKey string, msg providers.Messag
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[sessionKey]
-	if !ok {
+	session := sm.get(sessionKey)
+	if session == nil {
 		session = &Session{
 			Key:      sessionKey,
-			Messages: []providers.Message{},
+			Messages: []Message{},
 			Created:  time.Now(),
 		}
-		sm.sessions[sessionKey] = session
+		sm.cache(session)
 	}
 
-	session.Messages = append(session.Messages, msg)
+	if msg.Role == "user" {
+		session.Turns++
+	}
+	session.Messages = append(session.Messages, Message{Message: msg, Turn: session.Turns})
 	session.Updated = time.Now()
 }
 
 func (sm *SessionManager) GetHistory(key string) []providers.Message {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
-	if !ok {
+	session := sm.get(key)
+	if session == nil {
 		return []providers.Message{}
 	}
 
-	history := make([]providers.Message, len(session.Messages))
-	copy(history, session.Messages)
-	return history
+	return providerMessages(session.Messages)
 }
 
 func (sm *SessionManager) GetSummary(key string) string {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
-	if !ok {
+	session := sm.get(key)
+	if session == nil {
 		return ""
 	}
 	return session.Summary
@@ -115,10 +250,10 @@ func (sm *SessionManager) SetSummary(key string, summary string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
-	if ok {
+	if session := sm.get(key); session != nil {
 		session.Summary = summary
 		session.Updated = time.Now()
+		session.markRewrite()
 	}
 }
 
@@ -126,14 +261,15 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
-	if !ok {
+	session := sm.get(key)
+	if session == nil {
 		return
 	}
 
 	if keepLast <= 0 {
-		session.Messages = []providers.Message{}
+		session.Messages = []Message{}
 		session.Updated = time.Now()
+		session.markRewrite()
 		return
 	}
 
@@ -141,142 +277,235 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 		return
 	}
 
-	session.Messages = session.Messages[len(session.Messages)-keepLast:]
+	start := turnStart(session.Messages, len(session.Messages)-keepLast)
+	session.Messages = append([]Message(nil), session.Messages[start:]...)
 	session.Updated = time.Now()
+	session.markRewrite()
 }
 
-// sanitizeFilename converts a session key into a cross-platform safe filename.
-// Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
-// volume separator on Windows, so filepath.Base would misinterpret the key.
-// We replace it with '_'. The original key is preserved inside the JSON file,
-// so loadSessions still maps back to the right in-memory key.
-func sanitizeFilename(key string) string {
-	return strings.ReplaceAll(key, ":", "_")
-}
+// Compact replaces the leading messages covered with summary and records a
+// checkpoint. It returns false, changing nothing, if the history no longer
+// starts with covered, e.g. because it was rewritten meanwhile.
+func (sm *SessionManager) Compact(key string, covered []providers.Message, summary string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-func (sm *SessionManager) Save(key string) error {
-	if sm.storage == "" {
-		return nil
+	session := sm.get(key)
+	if session == nil || len(covered) == 0 || len(session.Messages) < len(covered) ||
+		!reflect.DeepEqual(providerMessages(session.Messages[:len(covered)]), covered) {
+		return false
 	}
 
-	filename := sanitizeFilename(key)
+	now := time.Now()
+	session.Checkpoints = append(session.Checkpoints, Checkpoint{
+		Summary:  summary,
+		Messages: session.Covered() + len(covered),
+		Created:  now,
+	})
+	if len(session.Checkpoints) > maxCheckpoints {
+		session.Checkpoints = session.Checkpoints[len(session.Checkpoints)-maxCheckpoints:]
+	}
+	session.Messages = append([]Message(nil), session.Messages[len(covered):]...)
+	session.Summary = summary
+	session.Updated = now
+	session.markRewrite()
+	return true
+}
 
-	// filepath.IsLocal rejects empty names, "..", absolute paths, and
-	// OS-reserved device names (NUL, COM1 … on Windows).
-	// The extra checks reject "." and any directory separators so that
-	// the session file is always written directly inside sm.storage.
-	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
-		return os.ErrInvalid
+// SetHistory replaces the messages of a session. They are numbered into
+// turns afresh.
+func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session := sm.get(key); session != nil {
+		msgs := make([]Message, len(history))
+		for i, m := range history {
+			msgs[i] = Message{Message: m}
+		}
+		session.Messages = msgs
+		session.numberTurns()
+		session.Updated = time.Now()
+		session.markRewrite()
 	}
+}
+
+func (s *Session) markRewrite() {
+	s.rewrite = true
+	s.gen++
+}
 
-	// Snapshot under read lock, then perform slow file I/O after unlock.
-	sm.mu.RLock()
-	stored, ok := sm.sessions[key]
-	if !ok {
-		sm.mu.RUnlock()
+// Save writes the session's unsaved changes to the store: just the new
+// messages when history only grew, the whole session otherwise.
+func (sm *SessionManager) Save(key string) error {
+	// Snapshot under lock, then perform slow store I/O after unlock.
+	sm.mu.Lock()
+	stored := sm.get(key)
+	if stored == nil {
+		sm.mu.Unlock()
 		return nil
 	}
 
-	snapshot := Session{
-		Key:     stored.Key,
-		Summary: stored.Summary,
-		Created: stored.Created,
-		Updated: stored.Updated,
-	}
-	if len(stored.Messages) > 0 {
-		snapshot.Messages = make([]providers.Message, len(stored.Messages))
-		copy(snapshot.Messages, stored.Messages)
+	snapshot := stored.clone()
+	rewrite, from, gen := stored.rewrite, stored.persisted, stored.gen
+	sm.mu.Unlock()
+
+	var err error
+	if rewrite || from == 0 {
+		err = sm.store.Save(snapshot)
 	} else {
-		snapshot.Messages = []providers.Message{}
+		err = sm.store.Append(snapshot, from)
 	}
-	sm.mu.RUnlock()
-
-	data, err := json.MarshalIndent(snapshot, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	sessionPath := filepath.Join(sm.storage, filename+".json")
-	tmpFile, err := os.CreateTemp(sm.storage, "session-*.tmp")
-	if err != nil {
-		return err
+	sm.mu.Lock()
+	if stored.gen == gen {
+		stored.rewrite = false
+		stored.persisted = len(snapshot.Messages)
 	}
-
-	tmpPath := tmpFile.Name()
-	cleanup := true
-	defer func() {
-		if cleanup {
-			_ = os.Remove(tmpPath)
+	due := (sm.retention.MaxAge > 0 || sm.retention.MaxMessages > 0) && time.Since(sm.lastPrune) >= pruneInterval
+	sm.mu.Unlock()
+
+	if due {
+		if _, err := sm.Prune(); err != nil {
+			logger.WarnCF("session", "Failed to prune sessions", map[string]interface{}{
+				"error": err.Error(),
+			})
 		}
-	}()
-
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Chmod(0644); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Sync(); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Close(); err != nil {
-		return err
 	}
+	return nil
+}
 
-	if err := os.Rename(tmpPath, sessionPath); err != nil {
-		return err
+// Get returns a copy of the session for key, or nil if there is none.
+func (sm *SessionManager) Get(key string) *Session {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session := sm.get(key)
+	if session == nil {
+		return nil
 	}
-	cleanup = false
-	return nil
+	return session.clone()
 }
 
-func (sm *SessionManager) loadSessions() error {
-	files, err := os.ReadDir(sm.storage)
+// Archive moves a session and its branches to a new key,
+// "<key>:archived:<timestamp>", so the next message under key starts a fresh
+// conversation. It returns the archive key, or "" if there are no messages
+// to archive.
+func (sm *SessionManager) Archive(key string) (string, error) {
+	branches, err := sm.branchKeys(key)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if root := sm.Get(key); (root == nil || len(root.Messages) == 0) && len(branches) == 0 {
+		return "", nil
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
+	archivedKey := key + ":archived:" + time.Now().Format("20060102-150405")
+	for _, from := range append([]string{key}, branches...) {
+		session := sm.Get(from)
+		if session == nil {
 			continue
 		}
-
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
+		session.Key = archivedKey + strings.TrimPrefix(from, key)
+		if session.Parent != "" {
+			session.Parent = archivedKey + strings.TrimPrefix(session.Parent, key)
 		}
-
-		sessionPath := filepath.Join(sm.storage, file.Name())
-		data, err := os.ReadFile(sessionPath)
-		if err != nil {
-			continue
+		if err := sm.store.Save(session); err != nil {
+			return "", err
 		}
-
-		var session Session
-		if err := json.Unmarshal(data, &session); err != nil {
-			continue
+		if err := sm.Delete(from); err != nil {
+			return "", err
 		}
+	}
+	return archivedKey, nil
+}
+
+// Delete removes a session from memory and the store.
+func (sm *SessionManager) Delete(key string) error {
+	sm.mu.Lock()
+	delete(sm.sessions, key)
+	sm.mu.Unlock()
+	return sm.store.Delete(key)
+}
 
-		sm.sessions[session.Key] = &session
+// List describes every stored session.
+func (sm *SessionManager) List() ([]Info, error) {
+	return sm.store.List()
+}
+
+// Search finds stored messages containing every term of query.
+func (sm *SessionManager) Search(query string, limit int) ([]SearchResult, error) {
+	return sm.store.Search(query, limit)
+}
+
+// Prune applies the retention policy: sessions idle longer than MaxAge are
+// deleted, and sessions over MaxMessages lose their oldest messages. It
+// returns how many sessions were deleted or trimmed.
+func (sm *SessionManager) Prune() (int, error) {
+	sm.mu.Lock()
+	policy := sm.retention
+	sm.lastPrune = time.Now()
+	sm.mu.Unlock()
+
+	if policy.MaxAge <= 0 && policy.MaxMessages <= 0 {
+		return 0, nil
 	}
 
-	return nil
+	infos, err := sm.store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, info := range infos {
+		if policy.MaxAge > 0 && time.Since(info.Updated) > policy.MaxAge {
+			if err := sm.Delete(info.Key); err != nil {
+				return pruned, err
+			}
+			pruned++
+			continue
+		}
+		if policy.MaxMessages > 0 && info.Messages > policy.MaxMessages {
+			if sm.trim(info.Key, policy.MaxMessages) {
+				if err := sm.Save(info.Key); err != nil {
+					return pruned, err
+				}
+				pruned++
+			}
+		}
+	}
+	return pruned, nil
 }
 
-// SetHistory updates the messages of a session.
-func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+// trim drops the oldest messages of a session so at most keep remain,
+// starting at a user message so tool calls keep their results.
+func (sm *SessionManager) trim(key string, keep int) bool {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
-	if ok {
-		// Create a deep copy to strictly isolate internal state
-		// from the caller's slice.
-		msgs := make([]providers.Message, len(history))
-		copy(msgs, history)
-		session.Messages = msgs
-		session.Updated = time.Now()
+	session := sm.get(key)
+	if session == nil || len(session.Messages) <= keep {
+		return false
 	}
+	start := turnStart(session.Messages, len(session.Messages)-keep)
+	session.Messages = append([]Message(nil), session.Messages[start:]...)
+	session.markRewrite()
+	return true
+}
+
+// turnStart returns the index of the first user message at or after from,
+// so history cut there never separates a tool call from its result.
+func turnStart(messages []Message, from int) int {
+	for from < len(messages) && messages[from].Role != "user" {
+		from++
+	}
+	return from
+}
+
+// Close releases the underlying store.
+func (sm *SessionManager) Close() error {
+	return sm.store.Close()
 }
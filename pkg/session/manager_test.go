@@ -1,9 +1,14 @@
 package session
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 func TestSanitizeFilename(t *testing.T) {
@@ -72,3 +77,251 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionManager_LazyLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	sm.AddMessage("telegram:1", "user", "hello")
+	if err := sm.Save("telegram:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	sm2 := NewSessionManager(tmpDir)
+	if len(sm2.sessions) != 0 {
+		t.Fatalf("sessions should not be loaded up front, got %d", len(sm2.sessions))
+	}
+	if got := sm2.GetHistory("telegram:1"); len(got) != 1 {
+		t.Fatalf("history = %v, want 1 message", got)
+	}
+	if len(sm2.sessions) != 1 {
+		t.Errorf("session should be cached after first access")
+	}
+}
+
+func TestSessionManager_EvictsOnlySavedSessions(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	for i := 0; i < maxCachedSessions+10; i++ {
+		key := fmt.Sprintf("s%d", i)
+		sm.AddMessage(key, "user", "hi")
+		if i%2 == 0 {
+			sm.Save(key)
+		}
+	}
+	if len(sm.sessions) > maxCachedSessions {
+		t.Errorf("cache holds %d sessions, want at most %d", len(sm.sessions), maxCachedSessions)
+	}
+	for i := 1; i < maxCachedSessions+10; i += 2 {
+		if _, ok := sm.sessions[fmt.Sprintf("s%d", i)]; !ok {
+			t.Fatalf("unsaved session s%d was evicted", i)
+		}
+	}
+	if got := sm.GetHistory("s0"); len(got) != 1 {
+		t.Errorf("evicted session should reload from the store, got %v", got)
+	}
+}
+
+func TestSessionManager_Retention(t *testing.T) {
+	store, err := NewLogStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := &Session{
+		Key:      "old",
+		Messages: []Message{{Message: providers.Message{Role: "user", Content: "ancient"}}},
+		Updated:  time.Now().Add(-48 * time.Hour),
+	}
+	if err := store.Save(old); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewSessionManagerWithStore(store)
+	for _, m := range []providers.Message{
+		{Role: "user", Content: "1"},
+		{Role: "assistant", Content: "2"},
+		{Role: "user", Content: "3"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "t"}}},
+		{Role: "tool", ToolCallID: "t", Content: "4"},
+		{Role: "user", Content: "5"},
+	} {
+		sm.AddFullMessage("long", m)
+	}
+	sm.Save("long")
+
+	sm.SetRetention(RetentionPolicy{MaxAge: 24 * time.Hour, MaxMessages: 3})
+	pruned, err := sm.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 2 {
+		t.Errorf("pruned = %d, want 2", pruned)
+	}
+	if s, _ := store.Load("old"); s != nil {
+		t.Error("session older than MaxAge should be deleted")
+	}
+
+	// Trimming starts at a user message so the tool call isn't orphaned.
+	reloaded, _ := store.Load("long")
+	if reloaded == nil || len(reloaded.Messages) != 1 || reloaded.Messages[0].Content != "5" {
+		t.Errorf("trimmed history = %+v", reloaded)
+	}
+}
+
+func TestSessionManager_Search(t *testing.T) {
+	for _, kind := range []string{"json", "jsonl"} {
+		t.Run(kind, func(t *testing.T) {
+			store, err := OpenStore(kind, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			sm := NewSessionManagerWithStore(store)
+			sm.AddMessage("a", "user", "Where did I park the car?")
+			sm.AddMessage("a", "assistant", "Level 3 of the car park, next to the blue pillar.")
+			sm.AddMessage("b", "user", "Remind me to buy a new car battery")
+			sm.Save("a")
+			sm.Save("b")
+
+			results, err := sm.Search("CAR park", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("results = %+v, want 2 matches", results)
+			}
+			if results[0].Key != "a" || results[0].Index != 1 || !strings.Contains(results[0].Snippet, "blue pillar") {
+				t.Errorf("best match = %+v", results[0])
+			}
+
+			infos, _ := sm.List()
+			if len(infos) != 2 {
+				t.Errorf("List() = %+v", infos)
+			}
+			if err := sm.Delete("b"); err != nil {
+				t.Fatal(err)
+			}
+			if results, _ := sm.Search("battery", 10); len(results) != 0 {
+				t.Errorf("deleted session still searchable: %+v", results)
+			}
+		})
+	}
+}
+
+func TestSessionManager_Archive(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	if key, err := sm.Archive("chat"); err != nil || key != "" {
+		t.Fatalf("Archive(empty) = %q, %v", key, err)
+	}
+
+	sm.AddMessage("chat", "user", "hello")
+	sm.SetSummary("chat", "a greeting")
+	sm.Save("chat")
+
+	key, err := sm.Archive("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "chat:archived:") {
+		t.Errorf("archive key = %q", key)
+	}
+	if s := sm.Get("chat"); s != nil {
+		t.Errorf("session still present after archive: %+v", s)
+	}
+
+	archived := sm.Get(key)
+	if archived == nil || len(archived.Messages) != 1 || archived.Summary != "a greeting" {
+		t.Fatalf("archived session = %+v", archived)
+	}
+	// Get returns a copy.
+	archived.Messages[0].Content = "changed"
+	if sm.Get(key).Messages[0].Content != "hello" {
+		t.Error("Get exposed the cached session")
+	}
+}
+
+func TestSessionManager_Compact(t *testing.T) {
+	for _, kind := range []string{"json", "jsonl"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := OpenStore(kind, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sm := NewSessionManagerWithStore(store)
+			for _, text := range []string{"one", "two", "three", "four"} {
+				sm.AddMessage("chat", "user", text)
+			}
+			history := sm.GetHistory("chat")
+
+			if sm.Compact("chat", []providers.Message{{Role: "user", Content: "two"}}, "x") {
+				t.Error("Compact accepted messages that are not the history's prefix")
+			}
+			if !sm.Compact("chat", history[:2], "counted to two") {
+				t.Fatal("Compact(first two) = false")
+			}
+			if !sm.Compact("chat", history[2:3], "counted to three") {
+				t.Fatal("Compact(third) = false")
+			}
+			sm.Save("chat")
+
+			reloaded, err := store.Load("chat")
+			if err != nil || reloaded == nil {
+				t.Fatalf("Load() = %v, %v", reloaded, err)
+			}
+			if len(reloaded.Messages) != 1 || reloaded.Messages[0].Content != "four" {
+				t.Errorf("messages = %+v, want only \"four\"", reloaded.Messages)
+			}
+			if reloaded.Summary != "counted to three" || reloaded.Covered() != 3 {
+				t.Errorf("summary = %q covering %d, want \"counted to three\" covering 3", reloaded.Summary, reloaded.Covered())
+			}
+			if len(reloaded.Checkpoints) != 2 || reloaded.Checkpoints[0].Messages != 2 {
+				t.Errorf("checkpoints = %+v", reloaded.Checkpoints)
+			}
+		})
+	}
+}
+
+func TestSessionManager_TruncateKeepsToolPairs(t *testing.T) {
+	sm := NewSessionManager("")
+	sm.AddMessage("chat", "user", "list files")
+	sm.AddFullMessage("chat", providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1", Name: "list_dir"}}})
+	sm.AddFullMessage("chat", providers.Message{Role: "tool", Content: "a.txt", ToolCallID: "1"})
+	sm.AddMessage("chat", "assistant", "a.txt")
+	sm.AddMessage("chat", "user", "thanks")
+	sm.AddMessage("chat", "assistant", "welcome")
+
+	// The last 5 messages start with the tool call; the cut moves to the next turn.
+	sm.TruncateHistory("chat", 5)
+	history := sm.GetHistory("chat")
+	if len(history) != 2 || history[0].Content != "thanks" {
+		t.Errorf("history = %+v, want the last turn", history)
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	s := &Session{
+		Key:     "telegram:42",
+		Summary: "Talked about the weather.",
+		Messages: []Message{
+			{Message: providers.Message{Role: "user", Content: "Will it rain?"}},
+			{Message: providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{
+				ID:       "1",
+				Function: &providers.FunctionCall{Name: "web_search", Arguments: `{"query":"rain"}`},
+			}}}},
+			{Message: providers.Message{Role: "tool", Content: "80% chance", ToolCallID: "1"}},
+			{Message: providers.Message{Role: "assistant", Content: "Probably, take an umbrella."}},
+		},
+	}
+
+	md := ExportMarkdown(s)
+	for _, want := range []string{
+		"# Session telegram:42",
+		"## Summary\n\nTalked about the weather.",
+		"### User\n\nWill it rain?",
+		"- Called `web_search` with `{\"query\":\"rain\"}`",
+		"### Tool result\n\n```\n80% chance\n```",
+		"### Assistant\n\nProbably, take an umbrella.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, md)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the session tables. Messages are rows of their own,
+// so a turn inserts just its new messages, and messages_fts indexes their
+// content for Search. The trigram tokenizer matches substrings, as the file
+// stores do, in any script.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	key         TEXT PRIMARY KEY,
+	summary     TEXT NOT NULL DEFAULT '',
+	checkpoints TEXT NOT NULL DEFAULT '',
+	created     INTEGER NOT NULL DEFAULT 0,
+	updated     INTEGER NOT NULL DEFAULT 0,
+	turns       INTEGER NOT NULL DEFAULT 0,
+	parent      TEXT NOT NULL DEFAULT '',
+	fork_turn   INTEGER NOT NULL DEFAULT 0,
+	active      TEXT NOT NULL DEFAULT '',
+	messages    INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS messages (
+	id      INTEGER PRIMARY KEY,
+	session TEXT NOT NULL,
+	idx     INTEGER NOT NULL,
+	role    TEXT NOT NULL,
+	content TEXT NOT NULL,
+	data    TEXT NOT NULL,
+	UNIQUE (session, idx)
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+	content, content='messages', content_rowid='id', tokenize='trigram'
+);
+CREATE TRIGGER IF NOT EXISTS messages_ai AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_ad AFTER DELETE ON messages BEGIN
+	INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+`
+
+// SQLiteStore keeps every session in one SQLite database, sessions.db in
+// its dir. A turn inserts only its new messages; a session is rewritten
+// only when history is replaced, such as after summarization or pruning.
+// Sessions are read one key at a time, and Search uses a full-text index
+// instead of reading every session.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens or creates dir/sessions.db. Sessions left behind by
+// the JSON and JSONL stores are imported once and their files renamed to
+// *.migrated.
+func NewSQLiteStore(dir string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + filepath.Join(dir, "sessions.db") +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers, which SQLite would otherwise make
+	// wait on its file lock.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &SQLiteStore{db: db}
+	s.migrateFiles(dir)
+	return s, nil
+}
+
+func (s *SQLiteStore) Load(key string) (*Session, error) {
+	session := &Session{Key: key, Messages: []Message{}}
+	var checkpoints string
+	var created, updated int64
+	err := s.db.QueryRow(`SELECT summary, checkpoints, created, updated, turns, parent, fork_turn, active
+		FROM sessions WHERE key = ?`, key).
+		Scan(&session.Summary, &checkpoints, &created, &updated, &session.Turns,
+			&session.Parent, &session.ForkTurn, &session.Active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.Created, session.Updated = fromUnixNano(created), fromUnixNano(updated)
+	if checkpoints != "" {
+		if err := json.Unmarshal([]byte(checkpoints), &session.Checkpoints); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.db.Query(`SELECT data FROM messages WHERE session = ? ORDER BY idx`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var m Message
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return nil, err
+		}
+		session.Messages = append(session.Messages, m)
+	}
+	return session, rows.Err()
+}
+
+// Append inserts the messages from index from on. If the database does not
+// hold exactly the first from messages, the session is rewritten instead.
+func (s *SQLiteStore) Append(session *Session, from int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored int
+	err = tx.QueryRow(`SELECT messages FROM sessions WHERE key = ?`, session.Key).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && stored != from) || from <= 0 {
+		if err := writeSession(tx, session); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := putSession(tx, session); err != nil {
+		return err
+	}
+	if err := insertMessages(tx, session.Key, session.Messages, from); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Save(session *Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := writeSession(tx, session); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Delete(key string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session = ?`, key); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE key = ?`, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// List answers from the sessions table without reading any messages.
+func (s *SQLiteStore) List() ([]Info, error) {
+	rows, err := s.db.Query(`SELECT key, messages, summary != '', created, updated
+		FROM sessions ORDER BY updated DESC, key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infos []Info
+	for rows.Next() {
+		var info Info
+		var created, updated int64
+		if err := rows.Scan(&info.Key, &info.Messages, &info.Summary, &created, &updated); err != nil {
+			return nil, err
+		}
+		info.Created, info.Updated = fromUnixNano(created), fromUnixNano(updated)
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// Search narrows the messages with the full-text index, then scores them
+// the same way the file stores do. Terms shorter than a trigram can't use
+// the index; a query made only of those scans every message.
+func (s *SQLiteStore) Search(query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	q := `SELECT m.session, m.idx, m.role, m.content, s.updated
+		FROM messages m JOIN sessions s ON s.key = m.session
+		WHERE m.content != ''`
+	var args []interface{}
+	var match []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= 3 {
+			match = append(match, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		}
+	}
+	if len(match) > 0 {
+		q += ` AND m.id IN (SELECT rowid FROM messages_fts WHERE messages_fts MATCH ?)`
+		args = append(args, strings.Join(match, " AND "))
+	}
+
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var key, role, content string
+		var index int
+		var updated int64
+		if err := rows.Scan(&key, &index, &role, &content, &updated); err != nil {
+			return nil, err
+		}
+		if result, ok := matchMessage(content, terms); ok {
+			result.Key, result.Index, result.Role, result.Updated = key, index, role, fromUnixNano(updated)
+			results = append(results, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rankResults(results, limit), nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// writeSession replaces the stored session and all its messages.
+func writeSession(tx *sql.Tx, session *Session) error {
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session = ?`, session.Key); err != nil {
+		return err
+	}
+	if err := putSession(tx, session); err != nil {
+		return err
+	}
+	return insertMessages(tx, session.Key, session.Messages, 0)
+}
+
+// putSession upserts the session row.
+func putSession(tx *sql.Tx, session *Session) error {
+	var checkpoints []byte
+	if len(session.Checkpoints) > 0 {
+		var err error
+		if checkpoints, err = json.Marshal(session.Checkpoints); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`INSERT INTO sessions
+		(key, summary, checkpoints, created, updated, turns, parent, fork_turn, active, messages)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			summary = excluded.summary, checkpoints = excluded.checkpoints,
+			created = excluded.created, updated = excluded.updated, turns = excluded.turns,
+			parent = excluded.parent, fork_turn = excluded.fork_turn, active = excluded.active,
+			messages = excluded.messages`,
+		session.Key, session.Summary, string(checkpoints),
+		unixNano(session.Created), unixNano(session.Updated), session.Turns,
+		session.Parent, session.ForkTurn, session.Active, len(session.Messages))
+	return err
+}
+
+// insertMessages inserts messages[from:].
+func insertMessages(tx *sql.Tx, key string, messages []Message, from int) error {
+	if from >= len(messages) {
+		return nil
+	}
+	stmt, err := tx.Prepare(`INSERT INTO messages (session, idx, role, content, data) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := from; i < len(messages); i++ {
+		data, err := json.Marshal(messages[i])
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(key, i, messages[i].Role, messages[i].Content, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateFiles imports sessions saved by the JSON and JSONL stores.
+func (s *SQLiteStore) migrateFiles(dir string) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		var read func(string) (*Session, error)
+		switch filepath.Ext(file.Name()) {
+		case ".json":
+			read = readJSONSession
+		case ".jsonl":
+			read = readLog
+		default:
+			continue
+		}
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		session, err := read(path)
+		if err != nil {
+			continue
+		}
+		if existing, err := s.Load(session.Key); err != nil || existing != nil {
+			continue
+		}
+		if err := s.Save(session); err != nil {
+			logger.WarnCF("session", "Failed to migrate session file", map[string]interface{}{
+				"key":   session.Key,
+				"error": err.Error(),
+			})
+			continue
+		}
+		os.Rename(path, path+".migrated")
+	}
+}
+
+// unixNano stores t as nanoseconds since the epoch, with 0 for the zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
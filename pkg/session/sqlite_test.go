@@ -0,0 +1,172 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func messageIDs(t *testing.T, store *SQLiteStore, key string) []int64 {
+	t.Helper()
+	rows, err := store.db.Query(`SELECT id FROM messages WHERE session = ? ORDER BY idx`, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestSQLiteStore_AppendsOnlyNewMessages(t *testing.T) {
+	store, err := NewSQLiteStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sm := NewSessionManagerWithStore(store)
+
+	key := "telegram:42"
+	sm.AddMessage(key, "user", "one")
+	sm.AddMessage(key, "assistant", "two")
+	sm.Save(key)
+	before := messageIDs(t, store, key)
+
+	sm.AddMessage(key, "user", "three")
+	sm.Save(key)
+	after := messageIDs(t, store, key)
+	if len(after) != 3 || !reflect.DeepEqual(after[:2], before) {
+		t.Fatalf("message rows %v -> %v, want the first two untouched", before, after)
+	}
+
+	// A summary replaces history, so the session is rewritten.
+	sm.SetSummary(key, "counting")
+	sm.TruncateHistory(key, 1)
+	sm.Save(key)
+	reloaded, err := store.Load(key)
+	if err != nil || reloaded == nil {
+		t.Fatalf("Load() = %v, %v", reloaded, err)
+	}
+	if reloaded.Summary != "counting" || len(reloaded.Messages) != 1 || reloaded.Messages[0].Content != "three" || reloaded.Messages[0].Turn != 2 {
+		t.Errorf("reloaded = %+v", reloaded)
+	}
+	if results, _ := store.Search("one", 10); len(results) != 0 {
+		t.Errorf("rewritten messages still searchable: %+v", results)
+	}
+}
+
+func TestSQLiteStore_LoadsOneKey(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewSQLiteStore(dir)
+	sm := NewSessionManagerWithStore(store)
+	sm.AddMessage("slack:1", "user", "first")
+	sm.AddMessage("slack:2", "user", "second")
+	sm.Save("slack:1")
+	sm.Save("slack:2")
+	store.Close()
+
+	reopened, err := NewSQLiteStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	session, err := reopened.Load("slack:2")
+	if err != nil || session == nil || len(session.Messages) != 1 || session.Messages[0].Content != "second" {
+		t.Fatalf("Load(slack:2) = %+v, %v", session, err)
+	}
+	if missing, err := reopened.Load("slack:3"); missing != nil || err != nil {
+		t.Errorf("Load(missing) = %+v, %v", missing, err)
+	}
+	infos, _ := reopened.List()
+	if len(infos) != 2 || infos[0].Messages != 1 {
+		t.Errorf("List() = %+v", infos)
+	}
+}
+
+func TestSQLiteStore_Search(t *testing.T) {
+	store, _ := NewSQLiteStore(t.TempDir())
+	defer store.Close()
+	sm := NewSessionManagerWithStore(store)
+	sm.AddMessage("telegram:1", "user", "Deploy the backend to staging")
+	sm.AddMessage("telegram:1", "assistant", "Deployed backend; staging backend is up")
+	sm.AddMessage("discord:2", "user", "今天部署到服务器")
+	sm.AddMessage("discord:2", "user", "go to bed")
+	sm.Save("telegram:1")
+	sm.Save("discord:2")
+
+	results, err := store.Search("BACKEND staging", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Index != 1 || results[0].Score != 3 || results[0].Role != "assistant" {
+		t.Errorf("Search(backend staging) = %+v", results)
+	}
+	if results, _ := store.Search("部署", 10); len(results) != 1 || results[0].Key != "discord:2" {
+		t.Errorf("Search(cjk) = %+v", results)
+	}
+	// Too short for the trigram index, so the messages are scanned.
+	if results, _ := store.Search("go", 10); len(results) != 1 || results[0].Snippet != "go to bed" {
+		t.Errorf("Search(go) = %+v", results)
+	}
+	if results, _ := store.Search(`"quoted" AND`, 10); len(results) != 0 {
+		t.Errorf("Search(fts syntax) = %+v", results)
+	}
+}
+
+func TestSQLiteStore_Retention(t *testing.T) {
+	store, _ := NewSQLiteStore(t.TempDir())
+	defer store.Close()
+	store.Save(&Session{Key: "old", Updated: time.Now().Add(-48 * time.Hour)})
+	sm := NewSessionManagerWithStore(store)
+	for i := 0; i < 3; i++ {
+		sm.AddMessage("busy", "user", "question")
+		sm.AddMessage("busy", "assistant", "answer")
+	}
+	sm.Save("busy")
+
+	sm.SetRetention(RetentionPolicy{MaxAge: 24 * time.Hour, MaxMessages: 2})
+	if n, err := sm.Prune(); n != 2 || err != nil {
+		t.Fatalf("Prune() = %d, %v", n, err)
+	}
+	infos, _ := store.List()
+	if len(infos) != 1 || infos[0].Key != "busy" || infos[0].Messages != 2 {
+		t.Errorf("List() after pruning = %+v", infos)
+	}
+	if ids := messageIDs(t, store, "busy"); len(ids) != 2 {
+		t.Errorf("busy has %d message rows, want 2", len(ids))
+	}
+}
+
+func TestSQLiteStore_MigratesFiles(t *testing.T) {
+	dir := t.TempDir()
+	legacy := NewSessionManager(dir)
+	legacy.AddMessage("discord:7", "user", "from json")
+	legacy.Save("discord:7")
+	logs, _ := NewLogStore(filepath.Join(dir, "logs"))
+	logs.Save(&Session{Key: "slack:8", Messages: []Message{{Turn: 1}}})
+	os.Rename(filepath.Join(dir, "logs", "slack_8.jsonl"), filepath.Join(dir, "slack_8.jsonl"))
+
+	store, err := OpenStore("sqlite", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	session, _ := store.Load("discord:7")
+	if session == nil || len(session.Messages) != 1 || session.Messages[0].Content != "from json" {
+		t.Fatalf("migrated session = %+v", session)
+	}
+	if session, _ := store.Load("slack:8"); session == nil || len(session.Messages) != 1 {
+		t.Fatalf("migrated log = %+v", session)
+	}
+	for _, name := range []string{"discord_7.json.migrated", "slack_8.jsonl.migrated"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("file should be renamed after migration: %v", err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store persists sessions for a SessionManager. The manager caches the
+// sessions in use and calls Load the first time a key is touched, so a
+// store never has to hold every session in memory.
+type Store interface {
+	// Load returns the session stored under key, or nil if there is none.
+	Load(key string) (*Session, error)
+	// Append persists s, of which the first from messages are already
+	// stored. Append-only stores write just the new tail.
+	Append(s *Session, from int) error
+	// Save replaces whatever is stored under s.Key with s.
+	Save(s *Session) error
+	Delete(key string) error
+	// List describes every stored session. Stores answer from an index
+	// rather than by reading the sessions.
+	List() ([]Info, error)
+	// Search returns up to limit messages containing every term of query,
+	// best matches first.
+	Search(query string, limit int) ([]SearchResult, error)
+	Close() error
+}
+
+// Info describes a stored session without its messages.
+type Info struct {
+	Key      string    `json:"key"`
+	Messages int       `json:"messages"`
+	Summary  bool      `json:"summary"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// SearchResult is a message matching a search query.
+type SearchResult struct {
+	Key     string    `json:"key"`
+	Index   int       `json:"index"` // Position of the message in the session
+	Role    string    `json:"role"`
+	Snippet string    `json:"snippet"`
+	Score   int       `json:"score"`
+	Updated time.Time `json:"updated"`
+}
+
+// RetentionPolicy bounds what a SessionManager keeps. Zero values disable
+// the corresponding limit.
+type RetentionPolicy struct {
+	MaxAge      time.Duration // Sessions not updated for this long are deleted
+	MaxMessages int           // Older messages beyond this count are dropped
+}
+
+// OpenStore opens the session store of the given kind in dir. Supported
+// kinds are "json" (the default; one JSON file per session, rewritten on
+// every save), "jsonl" (append-only log per session), "sqlite" (one
+// database for all sessions, with a full-text index) and "memory" (nothing
+// written; dir is not touched).
+func OpenStore(kind, dir string) (Store, error) {
+	switch kind {
+	case "", "json":
+		return NewJSONStore(dir), nil
+	case "memory":
+		return NewJSONStore(""), nil
+	case "jsonl":
+		return NewLogStore(dir)
+	case "sqlite":
+		return NewSQLiteStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown session store %q", kind)
+	}
+}
+
+// sanitizeFilename converts a session key into a cross-platform safe filename.
+// Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
+// volume separator on Windows, so filepath.Base would misinterpret the key.
+// We replace it with '_'. The original key is preserved inside the file,
+// so loading still maps back to the right key.
+func sanitizeFilename(key string) string {
+	return strings.ReplaceAll(key, ":", "_")
+}
+
+// sessionPath returns the file a session is stored in, rejecting keys that
+// would escape dir.
+func sessionPath(dir, key, ext string) (string, error) {
+	filename := sanitizeFilename(key)
+
+	// filepath.IsLocal rejects empty names, "..", absolute paths, and
+	// OS-reserved device names (NUL, COM1 … on Windows).
+	// The extra checks reject "." and any directory separators so that
+	// the session file is always written directly inside dir.
+	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
+		return "", os.ErrInvalid
+	}
+	return filepath.Join(dir, filename+ext), nil
+}
+
+// writeFileAtomic replaces path with data via a synced temp file.
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "session-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmpFile.Name()
+	cleanup := true
+	defer func() {
+		if cleanup {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	cleanup = false
+	return nil
+}
+
+// searchTerms splits a query into lowercase terms.
+func searchTerms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// matchMessages scores each message of a session against terms. A message
+// matches when it contains every term; its score is the total number of
+// occurrences.
+func matchMessages(key string, updated time.Time, messages []Message, terms []string) []SearchResult {
+	if len(terms) == 0 {
+		return nil
+	}
+	var results []SearchResult
+	for i, m := range messages {
+		if result, ok := matchMessage(m.Content, terms); ok {
+			result.Key, result.Index, result.Role, result.Updated = key, i, m.Role, updated
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// matchMessage scores content against terms, filling in the snippet and
+// score of a result.
+func matchMessage(content string, terms []string) (SearchResult, bool) {
+	if content == "" || len(terms) == 0 {
+		return SearchResult{}, false
+	}
+	lower := strings.ToLower(content)
+	score := 0
+	for _, term := range terms {
+		n := strings.Count(lower, term)
+		if n == 0 {
+			return SearchResult{}, false
+		}
+		score += n
+	}
+	return SearchResult{Snippet: snippet(content, strings.Index(lower, terms[0])), Score: score}, true
+}
+
+// rankResults orders results by score, then recency, and applies limit.
+func rankResults(results []SearchResult, limit int) []SearchResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if !results[i].Updated.Equal(results[j].Updated) {
+			return results[i].Updated.After(results[j].Updated)
+		}
+		return results[i].Index > results[j].Index
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// snippet returns about 160 characters of content around byte offset at.
+func snippet(content string, at int) string {
+	const before, width = 60, 160
+	runes := []rune(content)
+	start := len([]rune(content[:max(at, 0)])) - before
+	start = max(start, 0)
+	end := min(start+width, len(runes))
+	s := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(runes) {
+		s += "…"
+	}
+	return s
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -26,10 +27,11 @@ type SkillMetadata struct {
 }
 
 type SkillInfo struct {
-	Name        string `json:"name"`
-	Path        string `json:"path"`
-	Source      string `json:"source"`
-	Description string `json:"description"`
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Source      string   `json:"source"`
+	Description string   `json:"description"`
+	Shadows     []string `json:"shadows,omitempty"` // Sources of same-named skills this one overrides
 }
 
 func (info SkillInfo) validate() error {
@@ -55,9 +57,10 @@ func (info SkillInfo) validate() error {
 
 type SkillsLoader struct {
 	workspace       string
-	workspaceSkills string // workspace skills (项目级别)
-	globalSkills    string // 全局 skills (~/.picoclaw/skills)
-	builtinSkills   string // 内置 skills
+	workspaceSkills string   // workspace skills (项目级别)
+	globalSkills    string   // 全局 skills (~/.picoclaw/skills)
+	builtinSkills   string   // 内置 skills
+	filter          []string // Names or glob patterns of the skills offered; nil offers all
 }
 
 func NewSkillsLoader(workspace string, globalSkills string, builtinSkills string) *SkillsLoader {
@@ -69,143 +72,120 @@ func NewSkillsLoader(workspace string, globalSkills string, builtinSkills string
 	}
 }
 
-func (sl *SkillsLoader) ListSkills() []SkillInfo {
-	skills := make([]SkillInfo, 0)
+// SetFilter limits the skills offered by AvailableSkills, LoadSkill and
+// BuildSkillsSummary to those whose names match one of patterns, such as
+// "weather" or "github-*". nil offers every skill; an empty list none.
+func (sl *SkillsLoader) SetFilter(patterns []string) {
+	sl.filter = patterns
+}
 
-	if sl.workspaceSkills != "" {
-		if dirs, err := os.ReadDir(sl.workspaceSkills); err == nil {
-			for _, dir := range dirs {
-				if dir.IsDir() {
-					skillFile := filepath.Join(sl.workspaceSkills, dir.Name(), "SKILL.md")
-					if _, err := os.Stat(skillFile); err == nil {
-						info := SkillInfo{
-							Name:   dir.Name(),
-							Path:   skillFile,
-							Source: "workspace",
-						}
-						metadata := sl.getSkillMetadata(skillFile)
-						if metadata != nil {
-							info.Description = metadata.Description
-							info.Name = metadata.Name
-						}
-						if err := info.validate(); err != nil {
-							slog.Warn("invalid skill from workspace", "name", info.Name, "error", err)
-							continue
-						}
-						skills = append(skills, info)
-					}
-				}
-			}
-		}
+// Allowed reports whether the filter offers a skill of that name.
+func (sl *SkillsLoader) Allowed(name string) bool {
+	if sl.filter == nil {
+		return true
 	}
-
-	// 全局 skills (~/.picoclaw/skills) - 被 workspace skills 覆盖
-	if sl.globalSkills != "" {
-		if dirs, err := os.ReadDir(sl.globalSkills); err == nil {
-			for _, dir := range dirs {
-				if dir.IsDir() {
-					skillFile := filepath.Join(sl.globalSkills, dir.Name(), "SKILL.md")
-					if _, err := os.Stat(skillFile); err == nil {
-						// 检查是否已被 workspace skills 覆盖
-						exists := false
-						for _, s := range skills {
-							if s.Name == dir.Name() && s.Source == "workspace" {
-								exists = true
-								break
-							}
-						}
-						if exists {
-							continue
-						}
-
-						info := SkillInfo{
-							Name:   dir.Name(),
-							Path:   skillFile,
-							Source: "global",
-						}
-						metadata := sl.getSkillMetadata(skillFile)
-						if metadata != nil {
-							info.Description = metadata.Description
-							info.Name = metadata.Name
-						}
-						if err := info.validate(); err != nil {
-							slog.Warn("invalid skill from global", "name", info.Name, "error", err)
-							continue
-						}
-						skills = append(skills, info)
-					}
-				}
-			}
+	for _, pattern := range sl.filter {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
 		}
 	}
+	return false
+}
 
-	if sl.builtinSkills != "" {
-		if dirs, err := os.ReadDir(sl.builtinSkills); err == nil {
-			for _, dir := range dirs {
-				if dir.IsDir() {
-					skillFile := filepath.Join(sl.builtinSkills, dir.Name(), "SKILL.md")
-					if _, err := os.Stat(skillFile); err == nil {
-						// 检查是否已被 workspace 或 global skills 覆盖
-						exists := false
-						for _, s := range skills {
-							if s.Name == dir.Name() && (s.Source == "workspace" || s.Source == "global") {
-								exists = true
-								break
-							}
-						}
-						if exists {
-							continue
-						}
-
-						info := SkillInfo{
-							Name:   dir.Name(),
-							Path:   skillFile,
-							Source: "builtin",
-						}
-						metadata := sl.getSkillMetadata(skillFile)
-						if metadata != nil {
-							info.Description = metadata.Description
-							info.Name = metadata.Name
-						}
-						if err := info.validate(); err != nil {
-							slog.Warn("invalid skill from builtin", "name", info.Name, "error", err)
-							continue
-						}
-						skills = append(skills, info)
-					}
+// ListSkills returns every installed skill, whether or not the filter
+// offers it. When skills of the same name exist in several places, the
+// workspace skill overrides the global one, which overrides the builtin
+// one; only the overriding skill is listed, with the sources it shadows.
+func (sl *SkillsLoader) ListSkills() []SkillInfo {
+	skills := make([]SkillInfo, 0)
+	byName := make(map[string]int)
+
+	for _, dir := range []struct{ path, source string }{
+		{sl.workspaceSkills, "workspace"},
+		{sl.globalSkills, "global"},
+		{sl.builtinSkills, "builtin"},
+	} {
+		for _, info := range sl.scan(dir.path, dir.source) {
+			if i, ok := byName[info.Name]; ok {
+				if skills[i].Source == info.Source {
+					slog.Warn("duplicate skill name", "name", info.Name, "source", info.Source, "path", info.Path)
+				} else {
+					skills[i].Shadows = append(skills[i].Shadows, info.Source)
 				}
+				continue
 			}
+			byName[info.Name] = len(skills)
+			skills = append(skills, info)
 		}
 	}
 
 	return skills
 }
 
-func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
-	// 1. 优先从 workspace skills 加载（项目级别）
-	if sl.workspaceSkills != "" {
-		skillFile := filepath.Join(sl.workspaceSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
+// AvailableSkills returns the skills of ListSkills the filter offers.
+func (sl *SkillsLoader) AvailableSkills() []SkillInfo {
+	var available []SkillInfo
+	for _, info := range sl.ListSkills() {
+		if sl.Allowed(info.Name) {
+			available = append(available, info)
 		}
 	}
+	return available
+}
 
-	// 2. 其次从全局 skills 加载 (~/.picoclaw/skills)
-	if sl.globalSkills != "" {
-		skillFile := filepath.Join(sl.globalSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
-		}
+// scan returns the valid skills in dir, one per subdirectory holding a
+// SKILL.md, named by its frontmatter or else by the subdirectory.
+func (sl *SkillsLoader) scan(dir, source string) []SkillInfo {
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
 	}
 
-	// 3. 最后从内置 skills 加载
-	if sl.builtinSkills != "" {
-		skillFile := filepath.Join(sl.builtinSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
+	var skills []SkillInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
 		}
+		skillFile := filepath.Join(dir, entry.Name(), "SKILL.md")
+		if _, err := os.Stat(skillFile); err != nil {
+			continue
+		}
+		info := SkillInfo{
+			Name:   entry.Name(),
+			Path:   skillFile,
+			Source: source,
+		}
+		metadata := sl.getSkillMetadata(skillFile)
+		if metadata != nil {
+			info.Description = metadata.Description
+			info.Name = metadata.Name
+		}
+		if err := info.validate(); err != nil {
+			slog.Warn("invalid skill from "+source, "name", info.Name, "error", err)
+			continue
+		}
+		skills = append(skills, info)
 	}
+	return skills
+}
 
+// LoadSkill returns the content of the named skill, without frontmatter,
+// following the precedence of ListSkills. Skills the filter does not offer
+// are not found.
+func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
+	for _, info := range sl.AvailableSkills() {
+		if info.Name != name {
+			continue
+		}
+		content, err := os.ReadFile(info.Path)
+		if err != nil {
+			return "", false
+		}
+		return sl.stripFrontmatter(string(content)), true
+	}
 	return "", false
 }
 
@@ -225,8 +205,10 @@ func (sl *SkillsLoader) LoadSkillsForContext(skillNames []string) string {
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
+// BuildSkillsSummary lists the skills the filter offers for the system
+// prompt.
 func (sl *SkillsLoader) BuildSkillsSummary() string {
-	allSkills := sl.ListSkills()
+	allSkills := sl.AvailableSkills()
 	if len(allSkills) == 0 {
 		return ""
 	}
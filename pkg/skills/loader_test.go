@@ -1,6 +1,8 @@
 package skills
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -177,3 +179,77 @@ func TestStripFrontmatter(t *testing.T) {
 		})
 	}
 }
+
+func writeSkill(t *testing.T, root, dir, name, description string) {
+	t.Helper()
+	path := filepath.Join(root, dir, "SKILL.md")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "---\nname: " + name + "\ndescription: " + description + "\n---\n\n# " + name + " from " + root
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListSkills_Precedence(t *testing.T) {
+	workspace, global, builtin := t.TempDir(), t.TempDir(), t.TempDir()
+	writeSkill(t, filepath.Join(workspace, "skills"), "weather", "weather", "Local forecasts")
+	writeSkill(t, global, "weather", "weather", "Forecasts")
+	writeSkill(t, global, "gh", "github", "GitHub access")
+	writeSkill(t, builtin, "github", "github", "Builtin GitHub access")
+	writeSkill(t, builtin, "weather", "weather", "Builtin forecasts")
+	writeSkill(t, builtin, "summarize", "summarize", "Summaries")
+
+	loader := NewSkillsLoader(workspace, global, builtin)
+	skills := loader.ListSkills()
+	if assert.Len(t, skills, 3) {
+		assert.Equal(t, SkillInfo{
+			Name:        "weather",
+			Path:        filepath.Join(workspace, "skills", "weather", "SKILL.md"),
+			Source:      "workspace",
+			Description: "Local forecasts",
+			Shadows:     []string{"global", "builtin"},
+		}, skills[0])
+		// Shadowing goes by the skill's name, not its directory.
+		assert.Equal(t, "github", skills[1].Name)
+		assert.Equal(t, "global", skills[1].Source)
+		assert.Equal(t, []string{"builtin"}, skills[1].Shadows)
+		assert.Equal(t, "summarize", skills[2].Name)
+		assert.Empty(t, skills[2].Shadows)
+	}
+
+	content, ok := loader.LoadSkill("github")
+	assert.True(t, ok)
+	assert.Equal(t, "# github from "+global, content)
+}
+
+func TestSkillsLoader_Filter(t *testing.T) {
+	workspace, builtin := t.TempDir(), t.TempDir()
+	writeSkill(t, builtin, "github", "github", "GitHub access")
+	writeSkill(t, builtin, "github-actions", "github-actions", "CI runs")
+	writeSkill(t, builtin, "weather", "weather", "Forecasts")
+	writeSkill(t, builtin, "tmux", "tmux", "Terminal sessions")
+	loader := NewSkillsLoader(workspace, "", builtin)
+
+	names := func() []string {
+		var names []string
+		for _, s := range loader.AvailableSkills() {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"github", "github-actions", "tmux", "weather"}, names())
+
+	loader.SetFilter([]string{"github*", "weather", "missing"})
+	assert.Equal(t, []string{"github", "github-actions", "weather"}, names())
+	assert.Len(t, loader.ListSkills(), 4)
+	assert.NotContains(t, loader.BuildSkillsSummary(), "tmux")
+	_, ok := loader.LoadSkill("tmux")
+	assert.False(t, ok)
+
+	loader.SetFilter([]string{})
+	assert.Empty(t, names())
+	assert.Empty(t, loader.BuildSkillsSummary())
+}
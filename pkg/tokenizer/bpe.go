@@ -0,0 +1,222 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BPE is a byte-level BPE tokenizer compatible with tiktoken encodings. Text
+// is split with the cl100k_base pre-tokenization rules, then each piece is
+// merged by rank.
+type BPE struct {
+	name  string
+	ranks map[string]int
+}
+
+// NewBPE returns a tokenizer over ranks, the token bytes -> rank table of a
+// tiktoken vocabulary.
+func NewBPE(name string, ranks map[string]int) *BPE {
+	return &BPE{name: name, ranks: ranks}
+}
+
+// LoadRanks parses a .tiktoken file: one "<base64 token> <rank>" per line.
+func LoadRanks(r io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want \"<token> <rank>\"", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("empty vocabulary")
+	}
+	return ranks, nil
+}
+
+func (t *BPE) Name() string {
+	return t.name
+}
+
+// Count returns the number of tokens in text.
+func (t *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range splitPieces(text) {
+		if _, ok := t.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += len(t.merge(piece))
+	}
+	return n
+}
+
+// Encode returns the token ranks of text. Bytes missing from the vocabulary
+// are encoded as -1.
+func (t *BPE) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range splitPieces(text) {
+		if rank, ok := t.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		for _, part := range t.merge(piece) {
+			rank, ok := t.ranks[part]
+			if !ok {
+				rank = -1
+			}
+			tokens = append(tokens, rank)
+		}
+	}
+	return tokens
+}
+
+// merge splits piece into vocabulary tokens, repeatedly joining the adjacent
+// pair with the lowest rank, as tiktoken does.
+func (t *BPE) merge(piece string) []string {
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+
+	for len(parts) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := t.ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+// splitPieces pre-tokenizes text like the cl100k_base pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// Go's regexp has no lookahead, so the alternatives are matched by hand.
+func splitPieces(text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		n := matchPiece(text[i:])
+		pieces = append(pieces, text[i:i+n])
+		i += n
+	}
+	return pieces
+}
+
+// matchPiece returns the length in bytes of the piece at the start of s.
+func matchPiece(s string) int {
+	c0, w0 := utf8.DecodeRuneInString(s)
+	c1, w1 := utf8.DecodeRuneInString(s[w0:])
+	if w1 == 0 {
+		c1 = utf8.RuneError
+	}
+
+	// 's 't 're 've 'm 'll 'd
+	if c0 == '\'' {
+		lower := strings.ToLower(s[1:min(len(s), 3)])
+		for _, suffix := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+			if strings.HasPrefix(lower, suffix) {
+				return 1 + len(suffix)
+			}
+		}
+	}
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if unicode.IsLetter(c0) {
+		return w0 + spanOf(s[w0:], unicode.IsLetter)
+	}
+	if w1 > 0 && !isNewline(c0) && !unicode.IsNumber(c0) && unicode.IsLetter(c1) {
+		return w0 + w1 + spanOf(s[w0+w1:], unicode.IsLetter)
+	}
+
+	// \p{N}{1,3}
+	if unicode.IsNumber(c0) {
+		n := 0
+		for count := 0; count < 3 && n < len(s); count++ {
+			r, w := utf8.DecodeRuneInString(s[n:])
+			if !unicode.IsNumber(r) {
+				break
+			}
+			n += w
+		}
+		return n
+	}
+
+	// ' ?[^\s\p{L}\p{N}]+[\r\n]*'
+	start := 0
+	if c0 == ' ' && w1 > 0 && isPunct(c1) {
+		start = w0
+	}
+	if n := spanOf(s[start:], isPunct); n > 0 {
+		n += start
+		return n + spanOf(s[n:], isNewline)
+	}
+
+	// Whitespace: \s*[\r\n]+, then \s+(?!\S), then \s+
+	run := spanOf(s, unicode.IsSpace)
+	if run == 0 {
+		// Not reachable for valid categories; consume one rune regardless.
+		return w0
+	}
+	if last := strings.LastIndexAny(s[:run], "\r\n"); last >= 0 {
+		return last + 1
+	}
+	if run < len(s) {
+		_, lastWidth := utf8.DecodeLastRuneInString(s[:run])
+		if run-lastWidth > 0 {
+			return run - lastWidth
+		}
+	}
+	return run
+}
+
+// spanOf returns the length in bytes of the prefix of s whose runes match f.
+func spanOf(s string, f func(rune) bool) int {
+	for i, r := range s {
+		if !f(r) {
+			return i
+		}
+	}
+	return len(s)
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
@@ -0,0 +1,29 @@
+package tokenizer
+
+import "unicode"
+
+// heuristic estimates tokens when no vocabulary is available. English text
+// averages about four characters per token, but code, JSON and numbers run
+// much shorter, so ASCII is counted at 2.5 characters per token to err on
+// the side of overestimating. CJK ideographs and kana are usually a token
+// each, and other non-ASCII letters about two runes per token.
+type heuristic struct{}
+
+func (heuristic) Name() string {
+	return Heuristic
+}
+
+func (heuristic) Count(text string) int {
+	ascii, cjk, other := 0, 0, 0
+	for _, r := range text {
+		switch {
+		case r < 0x80:
+			ascii++
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			cjk++
+		default:
+			other++
+		}
+	}
+	return (ascii*2+4)/5 + cjk + (other+1)/2
+}
@@ -0,0 +1,94 @@
+// Package tokenizer counts tokens the way model providers bill them, so the
+// agent can budget its context window before sending a request.
+package tokenizer
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Encoding names accepted in model_list "tokenizer".
+const (
+	CL100K    = "cl100k_base"
+	Heuristic = "heuristic"
+)
+
+// Tokenizer counts the tokens in a piece of text.
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// vocabFS holds the vocabularies shipped in vocab/, as <encoding>.tiktoken
+// files. cl100k_base is always present.
+//
+//go:embed vocab
+var vocabFS embed.FS
+
+var (
+	loadMu sync.Mutex
+	loaded = map[string]Tokenizer{}
+)
+
+// ForName returns the tokenizer for an encoding name. BPE vocabularies are
+// read from the embedded vocab/ dir, then ~/.picoclaw/tokenizers. If the
+// vocabulary is missing, or name is "heuristic", a character-based estimate
+// is returned instead. An empty name means cl100k_base.
+func ForName(name string) Tokenizer {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = CL100K
+	}
+	if name == Heuristic {
+		return heuristic{}
+	}
+
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if tk, ok := loaded[name]; ok {
+		return tk
+	}
+
+	var tk Tokenizer = heuristic{}
+	if bpe, err := loadBPE(name); err == nil {
+		tk = bpe
+	} else {
+		logger.DebugCF("tokenizer", "BPE vocabulary not available, estimating tokens",
+			map[string]interface{}{
+				"encoding": name,
+				"error":    err.Error(),
+			})
+	}
+	loaded[name] = tk
+	return tk
+}
+
+func loadBPE(name string) (*BPE, error) {
+	file := name + ".tiktoken"
+
+	var r io.ReadCloser
+	r, err := vocabFS.Open("vocab/" + file)
+	if err != nil {
+		home, herr := os.UserHomeDir()
+		if herr != nil {
+			return nil, fmt.Errorf("%s is not embedded and the home dir is unknown: %w", file, herr)
+		}
+		if r, err = os.Open(filepath.Join(home, ".picoclaw", "tokenizers", file)); err != nil {
+			return nil, err
+		}
+	}
+	defer r.Close()
+
+	ranks, err := LoadRanks(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewBPE(name, ranks), nil
+}
@@ -0,0 +1,142 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitPieces(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello world", []string{"Hello", " world"}},
+		{"don't stop", []string{"don", "'t", " stop"}},
+		{"I'LL go", []string{"I", "'LL", " go"}},
+		{"1234567 apples", []string{"123", "456", "7", " apples"}},
+		{"x = 42;", []string{"x", " =", " ", "42", ";"}},
+		{"hi!!\n\nnext", []string{"hi", "!!\n\n", "next"}},
+		{"a  \n\n  b", []string{"a", "  \n\n", " ", " b"}},
+		{"end   ", []string{"end", "   "}},
+		{"  indented", []string{" ", " indented"}},
+		{`"quoted"`, []string{`"quoted`, `"`}},
+		{"你好世界", []string{"你好世界"}},
+	}
+	for _, tt := range tests {
+		got := splitPieces(tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitPieces(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if strings.Join(got, "") != tt.text {
+			t.Errorf("splitPieces(%q) does not cover the input", tt.text)
+		}
+	}
+}
+
+// testVocab is a tiny vocabulary: every byte, plus a few merges in rank order.
+func testVocab() string {
+	var sb strings.Builder
+	rank := 0
+	add := func(token string) {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+		rank++
+	}
+	for b := 0; b < 256; b++ {
+		add(string([]byte{byte(b)}))
+	}
+	for _, merge := range []string{"he", "ll", "hell", "hello", " w", "or", " wor"} {
+		add(merge)
+	}
+	return sb.String()
+}
+
+func TestBPE(t *testing.T) {
+	ranks, err := LoadRanks(strings.NewReader(testVocab()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bpe := NewBPE("test", ranks)
+
+	// "hello" is a whole token; " world" merges to " wor" + "l" + "d".
+	want := []int{ranks["hello"], ranks[" wor"], ranks["l"], ranks["d"]}
+	if got := bpe.Encode("hello world"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode = %v, want %v", got, want)
+	}
+	if n := bpe.Count("hello world"); n != 4 {
+		t.Errorf("Count = %d, want 4", n)
+	}
+	// Lowest rank merges first: "he"+"ll" beat "ll" on its own.
+	if got := bpe.merge("hell"); !reflect.DeepEqual(got, []string{"hell"}) {
+		t.Errorf("merge(hell) = %q", got)
+	}
+	if n := bpe.Count(""); n != 0 {
+		t.Errorf("Count(\"\") = %d", n)
+	}
+}
+
+func TestLoadRanks_Errors(t *testing.T) {
+	for _, bad := range []string{"", "aGk=\n", "!!! 1\n", "aGk= x\n"} {
+		if _, err := LoadRanks(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadRanks(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestHeuristic(t *testing.T) {
+	tk := ForName(Heuristic)
+	if tk.Name() != Heuristic {
+		t.Fatalf("Name() = %q", tk.Name())
+	}
+	// No lower than the 2.5 characters per token the budget used to assume.
+	if n := tk.Count("abcdefghij"); n != 4 {
+		t.Errorf("Count(ascii) = %d, want 4", n)
+	}
+	if n := tk.Count("你好世界"); n != 4 {
+		t.Errorf("Count(cjk) = %d, want 4", n)
+	}
+	if n := tk.Count(""); n != 0 {
+		t.Errorf("Count(\"\") = %d", n)
+	}
+}
+
+func TestForName_MissingVocabularyFallsBack(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if tk := ForName("no_such_encoding"); tk.Name() != Heuristic {
+		t.Errorf("ForName(missing) = %s, want heuristic", tk.Name())
+	}
+}
+
+func TestCL100K_MatchesTiktoken(t *testing.T) {
+	tk := ForName("")
+	if tk.Name() != CL100K {
+		t.Fatalf("ForName(\"\") = %s, want the embedded %s", tk.Name(), CL100K)
+	}
+	// Counts from tiktoken's cl100k_base encoding.
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"func main() {\n\tfmt.Println(\"hi\")\n}\n", 10},
+		{"Token counts: 1234567 apples, don't they're I'LL", 16},
+		{"你好世界，今天天气很好。", 15},
+		{"  indented   lines\n\n\nwith   spacing  ", 10},
+		{"emoji 🎉🚀 and accents: café naïve", 13},
+	}
+	for _, tt := range tests {
+		if n := tk.Count(tt.text); n != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, n, tt.want)
+		}
+	}
+}
+
+func TestForName_NoHomeFallsBack(t *testing.T) {
+	t.Setenv("HOME", "")
+	if _, err := loadBPE("no_such_encoding"); err == nil || !strings.Contains(err.Error(), "home") {
+		t.Errorf("loadBPE without HOME = %v, want a home dir error", err)
+	}
+}
@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// AuditRecord is one tool execution in the audit log.
+type AuditRecord struct {
+	Time        time.Time              `json:"time"`
+	AgentID     string                 `json:"agent_id,omitempty"`
+	SessionKey  string                 `json:"session_key,omitempty"`
+	Channel     string                 `json:"channel,omitempty"`
+	ChatID      string                 `json:"chat_id,omitempty"`
+	SenderID    string                 `json:"sender_id,omitempty"`
+	Tool        string                 `json:"tool"`
+	Args        map[string]interface{} `json:"args,omitempty"` // Redacted, see RedactArgs
+	DurationMS  int64                  `json:"duration_ms"`
+	ResultBytes int                    `json:"result_bytes"`
+	Async       bool                   `json:"async,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// AuditLog appends tool executions to a JSONL file. Thread-safe.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewAuditLog returns an audit log writing to <workspace>/audit/tools.jsonl.
+func NewAuditLog(workspace string) *AuditLog {
+	return &AuditLog{path: filepath.Join(workspace, "audit", "tools.jsonl")}
+}
+
+// Add appends r to the log.
+func (l *AuditLog) Add(r AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// maxAuditValueLen caps string arguments in the audit log; file contents
+// and the like are cut short.
+const maxAuditValueLen = 200
+
+// secretArgNames are substrings of argument names whose values are never logged.
+var secretArgNames = []string{"token", "secret", "password", "passwd", "api_key", "apikey", "authorization", "cookie", "credential"}
+
+// inlineSecrets match credentials written inside a string, such as a header
+// or an assignment in a shell command. The first group is kept.
+var inlineSecrets = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[^\s"']+`),
+	regexp.MustCompile(`(?i)((?:api[_-]?key|token|secret|password|passwd)["']?\s*[=:]\s*["']?)[^\s"'&]+`),
+}
+
+// RedactArgs returns a copy of tool arguments fit for the audit log: values
+// of secret-looking arguments and credentials inside strings are replaced,
+// and long strings are truncated.
+func RedactArgs(args map[string]interface{}) map[string]interface{} {
+	if args == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		if isSecretArg(name) {
+			redacted[name] = "[redacted]"
+			continue
+		}
+		redacted[name] = redactValue(value)
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, re := range inlineSecrets {
+			v = re.ReplaceAllString(v, "${1}[redacted]")
+		}
+		return utils.Truncate(v, maxAuditValueLen)
+	case map[string]interface{}:
+		return RedactArgs(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = redactValue(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+func isSecretArg(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretArgNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// audit records one execution of tool in the registry's audit log, if any.
+func (r *ToolRegistry) audit(ctx context.Context, tool string, args map[string]interface{}, channel, chatID string, duration time.Duration, result *ToolResult) {
+	if r.auditLog == nil {
+		return
+	}
+
+	channel, chatID = ToolContext(ctx, channel, chatID)
+	caller := CallerFromContext(ctx)
+	rec := AuditRecord{
+		Time:        time.Now().Add(-duration),
+		AgentID:     caller.AgentID,
+		SessionKey:  caller.SessionKey,
+		Channel:     channel,
+		ChatID:      chatID,
+		SenderID:    caller.SenderID,
+		Tool:        tool,
+		Args:        RedactArgs(args),
+		DurationMS:  duration.Milliseconds(),
+		ResultBytes: len(result.ForLLM),
+		Async:       result.Async,
+	}
+	if result.IsError {
+		rec.Error = result.ForLLM
+		if rec.Error == "" && result.Err != nil {
+			rec.Error = result.Err.Error()
+		}
+		rec.Error = utils.Truncate(rec.Error, maxAuditValueLen)
+	}
+	if err := r.auditLog.Add(rec); err != nil {
+		logger.WarnCF("tool", "Failed to write tool audit record", map[string]interface{}{
+			"tool":  tool,
+			"error": err.Error(),
+		})
+	}
+}
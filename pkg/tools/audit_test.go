@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := map[string]interface{}{
+		"command": `curl -H "Authorization: Bearer sk-123" https://x?api_key=abc&q=1`,
+		"api_key": "sk-456",
+		"content": strings.Repeat("x", 1000),
+		"headers": map[string]interface{}{"X-Token": "t", "Accept": "json"},
+		"count":   3.0,
+	}
+	got := RedactArgs(args)
+
+	command := got["command"].(string)
+	if strings.Contains(command, "sk-123") || strings.Contains(command, "abc") || !strings.Contains(command, "q=1") {
+		t.Errorf("command = %q, want credentials hidden and the rest kept", command)
+	}
+	if got["api_key"] != "[redacted]" {
+		t.Errorf("api_key = %v", got["api_key"])
+	}
+	if len(got["content"].(string)) > maxAuditValueLen+3 {
+		t.Errorf("content kept %d bytes", len(got["content"].(string)))
+	}
+	headers := got["headers"].(map[string]interface{})
+	if headers["X-Token"] != "[redacted]" || headers["Accept"] != "json" {
+		t.Errorf("headers = %v", headers)
+	}
+	if got["count"] != 3.0 {
+		t.Errorf("count = %v", got["count"])
+	}
+	if args["api_key"] != "sk-456" {
+		t.Error("RedactArgs modified its input")
+	}
+}
+
+func TestToolRegistry_AuditLog(t *testing.T) {
+	workspace := t.TempDir()
+	r := NewToolRegistry()
+	r.SetAuditLog(NewAuditLog(workspace))
+	r.Register(&probeTool{name: "probe", safe: true, mu: new(sync.Mutex), active: new(int), maxActive: new(int), log: new([]string)})
+
+	ctx := WithCaller(context.Background(), Caller{AgentID: "main", SessionKey: "agent:main:test", SenderID: "alice"})
+	r.ExecuteWithContext(ctx, "probe", map[string]interface{}{"id": "1", "password": "hunter2"}, "telegram", "42", nil)
+	r.ExecuteWithContext(ctx, "missing", nil, "telegram", "42", nil)
+
+	data, err := os.ReadFile(filepath.Join(workspace, "audit", "tools.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("audit log has %d records, want 2:\n%s", len(lines), data)
+	}
+
+	var rec AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.AgentID != "main" || rec.SessionKey != "agent:main:test" || rec.SenderID != "alice" ||
+		rec.Channel != "telegram" || rec.ChatID != "42" || rec.Tool != "probe" ||
+		rec.ResultBytes != len("result 1") || rec.Error != "" || rec.DurationMS < 20 {
+		t.Errorf("record = %+v", rec)
+	}
+	if rec.Args["password"] != "[redacted]" {
+		t.Errorf("args = %v", rec.Args)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Tool != "missing" || !strings.Contains(rec.Error, "not found") {
+		t.Errorf("record of a missing tool = %+v", rec)
+	}
+}
@@ -11,12 +11,22 @@ type Tool interface {
 }
 
 // ContextualTool is an optional interface that tools can implement
-// to receive the current message context (channel, chatID)
+// to receive a default message context (channel, chatID). During agent runs
+// the per-call context is carried by ctx; see WithToolContext.
 type ContextualTool interface {
 	Tool
 	SetContext(channel, chatID string)
 }
 
+// ConcurrentTool is an optional interface for tools that can run at the
+// same time as other calls from the same LLM response. ConcurrencySafe
+// reports whether the call with args only reads state; tools that do not
+// implement it are always run one at a time.
+type ConcurrentTool interface {
+	Tool
+	ConcurrencySafe(args map[string]interface{}) bool
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
@@ -41,7 +51,8 @@ type AsyncCallback func(ctx context.Context, result *ToolResult)
 // asynchronous execution with completion callbacks.
 //
 // Async tools return immediately with an AsyncResult, then notify completion
-// via the callback set by SetCallback.
+// via the callback carried by ctx (see WithAsyncCallback), falling back to
+// the one set by SetCallback.
 //
 // This is useful for:
 // - Long-running operations that shouldn't block the agent loop
@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type toolContextKey struct{}
+type asyncCallbackKey struct{}
+type roundKey struct{}
+type callerKey struct{}
+type subagentDepthKey struct{}
+
+type toolContext struct {
+	channel string
+	chatID  string
+}
+
+// WithToolContext returns a context carrying the channel and chat ID of the
+// conversation a tool call belongs to. Tools are shared between concurrent
+// agent runs, so per-call routing travels with the context rather than being
+// stored on the tool instance.
+func WithToolContext(ctx context.Context, channel, chatID string) context.Context {
+	return context.WithValue(ctx, toolContextKey{}, toolContext{channel: channel, chatID: chatID})
+}
+
+// ToolContext returns the channel and chat ID set by WithToolContext, or the
+// given defaults when the context carries none.
+func ToolContext(ctx context.Context, defaultChannel, defaultChatID string) (string, string) {
+	if tc, ok := ctx.Value(toolContextKey{}).(toolContext); ok && tc.channel != "" && tc.chatID != "" {
+		return tc.channel, tc.chatID
+	}
+	return defaultChannel, defaultChatID
+}
+
+// Caller identifies the agent, session and user a tool call is made for.
+// It is recorded in the audit log.
+type Caller struct {
+	AgentID    string
+	SessionKey string
+	SenderID   string
+}
+
+// WithCaller returns a context carrying the caller of tool calls made with it.
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// CallerFromContext returns the caller set by WithCaller, if any.
+func CallerFromContext(ctx context.Context) Caller {
+	c, _ := ctx.Value(callerKey{}).(Caller)
+	return c
+}
+
+// WithSubagentDepth returns a context for the work of a subagent nested
+// depth levels below the agent the user talks to.
+func WithSubagentDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, subagentDepthKey{}, depth)
+}
+
+// SubagentDepth returns how deeply the subagent running under ctx is
+// nested, or 0 outside subagents.
+func SubagentDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(subagentDepthKey{}).(int)
+	return depth
+}
+
+// WithAsyncCallback returns a context carrying the completion callback for
+// async tools started from it.
+func WithAsyncCallback(ctx context.Context, cb AsyncCallback) context.Context {
+	return context.WithValue(ctx, asyncCallbackKey{}, cb)
+}
+
+// AsyncCallbackFromContext returns the callback set by WithAsyncCallback, or
+// fallback when none is set.
+func AsyncCallbackFromContext(ctx context.Context, fallback AsyncCallback) AsyncCallback {
+	if cb, ok := ctx.Value(asyncCallbackKey{}).(AsyncCallback); ok && cb != nil {
+		return cb
+	}
+	return fallback
+}
+
+// Round tracks tool side effects during the processing of one inbound message.
+type Round struct {
+	messageSent atomic.Bool
+}
+
+func NewRound() *Round {
+	return &Round{}
+}
+
+// WithRound attaches r to ctx so tools executed under it can report into it.
+func WithRound(ctx context.Context, r *Round) context.Context {
+	return context.WithValue(ctx, roundKey{}, r)
+}
+
+// RoundFromContext returns the round attached to ctx, or nil.
+func RoundFromContext(ctx context.Context) *Round {
+	r, _ := ctx.Value(roundKey{}).(*Round)
+	return r
+}
+
+// MarkMessageSent records that the message tool delivered a message to the user.
+func (r *Round) MarkMessageSent() {
+	r.messageSent.Store(true)
+}
+
+// MessageSent reports whether the message tool already replied during this round.
+func (r *Round) MessageSent() bool {
+	return r.messageSent.Load()
+}
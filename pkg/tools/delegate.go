@@ -0,0 +1,201 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxDelegateSteps caps how many agents one delegate call may involve.
+const maxDelegateSteps = 8
+
+// DelegateTool hands a task to several agents and waits for all of them:
+// in parallel, each working on its own part, or as a pipeline, each
+// building on the output of the one before. The results come back as one
+// tool result for the calling agent to work with.
+type DelegateTool struct {
+	manager        *SubagentManager
+	agents         []string
+	allowlistCheck func(targetAgentID string) bool
+}
+
+// NewDelegateTool returns a delegate tool running subagents with manager.
+// agents are the IDs offered in the tool description.
+func NewDelegateTool(manager *SubagentManager, agents []string) *DelegateTool {
+	return &DelegateTool{manager: manager, agents: agents}
+}
+
+func (t *DelegateTool) SetAllowlistChecker(check func(targetAgentID string) bool) {
+	t.allowlistCheck = check
+}
+
+func (t *DelegateTool) Name() string {
+	return "delegate"
+}
+
+func (t *DelegateTool) Description() string {
+	desc := "Delegate work to other agents and wait for their results. In parallel mode every step runs at once; use it to split a task into independent parts. " +
+		"In pipeline mode the steps run in order and each agent gets the output of the one before; use it for chains such as research, then write, then review. " +
+		"Each step's agent works independently with its own tools, so describe its task completely."
+	if len(t.agents) > 0 {
+		desc += " Agents available: " + strings.Join(t.agents, ", ") + "."
+	}
+	return desc
+}
+
+func (t *DelegateTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"mode": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"parallel", "pipeline"},
+				"description": "parallel (default) runs all steps at once; pipeline runs them in order, passing each output to the next step",
+			},
+			"steps": map[string]interface{}{
+				"type":        "array",
+				"description": fmt.Sprintf("The agents to delegate to and their tasks (at most %d)", maxDelegateSteps),
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"agent_id": map[string]interface{}{
+							"type":        "string",
+							"description": "Agent to run the step; omit to run it as yourself",
+						},
+						"task": map[string]interface{}{
+							"type":        "string",
+							"description": "What the agent should do",
+						},
+					},
+					"required": []string{"task"},
+				},
+			},
+		},
+		"required": []string{"steps"},
+	}
+}
+
+// delegateStep is one agent's part of a delegation and how it went.
+type delegateStep struct {
+	agentID string
+	task    string
+	ran     bool
+	output  string
+	err     error
+}
+
+func (s *delegateStep) agentName() string {
+	if s.agentID == "" {
+		return "self"
+	}
+	return s.agentID
+}
+
+func (t *DelegateTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if t.manager == nil {
+		return ErrorResult("Subagent manager not configured")
+	}
+
+	mode, _ := args["mode"].(string)
+	if mode == "" {
+		mode = "parallel"
+	}
+	if mode != "parallel" && mode != "pipeline" {
+		return ErrorResult(fmt.Sprintf("unknown mode %q: use parallel or pipeline", mode))
+	}
+
+	rawSteps, _ := args["steps"].([]interface{})
+	if len(rawSteps) == 0 {
+		return ErrorResult("steps is required")
+	}
+	if len(rawSteps) > maxDelegateSteps {
+		return ErrorResult(fmt.Sprintf("at most %d steps can be delegated at once", maxDelegateSteps))
+	}
+	steps := make([]*delegateStep, len(rawSteps))
+	for i, raw := range rawSteps {
+		m, _ := raw.(map[string]interface{})
+		task, _ := m["task"].(string)
+		if strings.TrimSpace(task) == "" {
+			return ErrorResult(fmt.Sprintf("step %d has no task", i+1))
+		}
+		agentID, _ := m["agent_id"].(string)
+		if agentID != "" && t.allowlistCheck != nil && !t.allowlistCheck(agentID) {
+			return ErrorResult(fmt.Sprintf("not allowed to delegate to agent '%s'", agentID))
+		}
+		steps[i] = &delegateStep{agentID: agentID, task: task}
+	}
+
+	channel, chatID := ToolContext(ctx, "cli", "direct")
+	run := func(step *delegateStep, task string) {
+		step.ran = true
+		result, err := t.manager.runSync(ctx, step.agentID, task,
+			"You are a subagent. Complete the given task independently and provide a clear, concise result.",
+			channel, chatID, true)
+		if err != nil {
+			step.err = err
+			return
+		}
+		step.output = result.Content
+	}
+
+	if mode == "parallel" {
+		// Steps beyond the subagent limit, counting subagents started
+		// elsewhere, wait in runSync for a slot rather than fail.
+		var wg sync.WaitGroup
+		for _, step := range steps {
+			wg.Add(1)
+			go func(step *delegateStep) {
+				defer wg.Done()
+				run(step, step.task)
+			}(step)
+		}
+		wg.Wait()
+	} else {
+		for i, step := range steps {
+			task := step.task
+			if i > 0 {
+				prev := steps[i-1]
+				task = fmt.Sprintf("%s\n\n---\nOutput of the previous step (%s):\n\n%s", task, prev.agentName(), prev.output)
+			}
+			run(step, task)
+			if step.err != nil {
+				break
+			}
+		}
+	}
+
+	return delegateResult(mode, steps)
+}
+
+// delegateResult reports the outcome of every step in order. It is an
+// error only when no step succeeded.
+func delegateResult(mode string, steps []*delegateStep) *ToolResult {
+	var sb strings.Builder
+	succeeded, failed := 0, 0
+	for i, step := range steps {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "## Step %d: %s\n", i+1, step.agentName())
+		switch {
+		case !step.ran:
+			sb.WriteString("Not run, because an earlier step failed.")
+		case step.err != nil:
+			failed++
+			fmt.Fprintf(&sb, "Failed: %v", step.err)
+		default:
+			succeeded++
+			sb.WriteString(step.output)
+		}
+	}
+
+	if succeeded == 0 {
+		return ErrorResult(sb.String())
+	}
+	summary := fmt.Sprintf("Delegated %d steps (%s)", len(steps), mode)
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	return NewToolResult(summary + ":\n\n" + sb.String())
+}
@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// echoProvider answers with the model name and the task it was given. With
+// barrier set, every call waits until that many calls are in flight.
+type echoProvider struct {
+	mu       sync.Mutex
+	inFlight int
+	barrier  int
+	arrived  chan struct{}
+}
+
+func (m *echoProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	if m.barrier > 0 {
+		m.mu.Lock()
+		m.inFlight++
+		if m.inFlight == m.barrier {
+			close(m.arrived)
+		}
+		m.mu.Unlock()
+		select {
+		case <-m.arrived:
+		case <-time.After(2 * time.Second):
+			return nil, fmt.Errorf("steps did not run in parallel")
+		}
+	}
+	return &providers.LLMResponse{Content: fmt.Sprintf("[%s] %s", model, messages[len(messages)-1].Content)}, nil
+}
+
+func (m *echoProvider) GetDefaultModel() string {
+	return "echo"
+}
+
+func newDelegateTestManager(provider providers.LLMProvider) *SubagentManager {
+	manager := NewSubagentManager(nil, "unused", "/tmp/test", nil)
+	manager.SetResolver(func(agentID, task string) (*SubagentTarget, error) {
+		if agentID == "ghost" {
+			return nil, fmt.Errorf("agent %q is not configured", agentID)
+		}
+		return &SubagentTarget{
+			AgentID: agentID,
+			Loop:    ToolLoopConfig{Provider: provider, Model: agentID + "-model", MaxIterations: 3},
+		}, nil
+	})
+	return manager
+}
+
+func delegateSteps(agentTasks ...string) []interface{} {
+	var steps []interface{}
+	for i := 0; i < len(agentTasks); i += 2 {
+		steps = append(steps, map[string]interface{}{"agent_id": agentTasks[i], "task": agentTasks[i+1]})
+	}
+	return steps
+}
+
+func TestDelegateTool_Parallel(t *testing.T) {
+	provider := &echoProvider{barrier: 2, arrived: make(chan struct{})}
+	tool := NewDelegateTool(newDelegateTestManager(provider), []string{"researcher", "writer"})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"steps": delegateSteps("researcher", "find sources", "writer", "draft an outline"),
+	})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	want := "## Step 1: researcher\n[researcher-model] find sources\n\n## Step 2: writer\n[writer-model] draft an outline"
+	if !strings.Contains(result.ForLLM, want) {
+		t.Errorf("result = %q, want %q", result.ForLLM, want)
+	}
+	if !strings.Contains(tool.Description(), "Agents available: researcher, writer.") {
+		t.Errorf("description = %q", tool.Description())
+	}
+}
+
+func TestDelegateTool_WaitsForSlots(t *testing.T) {
+	manager := newDelegateTestManager(&echoProvider{})
+	manager.SetLimits(0, 1)
+	tool := NewDelegateTool(manager, nil)
+
+	// A subagent started elsewhere holds the only slot for a while.
+	manager.mu.Lock()
+	if err := manager.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	manager.mu.Unlock()
+	time.AfterFunc(50*time.Millisecond, manager.release)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"steps": delegateSteps("researcher", "find sources", "writer", "draft an outline"),
+	})
+	if result.IsError || strings.Contains(result.ForLLM, "already running") {
+		t.Fatalf("result = %q, want both steps to wait for a slot", result.ForLLM)
+	}
+}
+
+func TestDelegateTool_Pipeline(t *testing.T) {
+	tool := NewDelegateTool(newDelegateTestManager(&echoProvider{}), nil)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"mode":  "pipeline",
+		"steps": delegateSteps("researcher", "find sources", "writer", "write it up", "reviewer", "review"),
+	})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	// The reviewer got the writer's output, which carried the researcher's.
+	if !strings.Contains(result.ForLLM, "## Step 3: reviewer\n[reviewer-model] review\n\n---\nOutput of the previous step (writer):\n\n[writer-model] write it up\n\n---\nOutput of the previous step (researcher):\n\n[researcher-model] find sources") {
+		t.Errorf("result = %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"mode":  "pipeline",
+		"steps": delegateSteps("researcher", "find sources", "ghost", "write it up", "reviewer", "review"),
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "1 failed") ||
+		!strings.Contains(result.ForLLM, "## Step 2: ghost\nFailed: agent \"ghost\" is not configured") ||
+		!strings.Contains(result.ForLLM, "## Step 3: reviewer\nNot run") {
+		t.Errorf("result of a broken pipeline = %q", result.ForLLM)
+	}
+}
+
+func TestDelegateTool_Checks(t *testing.T) {
+	tool := NewDelegateTool(newDelegateTestManager(&echoProvider{}), nil)
+	tool.SetAllowlistChecker(func(id string) bool { return id == "researcher" })
+
+	for name, args := range map[string]map[string]interface{}{
+		"not allowed": {"steps": delegateSteps("researcher", "a", "writer", "b")},
+		"no steps":    {"steps": []interface{}{}},
+		"no task":     {"steps": delegateSteps("researcher", " ")},
+		"bad mode":    {"mode": "serial", "steps": delegateSteps("researcher", "a")},
+	} {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("%s: result = %q, want an error", name, result.ForLLM)
+		}
+	}
+
+	if result := tool.Execute(WithSubagentDepth(context.Background(), 1), map[string]interface{}{
+		"steps": delegateSteps("researcher", "a"),
+	}); result.IsError {
+		t.Errorf("nested delegation without a depth limit failed: %s", result.ForLLM)
+	}
+	tool.manager.SetLimits(1, 0)
+	if result := tool.Execute(WithSubagentDepth(context.Background(), 1), map[string]interface{}{
+		"steps": delegateSteps("researcher", "a"),
+	}); !result.IsError || !strings.Contains(result.ForLLM, "max depth") {
+		t.Errorf("delegation beyond the depth limit: %q", result.ForLLM)
+	}
+}
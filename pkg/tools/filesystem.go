@@ -90,6 +90,10 @@ func (t *ReadFileTool) Name() string {
 	return "read_file"
 }
 
+func (t *ReadFileTool) ConcurrencySafe(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *ReadFileTool) Description() string {
 	return "Read the contents of a file"
 }
@@ -201,6 +205,10 @@ func (t *ListDirTool) Name() string {
 	return "list_dir"
 }
 
+func (t *ListDirTool) ConcurrencySafe(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *ListDirTool) Description() string {
 	return "List files and directories in a path"
 }
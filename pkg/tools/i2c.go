@@ -20,6 +20,13 @@ func (t *I2CTool) Name() string {
 	return "i2c"
 }
 
+// ConcurrencySafe allows everything but writes to run alongside other calls;
+// the kernel serializes transfers on each bus.
+func (t *I2CTool) ConcurrencySafe(args map[string]interface{}) bool {
+	action, _ := args["action"].(string)
+	return action != "write"
+}
+
 func (t *I2CTool) Description() string {
 	return "Interact with I2C bus devices for reading sensors and controlling peripherals. Actions: detect (list buses), scan (find devices on a bus), read (read bytes from device), write (send bytes to device). Linux only."
 }
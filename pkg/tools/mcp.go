@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/mcp"
+)
+
+// maxToolNameLen is the longest tool name the major LLM APIs accept.
+const maxToolNameLen = 64
+
+// MCPCaller forwards a tool call to an MCP server.
+type MCPCaller interface {
+	CallTool(ctx context.Context, server, tool string, args map[string]interface{}) (*mcp.CallToolResult, error)
+}
+
+// MCPTool exposes one tool of an MCP server as mcp_<server>_<tool>.
+type MCPTool struct {
+	caller MCPCaller
+	server string
+	tool   mcp.Tool
+	name   string
+}
+
+func NewMCPTool(caller MCPCaller, server string, tool mcp.Tool) *MCPTool {
+	return &MCPTool{
+		caller: caller,
+		server: server,
+		tool:   tool,
+		name:   MCPToolName(server, tool.Name),
+	}
+}
+
+// MCPToolName namespaces a server's tool so names from different servers
+// can't collide with each other or with built-in tools. Characters LLM
+// APIs reject are replaced with '_' and the result is capped at 64 bytes.
+func MCPToolName(server, tool string) string {
+	name := "mcp_" + sanitizeToolName(server) + "_" + sanitizeToolName(tool)
+	if len(name) > maxToolNameLen {
+		name = name[:maxToolNameLen]
+	}
+	return name
+}
+
+func sanitizeToolName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func (t *MCPTool) Name() string {
+	return t.name
+}
+
+// Server returns the name of the MCP server the tool belongs to.
+func (t *MCPTool) Server() string {
+	return t.server
+}
+
+func (t *MCPTool) Description() string {
+	desc := t.tool.Description
+	if desc == "" {
+		desc = t.tool.Name
+	}
+	return fmt.Sprintf("[MCP %s] %s", t.server, desc)
+}
+
+func (t *MCPTool) Parameters() map[string]interface{} {
+	if t.tool.InputSchema == nil {
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		}
+	}
+	return t.tool.InputSchema
+}
+
+func (t *MCPTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	result, err := t.caller.CallTool(ctx, t.server, t.tool.Name, args)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("MCP tool %s on server %s failed: %v", t.tool.Name, t.server, err)).WithError(err)
+	}
+
+	content := mcpContentText(result.Content)
+	if result.IsError {
+		if content == "" {
+			content = "tool reported an error"
+		}
+		return ErrorResult(content)
+	}
+	if content == "" {
+		content = "(no output)"
+	}
+	return SilentResult(content)
+}
+
+// mcpContentText flattens tool output into text for the LLM. Binary
+// content is replaced by a short placeholder.
+func mcpContentText(content []mcp.Content) string {
+	parts := make([]string, 0, len(content))
+	for _, c := range content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "image", "audio":
+			parts = append(parts, fmt.Sprintf("[%s: %s, %d bytes base64]", c.Type, c.MimeType, len(c.Data)))
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			if c.Resource.Text != "" {
+				parts = append(parts, c.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource: %s]", c.Resource.URI))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource: %s]", c.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content]", c.Type))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
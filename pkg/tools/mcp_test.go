@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/mcp"
+)
+
+type fakeMCPCaller struct {
+	server, tool string
+	args         map[string]interface{}
+	result       *mcp.CallToolResult
+	err          error
+}
+
+func (f *fakeMCPCaller) CallTool(ctx context.Context, server, tool string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	f.server, f.tool, f.args = server, tool, args
+	return f.result, f.err
+}
+
+func TestMCPToolName(t *testing.T) {
+	tests := []struct {
+		server, tool, want string
+	}{
+		{"github", "create_issue", "mcp_github_create_issue"},
+		{"my.server", "read file", "mcp_my_server_read_file"},
+		{"s", strings.Repeat("x", 100), "mcp_s_" + strings.Repeat("x", 58)},
+	}
+	for _, tt := range tests {
+		if got := MCPToolName(tt.server, tt.tool); got != tt.want {
+			t.Errorf("MCPToolName(%q, %q) = %q, want %q", tt.server, tt.tool, got, tt.want)
+		}
+	}
+}
+
+func TestMCPTool_ForwardsCall(t *testing.T) {
+	caller := &fakeMCPCaller{result: &mcp.CallToolResult{Content: []mcp.Content{
+		{Type: "text", Text: "first"},
+		{Type: "image", MimeType: "image/png", Data: "aGVsbG8="},
+		{Type: "resource", Resource: &mcp.ResourceContents{URI: "file:///a.txt", Text: "file body"}},
+		{Type: "resource", Resource: &mcp.ResourceContents{URI: "file:///b.bin", Blob: "AAAA"}},
+		{Type: "resource_link", URI: "file:///c.txt"},
+	}}}
+	tool := NewMCPTool(caller, "fs", mcp.Tool{
+		Name:        "read",
+		Description: "Read a file",
+		InputSchema: map[string]interface{}{"type": "object", "required": []interface{}{"path"}},
+	})
+
+	if tool.Name() != "mcp_fs_read" {
+		t.Errorf("Name() = %q", tool.Name())
+	}
+	if tool.Description() != "[MCP fs] Read a file" {
+		t.Errorf("Description() = %q", tool.Description())
+	}
+	if tool.Parameters()["required"] == nil {
+		t.Error("Parameters() should pass the input schema through")
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "a.txt"})
+	if caller.server != "fs" || caller.tool != "read" || caller.args["path"] != "a.txt" {
+		t.Errorf("forwarded %s/%s %v", caller.server, caller.tool, caller.args)
+	}
+	if result.IsError || !result.Silent {
+		t.Errorf("result = %+v, want silent success", result)
+	}
+	want := "first\n[image: image/png, 8 bytes base64]\nfile body\n[resource: file:///b.bin]\n[resource: file:///c.txt]"
+	if result.ForLLM != want {
+		t.Errorf("ForLLM = %q, want %q", result.ForLLM, want)
+	}
+}
+
+func TestMCPTool_Errors(t *testing.T) {
+	caller := &fakeMCPCaller{result: &mcp.CallToolResult{
+		Content: []mcp.Content{{Type: "text", Text: "no such file"}},
+		IsError: true,
+	}}
+	tool := NewMCPTool(caller, "fs", mcp.Tool{Name: "read"})
+
+	result := tool.Execute(context.Background(), nil)
+	if !result.IsError || result.ForLLM != "no such file" {
+		t.Errorf("tool error result = %+v", result)
+	}
+
+	caller.err = errors.New("connection closed")
+	result = tool.Execute(context.Background(), nil)
+	if !result.IsError || result.Err == nil || !strings.Contains(result.ForLLM, "connection closed") {
+		t.Errorf("transport error result = %+v", result)
+	}
+}
+
+func TestMCPTool_DefaultSchema(t *testing.T) {
+	tool := NewMCPTool(&fakeMCPCaller{}, "fs", mcp.Tool{Name: "ping"})
+	if tool.Parameters()["type"] != "object" {
+		t.Errorf("Parameters() = %v, want an empty object schema", tool.Parameters())
+	}
+}
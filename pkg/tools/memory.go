@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/memory"
+)
+
+// MemorySearchTool searches the agent's memory files.
+type MemorySearchTool struct {
+	index *memory.Index
+}
+
+func NewMemorySearchTool(index *memory.Index) *MemorySearchTool {
+	return &MemorySearchTool{index: index}
+}
+
+func (t *MemorySearchTool) Name() string {
+	return "memory_search"
+}
+
+func (t *MemorySearchTool) ConcurrencySafe(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *MemorySearchTool) Description() string {
+	return "Search long-term memory and daily notes for facts, preferences and past events. Returns the most relevant snippets with their source file."
+}
+
+func (t *MemorySearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "What to look for, in natural language or keywords",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of snippets to return (default 5, max 20)",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *MemorySearchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return ErrorResult("query is required")
+	}
+	limit := 5
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = min(int(l), 20)
+	}
+
+	results, err := t.index.Search(ctx, query, limit)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("memory search failed: %v", err)).WithError(err)
+	}
+	if len(results) == 0 {
+		return SilentResult(fmt.Sprintf("No memories found for %q", query))
+	}
+	return SilentResult(FormatMemoryResults(results))
+}
+
+// FormatMemoryResults renders search results as a numbered list, each with
+// its source file, heading and line.
+func FormatMemoryResults(results []memory.Result) string {
+	var sb strings.Builder
+	for i, r := range results {
+		source := r.Source
+		if r.Heading != "" {
+			source += " > " + r.Heading
+		}
+		fmt.Fprintf(&sb, "%d. [%s, line %d]\n%s\n\n", i+1, source, r.Line, r.Text)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// MemoryWriteTool records facts in long-term memory or today's daily note.
+type MemoryWriteTool struct {
+	store *memory.Store
+}
+
+func NewMemoryWriteTool(store *memory.Store) *MemoryWriteTool {
+	return &MemoryWriteTool{store: store}
+}
+
+func (t *MemoryWriteTool) Name() string {
+	return "memory_write"
+}
+
+func (t *MemoryWriteTool) Description() string {
+	return "Remember something. Use target \"long_term\" for lasting facts and preferences (MEMORY.md, optionally under a section heading) and \"daily\" for events and notes about today."
+}
+
+func (t *MemoryWriteTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "What to remember, written so it makes sense on its own later",
+			},
+			"target": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"long_term", "daily"},
+				"description": "Where to write it (default long_term)",
+			},
+			"section": map[string]interface{}{
+				"type":        "string",
+				"description": "Section of MEMORY.md to add it under, e.g. \"Preferences\"; created if missing. Ignored for daily notes",
+			},
+		},
+		"required": []string{"content"},
+	}
+}
+
+func (t *MemoryWriteTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	content, _ := args["content"].(string)
+	if strings.TrimSpace(content) == "" {
+		return ErrorResult("content is required")
+	}
+	target, _ := args["target"].(string)
+	section, _ := args["section"].(string)
+
+	switch target {
+	case "", "long_term":
+		if err := t.store.AppendLongTerm(strings.TrimSpace(section), content); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to write memory: %v", err)).WithError(err)
+		}
+		if section != "" {
+			return SilentResult(fmt.Sprintf("Saved to long-term memory under %q", section))
+		}
+		return SilentResult("Saved to long-term memory")
+	case "daily":
+		if err := t.store.AppendDaily(content); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to write daily note: %v", err)).WithError(err)
+		}
+		return SilentResult("Saved to today's daily note")
+	default:
+		return ErrorResult(fmt.Sprintf("unknown target %q: use long_term or daily", target))
+	}
+}
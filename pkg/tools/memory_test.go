@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/memory"
+)
+
+func TestMemoryTools_WriteThenSearch(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	write := NewMemoryWriteTool(store)
+	search := NewMemorySearchTool(store.Index())
+
+	result := write.Execute(context.Background(), map[string]interface{}{
+		"content": "- Prefers oat milk in coffee",
+		"section": "Preferences",
+	})
+	if result.IsError {
+		t.Fatalf("write failed: %s", result.ForLLM)
+	}
+	data, _ := os.ReadFile(store.LongTermPath())
+	if !strings.Contains(string(data), "## Preferences\n\n- Prefers oat milk in coffee") {
+		t.Errorf("MEMORY.md = %q", data)
+	}
+
+	result = search.Execute(context.Background(), map[string]interface{}{"query": "coffee milk"})
+	if result.IsError || !result.Silent {
+		t.Fatalf("search result = %+v", result)
+	}
+	if !strings.Contains(result.ForLLM, "[MEMORY.md > Preferences, line 3]") || !strings.Contains(result.ForLLM, "oat milk") {
+		t.Errorf("search output = %q", result.ForLLM)
+	}
+
+	result = search.Execute(context.Background(), map[string]interface{}{"query": "bicycle"})
+	if !strings.Contains(result.ForLLM, "No memories found") {
+		t.Errorf("search output = %q", result.ForLLM)
+	}
+}
+
+func TestMemoryWriteTool_Validation(t *testing.T) {
+	write := NewMemoryWriteTool(memory.NewStore(t.TempDir()))
+
+	if r := write.Execute(context.Background(), map[string]interface{}{}); !r.IsError {
+		t.Error("expected error for missing content")
+	}
+	if r := write.Execute(context.Background(), map[string]interface{}{"content": "x", "target": "weekly"}); !r.IsError {
+		t.Error("expected error for unknown target")
+	}
+	if r := write.Execute(context.Background(), map[string]interface{}{"content": "x", "target": "daily"}); r.IsError {
+		t.Errorf("daily write failed: %s", r.ForLLM)
+	}
+}
@@ -257,3 +257,45 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_UsesContextTarget(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("default-channel", "default-chat-id")
+
+	var sentChannel, sentChatID string
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		sentChannel = channel
+		sentChatID = chatID
+		return nil
+	})
+
+	round := NewRound()
+	ctx := WithRound(WithToolContext(context.Background(), "telegram", "42"), round)
+	result := tool.Execute(ctx, map[string]interface{}{"content": "hi"})
+
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if sentChannel != "telegram" || sentChatID != "42" {
+		t.Errorf("sent to %s:%s, want telegram:42", sentChannel, sentChatID)
+	}
+	if !round.MessageSent() {
+		t.Error("expected round to record the sent message")
+	}
+}
+
+func TestMessageTool_Execute_RoundsAreIndependent(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+
+	sending := NewRound()
+	idle := NewRound()
+	tool.Execute(WithRound(WithToolContext(context.Background(), "slack", "a"), sending), map[string]interface{}{"content": "hi"})
+
+	if !sending.MessageSent() {
+		t.Error("expected sending round to be marked")
+	}
+	if idle.MessageSent() {
+		t.Error("expected other round to be unaffected")
+	}
+}
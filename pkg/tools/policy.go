@@ -0,0 +1,34 @@
+package tools
+
+import "path"
+
+// ToolPolicy limits by name which tools a registry accepts. Allow and Deny
+// hold glob patterns such as "web_*" or "mcp_github_*". With Allow set only
+// matching tools are accepted; Deny removes tools either way.
+type ToolPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allows reports whether the policy accepts a tool of that name. A nil
+// policy accepts every tool.
+func (p *ToolPolicy) Allows(name string) bool {
+	if p == nil {
+		return true
+	}
+	if matchesAny(p.Deny, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchesAny(p.Allow, name)
+}
+
+// matchesAny reports whether name matches one of patterns. Malformed
+// patterns match nothing; config.ValidateAgentTools rejects them on load.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
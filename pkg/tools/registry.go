@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,8 +12,10 @@ import (
 )
 
 type ToolRegistry struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools    map[string]Tool
+	mu       sync.RWMutex
+	auditLog *AuditLog
+	policy   *ToolPolicy
 }
 
 func NewToolRegistry() *ToolRegistry {
@@ -21,12 +24,65 @@ func NewToolRegistry() *ToolRegistry {
 	}
 }
 
+// Register adds tool, replacing any tool of the same name. Tools the
+// registry's policy does not allow are left out.
 func (r *ToolRegistry) Register(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if !r.policy.Allows(tool.Name()) {
+		logger.DebugCF("tool", "Tool not allowed by policy",
+			map[string]interface{}{
+				"tool": tool.Name(),
+			})
+		return
+	}
 	r.tools[tool.Name()] = tool
 }
 
+// Unregister removes the named tool, if registered.
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
+// SetPolicy limits the tools the registry accepts from now on. Tools
+// already registered that policy does not allow are removed.
+func (r *ToolRegistry) SetPolicy(policy *ToolPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+	for name := range r.tools {
+		if !policy.Allows(name) {
+			delete(r.tools, name)
+		}
+	}
+}
+
+// Without returns a copy of the registry lacking the named tools. The copy
+// shares tool instances, the audit log and the policy with r.
+func (r *ToolRegistry) Without(names ...string) *ToolRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	excluded := make(map[string]bool, len(names))
+	for _, name := range names {
+		excluded[name] = true
+	}
+	c := &ToolRegistry{tools: make(map[string]Tool, len(r.tools)), auditLog: r.auditLog, policy: r.policy}
+	for name, tool := range r.tools {
+		if !excluded[name] {
+			c.tools[name] = tool
+		}
+	}
+	return c
+}
+
+// SetAuditLog makes the registry record every execution in log.
+func (r *ToolRegistry) SetAuditLog(log *AuditLog) {
+	r.auditLog = log
+}
+
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -39,8 +95,8 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string
 }
 
 // ExecuteWithContext executes a tool with channel/chatID context and optional async callback.
-// If the tool implements AsyncTool and a non-nil callback is provided,
-// the callback will be set on the tool before execution.
+// Both are attached to ctx rather than set on the tool, so the same tool can
+// serve concurrent conversations.
 func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
 	logger.InfoCF("tool", "Tool execution started",
 		map[string]interface{}{
@@ -54,17 +110,18 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			map[string]interface{}{
 				"tool": name,
 			})
-		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
+		result := ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
+		r.audit(ctx, name, args, channel, chatID, 0, result)
+		return result
 	}
 
-	// If tool implements ContextualTool, set context
-	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
-		contextualTool.SetContext(channel, chatID)
+	if channel != "" && chatID != "" {
+		ctx = WithToolContext(ctx, channel, chatID)
 	}
 
-	// If tool implements AsyncTool and callback is provided, set callback
-	if asyncTool, ok := tool.(AsyncTool); ok && asyncCallback != nil {
-		asyncTool.SetCallback(asyncCallback)
+	// If tool implements AsyncTool and callback is provided, pass it along
+	if _, ok := tool.(AsyncTool); ok && asyncCallback != nil {
+		ctx = WithAsyncCallback(ctx, asyncCallback)
 		logger.DebugCF("tool", "Async callback injected",
 			map[string]interface{}{
 				"tool": name,
@@ -74,6 +131,7 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	start := time.Now()
 	result := tool.Execute(ctx, args)
 	duration := time.Since(start)
+	r.audit(ctx, name, args, channel, chatID, duration, result)
 
 	// Log based on result type
 	if result.IsError {
@@ -101,12 +159,59 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	return result
 }
 
+// ExecuteCalls executes the tool calls of one LLM response and returns their
+// results in call order. Consecutive calls that are concurrency safe run
+// together, at most maxParallel at a time. Any other call waits for the calls
+// before it and runs alone, so a write is never reordered around a read.
+// callback, if set, returns the async callback for each call.
+func (r *ToolRegistry) ExecuteCalls(ctx context.Context, calls []providers.ToolCall, channel, chatID string, maxParallel int, callback func(tc providers.ToolCall) AsyncCallback) []*ToolResult {
+	results := make([]*ToolResult, len(calls))
+	sem := make(chan struct{}, max(maxParallel, 1))
+	var wg sync.WaitGroup
+
+	for i, tc := range calls {
+		var cb AsyncCallback
+		if callback != nil {
+			cb = callback(tc)
+		}
+		if maxParallel <= 1 || !r.concurrencySafe(tc.Name, tc.Arguments) {
+			wg.Wait()
+			results[i] = r.ExecuteWithContext(ctx, tc.Name, tc.Arguments, channel, chatID, cb)
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, tc providers.ToolCall, cb AsyncCallback) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = r.ExecuteWithContext(ctx, tc.Name, tc.Arguments, channel, chatID, cb)
+		}(i, tc, cb)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// concurrencySafe reports whether a call to name with args may run alongside
+// other calls.
+func (r *ToolRegistry) concurrencySafe(name string, args map[string]interface{}) bool {
+	tool, ok := r.Get(name)
+	if !ok {
+		return false
+	}
+	ct, ok := tool.(ConcurrentTool)
+	return ok && ct.ConcurrencySafe(args)
+}
+
 func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	definitions := make([]map[string]interface{}, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		definitions = append(definitions, ToolToSchema(tool))
 	}
 	return definitions
@@ -119,7 +224,7 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 	defer r.mu.RUnlock()
 
 	definitions := make([]providers.ToolDefinition, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		schema := ToolToSchema(tool)
 
 		// Safely extract nested values with type checks
@@ -144,7 +249,7 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 	return definitions
 }
 
-// List returns a list of all registered tool names.
+// List returns the names of all registered tools, sorted.
 func (r *ToolRegistry) List() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -153,9 +258,25 @@ func (r *ToolRegistry) List() []string {
 	for name := range r.tools {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
+// sorted returns the registered tools ordered by name, so that what is sent
+// to the LLM does not change from one call to the next. Callers hold r.mu.
+func (r *ToolRegistry) sorted() []Tool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tools := make([]Tool, len(names))
+	for i, name := range names {
+		tools[i] = r.tools[name]
+	}
+	return tools
+}
+
 // Count returns the number of registered tools.
 func (r *ToolRegistry) Count() int {
 	r.mu.RLock()
@@ -170,7 +291,7 @@ func (r *ToolRegistry) GetSummaries() []string {
 	defer r.mu.RUnlock()
 
 	summaries := make([]string, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", tool.Name(), tool.Description()))
 	}
 	return summaries
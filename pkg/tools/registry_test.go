@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// probeTool records how many of its calls run at once.
+type probeTool struct {
+	name string
+	safe bool
+
+	mu        *sync.Mutex
+	active    *int
+	maxActive *int
+	log       *[]string // Calls in start order, with whether others were running
+}
+
+func (t *probeTool) Name() string        { return t.name }
+func (t *probeTool) Description() string { return "probe" }
+func (t *probeTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (t *probeTool) ConcurrencySafe(args map[string]interface{}) bool {
+	return t.safe
+}
+
+func (t *probeTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	id, _ := args["id"].(string)
+	t.mu.Lock()
+	*t.active++
+	if *t.active > *t.maxActive {
+		*t.maxActive = *t.active
+	}
+	if !t.safe && *t.active > 1 {
+		*t.log = append(*t.log, id+" overlapped")
+	}
+	t.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	t.mu.Lock()
+	*t.active--
+	t.mu.Unlock()
+	return NewToolResult("result " + id)
+}
+
+func TestToolRegistry_ExecuteCalls(t *testing.T) {
+	var mu sync.Mutex
+	var active, maxActive int
+	var log []string
+	r := NewToolRegistry()
+	r.Register(&probeTool{name: "read", safe: true, mu: &mu, active: &active, maxActive: &maxActive, log: &log})
+	r.Register(&probeTool{name: "write", mu: &mu, active: &active, maxActive: &maxActive, log: &log})
+
+	call := func(name, id string) providers.ToolCall {
+		return providers.ToolCall{ID: id, Name: name, Arguments: map[string]interface{}{"id": id}}
+	}
+	calls := []providers.ToolCall{
+		call("read", "r1"), call("read", "r2"), call("read", "r3"),
+		call("write", "w1"),
+		call("read", "r4"), call("read", "r5"),
+		call("missing", "m1"),
+	}
+
+	results := r.ExecuteCalls(context.Background(), calls, "", "", 2, nil)
+
+	for i, id := range []string{"r1", "r2", "r3", "w1", "r4", "r5"} {
+		if results[i].ForLLM != "result "+id {
+			t.Errorf("results[%d] = %q, want the result of %s", i, results[i].ForLLM, id)
+		}
+	}
+	if !results[6].IsError {
+		t.Errorf("call to a missing tool = %+v, want an error", results[6])
+	}
+	if maxActive != 2 {
+		t.Errorf("at most %d calls ran at once, want 2", maxActive)
+	}
+	if len(log) != 0 {
+		t.Errorf("unsafe calls ran alongside others: %v", log)
+	}
+
+	// A cap of 1 runs every call in turn.
+	maxActive = 0
+	r.ExecuteCalls(context.Background(), calls[:3], "", "", 1, nil)
+	if maxActive != 1 {
+		t.Errorf("with a cap of 1, %d calls ran at once", maxActive)
+	}
+}
+
+func TestI2CTool_ConcurrencySafe(t *testing.T) {
+	tool := NewI2CTool()
+	for action, want := range map[string]bool{"detect": true, "scan": true, "read": true, "write": false} {
+		if got := tool.ConcurrencySafe(map[string]interface{}{"action": action}); got != want {
+			t.Errorf("ConcurrencySafe(%s) = %v, want %v", action, got, want)
+		}
+	}
+}
+
+func TestToolRegistry_Policy(t *testing.T) {
+	probe := func(name string) *probeTool {
+		return &probeTool{name: name, mu: new(sync.Mutex), active: new(int), maxActive: new(int), log: new([]string)}
+	}
+
+	r := NewToolRegistry()
+	r.Register(probe("exec"))
+	r.SetPolicy(&ToolPolicy{Allow: []string{"web_*", "read_file", "mcp_*"}, Deny: []string{"mcp_github_*", "[bad"}})
+	for _, name := range []string{"read_file", "web_search", "web_fetch", "write_file", "mcp_github_push", "mcp_docs_search"} {
+		r.Register(probe(name))
+	}
+	got := r.List()
+	want := []string{"mcp_docs_search", "read_file", "web_fetch", "web_search"}
+	if len(got) != len(want) {
+		t.Fatalf("tools = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("tools = %v, want %v", got, want)
+		}
+	}
+
+	if !r.Without("read_file").policy.Allows("web_fetch") || r.Without("read_file").policy.Allows("exec") {
+		t.Error("Without did not keep the policy")
+	}
+	if !(*ToolPolicy)(nil).Allows("exec") || !(&ToolPolicy{Deny: []string{"i2c"}}).Allows("exec") {
+		t.Error("a policy without allow patterns refused a tool it does not deny")
+	}
+}
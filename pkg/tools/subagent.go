@@ -2,24 +2,52 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
+// maxFinishedTasks is how many finished tasks a manager keeps; older ones
+// are dropped.
+const maxFinishedTasks = 50
+
+// SubagentTask is a task run in the background by a subagent. Status is
+// running, completed, failed, timeout, cancelled, or interrupted when the
+// process stopped while it ran.
 type SubagentTask struct {
-	ID            string
-	Task          string
-	Label         string
-	AgentID       string
-	OriginChannel string
-	OriginChatID  string
-	Status        string
-	Result        string
-	Created       int64
+	ID            string `json:"id"`
+	Task          string `json:"task"`
+	Label         string `json:"label,omitempty"`
+	AgentID       string `json:"agent_id,omitempty"`
+	OriginChannel string `json:"origin_channel"`
+	OriginChatID  string `json:"origin_chat_id"`
+	Status        string `json:"status"`
+	Result        string `json:"result,omitempty"`
+	Created       int64  `json:"created"`
+	Finished      int64  `json:"finished,omitempty"`
+
+	cancel  context.CancelFunc // Stops the task while it runs
+	done    chan struct{}      // Closed when the task finishes
+	waiters int                // Callers of Wait; a task being waited for is not announced
+}
+
+// Name returns the task's label, or its ID when it has none.
+func (t *SubagentTask) Name() string {
+	if t.Label != "" {
+		return t.Label
+	}
+	return t.ID
 }
 
 type SubagentManager struct {
@@ -36,8 +64,27 @@ type SubagentManager struct {
 	hasMaxTokens   bool
 	hasTemperature bool
 	nextID         int
+	resolver       SubagentResolver
+	maxDepth       int // 0 means unlimited
+	maxConcurrent  int // 0 means unlimited
+	active         int
+	freed          chan struct{} // Closed when a slot frees up, if anyone waits for one
+	timeout        time.Duration // How long a task may run; 0 means no limit
+	path           string        // Where task records are saved; empty keeps them in memory
 }
 
+// SubagentTarget is what a subagent runs as: the system prompt and tool
+// loop of the agent it was started for.
+type SubagentTarget struct {
+	AgentID      string
+	SystemPrompt string
+	Loop         ToolLoopConfig
+}
+
+// SubagentResolver returns what a subagent for agentID runs as, given its
+// task. An empty agentID means the agent that starts it.
+type SubagentResolver func(agentID, task string) (*SubagentTarget, error)
+
 func NewSubagentManager(provider providers.LLMProvider, defaultModel, workspace string, bus *bus.MessageBus) *SubagentManager {
 	return &SubagentManager{
 		tasks:         make(map[string]*SubagentTask),
@@ -76,10 +123,273 @@ func (sm *SubagentManager) RegisterTool(tool Tool) {
 	sm.tools.Register(tool)
 }
 
+// SetResolver sets how subagents find the agent they run as. Without one
+// they run with the manager's provider, model, tools and a generic prompt.
+func (sm *SubagentManager) SetResolver(resolver SubagentResolver) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.resolver = resolver
+}
+
+// SetLimits caps how deeply subagents may nest and how many may run at once.
+// Zero means no limit.
+func (sm *SubagentManager) SetLimits(maxDepth, maxConcurrent int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.maxDepth = maxDepth
+	sm.maxConcurrent = maxConcurrent
+}
+
+// SetTimeout limits how long each task may run. Zero means no limit.
+func (sm *SubagentManager) SetTimeout(timeout time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.timeout = timeout
+}
+
+// Persist saves task records and results to <workspace>/subagents/tasks.json
+// from now on, after loading those saved by an earlier run. Tasks that were
+// still running when that run stopped are marked interrupted and announced
+// to the chats that started them.
+func (sm *SubagentManager) Persist() error {
+	sm.mu.Lock()
+	path := filepath.Join(sm.workspace, "subagents", "tasks.json")
+	sm.path = path
+
+	var interrupted []*SubagentTask
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var saved []*SubagentTask
+		if err := json.Unmarshal(data, &saved); err != nil {
+			sm.mu.Unlock()
+			return fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		for _, task := range saved {
+			if task.Status == "running" {
+				task.Status = "interrupted"
+				task.Result = "The task was interrupted by a restart and did not finish."
+				task.Finished = time.Now().UnixMilli()
+				interrupted = append(interrupted, task)
+			}
+			if n, err := strconv.Atoi(strings.TrimPrefix(task.ID, "subagent-")); err == nil && n >= sm.nextID {
+				sm.nextID = n + 1
+			}
+			if _, exists := sm.tasks[task.ID]; !exists {
+				sm.tasks[task.ID] = task
+			}
+		}
+		sm.save()
+	} else if !os.IsNotExist(err) {
+		sm.mu.Unlock()
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sm.mu.Unlock()
+
+	for _, task := range interrupted {
+		sm.announce(task)
+	}
+	return nil
+}
+
+// save writes the task records when the manager persists them, dropping
+// the oldest finished tasks beyond maxFinishedTasks. Callers hold sm.mu.
+func (sm *SubagentManager) save() {
+	var finished []*SubagentTask
+	for _, task := range sm.tasks {
+		if task.Status != "running" {
+			finished = append(finished, task)
+		}
+	}
+	if len(finished) > maxFinishedTasks {
+		sort.Slice(finished, func(i, j int) bool { return finished[i].Created < finished[j].Created })
+		for _, task := range finished[:len(finished)-maxFinishedTasks] {
+			delete(sm.tasks, task.ID)
+		}
+	}
+	if sm.path == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(sm.sorted(), "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(sm.path), 0755)
+	}
+	if err == nil {
+		tmp := sm.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, sm.path)
+		}
+	}
+	if err != nil {
+		logger.WarnCF("subagent", "Failed to save subagent tasks", map[string]interface{}{
+			"path":  sm.path,
+			"error": err.Error(),
+		})
+	}
+}
+
+// sorted returns the tasks in the order they were created. Callers hold sm.mu.
+func (sm *SubagentManager) sorted() []*SubagentTask {
+	tasks := make([]*SubagentTask, 0, len(sm.tasks))
+	for _, task := range sm.tasks {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Created != tasks[j].Created {
+			return tasks[i].Created < tasks[j].Created
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks
+}
+
+// announce tells the agent in the task's chat how the task ended, through
+// a system message.
+func (sm *SubagentManager) announce(task *SubagentTask) {
+	if sm.bus == nil {
+		return
+	}
+	outcome := task.Status
+	switch task.Status {
+	case "timeout":
+		outcome = "timed out"
+	case "interrupted":
+		outcome = "was interrupted"
+	}
+	sm.bus.PublishInbound(bus.InboundMessage{
+		Channel:  "system",
+		SenderID: fmt.Sprintf("subagent:%s", task.ID),
+		// Format: "original_channel:original_chat_id" for routing back
+		ChatID:  fmt.Sprintf("%s:%s", task.OriginChannel, task.OriginChatID),
+		Content: fmt.Sprintf("Task '%s' %s.\n\nResult:\n%s", task.Name(), outcome, task.Result),
+	})
+}
+
+// target returns what a subagent for agentID runs as. systemPrompt is used
+// when there is no resolver.
+func (sm *SubagentManager) target(agentID, task, systemPrompt string) (*SubagentTarget, error) {
+	sm.mu.RLock()
+	resolver := sm.resolver
+	sm.mu.RUnlock()
+	if resolver != nil {
+		return resolver(agentID, task)
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var llmOptions map[string]any
+	if sm.hasMaxTokens || sm.hasTemperature {
+		llmOptions = map[string]any{}
+		if sm.hasMaxTokens {
+			llmOptions["max_tokens"] = sm.maxTokens
+		}
+		if sm.hasTemperature {
+			llmOptions["temperature"] = sm.temperature
+		}
+	}
+	return &SubagentTarget{
+		AgentID:      agentID,
+		SystemPrompt: systemPrompt,
+		Loop: ToolLoopConfig{
+			Provider:      sm.provider,
+			Model:         sm.defaultModel,
+			Tools:         sm.tools,
+			MaxIterations: sm.maxIterations,
+			LLMOptions:    llmOptions,
+		},
+	}, nil
+}
+
+// acquire takes a slot for a subagent started under ctx, or explains why
+// the depth or concurrency limit forbids it. Callers hold sm.mu and call
+// release when the subagent is done.
+func (sm *SubagentManager) acquire(ctx context.Context) error {
+	if depth := SubagentDepth(ctx); sm.maxDepth > 0 && depth >= sm.maxDepth {
+		return fmt.Errorf("subagents may not start further subagents (max depth %d)", sm.maxDepth)
+	}
+	if sm.full() {
+		return fmt.Errorf("%d subagents are already running, the most allowed; wait for one to finish", sm.active)
+	}
+	sm.active++
+	return nil
+}
+
+// acquireWait is acquire, except that at the concurrency limit it waits for
+// a slot until ctx is done. Subagents do not wait: they hold slots
+// themselves, so subagents waiting on each other could wait forever.
+// Callers hold sm.mu.
+func (sm *SubagentManager) acquireWait(ctx context.Context) error {
+	for sm.full() && SubagentDepth(ctx) == 0 {
+		if sm.freed == nil {
+			sm.freed = make(chan struct{})
+		}
+		freed := sm.freed
+		sm.mu.Unlock()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+		}
+		sm.mu.Lock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return sm.acquire(ctx)
+}
+
+func (sm *SubagentManager) full() bool {
+	return sm.maxConcurrent > 0 && sm.active >= sm.maxConcurrent
+}
+
+func (sm *SubagentManager) release() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.active--
+	if sm.freed != nil {
+		close(sm.freed)
+		sm.freed = nil
+	}
+}
+
+// run executes task as target, one level deeper than ctx.
+func (sm *SubagentManager) run(ctx context.Context, target *SubagentTarget, task, channel, chatID string) (*ToolLoopResult, error) {
+	ctx = WithSubagentDepth(ctx, SubagentDepth(ctx)+1)
+	if target.AgentID != "" {
+		caller := CallerFromContext(ctx)
+		caller.AgentID = target.AgentID
+		ctx = WithCaller(ctx, caller)
+	}
+
+	messages := []providers.Message{
+		{
+			Role:    "system",
+			Content: target.SystemPrompt,
+		},
+		{
+			Role:    "user",
+			Content: task,
+		},
+	}
+	return RunToolLoop(ctx, target.Loop, messages, channel, chatID)
+}
+
 func (sm *SubagentManager) Spawn(ctx context.Context, task, label, agentID, originChannel, originChatID string, callback AsyncCallback) (string, error) {
+	// Build system prompt for subagent
+	target, err := sm.target(agentID, task, `You are a subagent. Complete the given task independently and report the result.
+You have access to tools - use them as needed to complete your task.
+After completing the task, provide a clear summary of what was done.`)
+	if err != nil {
+		return "", err
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	if err := sm.acquire(ctx); err != nil {
+		return "", err
+	}
+
 	taskID := fmt.Sprintf("subagent-%d", sm.nextID)
 	sm.nextID++
 
@@ -92,11 +402,22 @@ func (sm *SubagentManager) Spawn(ctx context.Context, task, label, agentID, orig
 		OriginChatID:  originChatID,
 		Status:        "running",
 		Created:       time.Now().UnixMilli(),
+		done:          make(chan struct{}),
 	}
 	sm.tasks[taskID] = subagentTask
+	sm.save()
+
+	// The task outlives the request that spawned it, keeping its values
+	// (chat, caller, depth) but not its cancellation.
+	var taskCtx context.Context
+	if sm.timeout > 0 {
+		taskCtx, subagentTask.cancel = context.WithTimeout(context.WithoutCancel(ctx), sm.timeout)
+	} else {
+		taskCtx, subagentTask.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
 
 	// Start task in background with context cancellation support
-	go sm.runTask(ctx, subagentTask, callback)
+	go sm.runTask(taskCtx, subagentTask, target, callback)
 
 	if label != "" {
 		return fmt.Sprintf("Spawned subagent '%s' for task: %s", label, task), nil
@@ -104,83 +425,52 @@ func (sm *SubagentManager) Spawn(ctx context.Context, task, label, agentID, orig
 	return fmt.Sprintf("Spawned subagent for task: %s", task), nil
 }
 
-func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, callback AsyncCallback) {
-	task.Status = "running"
-	task.Created = time.Now().UnixMilli()
-
-	// Build system prompt for subagent
-	systemPrompt := `You are a subagent. Complete the given task independently and report the result.
-You have access to tools - use them as needed to complete your task.
-After completing the task, provide a clear summary of what was done.`
-
-	messages := []providers.Message{
-		{
-			Role:    "system",
-			Content: systemPrompt,
-		},
-		{
-			Role:    "user",
-			Content: task.Task,
-		},
-	}
-
-	// Check if context is already cancelled before starting
-	select {
-	case <-ctx.Done():
-		sm.mu.Lock()
-		task.Status = "cancelled"
-		task.Result = "Task cancelled before execution"
-		sm.mu.Unlock()
-		return
-	default:
-	}
+func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, target *SubagentTarget, callback AsyncCallback) {
+	defer sm.release()
+	defer task.cancel()
 
 	// Run tool loop with access to tools
-	sm.mu.RLock()
-	tools := sm.tools
-	maxIter := sm.maxIterations
-	maxTokens := sm.maxTokens
-	temperature := sm.temperature
-	hasMaxTokens := sm.hasMaxTokens
-	hasTemperature := sm.hasTemperature
-	sm.mu.RUnlock()
-
-	var llmOptions map[string]any
-	if hasMaxTokens || hasTemperature {
-		llmOptions = map[string]any{}
-		if hasMaxTokens {
-			llmOptions["max_tokens"] = maxTokens
-		}
-		if hasTemperature {
-			llmOptions["temperature"] = temperature
-		}
-	}
-
-	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
-		Provider:      sm.provider,
-		Model:         sm.defaultModel,
-		Tools:         tools,
-		MaxIterations: maxIter,
-		LLMOptions:    llmOptions,
-	}, messages, task.OriginChannel, task.OriginChatID)
+	loopResult, err := sm.run(ctx, target, task.Task, task.OriginChannel, task.OriginChatID)
 
 	sm.mu.Lock()
 	var result *ToolResult
+	announce := false
 	defer func() {
 		sm.mu.Unlock()
+		if announce {
+			sm.announce(task)
+		}
 		// Call callback if provided and result is set
 		if callback != nil && result != nil {
 			callback(ctx, result)
 		}
 	}()
+	defer close(task.done)
 
-	if err != nil {
+	task.Finished = time.Now().UnixMilli()
+	switch {
+	case err == nil:
+		task.Status = "completed"
+		task.Result = loopResult.Content
+		result = &ToolResult{
+			ForLLM:  fmt.Sprintf("Subagent '%s' completed (iterations: %d): %s", task.Label, loopResult.Iterations, loopResult.Content),
+			ForUser: loopResult.Content,
+			Silent:  false,
+			IsError: false,
+			Async:   false,
+		}
+	case errors.Is(ctx.Err(), context.Canceled):
+		// Cancelled on request; whoever asked knows, so nothing is announced.
+		task.Status = "cancelled"
+		task.Result = "Task cancelled during execution"
+		sm.save()
+		return
+	default:
 		task.Status = "failed"
 		task.Result = fmt.Sprintf("Error: %v", err)
-		// Check if it was cancelled
-		if ctx.Err() != nil {
-			task.Status = "cancelled"
-			task.Result = "Task cancelled during execution"
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			task.Status = "timeout"
+			task.Result = fmt.Sprintf("Task timed out after %s", sm.timeout)
 		}
 		result = &ToolResult{
 			ForLLM:  task.Result,
@@ -190,49 +480,117 @@ After completing the task, provide a clear summary of what was done.`
 			Async:   false,
 			Err:     err,
 		}
-	} else {
-		task.Status = "completed"
-		task.Result = loopResult.Content
-		result = &ToolResult{
-			ForLLM:  fmt.Sprintf("Subagent '%s' completed (iterations: %d): %s", task.Label, loopResult.Iterations, loopResult.Content),
-			ForUser: loopResult.Content,
-			Silent:  false,
-			IsError: false,
-			Async:   false,
-		}
 	}
+	sm.save()
 
-	// Send announce message back to main agent
-	if sm.bus != nil {
-		announceContent := fmt.Sprintf("Task '%s' completed.\n\nResult:\n%s", task.Label, task.Result)
-		sm.bus.PublishInbound(bus.InboundMessage{
-			Channel:  "system",
-			SenderID: fmt.Sprintf("subagent:%s", task.ID),
-			// Format: "original_channel:original_chat_id" for routing back
-			ChatID:  fmt.Sprintf("%s:%s", task.OriginChannel, task.OriginChatID),
-			Content: announceContent,
-		})
-	}
+	// Send announce message back to main agent, unless a waiter collects the result
+	announce = task.waiters == 0
 }
 
+// GetTask returns a copy of the task with the given ID.
 func (sm *SubagentManager) GetTask(taskID string) (*SubagentTask, bool) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 	task, ok := sm.tasks[taskID]
-	return task, ok
+	if !ok {
+		return nil, false
+	}
+	snapshot := *task
+	return &snapshot, true
 }
 
+// ListTasks returns copies of all tasks, oldest first.
 func (sm *SubagentManager) ListTasks() []*SubagentTask {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	tasks := make([]*SubagentTask, 0, len(sm.tasks))
-	for _, task := range sm.tasks {
-		tasks = append(tasks, task)
+	tasks := sm.sorted()
+	for i, task := range tasks {
+		snapshot := *task
+		tasks[i] = &snapshot
 	}
 	return tasks
 }
 
+// Cancel stops a running task.
+func (sm *SubagentManager) Cancel(taskID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	task, ok := sm.tasks[taskID]
+	if !ok {
+		return fmt.Errorf("no task %s", taskID)
+	}
+	if task.Status != "running" || task.cancel == nil {
+		return fmt.Errorf("task %s is not running (%s)", taskID, task.Status)
+	}
+	task.cancel()
+	return nil
+}
+
+// Wait blocks until the task finishes or ctx is done, and returns a copy of
+// it; its status is still running if ctx ended first. The result of a task
+// someone waits for is not announced to its chat.
+func (sm *SubagentManager) Wait(ctx context.Context, taskID string) (*SubagentTask, error) {
+	sm.mu.Lock()
+	task, ok := sm.tasks[taskID]
+	if !ok {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("no task %s", taskID)
+	}
+	done := task.done
+	task.waiters++
+	sm.mu.Unlock()
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	task.waiters--
+	snapshot := *task
+	return &snapshot, nil
+}
+
+// runSync runs task as agentID and waits for the result, within the depth,
+// concurrency and time limits. At the concurrency limit it fails, or with
+// wait set, waits for a slot as acquireWait does. systemPrompt is used
+// when there is no resolver.
+func (sm *SubagentManager) runSync(ctx context.Context, agentID, task, systemPrompt, channel, chatID string, wait bool) (*ToolLoopResult, error) {
+	target, err := sm.target(agentID, task, systemPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.mu.Lock()
+	if wait {
+		err = sm.acquireWait(ctx)
+	} else {
+		err = sm.acquire(ctx)
+	}
+	timeout := sm.timeout
+	sm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer sm.release()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := sm.run(ctx, target, task, channel, chatID)
+	if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", timeout)
+	}
+	return result, err
+}
+
 // SubagentTool executes a subagent task synchronously and returns the result.
 // Unlike SpawnTool which runs tasks asynchronously, SubagentTool waits for completion
 // and returns the result directly in the ToolResult.
@@ -292,47 +650,12 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult("Subagent manager not configured").WithError(fmt.Errorf("manager is nil"))
 	}
 
-	// Build messages for subagent
-	messages := []providers.Message{
-		{
-			Role:    "system",
-			Content: "You are a subagent. Complete the given task independently and provide a clear, concise result.",
-		},
-		{
-			Role:    "user",
-			Content: task,
-		},
-	}
-
-	// Use RunToolLoop to execute with tools (same as async SpawnTool)
-	sm := t.manager
-	sm.mu.RLock()
-	tools := sm.tools
-	maxIter := sm.maxIterations
-	maxTokens := sm.maxTokens
-	temperature := sm.temperature
-	hasMaxTokens := sm.hasMaxTokens
-	hasTemperature := sm.hasTemperature
-	sm.mu.RUnlock()
-
-	var llmOptions map[string]any
-	if hasMaxTokens || hasTemperature {
-		llmOptions = map[string]any{}
-		if hasMaxTokens {
-			llmOptions["max_tokens"] = maxTokens
-		}
-		if hasTemperature {
-			llmOptions["temperature"] = temperature
-		}
-	}
+	originChannel, originChatID := ToolContext(ctx, t.originChannel, t.originChatID)
 
-	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
-		Provider:      sm.provider,
-		Model:         sm.defaultModel,
-		Tools:         tools,
-		MaxIterations: maxIter,
-		LLMOptions:    llmOptions,
-	}, messages, t.originChannel, t.originChatID)
+	// Use the same loop as async SpawnTool
+	loopResult, err := t.manager.runSync(ctx, "", task,
+		"You are a subagent. Complete the given task independently and provide a clear, concise result.",
+		originChannel, originChatID, false)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("Subagent execution failed: %v", err)).WithError(err)
 	}
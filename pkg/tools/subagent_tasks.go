@@ -0,0 +1,222 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// defaultWaitSeconds and maxWaitSeconds bound how long subagent_wait blocks.
+const (
+	defaultWaitSeconds = 60
+	maxWaitSeconds     = 600
+)
+
+// FormatSubagentTask describes a task on one line: ID, status, how long it
+// ran, the agent it runs as and what it was asked to do.
+func FormatSubagentTask(task *SubagentTask) string {
+	end := time.Now()
+	if task.Finished > 0 {
+		end = time.UnixMilli(task.Finished)
+	}
+	elapsed := end.Sub(time.UnixMilli(task.Created)).Round(time.Second)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s", task.ID, task.Status, elapsed)
+	if task.AgentID != "" {
+		fmt.Fprintf(&sb, " [%s]", task.AgentID)
+	}
+	if task.Label != "" {
+		fmt.Fprintf(&sb, " %s:", task.Label)
+	}
+	fmt.Fprintf(&sb, " %s", utils.Truncate(strings.ReplaceAll(task.Task, "\n", " "), 80))
+	return sb.String()
+}
+
+// chatTask returns the task with the given ID if it was started from the
+// chat of ctx. Tasks of other chats are hidden, as they may belong to
+// other users.
+func chatTask(ctx context.Context, manager *SubagentManager, taskID string) (*SubagentTask, *ToolResult) {
+	if manager == nil {
+		return nil, ErrorResult("Subagent manager not configured")
+	}
+	if taskID == "" {
+		return nil, ErrorResult("task_id is required")
+	}
+	channel, chatID := ToolContext(ctx, "", "")
+	task, ok := manager.GetTask(taskID)
+	if !ok || task.OriginChannel != channel || task.OriginChatID != chatID {
+		return nil, ErrorResult(fmt.Sprintf("no task %s in this chat", taskID))
+	}
+	return task, nil
+}
+
+// describeTask reports a task and, once it has finished, its result.
+func describeTask(task *SubagentTask) string {
+	if task.Status == "running" {
+		return FormatSubagentTask(task)
+	}
+	return FormatSubagentTask(task) + "\n\nResult:\n" + task.Result
+}
+
+// SubagentStatusTool reports on the subagent tasks started from the chat.
+type SubagentStatusTool struct {
+	manager *SubagentManager
+}
+
+func NewSubagentStatusTool(manager *SubagentManager) *SubagentStatusTool {
+	return &SubagentStatusTool{manager: manager}
+}
+
+func (t *SubagentStatusTool) Name() string {
+	return "subagent_status"
+}
+
+func (t *SubagentStatusTool) Description() string {
+	return "List the subagent tasks spawned in this chat with their status, or show one task and its result."
+}
+
+func (t *SubagentStatusTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"task_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional task ID, such as subagent-3; omit to list all tasks",
+			},
+		},
+	}
+}
+
+// ConcurrencySafe implements ConcurrentTool: status is read-only.
+func (t *SubagentStatusTool) ConcurrencySafe(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *SubagentStatusTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if taskID, _ := args["task_id"].(string); taskID != "" {
+		task, errResult := chatTask(ctx, t.manager, taskID)
+		if errResult != nil {
+			return errResult
+		}
+		return SilentResult(describeTask(task))
+	}
+
+	if t.manager == nil {
+		return ErrorResult("Subagent manager not configured")
+	}
+	channel, chatID := ToolContext(ctx, "", "")
+	var lines []string
+	for _, task := range t.manager.ListTasks() {
+		if task.OriginChannel == channel && task.OriginChatID == chatID {
+			lines = append(lines, FormatSubagentTask(task))
+		}
+	}
+	if len(lines) == 0 {
+		return SilentResult("No subagent tasks in this chat.")
+	}
+	return SilentResult(strings.Join(lines, "\n"))
+}
+
+// SubagentCancelTool stops a running subagent task.
+type SubagentCancelTool struct {
+	manager *SubagentManager
+}
+
+func NewSubagentCancelTool(manager *SubagentManager) *SubagentCancelTool {
+	return &SubagentCancelTool{manager: manager}
+}
+
+func (t *SubagentCancelTool) Name() string {
+	return "subagent_cancel"
+}
+
+func (t *SubagentCancelTool) Description() string {
+	return "Cancel a running subagent task spawned in this chat. Its result will not be reported."
+}
+
+func (t *SubagentCancelTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"task_id": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the task to cancel, such as subagent-3",
+			},
+		},
+		"required": []string{"task_id"},
+	}
+}
+
+func (t *SubagentCancelTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	taskID, _ := args["task_id"].(string)
+	if _, errResult := chatTask(ctx, t.manager, taskID); errResult != nil {
+		return errResult
+	}
+	if err := t.manager.Cancel(taskID); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return SilentResult(fmt.Sprintf("Task %s cancelled.", taskID))
+}
+
+// SubagentWaitTool waits for a subagent task to finish and returns its
+// result, which is then not announced separately.
+type SubagentWaitTool struct {
+	manager *SubagentManager
+}
+
+func NewSubagentWaitTool(manager *SubagentManager) *SubagentWaitTool {
+	return &SubagentWaitTool{manager: manager}
+}
+
+func (t *SubagentWaitTool) Name() string {
+	return "subagent_wait"
+}
+
+func (t *SubagentWaitTool) Description() string {
+	return "Wait for a subagent task spawned in this chat to finish and return its result. Use this when you need the result to continue; otherwise the result is reported when the task finishes."
+}
+
+func (t *SubagentWaitTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"task_id": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the task to wait for, such as subagent-3",
+			},
+			"timeout_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("How long to wait (default %d, at most %d)", defaultWaitSeconds, maxWaitSeconds),
+			},
+		},
+		"required": []string{"task_id"},
+	}
+}
+
+func (t *SubagentWaitTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	taskID, _ := args["task_id"].(string)
+	if _, errResult := chatTask(ctx, t.manager, taskID); errResult != nil {
+		return errResult
+	}
+
+	seconds := defaultWaitSeconds
+	if v, ok := args["timeout_seconds"].(float64); ok && v > 0 {
+		seconds = min(int(v), maxWaitSeconds)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+	defer cancel()
+
+	task, err := t.manager.Wait(waitCtx, taskID)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if task.Status == "running" {
+		return SilentResult(fmt.Sprintf("Task %s is still running after %ds. Wait again or let it report when it finishes.\n%s",
+			taskID, seconds, FormatSubagentTask(task)))
+	}
+	return SilentResult(describeTask(task))
+}
@@ -2,8 +2,11 @@ package tools
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -342,3 +345,215 @@ func TestSubagentTool_ForUserTruncation(t *testing.T) {
 		t.Error("ForLLM should contain reference to original task")
 	}
 }
+
+// blockingLLMProvider answers once release is closed.
+type blockingLLMProvider struct {
+	release chan struct{}
+}
+
+func (m *blockingLLMProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	select {
+	case <-m.release:
+		return &providers.LLMResponse{Content: "done"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *blockingLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSubagentManager_Limits(t *testing.T) {
+	provider := &blockingLLMProvider{release: make(chan struct{})}
+	manager := NewSubagentManager(provider, "test-model", "/tmp/test", nil)
+	manager.SetLimits(1, 2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := manager.Spawn(ctx, "wait", "", "", "cli", "direct", nil); err != nil {
+			t.Fatalf("spawn %d: %v", i, err)
+		}
+	}
+	if _, err := manager.Spawn(ctx, "wait", "", "", "cli", "direct", nil); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("third spawn: err = %v, want the concurrency limit", err)
+	}
+	if result := NewSubagentTool(manager).Execute(ctx, map[string]interface{}{"task": "wait"}); !result.IsError {
+		t.Errorf("subagent tool ran past the concurrency limit: %+v", result)
+	}
+
+	close(provider.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := manager.Spawn(ctx, "again", "", "", "cli", "direct", nil); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slots were not freed when subagents finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := manager.Spawn(WithSubagentDepth(ctx, 1), "nested", "", "", "cli", "direct", nil); err == nil || !strings.Contains(err.Error(), "depth") {
+		t.Errorf("nested spawn: err = %v, want the depth limit", err)
+	}
+}
+
+func TestSubagentManager_Resolver(t *testing.T) {
+	manager := NewSubagentManager(nil, "unused", "/tmp/test", nil)
+	probe := &probeTool{name: "probe", safe: true, mu: new(sync.Mutex), active: new(int), maxActive: new(int), log: new([]string)}
+
+	var gotDepth int
+	var gotCaller Caller
+	manager.SetResolver(func(agentID, task string) (*SubagentTarget, error) {
+		if agentID == "ghost" {
+			return nil, fmt.Errorf("agent %q is not configured", agentID)
+		}
+		return &SubagentTarget{
+			AgentID:      "researcher",
+			SystemPrompt: "You are the researcher.",
+			Loop: ToolLoopConfig{
+				Provider:      &toolCallOnceProvider{},
+				Model:         "research-model",
+				MaxIterations: 3,
+				ExecuteCalls: func(ctx context.Context, calls []providers.ToolCall, channel, chatID string) []*ToolResult {
+					gotDepth, gotCaller = SubagentDepth(ctx), CallerFromContext(ctx)
+					return []*ToolResult{probe.Execute(ctx, calls[0].Arguments)}
+				},
+			},
+		}, nil
+	})
+
+	if _, err := manager.Spawn(context.Background(), "task", "", "ghost", "cli", "direct", nil); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("spawn for an unknown agent: err = %v", err)
+	}
+
+	ctx := WithCaller(context.Background(), Caller{AgentID: "main", SessionKey: "agent:main:test"})
+	result := NewSubagentTool(manager).Execute(ctx, map[string]interface{}{"task": "probe"})
+	if result.IsError || !strings.Contains(result.ForUser, "result 7") {
+		t.Fatalf("result = %+v", result)
+	}
+	if gotDepth != 1 || gotCaller.AgentID != "researcher" || gotCaller.SessionKey != "agent:main:test" {
+		t.Errorf("tool ran at depth %d for %+v", gotDepth, gotCaller)
+	}
+}
+
+// toolCallOnceProvider asks for one probe call, then replies with its result.
+type toolCallOnceProvider struct{}
+
+func (m *toolCallOnceProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	if last := messages[len(messages)-1]; last.Role == "tool" {
+		return &providers.LLMResponse{Content: last.Content}, nil
+	}
+	return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+		ID: "call-1", Name: "probe", Arguments: map[string]interface{}{"id": "7"},
+	}}}, nil
+}
+
+func (m *toolCallOnceProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSubagentManager_CancelAndTimeout(t *testing.T) {
+	provider := &blockingLLMProvider{release: make(chan struct{})}
+	msgBus := bus.NewMessageBus()
+	manager := NewSubagentManager(provider, "test-model", t.TempDir(), msgBus)
+	ctx := context.Background()
+
+	if _, err := manager.Spawn(ctx, "wait", "", "", "telegram", "42", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Cancel("subagent-1"); err != nil {
+		t.Fatal(err)
+	}
+	task, err := manager.Wait(ctx, "subagent-1")
+	if err != nil || task.Status != "cancelled" {
+		t.Fatalf("task = %+v, %v; want cancelled", task, err)
+	}
+	if err := manager.Cancel("subagent-1"); err == nil {
+		t.Error("cancelled a finished task")
+	}
+
+	manager.SetTimeout(50 * time.Millisecond)
+	if _, err := manager.Spawn(ctx, "wait", "slow", "", "telegram", "42", nil); err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(waitCtx)
+	if !ok || msg.SenderID != "subagent:subagent-2" || !strings.Contains(msg.Content, "Task 'slow' timed out") {
+		t.Fatalf("announcement = %+v; want the timeout of subagent-2 only", msg)
+	}
+}
+
+func TestSubagentManager_Persist(t *testing.T) {
+	workspace := t.TempDir()
+	provider := &blockingLLMProvider{release: make(chan struct{})}
+	first := NewSubagentManager(provider, "test-model", workspace, nil)
+	if err := first.Persist(); err != nil {
+		t.Fatal(err)
+	}
+	for _, label := range []string{"quick", "slow"} {
+		if _, err := first.Spawn(context.Background(), label+" task", label, "", "telegram", "42", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first.Cancel("subagent-1")
+	first.Wait(context.Background(), "subagent-1")
+
+	// A restart while subagent-2 runs
+	msgBus := bus.NewMessageBus()
+	second := NewSubagentManager(provider, "test-model", workspace, msgBus)
+	if err := second.Persist(); err != nil {
+		t.Fatal(err)
+	}
+	tasks := second.ListTasks()
+	if len(tasks) != 2 || tasks[0].Status != "cancelled" || tasks[1].Status != "interrupted" {
+		t.Fatalf("restored tasks = %+v", tasks)
+	}
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(waitCtx)
+	if !ok || msg.ChatID != "telegram:42" || !strings.Contains(msg.Content, "Task 'slow' was interrupted") {
+		t.Errorf("announcement = %+v", msg)
+	}
+
+	result, err := second.Spawn(context.Background(), "next", "", "", "telegram", "42", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := second.GetTask("subagent-3"); !ok {
+		t.Errorf("new task after restart: %s; want ID subagent-3", result)
+	}
+	close(provider.release)
+	// Let both managers save their last records before the workspace goes.
+	first.Wait(context.Background(), "subagent-2")
+	second.Wait(context.Background(), "subagent-3")
+}
+
+func TestSubagentTaskTools(t *testing.T) {
+	provider := &blockingLLMProvider{release: make(chan struct{})}
+	manager := NewSubagentManager(provider, "test-model", t.TempDir(), nil)
+	manager.Spawn(context.Background(), "look around", "survey", "", "telegram", "42", nil)
+	manager.Spawn(context.Background(), "elsewhere", "", "", "telegram", "99", nil)
+
+	ctx := WithToolContext(context.Background(), "telegram", "42")
+	status := NewSubagentStatusTool(manager).Execute(ctx, map[string]interface{}{})
+	if !strings.Contains(status.ForLLM, "subagent-1 running") || strings.Contains(status.ForLLM, "subagent-2") {
+		t.Errorf("status = %q; want only this chat's task", status.ForLLM)
+	}
+	if result := NewSubagentCancelTool(manager).Execute(ctx, map[string]interface{}{"task_id": "subagent-2"}); !result.IsError {
+		t.Error("cancelled a task of another chat")
+	}
+
+	wait := NewSubagentWaitTool(manager).Execute(ctx, map[string]interface{}{"task_id": "subagent-1", "timeout_seconds": 0.05})
+	if wait.IsError {
+		t.Fatal(wait.ForLLM)
+	}
+	close(provider.release)
+	wait = NewSubagentWaitTool(manager).Execute(ctx, map[string]interface{}{"task_id": "subagent-1"})
+	if !strings.Contains(wait.ForLLM, "subagent-1 completed") || !strings.Contains(wait.ForLLM, "Result:\ndone") {
+		t.Errorf("wait = %q", wait.ForLLM)
+	}
+}
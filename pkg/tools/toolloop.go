@@ -23,6 +23,14 @@ type ToolLoopConfig struct {
 	Tools         *ToolRegistry
 	MaxIterations int
 	LLMOptions    map[string]any
+
+	// Chat, when set, makes each LLM call in place of Provider and Model,
+	// so the caller can record usage and enforce its budgets.
+	Chat func(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, options map[string]any) (*providers.LLMResponse, error)
+
+	// ExecuteCalls, when set, runs the tool calls of each response instead
+	// of Tools and returns one result per call, in order.
+	ExecuteCalls func(ctx context.Context, calls []providers.ToolCall, channel, chatID string) []*ToolResult
 }
 
 // ToolLoopResult contains the result of running the tool loop.
@@ -58,7 +66,13 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 			llmOpts = map[string]any{}
 		}
 		// 3. Call LLM
-		response, err := config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
+		var response *providers.LLMResponse
+		var err error
+		if config.Chat != nil {
+			response, err = config.Chat(ctx, messages, providerToolDefs, llmOpts)
+		} else {
+			response, err = config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
+		}
 		if err != nil {
 			logger.ErrorCF("toolloop", "LLM call failed",
 				map[string]any{
@@ -125,12 +139,21 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 					"tool":      tc.Name,
 					"iteration": iteration,
 				})
+		}
+		var toolResults []*ToolResult
+		if config.ExecuteCalls != nil {
+			toolResults = config.ExecuteCalls(ctx, normalizedToolCalls, channel, chatID)
+		}
 
+		for i, tc := range normalizedToolCalls {
 			// Execute tool (no async callback for subagents - they run independently)
 			var toolResult *ToolResult
-			if config.Tools != nil {
+			switch {
+			case toolResults != nil:
+				toolResult = toolResults[i]
+			case config.Tools != nil:
 				toolResult = config.Tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, channel, chatID, nil)
-			} else {
+			default:
 				toolResult = ErrorResult("No tools available")
 			}
 
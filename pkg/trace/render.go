@@ -0,0 +1,104 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// previewLen caps message and result text when rendering without verbose.
+const previewLen = 300
+
+// Render writes a readable account of t to w. verbose prints every message
+// sent to the LLM and untruncated text; otherwise only what changed in each
+// step is shown.
+func Render(w io.Writer, t *Trace, verbose bool) {
+	text := func(s string) string {
+		if verbose {
+			return s
+		}
+		return utils.Truncate(s, previewLen)
+	}
+
+	fmt.Fprintf(w, "Trace %s\n", t.ID)
+	fmt.Fprintf(w, "Agent:   %s\n", t.AgentID)
+	fmt.Fprintf(w, "Session: %s\n", t.SessionKey)
+	if t.Channel != "" {
+		fmt.Fprintf(w, "Chat:    %s/%s\n", t.Channel, t.ChatID)
+	}
+	fmt.Fprintf(w, "Started: %s (%s, %d steps)\n", t.Start.Local().Format("2006-01-02 15:04:05"),
+		time.Duration(t.DurationMS)*time.Millisecond, len(t.Steps))
+	fmt.Fprintf(w, "User:    %s\n", text(t.UserMessage))
+
+	for i, step := range t.Steps {
+		fmt.Fprintf(w, "\n── Step %d: %s, %s, %d messages, %d tools ──\n", i+1, step.Model,
+			time.Duration(step.DurationMS)*time.Millisecond, len(step.Request), len(step.Tools))
+		if verbose {
+			for j, msg := range step.Request {
+				fmt.Fprintf(w, "  [%d %s] %s\n", j, msg.Role, formatMessage(msg))
+			}
+			fmt.Fprintln(w)
+		}
+		if step.Response.Content != "" {
+			fmt.Fprintf(w, "Assistant: %s\n", text(step.Response.Content))
+		}
+		for _, tc := range step.Response.ToolCalls {
+			fmt.Fprintf(w, "→ %s %s\n", toolCallName(tc), text(toolCallArgs(tc)))
+			for _, result := range step.ToolResults {
+				if result.ToolCallID != tc.ID {
+					continue
+				}
+				marker := "←"
+				if result.IsError {
+					marker = "← error:"
+				}
+				fmt.Fprintf(w, "%s %s\n", marker, text(result.Content))
+			}
+		}
+		if u := step.Response.Usage; u != nil {
+			fmt.Fprintf(w, "Tokens: %d prompt, %d completion\n", u.PromptTokens, u.CompletionTokens)
+		}
+	}
+
+	fmt.Fprintln(w)
+	if t.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", t.Error)
+	} else {
+		fmt.Fprintf(w, "Response: %s\n", text(t.Response))
+	}
+}
+
+// formatMessage renders the content of a request message on one line.
+func formatMessage(msg providers.Message) string {
+	var parts []string
+	if msg.Content != "" {
+		parts = append(parts, msg.Content)
+	}
+	for _, tc := range msg.ToolCalls {
+		parts = append(parts, fmt.Sprintf("→ %s %s", toolCallName(tc), toolCallArgs(tc)))
+	}
+	if msg.ToolCallID != "" {
+		parts = append([]string{"(" + msg.ToolCallID + ")"}, parts...)
+	}
+	return strings.Join(parts, " ")
+}
+
+func toolCallName(tc providers.ToolCall) string {
+	if tc.Name == "" && tc.Function != nil {
+		return tc.Function.Name
+	}
+	return tc.Name
+}
+
+func toolCallArgs(tc providers.ToolCall) string {
+	if tc.Arguments == nil && tc.Function != nil {
+		return tc.Function.Arguments
+	}
+	data, _ := json.Marshal(tc.Arguments)
+	return string(data)
+}
@@ -0,0 +1,128 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// ReplayProvider answers LLM calls with the responses recorded in a trace,
+// in order. Token usage is dropped so that a replay spends nothing.
+type ReplayProvider struct {
+	mu    sync.Mutex
+	steps []*Step
+	next  int
+}
+
+func NewReplayProvider(t *Trace) *ReplayProvider {
+	return &ReplayProvider{steps: t.Steps}
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.next >= len(p.steps) {
+		return nil, fmt.Errorf("trace has no response for step %d", p.next+1)
+	}
+	response := p.steps[p.next].Response
+	response.ToolCalls = append([]providers.ToolCall(nil), response.ToolCalls...)
+	response.Usage = nil
+	p.next++
+	return &response, nil
+}
+
+func (p *ReplayProvider) GetDefaultModel() string {
+	return "replay"
+}
+
+// Diff describes how a replay differs from the recorded trace: the steps
+// taken, the tools offered, the messages sent and the outcome. It returns
+// nil when they match.
+func Diff(recorded, replayed *Trace) []string {
+	var diffs []string
+	if len(recorded.Steps) != len(replayed.Steps) {
+		diffs = append(diffs, fmt.Sprintf("recorded %d steps, replay took %d", len(recorded.Steps), len(replayed.Steps)))
+	}
+
+	for i := 0; i < len(recorded.Steps) && i < len(replayed.Steps); i++ {
+		before, after := recorded.Steps[i], replayed.Steps[i]
+		if added, removed := diffNames(before.Tools, after.Tools); len(added)+len(removed) > 0 {
+			diffs = append(diffs, fmt.Sprintf("step %d: tools added %v, removed %v", i+1, added, removed))
+		}
+		if len(before.Request) != len(after.Request) {
+			diffs = append(diffs, fmt.Sprintf("step %d: %d messages sent, recorded %d", i+1, len(after.Request), len(before.Request)))
+		}
+		for j := 0; j < len(before.Request) && j < len(after.Request); j++ {
+			if d := diffMessage(before.Request[j], after.Request[j]); d != "" {
+				diffs = append(diffs, fmt.Sprintf("step %d: message %d (%s) %s", i+1, j, after.Request[j].Role, d))
+			}
+		}
+	}
+
+	if recorded.Response != replayed.Response {
+		diffs = append(diffs, fmt.Sprintf("response differs:\n  - %s\n  + %s",
+			utils.Truncate(recorded.Response, previewLen), utils.Truncate(replayed.Response, previewLen)))
+	}
+	if recorded.Error != replayed.Error {
+		diffs = append(diffs, fmt.Sprintf("error differs:\n  - %s\n  + %s", recorded.Error, replayed.Error))
+	}
+	return diffs
+}
+
+// diffMessage describes the first difference between two messages, or
+// returns "" if they are the same.
+func diffMessage(before, after providers.Message) string {
+	if before.Role != after.Role {
+		return fmt.Sprintf("was %s", before.Role)
+	}
+	if before.Content != after.Content {
+		beforeLines, afterLines := strings.Split(before.Content, "\n"), strings.Split(after.Content, "\n")
+		for i := 0; i < len(beforeLines) || i < len(afterLines); i++ {
+			var o, n string
+			if i < len(beforeLines) {
+				o = beforeLines[i]
+			}
+			if i < len(afterLines) {
+				n = afterLines[i]
+			}
+			if o != n {
+				return fmt.Sprintf("differs at line %d:\n  - %s\n  + %s", i+1, utils.Truncate(o, previewLen), utils.Truncate(n, previewLen))
+			}
+		}
+	}
+	before.Content, after.Content = "", ""
+	beforeJSON, _ := json.Marshal(before)
+	afterJSON, _ := json.Marshal(after)
+	if string(beforeJSON) != string(afterJSON) {
+		return "differs in tool calls or attachments"
+	}
+	return ""
+}
+
+// diffNames returns the names only in after and those only in before.
+func diffNames(before, after []string) (added, removed []string) {
+	seen := make(map[string]int)
+	for _, name := range before {
+		seen[name]--
+	}
+	for _, name := range after {
+		seen[name]++
+	}
+	for _, name := range after {
+		if seen[name] > 0 {
+			added = append(added, name)
+		}
+	}
+	for _, name := range before {
+		if seen[name] < 0 {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
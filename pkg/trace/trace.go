@@ -0,0 +1,226 @@
+// Package trace records agent turns: every request sent to the LLM, the
+// response and the results of the tools it called, so that a turn can be
+// inspected and replayed later.
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// DefaultMaxTraces is how many traces a store keeps when no limit is set.
+const DefaultMaxTraces = 100
+
+// Trace is the record of one agent turn.
+type Trace struct {
+	ID          string              `json:"id"`
+	AgentID     string              `json:"agent_id"`
+	SessionKey  string              `json:"session_key"`
+	Channel     string              `json:"channel,omitempty"`
+	ChatID      string              `json:"chat_id,omitempty"`
+	UserMessage string              `json:"user_message"`
+	Media       []string            `json:"media,omitempty"`
+	History     []providers.Message `json:"history,omitempty"` // Session history the turn started from
+	Summary     string              `json:"summary,omitempty"`
+	Start       time.Time           `json:"start"`
+	DurationMS  int64               `json:"duration_ms"`
+	Steps       []*Step             `json:"steps"`
+	Response    string              `json:"response,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// Step is one LLM call of a turn and the tool calls it asked for.
+type Step struct {
+	Model       string                `json:"model,omitempty"`
+	Request     []providers.Message   `json:"request"`
+	Tools       []string              `json:"tools,omitempty"` // Names of the tools offered, sorted
+	Response    providers.LLMResponse `json:"response"`
+	DurationMS  int64                 `json:"duration_ms"`
+	ToolResults []ToolResult          `json:"tool_results,omitempty"`
+}
+
+// ToolResult is what one tool call returned to the LLM.
+type ToolResult struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name"`
+	Content    string `json:"content"`
+	IsError    bool   `json:"is_error,omitempty"`
+}
+
+// New starts the trace of a turn. IDs sort by start time.
+func New(agentID, sessionKey, channel, chatID, userMessage string) *Trace {
+	now := time.Now()
+	return &Trace{
+		ID:          now.Format("20060102-150405") + "-" + uuid.NewString()[:6],
+		AgentID:     agentID,
+		SessionKey:  sessionKey,
+		Channel:     channel,
+		ChatID:      chatID,
+		UserMessage: userMessage,
+		Start:       now,
+	}
+}
+
+// AddStep records an LLM call. Calling it on a nil trace does nothing, so
+// callers need not check whether tracing is on.
+func (t *Trace) AddStep(model string, request []providers.Message, tools []providers.ToolDefinition, response *providers.LLMResponse, duration time.Duration) *Step {
+	if t == nil {
+		return nil
+	}
+	step := &Step{
+		Model:      model,
+		Request:    append([]providers.Message(nil), request...),
+		Response:   *response,
+		DurationMS: duration.Milliseconds(),
+	}
+	for _, tool := range tools {
+		step.Tools = append(step.Tools, tool.Function.Name)
+	}
+	sort.Strings(step.Tools)
+	t.Steps = append(t.Steps, step)
+	return step
+}
+
+// AddToolResult records the result of a tool call made in the step. Calling
+// it on a nil step does nothing.
+func (s *Step) AddToolResult(tc providers.ToolCall, content string, isError bool) {
+	if s == nil {
+		return
+	}
+	s.ToolResults = append(s.ToolResults, ToolResult{
+		ToolCallID: tc.ID,
+		Name:       tc.Name,
+		Content:    content,
+		IsError:    isError,
+	})
+}
+
+// Finish records how the turn ended.
+func (t *Trace) Finish(response string, err error) {
+	if t == nil {
+		return
+	}
+	t.DurationMS = time.Since(t.Start).Milliseconds()
+	t.Response = response
+	if err != nil {
+		t.Error = err.Error()
+	}
+}
+
+// Store keeps traces as JSON files in <workspace>/traces, dropping the
+// oldest beyond its limit. Thread-safe.
+type Store struct {
+	mu  sync.Mutex
+	dir string
+	max int
+}
+
+// NewStore returns the trace store of a workspace. A max of 0 keeps
+// DefaultMaxTraces.
+func NewStore(workspace string, max int) *Store {
+	if max <= 0 {
+		max = DefaultMaxTraces
+	}
+	return &Store{dir: filepath.Join(workspace, "traces"), max: max}
+}
+
+// Save writes t and prunes the oldest traces over the limit.
+func (s *Store) Save(t *Trace) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trace: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create trace directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, t.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+
+	ids, err := s.list()
+	if err != nil {
+		return err
+	}
+	for len(ids) > s.max {
+		os.Remove(filepath.Join(s.dir, ids[0]+".json"))
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// Load reads the trace with the given ID or unique ID prefix.
+func (s *Store) Load(id string) (*Trace, error) {
+	s.mu.Lock()
+	ids, err := s.list()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, candidate := range ids {
+		if candidate == id {
+			matches = []string{candidate}
+			break
+		}
+		if strings.HasPrefix(candidate, id) {
+			matches = append(matches, candidate)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("trace %s not found", id)
+	case 1:
+	default:
+		return nil, fmt.Errorf("trace %s is ambiguous: %s", id, strings.Join(matches, ", "))
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, matches[0]+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+	var t Trace
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to decode trace %s: %w", matches[0], err)
+	}
+	return &t, nil
+}
+
+// List returns the IDs of the stored traces, oldest first.
+func (s *Store) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *Store) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list traces: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestStore_SaveLoadAndPrune(t *testing.T) {
+	store := NewStore(t.TempDir(), 2)
+	for i := 0; i < 3; i++ {
+		tr := New("main", "agent:main:test", "cli", "direct", fmt.Sprintf("message %d", i))
+		tr.ID = fmt.Sprintf("20260101-00000%d-abcdef", i)
+		if err := store.Save(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "20260101-000001-abcdef" || ids[1] != "20260101-000002-abcdef" {
+		t.Fatalf("ids = %v, want the two newest, oldest first", ids)
+	}
+
+	tr, err := store.Load("20260101-000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.UserMessage != "message 2" {
+		t.Errorf("loaded %q", tr.UserMessage)
+	}
+	if _, err := store.Load("20260101"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("ambiguous prefix: err = %v", err)
+	}
+	if _, err := store.Load("20260101-000000"); err == nil {
+		t.Error("pruned trace was loaded")
+	}
+}
+
+func TestDiffAndRender(t *testing.T) {
+	record := func(system string, tools []string) *Trace {
+		tr := New("main", "agent:main:test", "cli", "direct", "list files")
+		var defs []providers.ToolDefinition
+		for _, name := range tools {
+			defs = append(defs, providers.ToolDefinition{Type: "function", Function: providers.ToolFunctionDefinition{Name: name}})
+		}
+		call := providers.ToolCall{ID: "call-1", Name: "exec", Arguments: map[string]interface{}{"command": "ls"}}
+		step := tr.AddStep("model", []providers.Message{{Role: "system", Content: system}, {Role: "user", Content: "list files"}},
+			defs, &providers.LLMResponse{ToolCalls: []providers.ToolCall{call}}, time.Second)
+		step.AddToolResult(call, "a.txt", false)
+		tr.AddStep("model", nil, defs, &providers.LLMResponse{Content: "a.txt"}, time.Second)
+		tr.Finish("a.txt", nil)
+		return tr
+	}
+
+	recorded := record("You are picoclaw.\nBe brief.", []string{"exec", "read_file"})
+	if diffs := Diff(recorded, record("You are picoclaw.\nBe brief.", []string{"read_file", "exec"})); len(diffs) != 0 {
+		t.Errorf("identical runs differ: %v", diffs)
+	}
+
+	diffs := Diff(recorded, record("You are picoclaw.\nBe thorough.", []string{"exec", "web_fetch"}))
+	joined := strings.Join(diffs, "\n")
+	for _, want := range []string{"added [web_fetch], removed [read_file]", "message 0 (system) differs at line 2", "+ Be thorough."} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("diff lacks %q:\n%s", want, joined)
+		}
+	}
+
+	var out bytes.Buffer
+	Render(&out, recorded, false)
+	for _, want := range []string{"── Step 1: model", `→ exec {"command":"ls"}`, "← a.txt", "Response: a.txt"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("render lacks %q:\n%s", want, out.String())
+		}
+	}
+}
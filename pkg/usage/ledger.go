@@ -0,0 +1,137 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record is the token usage of one LLM call.
+type Record struct {
+	Time             time.Time `json:"time"`
+	AgentID          string    `json:"agent_id"`
+	SessionKey       string    `json:"session_key"`
+	Channel          string    `json:"channel,omitempty"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost,omitempty"` // USD, when the model has a price
+}
+
+// TotalTokens returns prompt plus completion tokens.
+func (r Record) TotalTokens() int {
+	return r.PromptTokens + r.CompletionTokens
+}
+
+// Ledger appends usage records to a JSONL file in the workspace and keeps
+// today's per-session totals in memory for budget checks. Thread-safe.
+type Ledger struct {
+	mu      sync.Mutex
+	path    string
+	day     string         // local date the totals below belong to
+	today   map[string]int // session key -> tokens used today
+	nowFunc func() time.Time
+}
+
+// NewLedger opens the ledger at <workspace>/usage/ledger.jsonl, loading
+// today's totals from any existing records.
+func NewLedger(workspace string) *Ledger {
+	l := &Ledger{
+		path:    filepath.Join(workspace, "usage", "ledger.jsonl"),
+		today:   make(map[string]int),
+		nowFunc: time.Now,
+	}
+	l.day = dayOf(l.nowFunc())
+
+	since, _ := time.ParseInLocation("2006-01-02", l.day, time.Local)
+	records, _ := l.Records(since)
+	for _, r := range records {
+		l.today[r.SessionKey] += r.TotalTokens()
+	}
+	return l
+}
+
+// Add appends r to the ledger. A zero Time is set to now.
+func (l *Ledger) Add(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r.Time.IsZero() {
+		r.Time = l.nowFunc()
+	}
+	l.rollover()
+	if dayOf(r.Time) == l.day {
+		l.today[r.SessionKey] += r.TotalTokens()
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage record: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	return nil
+}
+
+// SessionTokensToday returns the tokens a session has used since local midnight.
+func (l *Ledger) SessionTokensToday(sessionKey string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover()
+	return l.today[sessionKey]
+}
+
+// Records returns every record at or after since, oldest first.
+// Malformed lines are skipped.
+func (l *Ledger) Records(since time.Time) ([]Record, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if !r.Time.Before(since) {
+			records = append(records, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+	return records, nil
+}
+
+// rollover resets the in-memory totals at local midnight. It must be called with mu held.
+func (l *Ledger) rollover() {
+	if day := dayOf(l.nowFunc()); day != l.day {
+		l.day = day
+		l.today = make(map[string]int)
+	}
+}
+
+func dayOf(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
@@ -0,0 +1,62 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLedger_AddAndSessionTotals(t *testing.T) {
+	l := NewLedger(t.TempDir())
+
+	l.Add(Record{AgentID: "main", SessionKey: "s1", Model: "gpt", PromptTokens: 100, CompletionTokens: 20})
+	l.Add(Record{AgentID: "main", SessionKey: "s1", Model: "gpt", PromptTokens: 50, CompletionTokens: 5})
+	l.Add(Record{AgentID: "main", SessionKey: "s2", Model: "gpt", PromptTokens: 10, CompletionTokens: 1})
+
+	if got := l.SessionTokensToday("s1"); got != 175 {
+		t.Errorf("SessionTokensToday(s1) = %d, want 175", got)
+	}
+	if got := l.SessionTokensToday("s2"); got != 11 {
+		t.Errorf("SessionTokensToday(s2) = %d, want 11", got)
+	}
+}
+
+func TestLedger_PersistsAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLedger(dir)
+	l.Add(Record{SessionKey: "s1", PromptTokens: 30, CompletionTokens: 12})
+	l.Add(Record{Time: time.Now().AddDate(0, 0, -3), SessionKey: "s1", PromptTokens: 1000})
+
+	l2 := NewLedger(dir)
+	if got := l2.SessionTokensToday("s1"); got != 42 {
+		t.Errorf("SessionTokensToday after reload = %d, want 42 (older records excluded)", got)
+	}
+
+	records, err := l2.Records(time.Time{})
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("len(records) = %d, want 2", len(records))
+	}
+}
+
+func TestLedger_ResetsAtMidnight(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 59, 0, 0, time.Local)
+	l := NewLedger(t.TempDir())
+	l.nowFunc = func() time.Time { return now }
+	l.day = dayOf(now)
+
+	l.Add(Record{SessionKey: "s1", PromptTokens: 100})
+	now = now.Add(2 * time.Minute)
+
+	if got := l.SessionTokensToday("s1"); got != 0 {
+		t.Errorf("SessionTokensToday after midnight = %d, want 0", got)
+	}
+}
+
+func TestLedger_RecordsMissingFile(t *testing.T) {
+	records, err := NewLedger(t.TempDir()).Records(time.Time{})
+	if err != nil || len(records) != 0 {
+		t.Errorf("Records() = %v, %v; want empty, nil", records, err)
+	}
+}
@@ -0,0 +1,148 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Totals aggregates a set of records.
+type Totals struct {
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+// Add folds r into t.
+func (t *Totals) Add(r Record) {
+	t.Calls++
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.Cost += r.Cost
+}
+
+// TotalTokens returns prompt plus completion tokens.
+func (t Totals) TotalTokens() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+func (t Totals) String() string {
+	s := fmt.Sprintf("%d tokens (%d in / %d out), %d calls", t.TotalTokens(), t.PromptTokens, t.CompletionTokens, t.Calls)
+	if t.Cost > 0 {
+		s += fmt.Sprintf(", $%.4f", t.Cost)
+	}
+	return s
+}
+
+// Group is one row of a breakdown.
+type Group struct {
+	Key string
+	Totals
+}
+
+// GroupBy aggregates records by the key returned for each, sorted by key.
+func GroupBy(records []Record, key func(Record) string) []Group {
+	index := make(map[string]int)
+	var groups []Group
+	for _, r := range records {
+		k := key(r)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, Group{Key: k})
+		}
+		groups[i].Add(r)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// Sum aggregates all records.
+func Sum(records []Record) Totals {
+	var t Totals
+	for _, r := range records {
+		t.Add(r)
+	}
+	return t
+}
+
+// Key functions for GroupBy.
+var (
+	ByDay = func(r Record) string { return dayOf(r.Time) }
+	// ByWeek groups by ISO week, e.g. "2026-W07".
+	ByWeek = func(r Record) string {
+		year, week := r.Time.Local().ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	ByAgent   = func(r Record) string { return r.AgentID }
+	BySession = func(r Record) string { return r.SessionKey }
+	ByChannel = func(r Record) string { return r.Channel }
+	ByModel   = func(r Record) string { return r.Model }
+)
+
+// KeyFunc returns the GroupBy key function for a dimension name.
+func KeyFunc(name string) (func(Record) string, bool) {
+	switch name {
+	case "day":
+		return ByDay, true
+	case "week":
+		return ByWeek, true
+	case "agent":
+		return ByAgent, true
+	case "session":
+		return BySession, true
+	case "channel":
+		return ByChannel, true
+	case "model":
+		return ByModel, true
+	}
+	return nil, false
+}
+
+// Price is a model's cost in USD per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// PriceTable maps model names to prices. Entries are registered under their
+// model_name, their full "protocol/model" and the bare model ID, so a record
+// can be priced from whichever form the caller knows.
+type PriceTable map[string]Price
+
+// NewPriceTable builds a table from the priced entries of a model_list.
+// The first entry wins when several share a name.
+func NewPriceTable(models []config.ModelConfig) PriceTable {
+	pt := make(PriceTable)
+	for _, mc := range models {
+		if mc.InputPrice == 0 && mc.OutputPrice == 0 {
+			continue
+		}
+		price := Price{Input: mc.InputPrice, Output: mc.OutputPrice}
+		names := []string{mc.ModelName, mc.Model}
+		if idx := strings.Index(mc.Model, "/"); idx >= 0 {
+			names = append(names, mc.Model[idx+1:])
+		}
+		for _, name := range names {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, exists := pt[name]; name != "" && !exists {
+				pt[name] = price
+			}
+		}
+	}
+	return pt
+}
+
+// Cost prices a call under the first of names found in the table, or 0.
+func (pt PriceTable) Cost(prompt, completion int, names ...string) float64 {
+	for _, name := range names {
+		if price, ok := pt[strings.ToLower(strings.TrimSpace(name))]; ok {
+			return (float64(prompt)*price.Input + float64(completion)*price.Output) / 1e6
+		}
+	}
+	return 0
+}
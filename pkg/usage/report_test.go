@@ -0,0 +1,67 @@
+package usage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestGroupBy(t *testing.T) {
+	day1 := time.Date(2026, 3, 2, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	records := []Record{
+		{Time: day1, AgentID: "main", Model: "gpt", PromptTokens: 10, CompletionTokens: 5, Cost: 0.5},
+		{Time: day2, AgentID: "main", Model: "claude", PromptTokens: 20},
+		{Time: day2, AgentID: "coder", Model: "gpt", PromptTokens: 1, CompletionTokens: 1},
+	}
+
+	byModel := GroupBy(records, ByModel)
+	if len(byModel) != 2 || byModel[0].Key != "claude" || byModel[1].Key != "gpt" {
+		t.Fatalf("GroupBy(ByModel) = %+v", byModel)
+	}
+	if byModel[1].Calls != 2 || byModel[1].TotalTokens() != 17 || byModel[1].Cost != 0.5 {
+		t.Errorf("gpt totals = %+v", byModel[1].Totals)
+	}
+
+	byDay := GroupBy(records, ByDay)
+	if len(byDay) != 2 || byDay[0].Key != "2026-03-02" || byDay[1].TotalTokens() != 22 {
+		t.Errorf("GroupBy(ByDay) = %+v", byDay)
+	}
+
+	if got := Sum(records).TotalTokens(); got != 37 {
+		t.Errorf("Sum() = %d tokens, want 37", got)
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	for _, name := range []string{"day", "week", "agent", "session", "channel", "model"} {
+		if _, ok := KeyFunc(name); !ok {
+			t.Errorf("KeyFunc(%q) not found", name)
+		}
+	}
+	if _, ok := KeyFunc("year"); ok {
+		t.Error("KeyFunc(year) should not exist")
+	}
+}
+
+func TestPriceTable(t *testing.T) {
+	pt := NewPriceTable([]config.ModelConfig{
+		{ModelName: "gpt4", Model: "openai/gpt-5.2", InputPrice: 2, OutputPrice: 8},
+		{ModelName: "free", Model: "openai/llama"},
+	})
+
+	want := (1000*2.0 + 500*8.0) / 1e6
+	for _, name := range []string{"gpt4", "openai/gpt-5.2", "GPT-5.2"} {
+		if got := pt.Cost(1000, 500, name); math.Abs(got-want) > 1e-12 {
+			t.Errorf("Cost(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if got := pt.Cost(1000, 500, "unknown", "gpt-5.2"); math.Abs(got-want) > 1e-12 {
+		t.Errorf("Cost should fall back to later names, got %v", got)
+	}
+	if got := pt.Cost(1000, 500, "free"); got != 0 {
+		t.Errorf("unpriced model cost = %v, want 0", got)
+	}
+}
@@ -32,6 +32,28 @@ func IsAudioFile(filename, contentType string) bool {
 	return false
 }
 
+// IsImageFile checks if a file is an image based on its filename extension and content type.
+func IsImageFile(filename, contentType string) bool {
+	imageExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+	lower := strings.ToLower(filename)
+	if i := strings.IndexAny(lower, "?#"); i >= 0 {
+		lower = lower[:i] // URLs may carry query strings after the extension
+	}
+	for _, ext := range imageExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+
+	return strings.HasPrefix(strings.ToLower(contentType), "image/")
+}
+
+// MediaDir returns the temp directory downloaded media is stored in.
+func MediaDir() string {
+	return filepath.Join(os.TempDir(), "picoclaw_media")
+}
+
 // SanitizeFilename removes potentially dangerous characters from a filename
 // and returns a safe version for local filesystem storage.
 func SanitizeFilename(filename string) string {
@@ -64,7 +86,7 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		opts.LoggerPrefix = "utils"
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	mediaDir := MediaDir()
 	if err := os.MkdirAll(mediaDir, 0700); err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]interface{}{
 			"error": err.Error(),